@@ -7,4 +7,7 @@ require (
     github.com/judwhite/go-svc v1.2.1
     github.com/satori/go.uuid v1.2.1-0.20181028125025-b2ce2384e17b
     github.com/go-sql-driver/mysql v1.6.0
+    github.com/mattn/go-sqlite3 v1.14.6
+    golang.org/x/crypto v0.9.0
+    golang.org/x/sys v0.10.0 // indirect
 )
@@ -15,6 +15,8 @@ package play
 
 import (
     "fmt"
+    "os"
+    "strings"
     "testing"
     "io/ioutil"
   _ "github.com/mysql"
@@ -22,7 +24,12 @@ import (
   . "tlkm"
 )
 
+// TLKM_TEST_DSN sama dengan test tlkm, contoh: "sqlite3.syst=file:go.db"
 func init() {
+    if v := strings.SplitN(os.Getenv("TLKM_TEST_DSN"), "=", 2); len(v) == 2 {
+        SQL.Register(v[0], v[1])
+        return
+    }
     SQL.Register("mysql.syst", "root:test@tcp(127.0.0.1:3306)/go")
 }
 
@@ -0,0 +1,368 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Akun lokal: credential disimpan di st_users (PWD, PWD_CHANGED), group di st_group_users
+//
+// Tabel pendukung:
+//
+//      st_password_history (USR, PWD, CREATED_AT)          policy PWD_HISTORY
+//      st_password_resets  (TOKEN, USR, EXPIRES_AT, USED)  TOKEN adalah sha256 token
+//
+// LocalAuthenticator di export otomatis oleh Win32Service jika config AUTH_LOCAL true.
+// Token reset password dikirim ke user melalui PasswordResetSender yang didaftarkan
+// aplikasi (email, sms dst), lifetime token (detik) dari config PWD_RESET_EXP
+// (default 3600)
+package tlkm
+
+import (
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
+    "strings"
+    "sync"
+    "time"
+)
+
+type (
+    // Authenticator st_users. Hash lama di-rehash secara transparan pada saat login
+    LocalAuthenticator struct {}
+
+    // Pengiriman token reset password ke user
+    PasswordResetSender func(conn *Connection, USR, token string) error
+
+    // Admin API user, di embed oleh handler modul (secure)
+    //
+    //  POST    USR=<username>&PWD=<password>&GID=<gid>&GID=<gid>   create user
+    //  PUT     USR=<username>&GID=<gid>&GID=<gid>                  replace groups
+    UserService struct {
+        NotAllowedService
+    }
+
+    // Ganti password. Tanpa session (password expired), USR dikirim sebagai parameter.
+    // Password lama yang salah dicatat sebagai login gagal (lockout.go)
+    //
+    //  PUT     [USR=<username>&]PWD=<password lama>&NEW=<password baru>
+    PasswordService struct {
+        NotAllowedService
+    }
+
+    // Reset password, di export tanpa session (SEC false)
+    //
+    //  POST    USR=<username>                  kirim token via PasswordResetSender
+    //  PUT     TOKEN=<token>&PWD=<password>    set password baru
+    PasswordResetService struct {
+        NotAllowedService
+    }
+)
+
+const (
+    // ** private **
+    sqlDatetime = "2006-01-02 15:04:05"
+)
+
+var (
+    // ** private **
+    passwordResetSender PasswordResetSender
+
+    // hash pembanding untuk user yang tidak ditemukan (waktu respon sama)
+    dummyPassword   string
+    dummyOnce       sync.Once
+)
+
+func ExportPasswordResetSender(f PasswordResetSender) {
+    passwordResetSender = f
+}
+
+func (self *LocalAuthenticator) Authenticate(conn *Connection, USR, PWD string) (*Identity, error) {
+    rows := conn.Query("SELECT PWD,PWD_CHANGED FROM st_users WHERE USR=?", USR)
+    if !rows.Next() {
+        rows.Close()
+        dummyOnce.Do(func() { dummyPassword, _ = HashPassword("dummy-password") })
+        VerifyPassword(dummyPassword, PWD)
+        return nil, ErrInvalidCredentials
+    }
+    hash, changed := rows.String("PWD"), rows.String("PWD_CHANGED")
+    rows.Close()
+    ok, rehash := VerifyPassword(hash, PWD)
+    if !ok {
+        return nil, ErrInvalidCredentials
+    }
+    if rehash {
+        if v, e := HashPassword(PWD); e == nil {
+            conn.Exec("UPDATE st_users SET PWD=? WHERE USR=? AND PWD=?", v, USR, hash)
+        }
+    }
+    t, _ := time.ParseInLocation(sqlDatetime, changed, time.Local)
+    if PasswordPolicyConfig().Expired(t) {
+        return nil, ErrPasswordExpired
+    }
+    return &Identity{USR: USR, GID: userGroups(conn, USR), Source: "LOCAL"}, nil
+}
+
+// Groups user dari st_group_users
+func userGroups(conn *Connection, USR string) map[string]string {
+    GID := make(map[string]string)
+    rows := conn.Query("SELECT GID FROM st_group_users WHERE USR=?", USR)
+    defer rows.Close()
+    for rows.Next() {
+        GID[rows.String("GID")] = rows.String("GID")
+    }
+    return GID
+}
+
+// Hash password saat ini dan history (terbaru lebih dulu)
+func passwordHistory(conn *Connection, USR string) (z List) {
+    rows := conn.Query("SELECT PWD FROM st_users WHERE USR=?", USR)
+    if rows.Next() {
+        z = append(z, rows.String("PWD"))
+    }
+    rows.Close()
+    rows = conn.Query("SELECT PWD FROM st_password_history WHERE USR=? ORDER BY CREATED_AT DESC", USR)
+    defer rows.Close()
+    for rows.Next() {
+        z = append(z, rows.String("PWD"))
+    }
+    return
+}
+
+// Buat user lokal beserta groups
+func CreateUser(conn *Connection, USR, PWD string, GID List) (e error) {
+    if USR == "" {
+        return errors.New("EmptyUSRException: expected parameter USR")
+    }
+    if e = PasswordPolicyConfig().Check(USR, PWD, nil); e != nil {
+        return
+    }
+    hash, e := HashPassword(PWD)
+    if e != nil {
+        return
+    }
+    now := time.Now().Format(sqlDatetime)
+    tx := conn.Begin()
+    defer func() {
+        if e != nil {
+            tx.Rollback()
+        }
+    }()
+    if _, e = tx.Exec("INSERT INTO st_users(USR,PWD,PWD_CHANGED) VALUES (?,?,?)", USR, hash, now); e != nil {
+        return
+    }
+    if _, e = tx.Exec("INSERT INTO st_password_history(USR,PWD,CREATED_AT) VALUES (?,?,?)", USR, hash, now); e != nil {
+        return
+    }
+    for _, i := range GID {
+        if _, e = tx.Exec("INSERT INTO st_group_users(GID,USR) VALUES (?,?)", i, USR); e != nil {
+            return
+        }
+    }
+    return tx.Commit()
+}
+
+// Replace groups user
+func AssignGroups(conn *Connection, USR string, GID List) (e error) {
+    tx := conn.Begin()
+    defer func() {
+        if e != nil {
+            tx.Rollback()
+        }
+    }()
+    if _, e = tx.Exec("DELETE FROM st_group_users WHERE USR=?", USR); e != nil {
+        return
+    }
+    for _, i := range GID {
+        if _, e = tx.Exec("INSERT INTO st_group_users(GID,USR) VALUES (?,?)", i, USR); e != nil {
+            return
+        }
+    }
+    return tx.Commit()
+}
+
+// Set password baru sesuai policy (tanpa verifikasi password lama)
+func SetPassword(conn *Connection, USR, PWD string) (e error) {
+    history := passwordHistory(conn, USR)
+    if len(history) == 0 {
+        return errors.New("UserNotFoundException: " + USR)
+    }
+    if e = PasswordPolicyConfig().Check(USR, PWD, history); e != nil {
+        return
+    }
+    hash, e := HashPassword(PWD)
+    if e != nil {
+        return
+    }
+    now := time.Now().Format(sqlDatetime)
+    tx := conn.Begin()
+    defer func() {
+        if e != nil {
+            tx.Rollback()
+        }
+    }()
+    if _, e = tx.Exec("UPDATE st_users SET PWD=?,PWD_CHANGED=? WHERE USR=?", hash, now, USR); e != nil {
+        return
+    }
+    if _, e = tx.Exec("INSERT INTO st_password_history(USR,PWD,CREATED_AT) VALUES (?,?,?)", USR, hash, now); e != nil {
+        return
+    }
+    return tx.Commit()
+}
+
+// Ganti password dengan verifikasi password lama
+func ChangePassword(conn *Connection, USR, PWD, NEW string) error {
+    history := passwordHistory(conn, USR)
+    if len(history) == 0 {
+        return ErrInvalidCredentials
+    }
+    if ok, _ := VerifyPassword(history[0], PWD); !ok {
+        return ErrInvalidCredentials
+    }
+    return SetPassword(conn, USR, NEW)
+}
+
+func passwordResetKey(token string) string {
+    h := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(h[:])
+}
+
+// Token reset password (dikirim ke user), yang disimpan di database hanya hash token
+func RequestPasswordReset(conn *Connection, USR string) (string, error) {
+    rows := conn.Query("SELECT USR FROM st_users WHERE USR=?", USR)
+    b := rows.Next()
+    rows.Close()
+    if !b {
+        return "", errors.New("UserNotFoundException: " + USR)
+    }
+    buf := make([]byte, 32)
+    if _, e := rand.Read(buf); e != nil {
+        return "", e
+    }
+    token := base64.RawURLEncoding.EncodeToString(buf)
+    exp, _ := Cache.Int("PWD_RESET_EXP")
+    if exp <= 0 {
+        exp = 3600
+    }
+    _, e := conn.Exec("INSERT INTO st_password_resets(TOKEN,USR,EXPIRES_AT,USED) VALUES (?,?,?,'0')",
+        passwordResetKey(token), USR, time.Now().Add(time.Duration(exp) * time.Second).Format(sqlDatetime))
+    return token, e
+}
+
+// Set password dengan token reset. Semua token user dan session yang aktif dibatalkan
+//
+// Token ditandai USED lebih dulu (UPDATE ... AND USED='0'), sehingga request bersamaan
+// dengan token yang sama hanya berhasil satu kali. Token dikembalikan jika password
+// ditolak policy agar user bisa mencoba lagi
+func ResetPassword(conn *Connection, token, PWD string) error {
+    key := passwordResetKey(token)
+    invalid := errors.New("PasswordResetException: token tidak valid")
+    r, e := conn.Exec("UPDATE st_password_resets SET USED='1' WHERE TOKEN=? AND USED='0'", key)
+    if e != nil {
+        return e
+    }
+    if n, _ := r.RowsAffected(); n != 1 {
+        return invalid
+    }
+    rows := conn.Query("SELECT USR,EXPIRES_AT FROM st_password_resets WHERE TOKEN=?", key)
+    if !rows.Next() {
+        rows.Close()
+        return invalid
+    }
+    USR := rows.String("USR")
+    exp, b := sessionTime(rows.String("EXPIRES_AT"))
+    rows.Close()
+    if !b || !time.Now().Before(exp) {
+        return errors.New("PasswordResetException: token expired")
+    }
+    if e := SetPassword(conn, USR, PWD); e != nil {
+        conn.Exec("UPDATE st_password_resets SET USED='0' WHERE TOKEN=?", key)
+        return e
+    }
+    conn.Exec("UPDATE st_password_resets SET USED='1' WHERE USR=?", USR)
+    if z, e := sessionStore.List(USR); e == nil {
+        for _, i := range z {
+            sessionDestroy(conn, i.SID)
+        }
+    }
+    return nil
+}
+
+// Status http untuk error akun
+func accountStatus(e error) int {
+    switch {
+    case e == ErrInvalidCredentials:
+        return StatusUnauthorized
+    case e == ErrPasswordExpired:
+        return StatusForbidden
+    case strings.HasPrefix(e.Error(), "SessionLimitException"):
+        return StatusConflict
+    case strings.HasPrefix(e.Error(), "PasswordPolicyException"), strings.HasPrefix(e.Error(), "PasswordResetException"),
+        strings.HasPrefix(e.Error(), "EmptyUSRException"):
+        return StatusBadRequest
+    }
+    return StatusInternalServerError
+}
+
+func (self *UserService) POST(conn *Connection, ctx *Context) {
+    if e := CreateUser(conn, ctx.Get("USR"), ctx.Get("PWD"), ctx.GetList("GID")); e != nil {
+        ctx.Code(accountStatus(e)).Warn(e.Error())
+        return
+    }
+    ctx.Code(StatusCreated).Message(ctx.Get("USR"))
+}
+
+func (self *UserService) PUT(conn *Connection, ctx *Context) {
+    if e := AssignGroups(conn, ctx.Get("USR"), ctx.GetList("GID")); e != nil {
+        ctx.Code(accountStatus(e)).Warn(e.Error())
+        return
+    }
+    ctx.Code(StatusOK).Message(ctx.Get("USR"))
+}
+
+func (self *PasswordService) impersonationDenied() {}
+
+func (self *PasswordService) PUT(conn *Connection, ctx *Context) {
+    USR, b := ctx.SessionUser()
+    if !b {
+        USR = ctx.Get("USR")
+    }
+    IP, now := loginAddr(ctx), time.Now()
+    if e := loginAllowed(USR, IP, now); e != nil {
+        lockoutResponse(ctx, e)
+        return
+    }
+    if e := ChangePassword(conn, USR, ctx.Get("PWD"), ctx.Get("NEW")); e != nil {
+        if e == ErrInvalidCredentials {
+            loginFailed(conn, ctx, USR, IP, now)
+        }
+        ctx.Code(accountStatus(e)).Warn(e.Error())
+        return
+    }
+    ctx.Code(StatusOK).Message(USR)
+}
+
+// Response selalu sama untuk mencegah enumerasi username
+func (self *PasswordResetService) POST(conn *Connection, ctx *Context) {
+    USR := ctx.Get("USR")
+    if token, e := RequestPasswordReset(conn, USR); e == nil && passwordResetSender != nil {
+        passwordResetSender(conn, USR, token)
+    }
+    ctx.Code(StatusAccepted).Message("password reset requested")
+}
+
+func (self *PasswordResetService) PUT(conn *Connection, ctx *Context) {
+    if e := ResetPassword(conn, ctx.Get("TOKEN"), ctx.Get("PWD")); e != nil {
+        ctx.Code(accountStatus(e)).Warn(e.Error())
+        return
+    }
+    ctx.Code(StatusOK).Message("password updated")
+}
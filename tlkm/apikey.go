@@ -0,0 +1,407 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// API key untuk client service-to-service (integrasi partner, batch job dst)
+//
+// Key dikirim melalui header X-API-Key dengan format sak_<KID>_<secret>. KID (public)
+// digunakan untuk lookup dan identifikasi key di log, secret hanya disimpan hash-nya
+// (sha256) dan ditampilkan satu kali pada saat key dibentuk/dirotasi
+//
+// Setiap key terikat pada technical user (st_users) dan subset group user tersebut.
+// Request dengan API key mendapat session sementara (tidak disimpan, tanpa cookie)
+// dengan attribute USR, GID, AUTH=APIKEY dan APIKEY=<KID>. SessionCallback.OnCreate
+// dipanggil untuk membentuk attribute lain (ACL dst) sehingga pemeriksaan GID/ACL di
+// ServeHTTP sama seperti user biasa. Session di-cache selama API_KEY_CACHE detik
+// (default 60), perubahan group/ACL berlaku setelah cache expired
+//
+// Pembatasan tambahan per key:
+//   1. Scope   daftar handler (path) dan method yang boleh dipanggil, format
+//              <handler>[:<method>|<method>], kosong berarti semua handler sesuai ACL
+//   2. IPs     IP atau CIDR client. IP client diambil dari RemoteAddr, atau header
+//              config API_KEY_IP_HEADER (misal X-Real-IP) jika di belakang proxy
+//   3. Expires key tidak berlaku setelah waktu ini. Rotasi menerbitkan key baru dengan
+//              scope yang sama, key lama tetap berlaku selama grace period
+//
+// Tabel:
+//
+//      st_api_keys (KID, USR, NAME, HASH, GID, SCOPE, IPS, EXPIRES_AT, CREATED_AT,
+//                   LAST_USED, REVOKED)
+package tlkm
+
+import (
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
+    "net"
+    "strings"
+    "time"
+    "github.com/telkomdit/goframework/to"
+)
+
+type (
+    APIKey struct {
+        KID         string
+        USR         string
+        Name        string
+        GID         List
+        Scope       List
+        IPs         List
+        Expires     time.Time   // zero: tidak expired
+        LastUsed    time.Time
+    }
+
+    // Admin API key, di embed oleh handler modul (secure)
+    //
+    //  GET     USR=<username>                                      list key
+    //  POST    USR=<username>&NAME=<nama>&GID=<gid>[&SCOPE=<scope>][&IP=<ip/cidr>][&EXP=<hari>]
+    //  PUT     KID=<kid>[&GRACE=<detik>]                           rotasi
+    //  DELETE  KID=<kid>                                           revoke
+    APIKeyService struct {
+        NotAllowedService
+    }
+
+    // ** private **
+    apiKeyEntry struct {
+        key     *APIKey
+        hash    string
+        data    GMap    // session attributes (hasil OnCreate)
+    }
+)
+
+const (
+    APIKeyHeader = "X-API-Key"
+
+    // ** private **
+    apiKeyPrefix = "sak_"
+)
+
+// Buat key baru untuk technical user k.USR. Return key lengkap (hanya sekali)
+func CreateAPIKey(conn *Connection, k *APIKey) (string, error) {
+    if k.USR == "" {
+        return "", errors.New("EmptyUSRException: expected parameter USR")
+    }
+    if len(k.GID) == 0 {
+        return "", errors.New("APIKeyException: expected parameter GID")
+    }
+    GID := userGroups(conn, k.USR)
+    for _, i := range k.GID {
+        if _, b := GID[i]; !b {
+            return "", errors.New("APIKeyException: " + k.USR + " bukan anggota group " + i)
+        }
+    }
+    for _, i := range k.IPs {
+        if apiKeyNet(i) == nil {
+            return "", errors.New("APIKeyException: IP tidak valid " + i)
+        }
+    }
+    b := make([]byte, 40)
+    if _, e := rand.Read(b); e != nil {
+        return "", e
+    }
+    k.KID = hex.EncodeToString(b[:8])
+    secret := base64.RawURLEncoding.EncodeToString(b[8:])
+    var EXP interface{}
+    if !k.Expires.IsZero() {
+        EXP = k.Expires.Format(sqlDatetime)
+    }
+    _, e := conn.Exec("INSERT INTO st_api_keys(KID,USR,NAME,HASH,GID,SCOPE,IPS,EXPIRES_AT,CREATED_AT,REVOKED) VALUES (?,?,?,?,?,?,?,?,?,'0')",
+        k.KID, k.USR, k.Name, apiKeyHash(secret), strings.Join(k.GID, ","), strings.Join(k.Scope, ","), strings.Join(k.IPs, ","),
+        EXP, time.Now().Format(sqlDatetime))
+    if e != nil {
+        return "", e
+    }
+    return apiKeyPrefix + k.KID + "_" + secret, nil
+}
+
+// Key baru dengan user, group, scope dan IP yang sama. Key lama berlaku sampai grace
+// period berakhir (0: langsung tidak berlaku)
+func RotateAPIKey(conn *Connection, KID string, grace time.Duration) (string, error) {
+    k, _ := apiKeyLoad(conn, KID)
+    if k == nil {
+        return "", errors.New("APIKeyNotFoundException: " + KID)
+    }
+    n := *k.key
+    v, e := CreateAPIKey(conn, &n)
+    if e != nil {
+        return "", e
+    }
+    EXP := time.Now().Add(grace)
+    if !k.key.Expires.IsZero() && k.key.Expires.Before(EXP) {
+        EXP = k.key.Expires
+    }
+    if _, e = conn.Exec("UPDATE st_api_keys SET EXPIRES_AT=? WHERE KID=?", EXP.Format(sqlDatetime), KID); e != nil {
+        return "", e
+    }
+    Cache.Delete("apikey:" + KID)
+    return v, nil
+}
+
+func RevokeAPIKey(conn *Connection, KID string) error {
+    r, e := conn.Exec("UPDATE st_api_keys SET REVOKED='1' WHERE KID=?", KID)
+    if e != nil {
+        return e
+    }
+    if n, _ := r.RowsAffected(); n == 0 {
+        return errors.New("APIKeyNotFoundException: " + KID)
+    }
+    Cache.Delete("apikey:" + KID)
+    return nil
+}
+
+// Key aktif (belum di-revoke) milik USR, tanpa hash
+func APIKeys(conn *Connection, USR string) []*APIKey {
+    z := make([]*APIKey, 0)
+    rows := conn.Query("SELECT * FROM st_api_keys WHERE USR=? AND REVOKED='0' ORDER BY CREATED_AT", USR)
+    defer rows.Close()
+    for rows.Next() {
+        z = append(z, apiKeyRow(rows))
+    }
+    return z
+}
+
+func apiKeyRow(rows *ResultSet) *APIKey {
+    split := func(v string) List {
+        z := List{}
+        for _, i := range strings.Split(v, ",") {
+            if i = strings.TrimSpace(i); i != "" {
+                z = append(z, i)
+            }
+        }
+        return z
+    }
+    k := &APIKey{KID: rows.String("KID"), USR: rows.String("USR"), Name: rows.String("NAME"),
+        GID: split(rows.String("GID")), Scope: split(rows.String("SCOPE")), IPs: split(rows.String("IPS"))}
+    k.Expires, _ = time.ParseInLocation(sqlDatetime, rows.String("EXPIRES_AT"), time.Local)
+    k.LastUsed, _ = time.ParseInLocation(sqlDatetime, rows.String("LAST_USED"), time.Local)
+    return k
+}
+
+func apiKeyHash(secret string) string {
+    h := sha256.Sum256([]byte(secret))
+    return hex.EncodeToString(h[:])
+}
+
+// sak_<KID>_<secret>
+func apiKeyParse(v string) (KID, secret string, b bool) {
+    if !strings.HasPrefix(v, apiKeyPrefix) {
+        return
+    }
+    i := strings.IndexByte(v[len(apiKeyPrefix):], '_')
+    if i <= 0 {
+        return
+    }
+    KID, secret = v[len(apiKeyPrefix):len(apiKeyPrefix) + i], v[len(apiKeyPrefix) + i + 1:]
+    return KID, secret, secret != ""
+}
+
+// Key (belum di-revoke) dari cache atau database
+func apiKeyLoad(conn *Connection, KID string) (*apiKeyEntry, bool) {
+    if v, b := Cache.Get("apikey:" + KID); b {
+        z, b := v.(*apiKeyEntry)
+        return z, b
+    }
+    if conn == nil {
+        return nil, false
+    }
+    rows := conn.Query("SELECT * FROM st_api_keys WHERE KID=? AND REVOKED='0'", KID)
+    defer rows.Close()
+    if !rows.Next() {
+        return nil, false
+    }
+    return &apiKeyEntry{key: apiKeyRow(rows), hash: rows.String("HASH")}, false
+}
+
+func apiKeyNet(v string) *net.IPNet {
+    if !strings.Contains(v, "/") {
+        if ip := net.ParseIP(v); ip != nil {
+            if ip.To4() != nil {
+                v += "/32"
+            } else {
+                v += "/128"
+            }
+        }
+    }
+    _, n, e := net.ParseCIDR(v)
+    if e != nil {
+        return nil
+    }
+    return n
+}
+
+// IP client untuk allow-list. Header forwarded hanya dipercaya jika dikonfigurasi
+func apiKeyIP(ctx *Context) net.IP {
+    v := ctx.Request.RemoteAddr
+    if h, b := Cache.String("API_KEY_IP_HEADER"); b && h != "" {
+        if x := ctx.Request.Header.Get(h); x != "" {
+            v = strings.TrimSpace(strings.Split(x, ",")[0])
+        }
+    }
+    if h, _, e := net.SplitHostPort(v); e == nil {
+        v = h
+    }
+    return net.ParseIP(v)
+}
+
+func (self *APIKey) allowIP(ip net.IP) bool {
+    if len(self.IPs) == 0 {
+        return true
+    }
+    if ip == nil {
+        return false
+    }
+    for _, i := range self.IPs {
+        if n := apiKeyNet(i); n != nil && n.Contains(ip) {
+            return true
+        }
+    }
+    return false
+}
+
+// Handler IDX dan method call ada dalam scope key
+func (self *APIKey) allowCall(IDX, call string) bool {
+    if len(self.Scope) == 0 {
+        return true
+    }
+    for _, i := range self.Scope {
+        path, methods := i, ""
+        if j := strings.LastIndexByte(i, ':'); j > 0 {
+            path, methods = i[:j], i[j+1:]
+        }
+        if path != IDX {
+            continue
+        }
+        if methods == "" {
+            return true
+        }
+        for _, m := range strings.Split(methods, "|") {
+            if strings.EqualFold(m, call) {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// Autentikasi header X-API-Key, dipanggil oleh sessionStart. Key yang tidak valid
+// diperlakukan sama seperti request tanpa session
+func (self *Context) apiKeyStart(conn *Connection, v string) bool {
+    KID, secret, b := apiKeyParse(v)
+    if !b {
+        return false
+    }
+    z, cached := apiKeyLoad(conn, KID)
+    if z == nil || subtle.ConstantTimeCompare([]byte(apiKeyHash(secret)), []byte(z.hash)) != 1 {
+        return false
+    }
+    now := time.Now()
+    if !z.key.Expires.IsZero() && !now.Before(z.key.Expires) {
+        return false
+    }
+    if !z.key.allowIP(apiKeyIP(self)) {
+        return false
+    }
+    if !cached {
+        z.data = self.apiKeySession(conn, z.key)
+        exp, b := Cache.Int("API_KEY_CACHE")
+        if !b {
+            exp = 60
+        }
+        Cache.Set("apikey:" + KID, z, time.Duration(exp))
+    }
+    self.apiKey = z.key
+    self.sesMap = GMap{}
+    for k, v := range z.data {
+        self.sesMap[k] = v
+    }
+    if conn != nil {
+        if _, b := Cache.Get("apikey-used:" + KID); !b {
+            Cache.Set("apikey-used:" + KID, true, sessionTouchInterval)
+            conn.Exec("UPDATE st_api_keys SET LAST_USED=? WHERE KID=?", now.Format(sqlDatetime), KID)
+        }
+    }
+    return true
+}
+
+// Session attributes key: USR, GID (subset group user) dan hasil OnCreate
+func (self *Context) apiKeySession(conn *Connection, k *APIKey) GMap {
+    GID := make(map[string]string)
+    for _, i := range k.GID {
+        GID[i] = i
+    }
+    self.sesMap = GMap{"USR": k.USR, "GID": GID, "AUTH": "APIKEY", "APIKEY": k.KID}
+    self.sessionGroups(conn, GID)
+    for _, l := range sessMap {
+        l.OnCreate(conn, self)
+    }
+    // session tidak disimpan
+    self.sesUpdate = false
+    self.sesDiff = nil
+    self.newSID = ""
+    return self.sesMap
+}
+
+// Scope key untuk handler IDX, dipanggil ServeHTTP sebelum pemeriksaan ACL. Key dengan
+// satu group tidak perlu mengirim parameter GID
+func apiKeyCheck(ctx *Context, IDX string) error {
+    k := ctx.apiKey
+    if k == nil {
+        return nil
+    }
+    if ctx.GID == "" && len(k.GID) == 1 {
+        ctx.GID = k.GID[0]
+    }
+    if !k.allowCall(IDX, ctx.call) {
+        return errors.New("APIKeyScopeException: " + k.KID + " tidak diizinkan " + ctx.call + " " + IDX)
+    }
+    return nil
+}
+
+func (self *APIKeyService) impersonationDenied() {}
+
+func (self *APIKeyService) GET(conn *Connection, ctx *Context) {
+    ctx.Data(APIKeys(conn, ctx.Get("USR")))
+}
+
+func (self *APIKeyService) POST(conn *Connection, ctx *Context) {
+    k := &APIKey{USR: ctx.Get("USR"), Name: ctx.Get("NAME"), GID: ctx.GetList("GID"), Scope: ctx.GetList("SCOPE"), IPs: ctx.GetList("IP")}
+    if d := to.Int(ctx.Get("EXP")); d > 0 {
+        k.Expires = time.Now().AddDate(0, 0, d)
+    }
+    v, e := CreateAPIKey(conn, k)
+    if e != nil {
+        ctx.Code(StatusBadRequest).Warn(e.Error())
+        return
+    }
+    ctx.Code(StatusCreated).Data(GMap{"KID": k.KID, "key": v})
+}
+
+func (self *APIKeyService) PUT(conn *Connection, ctx *Context) {
+    v, e := RotateAPIKey(conn, ctx.Get("KID"), time.Duration(to.Int(ctx.Get("GRACE"))) * time.Second)
+    if e != nil {
+        ctx.Code(StatusNotFound).Warn(e.Error())
+        return
+    }
+    KID, _, _ := apiKeyParse(v)
+    ctx.Code(StatusCreated).Data(GMap{"KID": KID, "key": v})
+}
+
+func (self *APIKeyService) DELETE(conn *Connection, ctx *Context) {
+    if e := RevokeAPIKey(conn, ctx.Get("KID")); e != nil {
+        ctx.Code(StatusNotFound).Warn(e.Error())
+        return
+    }
+    ctx.Code(StatusOK).Message(ctx.Get("KID"))
+}
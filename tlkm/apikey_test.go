@@ -0,0 +1,127 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "net/url"
+    "testing"
+    "time"
+)
+
+type testACLListener struct {}
+
+func (self *testACLListener) OnCreate(conn *Connection, ctx *Context) {
+    ctx.SessionSet("ACL", map[string]string{"OPSPIDHID": "1010"})
+}
+
+func (self *testACLListener) OnUpdate(conn *Connection, ctx *Context) {}
+
+func TestAPIKeyParse(t *testing.T) {
+    if KID, secret, b := apiKeyParse("sak_0123abcd_s3cr_et"); !b || KID != "0123abcd" || secret != "s3cr_et" {
+        t.Errorf("unexpected %s %s %v", KID, secret, b)
+    }
+    for _, i := range []string{"", "sak_", "sak__x", "sak_abc", "sak_abc_", "xyz_abc_def"} {
+        if _, _, b := apiKeyParse(i); b {
+            t.Errorf("%q must be invalid", i)
+        }
+    }
+}
+
+func TestAPIKeyRestriction(t *testing.T) {
+    k := &APIKey{IPs: List{"10.1.0.0/16", "192.168.1.5"}, Scope: List{"/app/hr/Employee:GET|POST", "/app/hr/Report"}}
+    ctx := testContext("", nil)
+    for addr, allowed := range map[string]bool{"10.1.2.3:5000": true, "192.168.1.5:80": true, "192.168.1.6:80": false} {
+        ctx.Request.RemoteAddr = addr
+        if k.allowIP(apiKeyIP(ctx)) != allowed {
+            t.Errorf("%s: expected allowed=%v", addr, allowed)
+        }
+    }
+    // header forwarded diabaikan tanpa config
+    ctx.Request.RemoteAddr = "192.168.1.6:80"
+    ctx.Request.Header.Set("X-Real-IP", "10.1.2.3")
+    if k.allowIP(apiKeyIP(ctx)) {
+        t.Error("X-Real-IP must not be trusted by default")
+    }
+    Cache.Set("API_KEY_IP_HEADER", "X-Real-IP")
+    defer Cache.Delete("API_KEY_IP_HEADER")
+    if !k.allowIP(apiKeyIP(ctx)) {
+        t.Error("expected X-Real-IP trusted")
+    }
+
+    calls := []struct {
+        IDX, call   string
+        allowed     bool
+    }{
+        {"/app/hr/Employee", "GET", true},
+        {"/app/hr/Employee", "post", true},
+        {"/app/hr/Employee", "DELETE", false},
+        {"/app/hr/Report", "export", true},
+        {"/app/finance/Invoice", "GET", false},
+    }
+    for _, i := range calls {
+        if k.allowCall(i.IDX, i.call) != i.allowed {
+            t.Errorf("%s %s: expected allowed=%v", i.call, i.IDX, i.allowed)
+        }
+    }
+}
+
+func TestAPIKeyStart(t *testing.T) {
+    prev := sessMap
+    sessMap = map[string]SessionCallback{"acl": &testACLListener{}}
+    defer func() { sessMap = prev }()
+
+    k := &APIKey{KID: "0123abcd", USR: "partner", GID: List{"OPS"}, Scope: List{"/app/hr/Employee:GET"}, Expires: time.Now().Add(time.Hour)}
+    ctx := testContext("", url.Values{})
+    z := &apiKeyEntry{key: k, hash: apiKeyHash("rahasia")}
+    z.data = ctx.apiKeySession(nil, k)
+    if ACL, b := z.data["ACL"].(map[string]string); !b || ACL["OPSPIDHID"] != "1010" {
+        t.Fatalf("expected ACL from OnCreate. received %v", z.data)
+    }
+    if ctx.sesUpdate || ctx.newSID != "" {
+        t.Error("API key session must not be persisted")
+    }
+    Cache.Set("apikey:" + k.KID, z, 60)
+    defer Cache.Delete("apikey:" + k.KID)
+
+    ctx = testContext("", url.Values{})
+    if ctx.apiKeyStart(nil, "sak_0123abcd_salah") {
+        t.Error("expected invalid secret")
+    }
+    if !ctx.apiKeyStart(nil, "sak_0123abcd_rahasia") {
+        t.Fatal("expected valid key")
+    }
+    if USR, _ := ctx.SessionUser(); USR != "partner" || !ctx.HasRole("OPS") || !ctx.HasHandler("OPS", "PID", "HID") {
+        t.Errorf("unexpected session %v", ctx.sesMap)
+    }
+    ctx.call = "GET"
+    if e := apiKeyCheck(ctx, "/app/hr/Employee"); e != nil || ctx.GID != "OPS" {
+        t.Errorf("expected default GID OPS. received %q %v", ctx.GID, e)
+    }
+    ctx.call = "POST"
+    if e := apiKeyCheck(ctx, "/app/hr/Employee"); e == nil {
+        t.Error("expected APIKeyScopeException")
+    }
+
+    // attribute yang diubah handler tidak mengubah cache
+    ctx.SessionSet("LANG", "en")
+    ctx.sessionClose()
+    if _, b := z.data["LANG"]; b || ctx.SID != "" {
+        t.Error("API key session must not be persisted")
+    }
+
+    k.Expires = time.Now().Add(-time.Second)
+    if testContext("", url.Values{}).apiKeyStart(nil, "sak_0123abcd_rahasia") {
+        t.Error("expired key must be rejected")
+    }
+}
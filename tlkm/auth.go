@@ -0,0 +1,167 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Abstraksi authentication provider. Setiap provider (LDAP, akun lokal dst) memverifikasi
+// credential dan mengembalikan Identity, session dibentuk oleh framework melalui
+// Context.LoginIdentity sehingga alur SessionCallback.OnCreate sama untuk semua provider
+//
+// Provider dicoba sesuai urutan config AUTH_PROVIDERS (nama dipisahkan koma), atau
+// urutan export jika config tidak ada
+//
+// contoh:
+//
+//      func init() {
+//          tlkm.ExportAuthenticator("LDAP", tlkm.LDAPFromConfig())
+//      }
+package tlkm
+
+import (
+    "errors"
+    "strings"
+    "time"
+)
+
+type (
+    // Kontrak authentication provider. Return ErrInvalidCredentials jika user tidak
+    // dikenal atau password salah agar provider berikutnya tetap dicoba
+    Authenticator interface {
+        Authenticate(conn *Connection, USR, PWD string) (*Identity, error)
+    }
+
+    // Hasil login yang sudah tervalidasi. GID berisi GID => nama group
+    Identity struct {
+        USR     string
+        GID     map[string]string
+        Source  string      // nama provider
+        Claims  GMap        // informasi tambahan dari provider (opsional)
+    }
+
+    // Handler login username/password, di embed oleh handler modul dan di export tanpa
+    // session (SEC false)
+    //
+    //  POST    USR=<username>&PWD=<password>
+    LoginService struct {
+        NotAllowedService
+    }
+
+    // ** private **
+    authProvider struct {
+        name    string
+        object  Authenticator
+    }
+)
+
+var (
+    ErrInvalidCredentials = errors.New("AuthenticationException: invalid username or password")
+
+    // ** private **
+    authList []authProvider
+)
+
+// Register authentication provider. Provider dengan nama yang sama di replace
+func ExportAuthenticator(name string, object Authenticator) {
+    for i, j := range authList {
+        if j.name == name {
+            authList[i].object = object
+            return
+        }
+    }
+    authList = append(authList, authProvider{name: name, object: object})
+}
+
+// Provider sesuai urutan AUTH_PROVIDERS
+func authenticators() []authProvider {
+    v, _ := Cache.String("AUTH_PROVIDERS")
+    if v == "" {
+        return authList
+    }
+    var z []authProvider
+    for _, i := range strings.Split(v, ",") {
+        for _, j := range authList {
+            if j.name == strings.TrimSpace(i) {
+                z = append(z, j)
+            }
+        }
+    }
+    return z
+}
+
+// Verifikasi credential ke semua provider, return Identity dari provider pertama yang
+// berhasil. Error selain ErrInvalidCredentials (misal server LDAP tidak bisa dihubungi)
+// dikembalikan jika tidak ada provider yang berhasil
+func Authenticate(conn *Connection, USR, PWD string) (*Identity, error) {
+    if USR == "" || PWD == "" {
+        return nil, ErrInvalidCredentials
+    }
+    var err error = ErrInvalidCredentials
+    for _, i := range authenticators() {
+        z, e := i.object.Authenticate(conn, USR, PWD)
+        if e == nil {
+            if z.Source == "" {
+                z.Source = i.name
+            }
+            return z, nil
+        }
+        if e != ErrInvalidCredentials {
+            err = e
+        }
+    }
+    return nil, err
+}
+
+// Bentuk session untuk identity yang sudah tervalidasi. Provider disimpan di session
+// attribute AUTH. Error SessionLimitException jika batas session group tercapai (lihat
+// sessionpolicy.go)
+func (self *Context) LoginIdentity(z *Identity) error {
+    if e := sessionAdmit(z.USR, self.SID, SessionPolicyOf(z.GID)); e != nil {
+        return e
+    }
+    self.sesAdmit = true
+    self.SessionLogin(z.USR, z.GID).SessionSet("AUTH", z.Source)
+    return nil
+}
+
+// Login username/password melalui authentication provider. Jika second factor
+// dibutuhkan, session belum dibentuk dan return *MFARequired (lihat mfa.go)
+//
+// Percobaan login dilacak per USR dan IP, error *LoginLocked jika sedang dikunci atau
+// harus menunggu (lihat lockout.go). Counter USR di-reset setelah login selesai,
+// termasuk second factor jika dibutuhkan
+func (self *Context) Login(conn *Connection, USR, PWD string) error {
+    IP, now := loginAddr(self), time.Now()
+    if e := loginAllowed(USR, IP, now); e != nil {
+        return e
+    }
+    z, e := Authenticate(conn, USR, PWD)
+    if e != nil {
+        if e == ErrInvalidCredentials {
+            loginFailed(conn, self, USR, IP, now)
+        }
+        return e
+    }
+    if e := self.mfaChallenge(conn, z); e != nil {
+        return e
+    }
+    loginSucceeded(self, USR, IP, now)
+    return self.LoginIdentity(z)
+}
+
+func (self *LoginService) POST(conn *Connection, ctx *Context) {
+    if e := ctx.Login(conn, ctx.Get("USR"), ctx.Get("PWD")); e != nil {
+        mfaResponse(ctx, e)
+        return
+    }
+    USR, _ := ctx.SessionUser()
+    g, _ := ctx.Session("GID")
+    ctx.Data(GMap{"USR": USR, "GID": g})
+}
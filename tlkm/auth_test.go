@@ -0,0 +1,83 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "errors"
+    "testing"
+)
+
+type testAuthenticator struct {
+    USR, PWD    string
+    err         error
+}
+
+func (self *testAuthenticator) Authenticate(conn *Connection, USR, PWD string) (*Identity, error) {
+    if self.err != nil {
+        return nil, self.err
+    }
+    if USR != self.USR || PWD != self.PWD {
+        return nil, ErrInvalidCredentials
+    }
+    return &Identity{USR: USR, GID: map[string]string{"USER": "User"}}, nil
+}
+
+func TestAuthenticate(t *testing.T) {
+    list := authList
+    defer func() { authList = list }()
+    authList = nil
+
+    down := errors.New("LDAPException: connection refused")
+    ExportAuthenticator("A", &testAuthenticator{err: down})
+    ExportAuthenticator("B", &testAuthenticator{USR: "tester", PWD: "rahasia"})
+
+    z, e := Authenticate(nil, "tester", "rahasia")
+    if e != nil {
+        t.Fatal(e)
+    }
+    if z.Source != "B" {
+        t.Errorf("expected source B. received %s", z.Source)
+    }
+    if _, e := Authenticate(nil, "tester", "salah"); e != down {
+        t.Errorf("expected provider error. received %v", e)
+    }
+
+    Cache.Set("AUTH_PROVIDERS", "B")
+    defer Cache.Delete("AUTH_PROVIDERS")
+    if _, e := Authenticate(nil, "tester", "salah"); e != ErrInvalidCredentials {
+        t.Errorf("expected ErrInvalidCredentials. received %v", e)
+    }
+
+    s, done := testFileSessionStore(t)
+    defer done()
+    store := sessionStore
+    ExportSessionStore(s)
+    defer ExportSessionStore(store)
+
+    ctx := testContext("", nil)
+    ctx.SID = "OLD"
+    z, e = Authenticate(nil, "tester", "rahasia")
+    if e != nil {
+        t.Fatal(e)
+    }
+    if e := ctx.LoginIdentity(z); e != nil {
+        t.Fatal(e)
+    }
+    if USR, _ := ctx.SessionUser(); USR != "tester" || ctx.SID != "" || ctx.newSID == "" {
+        t.Errorf("login must create a new session")
+    }
+    if v, _ := ctx.Session("AUTH"); v != "B" {
+        t.Errorf("unexpected AUTH %v", v)
+    }
+}
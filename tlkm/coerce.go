@@ -0,0 +1,246 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Registry coerce yang bisa direferensikan (by name) dari kolom
+// st_handler_arguments.COERCED. Beberapa coerce bisa digabung sebagai pipeline
+// dengan separator |, dieksekusi berurutan dari kiri ke kanan
+//
+// ex: TRIM|RUPIAH  hasil TRIM akan menjadi input RUPIAH
+//
+// Modules bisa menambah (atau mereplace) coerce melalui ExportCoerce, sama seperti
+// PlayExport untuk interpreter
+package tlkm
+
+import (
+    "errors"
+    "strconv"
+    "strings"
+    "time"
+    "github.com/telkomdit/goframework/is"
+    "github.com/telkomdit/goframework/to"
+)
+
+type (
+    // Parameter pertama adalah nama argument (untuk kebutuhan pesan error), return
+    // adalah value hasil coerce yang akan mereplace parameter di Context
+    CoerceSignature func(string, string) (string, error)
+    CoerceExportSignature map[string]CoerceSignature
+)
+
+const (
+    CoerceSeparator = "|"
+)
+
+var (
+    // ** private **
+    coerceMap = CoerceExportSignature{
+        "NUMERIC":  CoerceNumeric,
+        "DIGIT":    CoerceDigit,
+        "DATE":     CoerceDate,
+        "DATETIME": CoerceDateTime,
+        "TRIM":     CoerceTrim,
+        "UPPER":    CoerceUpper,
+        "LOWER":    CoerceLower,
+        "PHONE":    CoercePhone,
+        "RUPIAH":   CoerceRupiah,
+        "BOOLEAN":  CoerceBoolean,
+    }
+
+    // ** private **
+    // layout yang dicoba (berurutan) oleh DATETIME, layout tanpa zona waktu akan
+    // diasumsikan menggunakan zona waktu server (config TIMEZONE)
+    coerceLayouts = List{
+        time.RFC3339Nano,
+        time.RFC3339,
+        "2006-01-02T15:04:05Z0700",
+        "2006-01-02 15:04:05Z07:00",
+        "2006-01-02 15:04:05 -0700",
+        "2006-01-02 15:04:05 MST",
+        "2006-01-02T15:04:05",
+        "2006-01-02T15:04",
+        "2006-01-02 15:04:05",
+        "2006-01-02 15:04",
+    }
+)
+
+// Registrasi coerce dari modules. Nama akan diperlakukan uppercase agar konsisten
+// dengan isi kolom COERCED
+//
+// contoh:
+//
+//      func init() {
+//          ExportCoerce(CoerceExportSignature{"NIK": coerceNIK})
+//      }
+func ExportCoerce(m CoerceExportSignature) {
+    for i, j := range m {
+        coerceMap[strings.ToUpper(i)] = j
+    }
+}
+
+// Eksekusi pipeline coerce, berhenti pada error pertama
+func Coerce(enum, name, value string) (string, error) {
+    for _, j := range strings.Split(enum, CoerceSeparator) {
+        k := strings.ToUpper(strings.TrimSpace(j))
+        if k == "" { continue }
+        f, v := coerceMap[k]
+        if !v {
+            return value, errors.New("CoerceNotFoundException: " + k)
+        }
+        u, e := f(name, value)
+        if e != nil {
+            return value, e
+        }
+        value = u
+    }
+    return value, nil
+}
+
+// Nama coerce terakhir dalam pipeline, digunakan sebagai tipe data argument
+func coerceType(enum string) string {
+    if i := strings.LastIndex(enum, CoerceSeparator); i >= 0 {
+        enum = enum[i+1:]
+    }
+    return strings.ToUpper(strings.TrimSpace(enum))
+}
+
+func CoerceNumeric(name, value string) (string, error) {
+    if !is.Numeric(value) { return to.Numeric(value), nil }
+    return value, nil
+}
+
+func CoerceDigit(name, value string) (string, error) {
+    if !is.Digit(value) { return to.Digit(value), nil }
+    return value, nil
+}
+
+// Format tanggal yang diterima: Y-m-d, d-m-Y (separator bebas) atau Ymd tanpa separator
+func CoerceDate(name, value string) (string, error) {
+    l := len(value)
+    if l < 8 || l > 10 {
+        return value, errors.New(Sprintf("expected (%s) date length 8|10. received %s", name, strconv.Itoa(l)))
+    }
+    exp := errors.New(Sprintf("expected (%s) date. received %s", name, value))
+    var d string
+    switch l {
+        case 10:
+            if is.Digit(value) { return value, exp }
+            _, _, _, _, d = to.DateSplit(value)
+        case 9,8:
+            if l == 8 && is.Digit(value) { // diijinkan untuk dikirim tanpa separator dalam format Ymd
+                d = Sprintf("%s-%s-%s", value[:4], value[4:6], value[6:])
+                if _, err := time.Parse("2006-01-02", d); err != nil {
+                    d = Sprintf("%s-%s-%s", value[4:], value[2:4], value[:2])
+                }
+            } else {
+                _, _, _, _, d = to.DateSplit(value) // asumsi m/d hanya 1 digit
+            }
+    }
+    if _, e := time.Parse("2006-01-02", d); e != nil { return value, e }
+    return d, nil
+}
+
+// Hasil akhir selalu Y-m-d H:i:s pada zona waktu server, sesuai format DATETIME
+// database. Input dengan offset/zona waktu akan dikonversi terlebih dahulu
+func CoerceDateTime(name, value string) (string, error) {
+    loc := time.Local
+    if tz, b := Cache.String("TIMEZONE"); b && tz != "" {
+        if l, e := time.LoadLocation(tz); e == nil {
+            loc = l
+        }
+    }
+    for _, j := range coerceLayouts {
+        if t, e := time.ParseInLocation(j, value, loc); e == nil {
+            return t.In(loc).Format("2006-01-02 15:04:05"), nil
+        }
+    }
+    if d, e := CoerceDate(name, value); e == nil {   // tanggal tanpa jam
+        return d + " 00:00:00", nil
+    }
+    return value, errors.New(Sprintf("expected (%s) datetime. received %s", name, value))
+}
+
+func CoerceTrim(name, value string) (string, error) {
+    return strings.TrimSpace(value), nil
+}
+
+func CoerceUpper(name, value string) (string, error) {
+    return strings.ToUpper(value), nil
+}
+
+func CoerceLower(name, value string) (string, error) {
+    return strings.ToLower(value), nil
+}
+
+// Normalisasi nomor telepon Indonesia ke format +62xxx
+//
+// ex: 0812-3456-789, 62812 3456 789, (+62) 812.3456.789 -> +628123456789
+func CoercePhone(name, value string) (string, error) {
+    d := to.Digit(value)
+    switch {
+    case strings.HasPrefix(d, "62"):
+        d = d[2:]
+    case strings.HasPrefix(d, "0"):
+        d = d[1:]
+    }
+    // nomor nasional (tanpa 0/62) minimal 8 dan maksimal 12 digit
+    if l := len(d); l < 8 || l > 12 || d[0] == '0' {
+        return value, errors.New(Sprintf("expected (%s) phone number. received %s", name, value))
+    }
+    return "+62" + d, nil
+}
+
+// Nominal rupiah dengan separator ribuan titik dan desimal koma. Titik hanya diterima
+// sebagai pemisah ribuan (kelompok 3 digit), format lain (1500.50, 1,500.50, 1.5) ditolak
+// karena tidak bisa dipastikan maksudnya
+//
+// ex: Rp 1.250.000,50 -> 1250000.50
+func CoerceRupiah(name, value string) (string, error) {
+    exp := errors.New(Sprintf("expected (%s) rupiah. received %s", name, value))
+    v := strings.TrimSpace(value)
+    if len(v) >= 2 && strings.EqualFold(v[:2], "RP") {
+        v = v[2:]
+    }
+    v = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(v), ",-"))
+    v = strings.Replace(v, " ", "", -1)
+    sign := ""
+    if strings.HasPrefix(v, "-") {
+        sign, v = "-", v[1:]
+    }
+    d := ""
+    if i := strings.Index(v, ","); i >= 0 {
+        v, d = v[:i], v[i+1:]
+        if d == "" || !is.Digit(d) {
+            return value, exp
+        }
+        d = "." + d
+    }
+    g := strings.Split(v, ".")
+    for i, j := range g {
+        // kelompok pertama 1-3 digit, berikutnya tepat 3 digit
+        if j == "" || !is.Digit(j) || (len(g) > 1 && (len(j) > 3 || (i > 0 && len(j) != 3))) {
+            return value, exp
+        }
+    }
+    return sign + strings.Join(g, "") + d, nil
+}
+
+// Normalisasi boolean menjadi 1/0 sesuai tipe data CHAR(1)/TINYINT database
+func CoerceBoolean(name, value string) (string, error) {
+    switch strings.ToLower(strings.TrimSpace(value)) {
+    case "1", "true", "t", "y", "yes", "ya", "on":
+        return "1", nil
+    case "0", "false", "f", "n", "no", "tidak", "off", "":
+        return "0", nil
+    }
+    return value, errors.New(Sprintf("expected (%s) boolean. received %s", name, value))
+}
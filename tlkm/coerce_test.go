@@ -0,0 +1,107 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "net/url"
+    "testing"
+)
+
+func TestCoerce(t *testing.T) {
+    data := []SList{
+        {"TRIM|UPPER", "  abc ", "ABC"},
+        {"DIGIT", "123x45", "12345"},
+        {"DATE", "20210102", "2021-01-02"},
+        {"PHONE", "0812-3456-789", "+628123456789"},
+        {"PHONE", "(+62) 812.3456.789", "+628123456789"},
+        {"PHONE", "628123456789", "+628123456789"},
+        {"RUPIAH", "Rp 1.250.000,50", "1250000.50"},
+        {"TRIM|RUPIAH", " 15.000,- ", "15000"},
+        {"RUPIAH", "1500", "1500"},
+        {"RUPIAH", "Rp -750,25", "-750.25"},
+        {"BOOLEAN", "Ya", "1"},
+        {"BOOLEAN", "off", "0"},
+        {"DATETIME", "2021-01-02 03:04", "2021-01-02 03:04:00"},
+    }
+    for _, j := range data {
+        v, e := Coerce(j[0], "TEST", j[1])
+        if e != nil || v != j[2] {
+            t.Errorf("%s(%s): expected %s, received %s (%v)", j[0], j[1], j[2], v, e)
+        }
+    }
+    for _, j := range []SList{{"PHONE", "12345"}, {"RUPIAH", "Rp abc"}, {"RUPIAH", "1500.50"}, {"RUPIAH", "1,500.50"}, {"RUPIAH", "1.5"}, {"RUPIAH", "1.2345"}, {"RUPIAH", "1.500,"}, {"BOOLEAN", "mungkin"}, {"UNKNOWN", "x"}} {
+        if _, e := Coerce(j[0], "TEST", j[1]); e == nil {
+            t.Errorf("%s(%s): expected error", j[0], j[1])
+        }
+    }
+}
+
+func TestCoerceExport(t *testing.T) {
+    ExportCoerce(CoerceExportSignature{"reverse": func(n, v string) (string, error) {
+        r := []rune(v)
+        for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+            r[i], r[j] = r[j], r[i]
+        }
+        return string(r), nil
+    }})
+    c := &controller{Logger: &Logger{logNs: "HTTP", logLv: ERROR}}
+    args := map[string]Argument{
+        "KODE": Argument{Minl: -1, Maxl: 5, Minv: -1, Maxv: -1, Coerce: "TRIM|REVERSE", Type: coerceType("TRIM|REVERSE")},
+        "HARGA": Argument{Minl: -1, Maxl: -1, Minv: -1, Maxv: -1, Coerce: "RUPIAH", Type: "RUPIAH"},
+    }
+    ctx := testContext("", url.Values{"KODE": {" abc "}, "HARGA": {"Rp 1.500"}})
+    if e := c.validate(args, ctx, false, ""); e != nil {
+        t.Fatal(e)
+    }
+    if ctx.Get("KODE") != "cba" || ctx.Get("HARGA") != "1500" {
+        t.Errorf("unexpected coerce result %v", ctx.Values)
+    }
+}
+
+// Constraint berlaku untuk value yang dikirim client, coerce dieksekusi terakhir
+func TestCoerceOrder(t *testing.T) {
+    c := &controller{Logger: &Logger{logNs: "HTTP", logLv: ERROR}}
+    args := map[string]Argument{
+        "HARGA": Argument{Minl: -1, Maxl: -1, Minv: 1000, Maxv: -1, Coerce: "RUPIAH", Type: "RUPIAH"},
+    }
+    ctx := testContext("", url.Values{"HARGA": {"1500"}})
+    if e := c.validate(args, ctx, false, ""); e != nil {
+        t.Fatal(e)
+    }
+    ctx = testContext("", url.Values{"HARGA": {"Rp 1.500"}})
+    e := c.validate(args, ctx, false, "")
+    z, _ := e.(ValidationErrors)
+    if len(z) == 0 || z[0].Rule != "int" {
+        t.Errorf("expected int error before coerce. received %v", e)
+    }
+}
+
+// Tipe data pipeline dicek terhadap hasil pipeline, bukan value mentah
+func TestCoercePipelineType(t *testing.T) {
+    c := &controller{Logger: &Logger{logNs: "HTTP", logLv: ERROR}}
+    for _, j := range []string{"TRIM|NUMERIC", "TRIM|DIGIT"} {
+        args := map[string]Argument{"KODE": Argument{Minl: -1, Maxl: -1, Minv: -1, Maxv: -1, Coerce: j, Type: coerceType(j)}}
+        ctx := testContext("", url.Values{"KODE": {" 123"}})
+        if e := c.validate(args, ctx, false, ""); e != nil {
+            t.Errorf("%s: %v", j, e)
+        }
+        if ctx.Get("KODE") != "123" {
+            t.Errorf("%s: expected 123, received %q", j, ctx.Get("KODE"))
+        }
+    }
+    args := map[string]Argument{"KODE": Argument{Minl: -1, Maxl: -1, Minv: -1, Maxv: -1, Coerce: "DIGIT", Type: "DIGIT"}}
+    if e := c.validate(args, testContext("", url.Values{"KODE": {"12x"}}), false, ""); e == nil {
+        t.Error("single coerce must keep the type check on the received value")
+    }
+}
@@ -0,0 +1,280 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Kondisi WHERE yang bisa disusun, dipakai oleh QueryBuilder.Where, SQL.UpdateQuery dan
+// SQL.DeleteQuery. *GMap tetap bisa dipakai langsung sebagai Condition (semua entry
+// di-AND seperti WhereQuery)
+//
+//      qb.Select("*").From("orders o").Where(
+//          &GMap{"o.STATUS": "OPEN"},
+//          Cond.Or(
+//              Cond.In("o.REGION", List{"JKT", "SBY"}),
+//              Cond.Between("o.AMOUNT", 1000, 5000),
+//              Cond.IsNull("o.CLOSED_AT"),
+//          ),
+//          Cond.Not(Cond.Exists(SQL.Builder().Select("1").From("refunds r").Where(Cond.Raw("r.ORDER_ID=o.ID")))),
+//      )
+//
+// Placeholder dinomori sesuai urutan argument pada statement akhir ($1.. PGSQL, :1..
+// ORACL, @p1.. MSSQL, ? MYSQL/SQLITE), termasuk subquery, SET dan row-level policy.
+// Subquery mengikuti driver statement induknya, Context (row-level policy) diturunkan
+// jika subquery belum memiliki Context/System
+//
+// Or dan Raw selalu ditulis dalam kurung agar aman digabung dengan AND lain
+//
+// Perubahan perilaku SQL.WhereQuery (juga berlaku untuk *GMap):
+//   1. Nilai nil ditulis sebagai column IS NULL, sebelumnya column=NULL yang tidak
+//      pernah bernilai true
+//   2. Placeholder ORACL/MSSQL menjadi :1../@p1.. (sebelumnya :column/@column), sehingga
+//      column yang sama bisa muncul lebih dari sekali (SET dan WHERE, subquery)
+package tlkm
+
+import (
+    "reflect"
+    "strings"
+    "github.com/telkomdit/goframework/buffer"
+)
+
+type (
+    // Hanya bisa dibentuk melalui Cond atau *GMap
+    Condition interface {
+        condition(w *conditionWriter)
+    }
+
+    // Namespace constructor Condition (lihat var Cond)
+    conditions struct {}
+
+    // ** private **
+    conditionWriter struct {
+        driver  Driver
+        stmt    *buffer.ByteBuffer
+        argv    *[]interface{}
+        outer   *QueryBuilder   // nil untuk SQL.UpdateQuery/DeleteQuery
+    }
+
+    // AND/OR dari beberapa kondisi
+    condGroup struct {
+        op      string
+        list    []Condition
+    }
+
+    condNot struct {
+        cond    Condition
+    }
+
+    // Potongan statement: string ditulis apa adanya, condValue menjadi placeholder,
+    // *QueryBuilder menjadi subquery
+    condExpr []interface{}
+
+    condValue struct {
+        v   interface{}
+    }
+)
+
+var (
+    // ** GLOBAL **
+    Cond = &conditions{}
+)
+
+// Semua kondisi harus terpenuhi, kondisi kosong diabaikan
+func (self *conditions) And(list ...Condition) Condition {
+    return &condGroup{op: " AND ", list: list}
+}
+
+// Salah satu kondisi terpenuhi, ditulis dalam kurung
+func (self *conditions) Or(list ...Condition) Condition {
+    return &condGroup{op: " OR ", list: list}
+}
+
+// NOT (cond)
+func (self *conditions) Not(cond Condition) Condition {
+    return &condNot{cond: cond}
+}
+
+// column = value, nil menjadi IS NULL dan *QueryBuilder menjadi subquery
+func (self *conditions) Eq(column string, value interface{}) Condition {
+    if value == nil {
+        return self.IsNull(column)
+    }
+    return condExpr{column + "=", conditionValue(value)}
+}
+
+// column op value, contoh: Op("AMOUNT", ">=", 100), Op("NAME", "LIKE", "A%")
+func (self *conditions) Op(column, op string, value interface{}) Condition {
+    return condExpr{column + " " + strings.TrimSpace(op) + " ", conditionValue(value)}
+}
+
+// column IN (values), values berupa beberapa nilai, satu slice atau satu *QueryBuilder.
+// Tanpa nilai menjadi 1=0
+func (self *conditions) In(column string, values ...interface{}) Condition {
+    return conditionIn(column, " IN ", "1=0", values)
+}
+
+// Tanpa nilai menjadi 1=1
+func (self *conditions) NotIn(column string, values ...interface{}) Condition {
+    return conditionIn(column, " NOT IN ", "1=1", values)
+}
+
+// column BETWEEN from AND to
+func (self *conditions) Between(column string, from, to interface{}) Condition {
+    return condExpr{column + " BETWEEN ", conditionValue(from), " AND ", conditionValue(to)}
+}
+
+// column IS NULL
+func (self *conditions) IsNull(column string) Condition {
+    return condExpr{column + " IS NULL"}
+}
+
+// column IS NOT NULL
+func (self *conditions) NotNull(column string) Condition {
+    return condExpr{column + " IS NOT NULL"}
+}
+
+// EXISTS (subquery)
+func (self *conditions) Exists(qb *QueryBuilder) Condition {
+    return condExpr{"EXISTS ", qb}
+}
+
+// NOT EXISTS (subquery)
+func (self *conditions) NotExists(qb *QueryBuilder) Condition {
+    return condExpr{"NOT EXISTS ", qb}
+}
+
+// Ekspresi SQL dengan ? sebagai placeholder (diluar literal '...'), argument
+// *QueryBuilder menjadi subquery
+func (self *conditions) Raw(expr string, args ...interface{}) Condition {
+    z := condExpr{"("}
+    quote := false
+    last, n := 0, 0
+    for i := 0; i < len(expr); i++ {
+        switch {
+        case expr[i] == '\'':
+            quote = !quote
+        case expr[i] == '?' && !quote && n < len(args):
+            z = append(z, expr[last:i], conditionValue(args[n]))
+            last = i + 1
+            n++
+        }
+    }
+    return append(z, expr[last:], ")")
+}
+
+func conditionValue(v interface{}) interface{} {
+    if qb, b := v.(*QueryBuilder); b {
+        return qb
+    }
+    return condValue{v}
+}
+
+func conditionIn(column, op, empty string, values []interface{}) Condition {
+    if len(values) == 1 {
+        if qb, b := values[0].(*QueryBuilder); b {
+            return condExpr{column + op, qb}
+        }
+        values = conditionList(values[0])
+    }
+    if len(values) == 0 {
+        return condExpr{empty}
+    }
+    z := condExpr{column + op + "("}
+    for i, v := range values {
+        if i > 0 {
+            z = append(z, ",")
+        }
+        z = append(z, condValue{v})
+    }
+    return append(z, ")")
+}
+
+// Slice/array sebagai list nilai ([]byte tetap satu nilai)
+func conditionList(v interface{}) []interface{} {
+    r := reflect.ValueOf(v)
+    if (r.Kind() != reflect.Slice && r.Kind() != reflect.Array) || r.Type().Elem().Kind() == reflect.Uint8 {
+        return []interface{}{v}
+    }
+    z := make([]interface{}, r.Len())
+    for i := range z {
+        z[i] = r.Index(i).Interface()
+    }
+    return z
+}
+
+// Render kondisi ke buffer baru, string kosong jika tidak ada kondisi
+func (self *conditionWriter) render(cond Condition) string {
+    if cond == nil {
+        return ""
+    }
+    b := buffer.Get()
+    defer b.Close()
+    w := &conditionWriter{driver: self.driver, stmt: b, argv: self.argv, outer: self.outer}
+    cond.condition(w)
+    return b.String()
+}
+
+// Tulis qb sebagai subquery dengan driver dan Context statement induk
+func (self *conditionWriter) subquery(qb *QueryBuilder) {
+    qb.driver = self.driver
+    if self.outer != nil && qb.ctx == nil && !qb.system {
+        qb.ctx, qb.system = self.outer.ctx, self.outer.system
+    }
+    self.stmt.WRune('(').WS(qb.selectQuery(self.argv)).WRune(')')
+}
+
+func (self *GMap) condition(w *conditionWriter) {
+    if self != nil && len(*self) > 0 {
+        SQL.WhereQuery(w.driver, w.stmt, self, w.argv)
+    }
+}
+
+func (self *condGroup) condition(w *conditionWriter) {
+    list := List{}
+    for _, c := range self.list {
+        if s := w.render(c); s != "" {
+            list = append(list, s)
+        }
+    }
+    switch {
+    case len(list) == 0:
+        if self.op == " OR " {
+            w.stmt.WS("1=0")
+        }
+    case len(list) == 1 || self.op == " AND ":
+        w.stmt.WS(strings.Join(list, self.op))
+    default:
+        w.stmt.WRune('(').WS(strings.Join(list, self.op)).WRune(')')
+    }
+}
+
+func (self *condNot) condition(w *conditionWriter) {
+    if s := w.render(self.cond); s != "" {
+        w.stmt.WS("NOT (").WS(s).WRune(')')
+    }
+}
+
+func (self condExpr) condition(w *conditionWriter) {
+    for _, i := range self {
+        switch x := i.(type) {
+        case string:
+            w.stmt.WS(x)
+        case condValue:
+            if x.v == nil {
+                w.stmt.WS("NULL")
+                continue
+            }
+            SQL.bind(w.driver, w.stmt, len(*w.argv) + 1)
+            *w.argv = append(*w.argv, x.v)
+        case *QueryBuilder:
+            w.subquery(x)
+        }
+    }
+}
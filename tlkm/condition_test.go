@@ -0,0 +1,93 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "net/url"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestConditionPlaceholders(t *testing.T) {
+    where := Cond.Or(Cond.Eq("B", 2), Cond.In("C", List{"x", "y"}), Cond.IsNull("D"))
+    expected := map[Driver]string{
+        MYSQL: "UPDATE t SET A=? WHERE (B=? OR C IN (?,?) OR D IS NULL)",
+        PGSQL: "UPDATE t SET A=$1 WHERE (B=$2 OR C IN ($3,$4) OR D IS NULL)",
+        ORACL: "UPDATE t SET A=:1 WHERE (B=:2 OR C IN (:3,:4) OR D IS NULL)",
+        MSSQL: "UPDATE t SET A=@p1 WHERE (B=@p2 OR C IN (@p3,@p4) OR D IS NULL)",
+    }
+    for driver, v := range expected {
+        stmt, argv := SQL.UpdateQuery(driver, "t", &GMap{"A": 1}, where)
+        if stmt != v || !reflect.DeepEqual(argv, []interface{}{1, 2, "x", "y"}) {
+            t.Errorf("expected %s. received %s %v", v, stmt, argv)
+        }
+    }
+
+    // GMap dan raw @column tetap didukung, nil menjadi IS NULL
+    stmt, argv := SQL.DeleteQuery(PGSQL, "t", &GMap{"ID@>": 7}, &GMap{"MSG": nil}, Cond.Between("AMOUNT", 10, 20))
+    if stmt != "DELETE FROM t WHERE ID > $1 AND MSG IS NULL AND AMOUNT BETWEEN $2 AND $3" || len(argv) != 3 {
+        t.Errorf("unexpected %s %v", stmt, argv)
+    }
+    if stmt, _ = SQL.DeleteQuery(PGSQL, "t", Cond.And()); stmt != "DELETE FROM t" {
+        t.Errorf("empty condition must not write WHERE. received %s", stmt)
+    }
+}
+
+func TestConditionSubquery(t *testing.T) {
+    sub := SQL.Builder().Select("r.ORDER_ID").From("refunds r").Where(Cond.Op("r.AMOUNT", ">=", 100))
+    uni := SQL.Builder().Select("ID").From("archive").Where(&GMap{"STATUS": "X"})
+    qb := SQL.Builder(PGSQL).Select("ID").From("orders o").Where(
+        &GMap{"o.STATUS": "OPEN"},
+        Cond.Not(Cond.In("o.ID", sub)),
+        Cond.Or(Cond.Exists(SQL.Builder().Select("1").From("notes n").Where(Cond.Raw("n.ORDER_ID=o.ID AND n.TXT<>'?'"))), Cond.Raw("o.TOTAL > ? + ?", 1, 2)),
+    ).Union(uni)
+    defer qb.Close()
+    stmt, argv := qb.SelectQuery()
+    for _, i := range []string{
+        "WHERE o.STATUS=$1 AND NOT (o.ID IN (",
+        "WHERE r.AMOUNT >= $2)) AND (EXISTS (",
+        "WHERE (n.ORDER_ID=o.ID AND n.TXT<>'?'))",
+        " OR (o.TOTAL > $3 + $4))",
+        "WHERE STATUS=$5",
+    } {
+        if !strings.Contains(stmt, i) {
+            t.Errorf("expected %q in\n%s", i, stmt)
+        }
+    }
+    if !reflect.DeepEqual(argv, []interface{}{"OPEN", 100, 1, 2, "X"}) {
+        t.Errorf("unexpected argv %v", argv)
+    }
+    if stmt, _ = SQL.Builder().From("t").Where(Cond.In("ID"), Cond.NotIn("X", []int{})).SelectQuery(); !strings.Contains(stmt, "WHERE 1=0 AND 1=1") {
+        t.Errorf("unexpected %s", stmt)
+    }
+}
+
+// OR dari Where tidak boleh melemahkan row-level policy
+func TestConditionRowPolicy(t *testing.T) {
+    defer testRowPolicies(t)()
+
+    ctx := testContext("", url.Values{})
+    ctx.sesMap = GMap{"USR": "tester", "REGION": "R1", "GID": map[string]string{"REGIONAL": ""}}
+    ctx.GID = "REGIONAL"
+    sub := SQL.Builder().Select("o.CUSTOMER_ID").From("orders o")
+    stmt, argv := SQL.Builder(PGSQL).From("customers c").Context(ctx).
+        Where(Cond.Or(Cond.Eq("c.ID", 1), Cond.In("c.ID", sub))).SelectQuery()
+    if !strings.Contains(stmt, "WHERE ((c.ID=$1 OR c.ID IN (") || !strings.HasSuffix(stmt, "))) AND (c.REGION_ID=$3)") {
+        t.Errorf("unexpected statement %s", stmt)
+    }
+    if !strings.Contains(stmt, "WHERE (o.STATUS<>'X:Y') AND (o.REGION_ID=$2)") || !reflect.DeepEqual(argv, []interface{}{1, "R1", "R1"}) {
+        t.Errorf("subquery must inherit policy: %s %v", stmt, argv)
+    }
+}
@@ -24,9 +24,7 @@ import (
     "net/http"
     "net/url"
     "os"
-    "time"
     "github.com/satori/go.uuid"
-    "github.com/golang-jwt/jwt"
     "github.com/telkomdit/goframework/to"
 )
 
@@ -55,6 +53,11 @@ type (
         // sinkronisasi antara cache dan database dilakukan jika dan hanya jika
         // ada perubahan Map (melalui set/unset)
         sesCreate, sesUpdate   bool
+        sesDiff     SessionDiff // nilai lama attribute yang diubah (lihat sessionevent.go)
+
+        cookieAuth  bool    // session dari cookie SAFSID (bukan Bearer), lihat csrf.go
+        sesAdmit    bool    // batas session sudah diperiksa LoginIdentity, lihat sessionpolicy.go
+        apiKey      *APIKey // request dengan header X-API-Key, lihat apikey.go
 
         json        GMap    // default property untuk response json
 
@@ -77,6 +80,8 @@ type (
         exit        bool
         
         code        int     // Http Status Code
+
+        trace       []RuleTrace // trace eksekusi rules (lihat trace.go)
     }
 )
 
@@ -129,27 +134,22 @@ func (self *Context) Cookie(name string) string {
 // SID (Session ID) dikirim melalui dua cara:
 //   1. otomatis oleh browser (jika client adalah browser), curl, http-based client
 //   2. http header Authorization: Bearer JWT (jika client adalah user API)
+//
+// Client service-to-service menggunakan header X-API-Key tanpa SID (lihat apikey.go)
 func (self *Context) sessionStart(conn *Connection) (e error) {
     SID := ""
     if cookie, e := self.Request.Cookie(SAFSID); e == nil {
         SID = cookie.Value
+        self.cookieAuth = SID != ""
     } else {
-        if HDR := self.Request.Header.Get("Authorization"); HDR != "" {
-            mc := jwt.MapClaims{}   // lebih praktis karena isi claim hanya 1 field
-
-            // (Authorization)[7:] karena selain Bearer tidak ada rencana untuk implementasi
-            // auth method yang lain (Basic, Digest etc)
-            //
-            // Kedepan, paling mungkin switch HDR[:6] antara Bearer atau Digest
-            _, e = jwt.ParseWithClaims(HDR[7:], mc, func(T *jwt.Token) (interface{}, error) {
-                if _, b := T.Method.(*jwt.SigningMethodHMAC); !b {
-                    return nil, errors.New("SigningMethodException: " + to.String(T.Header["alg"]))
-                }
-                return jwtSecret, nil
-            })
-            if e == nil {
-                SID = to.String(mc[SAFSID])  // claim hanya 1 field yaitu session yang sama yang digunakan browser
+        // Selain Bearer (Basic, Digest etc) tidak ada rencana untuk implementasi. Token
+        // yang tidak valid/expired diperlakukan sama seperti request tanpa session
+        if HDR, b := bearerToken(self.Request.Header.Get("Authorization")); b {
+            if mc, e := jwtParse(HDR, JWTAccess); e == nil {
+                SID = to.String(mc[SAFSID])  // session yang sama yang digunakan browser
             }
+        } else if HDR := self.Request.Header.Get(APIKeyHeader); HDR != "" && self.apiKeyStart(conn, HDR) {
+            return nil
         }
     }
     // Dengan semua proses yang dilakukan pada saat login, harga yang harus dibayar
@@ -161,86 +161,53 @@ func (self *Context) sessionStart(conn *Connection) (e error) {
     if SID == "" {
         self.sesMap = GMap{}    // atau sebaiknya nil?
     } else {
-        if v, b := Cache.GMap(SID); b {
-            self.sesMap = v
-            self.SID = SID
-        } else {
-            // Tidak ditemukan di cache belum tentu benar2 expired, ada kemungkinan
-            // karena flush Cache. Jadi selama session di DB ditemukan (dan valid),
-            // maka cache harus push ulang
-            ssot, _ := Cache.Int("SSO_SSN_EXP")
-            rows := conn.Query("SELECT MSGT FROM st_sessions WHERE SID=? AND UTS>(UNIX_TIMESTAMP()-?)", SID, ssot)
-            if rows.Next() {
-                var v GMap
-                if e := json.Unmarshal(rows.Bytes("MSGT"), &v); e == nil {
-                    ssox, _ := Cache.Int("SSO_SSN_EXP")
-                    self.sesMap = v
-                    self.remap("GID", "ACL")
-                    Cache.Set(SID, self.sesMap, time.Duration(ssox))
-                }
-            } else {
-                return errors.New("SessionNotFoundException: " + SID)
-            }
+        r, e := sessionStore.Load(SID)  // lihat session.go
+        if e != nil {
+            return errors.New("SessionNotFoundException: " + SID)
         }
+        self.sesMap = r.Data
+        self.SID = SID
     }
     return
 }
 
-// memastikan session (yang dimanage framework) sesuai tipe data yang diinginkan
-// untuk menghindari assert dalam setiap request/response
-//
-// beberapa kasus, hasil assert json.Unmarshal SMap menjadi GMap
-func (self *Context) remap(index... string) {
-    for _, j := range index {
-        if k, v := self.sesMap[j]; v {
-            g := k.(map[string]interface{})
-            m := make(map[string]string)
-            for o, p := range g {
-                m[o] = p.(string)
-            }
-            self.sesMap[j] = m
-        }
-    }
-}
-
 // Akan dipanggil pada saat write data pertama kali ke http.Response
 func (self *Context) sessionClose() {
     USR, e := self.SessionUser()
-    if !e || self.sent { return }
-    ssox, _ := Cache.Int("SSO_SSN_EXP")
+    if !e || self.sent || self.apiKey != nil { return }  // session API key tidak disimpan
     if !self.sesUpdate {
-        Cache.Extend(self.SID, time.Duration(ssox)) // jika tidak ada perubahan, extends lifetime
+        sessionStore.Touch(self.SID) // jika tidak ada perubahan, extends lifetime
         return
     }
-    conn := SQL.Default()
-    defer conn.Close()
     _new := false
     if self.SID == "" { _new = true }
+    if _new && !self.sesAdmit {
+        // login via SessionSet("USR") tanpa LoginIdentity. Jika batas tercapai session
+        // tidak dibentuk dan status response menjadi 409 (lihat sessionpolicy.go)
+        GID, _ := self.sesMap["GID"].(map[string]string)
+        if e := sessionAdmit(USR, "", SessionPolicyOf(GID)); e != nil {
+            (&Logger{logNs: "SYST", logLv: loglv}).Log(WARN, Sprintf("%s (%s)", e.Error(), USR))
+            self.code = StatusConflict
+            return
+        }
+    }
+    conn := SQL.Default()
+    defer conn.Close()
     // sessMap private hanya untuk package tlkm, tidak ada alasan lain untuk mutable
     // kecuali perubahannya krn internal
     if _new {
         for _, l := range sessMap {
             l.OnCreate(conn, self)  // 1x pada saat client berhasil login
         }
-    } else { // Dipanggil setiap ada perubahan. Belum ada mekanisme subscribe untuk package spesifik (misal)
-        for _, l := range sessMap {
-            l.OnUpdate(conn, self)
-        }
+    } else { // Dipanggil setiap ada perubahan, sesuai subscription listener
+        sessionUpdated(conn, self)
     }
-    if j, e := json.Marshal(self.sesMap); e == nil { // serialize/marshal map untuk disimpan di DB
-        jso := string(j)
-        if _new {
-            self.SID = self.newSID
-            self.sessionCreate(0)   // valid sampai browser ditutup atau expired dari sisi server
-            conn.Exec(
-                "INSERT INTO st_sessions(SID,USR,ADDR,UTS,LOGT,MSGT) VALUES (?,?,?,UNIX_TIMESTAMP(),CURRENT_TIMESTAMP,?)",
-                self.SID, USR, self.ClientIP(),
-            jso)
-        } else {
-            conn.Exec("UPDATE st_sessions SET UTS=UNIX_TIMESTAMP(),MSGT=? WHERE SID=?", jso, self.SID)
-        }
-        Cache.Set(self.SID, self.sesMap, time.Duration(ssox))
+    if _new {
+        self.SID = self.newSID
+        self.sessionCreate(0)   // valid sampai browser ditutup atau expired dari sisi server
+        self.csrfIssue()        // token CSRF dibentuk bersama session (lihat csrf.go)
     }
+    sessionStore.Save(&SessionRecord{SID: self.SID, USR: USR, ADDR: self.ClientIP(), Data: self.sesMap}, _new)
 }
 
 // Hanya untuk membedakan session cookie dibuat atau sudah expired
@@ -259,31 +226,12 @@ func (self *Context) sessionCreate(maxAge int) *Context {
     return self
 }
 
-// Dua hal yang dilakukan jika session expired karena client (dengan sengaja) melakukan
-// signout/logout:
-//   1. Memindahkan data session ke archive untuk menjaga performansi tabel session dan
-//      untuk kebutuhan audit
-//   2. Hapus cache yang digunakan untuk lookup data
+// Session expired karena client (dengan sengaja) melakukan signout/logout. Data session
+// dipindahkan ke archive oleh session store (lihat session.go)
 func (self *Context) SessionDestroy(conn *Connection) (e error) {
-    tx := conn.Begin()
-    (&Go{
-        Try: func() {
-            tx.Exec(`INSERT IGNORE INTO st_session_archive(PERIOD,SID,USR,ADDR,UTS,LOGT,MSGT)
-                     SELECT DATE_FORMAT(LOGT, "%Y%m") PERIOD,SID,USR,ADDR,UTS,LOGT,MSGT
-                       FROM st_sessions
-                      WHERE SID=? FOR UPDATE`, self.SID)
-            tx.Exec("LOCK TABLE st_sessions WRITE")
-            tx.Exec("DELETE FROM st_sessions WHERE SID=?", self.SID)    // hapus dari tabel operasional
-            tx.Exec("UNLOCK TABLES")
-            tx.Commit()
-            Cache.Delete(self.SID)
-            self.sessionCreate(-1)
-        },
-        Catch: func(ex Exception) {
-            tx.Rollback()
-            e = errors.New(to.String(ex))
-        },
-    }).Run()
+    if e = sessionDestroy(conn, self.SID); e == nil {
+        self.sessionCreate(-1)
+    }
     return e
 }
 
@@ -325,7 +273,7 @@ func (self *Context) SessionUser(name ...string) (k string, v bool) {
 // Mengikuti perilaku $_SESSION di PHP, tanpa inisialisasi secara eksplisit, session
 // akan dibentuk secara otomatis pada saat pertama kali data session dibuat
 func (self *Context) SessionSet(k string, v interface{}) *Context {
-    self.sesUpdate = true
+    self.sessionTrack(k)
     if self.SID == "" && self.newSID == "" {
         newV4, _ := uuid.NewV4()
         self.newSID = newV4.String()  // dipastikan hanya 1x
@@ -334,25 +282,44 @@ func (self *Context) SessionSet(k string, v interface{}) *Context {
     return self
 }
 
+// Login user USR dengan groups GID (GID => nama group) sebagai session baru. Session
+// lama (jika ada) di-destroy untuk mencegah session fixation. OnCreate session listener
+// dipanggil pada saat session disimpan, sama seperti login via SessionSet
+//
+// Idle/absolute timeout diambil dari policy group (lihat sessionpolicy.go)
+func (self *Context) SessionLogin(USR string, GID map[string]string) *Context {
+    if self.SID != "" {
+        sessionDestroy(nil, self.SID)
+        self.SID = ""
+    }
+    self.sesMap = GMap{}
+    self.sesDiff = nil
+    self.SessionSet("USR", USR)
+    if GID != nil {
+        self.SessionSet("GID", GID)
+        self.sessionGroups(nil, GID)    // hierarki group (lihat group.go)
+    }
+    self.sessionPolicy(SessionPolicyOf(GID))
+    return self
+}
+
 // Hapus data session
 func (self *Context) SessionUnset(name string) *Context {
-    self.sesUpdate = true
+    self.sessionTrack(name)
     if _, v := self.sesMap[name]; v {   // hanya jika ditemukan
         delete(self.sesMap, name)
     }
     return self
 }
 
-// Token yang (mungkin) akan digunakan oleh client non-browser (akses via API)
+// Access token yang (mungkin) akan digunakan oleh client non-browser (akses via API).
+// Untuk sekaligus mendapatkan refresh token gunakan JWTPair (lihat token.go)
 //
-// Pembentukan token tidak di expose ke modul untuk menjaga jwtSecret tetap private
+// Pembentukan token tidak di expose ke modul untuk menjaga key set tetap private
 // (available) hanya di package tlkm
 func (self *Context) JWT() (v string, e error) {
     if SID, b := self.SessionID(); b {
-        m := jwt.MapClaims{}
-        m[SAFSID] = SID
-        j := jwt.NewWithClaims(jwt.SigningMethodHS256, m)
-        v, e = j.SignedString(jwtSecret)
+        v, _, e = jwtIssue(SID, JWTAccess)
     }
     return
 }
@@ -369,8 +336,10 @@ func (self *Context) keyExists(k, v string) bool {
 
 // Karena sejak awal framework sudah coupling dengan database (frameworknya sendiri)
 // beberapa fungsi checking akan langsung disediakan oleh framework
+//
+// Termasuk group yang di-inherit (lihat group.go)
 func (self *Context) HasRole(GID string) bool {
-    return self.keyExists("GID", GID)
+    return self.keyExists("GID", GID) || self.keyExists("GIDX", GID)
 }
 
 // Sama seperti fungsi diatas
@@ -17,7 +17,6 @@ package tlkm
 
 import (
     "encoding/json"
-    "errors"
     "fmt"
     "io/ioutil"
     "mime"
@@ -27,9 +26,7 @@ import (
     "strconv"
     "strings"
     "sync"
-    "time"
     "github.com/telkomdit/goframework/is"
-    "github.com/telkomdit/goframework/to"
 )
 
 type (
@@ -42,15 +39,27 @@ type (
         httpSwagger http.HandlerFunc
     }
 
+    // ** private **
+    // hasil lookup rules handler (cache rule:)
+    ruleSet struct {
+        Key     List                    // urutan eksekusi
+        Map     BMap                    // expected-return
+        Ref     SMap                    // argument wajib rule yang tidak disyaratkan handler
+        Params  map[string]RuleParams   // parameter per binding
+        Errs    SMap                    // PARAMS yang tidak sesuai schema
+    }
+
     // ** private **
     // mapping parameter -> constraint
     Argument struct {
         Required, Logged    bool
         Minl, Maxl    int
         Minv, Maxv    int
+        Minc, Maxc    int   // jumlah item minimal/maksimal jika value berupa json array
         Enum    string
         Coerce  string
         Type    string
+        Format  string  // EMAIL, URL, ALNUM dst (lihat validate.go)
     }
 )
 
@@ -93,24 +102,32 @@ func (self *controller) getCacheKey(cache cacheKey, method httpMethod) string {
     return ""
 }
 
-// Membentuk struktur data BMap (map[string]bool) rule dan return yang diharapkan.
-// Key hanya helper untuk lookup Map agar eksekusi dijalankan sesuai urutan yang diharapkan
+// Membentuk struktur data ruleSet: urutan rule (Key), return yang diharapkan (Map) dan
+// parameter per binding (Params)
 //
 // Hasil akhir akan disimpan dalam cache untuk memastikan fungsi lookup rules untuk
 // path dan call yang sama hanya dijalankan 1x
-func (self *controller) handlerRules(conn *Connection, path, call string, method httpMethod) (Key List, Map BMap) {
+func (self *controller) handlerRules(conn *Connection, path, call string, method httpMethod) *ruleSet {
     nv, _ := servKey[path]
     ns := self.getCacheKey(nv.rule, method)
-    if ns == "" { return }
+    if ns == "" { return nil }
 
     // return dari cache jika path + call yang sama sudah dilakukan. Ada/tidak rules, proses
     // dipastikan hanya dilakukan 1x. Artinya jika sebuah handler tidak memiliki rules, maka
-    // Key dan Map bernilai nil
-    e := false
-    if Key, Map, e = Cache.KeyBMap(ns); e { return }
+    // Key bernilai nil
+    if object, e := Cache.Get(ns); e {
+        return object.(*ruleSet)
+    }
+    rs := loadRules(conn, path, call)
+    Cache.Set(ns, rs) // simpan hasil dalam cache untuk lookup
+    return rs
+}
+
+// Lookup rules handler langsung dari database (tanpa cache)
+func loadRules(conn *Connection, path, call string) *ruleSet {
+    rs := &ruleSet{}
 
-    // Karena output proses ini akan masuk cache, pertama yang harus dipastikan adalah
-    // handler punya rules atau tidak: inisialisasi Key dan Map
+    // Pertama yang harus dipastikan adalah handler punya rules atau tidak
     stmt := `SELECT COUNT(*) T
        FROM st_handlers a
        JOIN st_handler_rules b ON (a.PID=b.PID AND a.HID=b.HID AND b.MID=?)
@@ -119,8 +136,9 @@ func (self *controller) handlerRules(conn *Connection, path, call string, method
     rchk := conn.Query(stmt, call, path)
     defer rchk.Close()
 
-    if rchk.Next() {    // jika handler tidak memiliki rules, Key dan Map nil
+    if rchk.Next() {    // jika handler tidak memiliki rules, Key nil
         if cnt := rchk.Int("T"); cnt > 0 {
+            // rule yang argument wajibnya tidak disyaratkan handler (pasti gagal)
             stmt = `SELECT c.SRC, f.TBL, f.COL
        FROM st_handlers a
        JOIN st_handler_rules b ON (b.PID=a.PID AND b.HID=a.HID AND b.MID=?)
@@ -129,17 +147,24 @@ func (self *controller) handlerRules(conn *Connection, path, call string, method
   LEFT JOIN st_handler_arguments e ON (e.PID=a.PID AND e.HID=a.HID AND e.TID=d.TID AND e.CID=d.CID AND e.MID=b.MID)
        JOIN st_metadata f ON (f.TID=d.TID AND f.CID=d.CID)
       WHERE a.SRC=? AND b.USED='1' AND c.USED='1' AND d.REQUIRED='1' AND (e.REQUIRED='0' OR e.CID IS NULL)`
+            rs.Ref = make(SMap)
             rows := conn.Query(stmt, call, path)
             for rows.Next() {
                 SRC := rows.String("SRC")
-                ruleRef[SRC] = Sprintf(" required %s (%s) IS NOT NULL", rows.String("TBL"), rows.String("COL"))
+                rs.Ref[SRC] = Sprintf(" required %s (%s) IS NOT NULL", rows.String("TBL"), rows.String("COL"))
             }
             rows.Close()
 
-            Key = make(List, 0)
-            Map = make(BMap)
+            rs.Key = make(List, 0)
+            rs.Map = make(BMap)
+            rs.Params = make(map[string]RuleParams)
+            rs.Errs = make(SMap)
 
-            stmt = `SELECT c.SRC, b.EXPR
+            cols := "NULL PARAMS"   // database belum dimigrasi, lihat handlerColumns
+            if handlerColumns(conn, "st_handler_rules", "PARAMS") {
+                cols = "b.PARAMS"
+            }
+            stmt = `SELECT c.SRC, b.EXPR, ` + cols + `
                FROM st_handlers a
                JOIN st_handler_rules b ON (a.PID=b.PID AND a.HID=b.HID AND b.MID=?)
                JOIN st_rules c ON (b.PID=c.PID AND b.RID=c.RID)
@@ -148,17 +173,22 @@ func (self *controller) handlerRules(conn *Connection, path, call string, method
             rows = conn.Query(stmt, call, path)
             for rows.Next() {
                 SRC := rows.String("SRC")
-                Key = append(Key, SRC)
-                Map[SRC] = false
+                rs.Key = append(rs.Key, SRC)
+                rs.Map[SRC] = false
                 if EXPR := rows.Int("EXPR"); EXPR == 1 {
-                    Map[SRC] = true
+                    rs.Map[SRC] = true
+                }
+                // PARAMS divalidasi sekali (sebelum masuk cache), error dilaporkan saat eksekusi
+                if p, e := ParseRuleParams(SRC, rows.String("PARAMS")); e == nil {
+                    rs.Params[SRC] = p
+                } else {
+                    rs.Errs[SRC] = e.Error()
                 }
             }
             rows.Close()
         }
     }
-    Cache.Set(ns, KeyBMap{Key: Key, Map: Map}) // simpan hasil dalam cache untuk lookup
-    return
+    return rs
 }
 
 // Membentuk struktur data Map (map[string]Argument) parameter sesuai tabel st_handler_arguments
@@ -178,9 +208,42 @@ func (self *controller) handlerArguments(conn *Connection, path, call string, me
         return
     }
 
+    list = loadArguments(conn, path, call)
+    Cache.Set(ns, list) // simpan hasil dalam cache untuk lookup
+    return
+}
+
+var (
+    // ** private **
+    // kolom yang sudah dipastikan ada, lihat handlerColumns
+    handlerSchema sync.Map
+)
+
+// Kolom tambahan st_handler_arguments/st_handler_rules (migrasi SYST versi 2, schema.go).
+// Database yang belum dimigrasi tetap dilayani dengan kolom baseline, hasil positif
+// disimpan agar pemeriksaan hanya dilakukan sampai kolom tersedia
+func handlerColumns(conn *Connection, table, columns string) bool {
+    k := table + ":" + columns
+    if _, b := handlerSchema.Load(k); b {
+        return true
+    }
+    if !migrationExists(conn, table, columns) {
+        return false
+    }
+    handlerSchema.Store(k, true)
+    return true
+}
+
+// Lookup arguments handler langsung dari database (tanpa cache)
+func loadArguments(conn *Connection, path, call string) (list map[string]Argument) {
     list = make(map[string]Argument)
 
-    stmt := `SELECT c.COL COLN, c.COLT, c.MINL, c.MAXL, c.MINV, c.MAXV, c.ENUM, b.COERCED, b.REQUIRED, b.LOGGED
+    cols := "NULL PATH, NULL FORMAT, 0 MINC, 0 MAXC"
+    if handlerColumns(conn, "st_handler_arguments", "PATH, FORMAT, MINC, MAXC") {
+        cols = "b.PATH, b.FORMAT, b.MINC, b.MAXC"
+    }
+    stmt := `SELECT c.COL COLN, c.COLT, c.MINL, c.MAXL, c.MINV, c.MAXV, c.ENUM, b.COERCED, b.REQUIRED, b.LOGGED,
+            ` + cols + `
        FROM st_handlers a
        JOIN st_handler_arguments b ON (a.PID=b.PID AND a.HID=b.HID AND b.MID=?)
        JOIN st_metadata c ON (b.TID=c.TID AND b.CID=c.CID)
@@ -193,22 +256,29 @@ func (self *controller) handlerArguments(conn *Connection, path, call string, me
         COERCED := rows.String("COERCED")
         ENUM := rows.String("ENUM")
         data := Argument{Required: false, Logged: false, Minl: -1, Maxl: -1, Minv: -1, Maxv: -1, Enum: "",}
-        data.Type = COERCED
+        data.Type = coerceType(COERCED) // pipeline: tipe data mengikuti coerce terakhir
         if i := rows.Int("REQUIRED"); i == 1 { data.Required = true }
         if i := rows.Int("LOGGED"); i == 1 { data.Logged = true }
         if i := rows.Int("MINL"); i != 0 { data.Minl = i }
         if i := rows.Int("MAXL"); i != 0 { data.Maxl = i }
         if i := rows.Int("MINV"); i != 0 { data.Minv = i }
         if i := rows.Int("MAXV"); i != 0 { data.Maxv = i }
+        if i := rows.Int("MINC"); i != 0 { data.Minc = i }
+        if i := rows.Int("MAXC"); i != 0 { data.Maxc = i }
         if ENUM != "" { data.Enum = ENUM }
+        data.Format = strings.ToUpper(rows.String("FORMAT"))
         if COERCED != "" {
             data.Coerce = COERCED
         } else {
             if COLT == "DATE" { data.Coerce = COLT }
         }
+        // PATH (optional) untuk constraint nested json, ex: items[].qty, customer.email.
+        // Kolom metadata tetap digunakan sebagai referensi tipe/panjang data
+        if PATH := rows.String("PATH"); PATH != "" {
+            COLN = PATH
+        }
         list[COLN] = data
     }
-    Cache.Set(ns, list) // simpan hasil dalam cache untuk lookup
     return
 }
 
@@ -217,41 +287,21 @@ func (self *controller) handlerArguments(conn *Connection, path, call string, me
 // data final parameter
 //
 // ex: client mengirim 123x45 untuk constraint digit, hasil akhir coerce: 12345
-func (self *controller) coerce(ctx *Context, enum, name, value string) error {
-    l := len(value)
-    switch enum {
-    case "NUMERIC":
-        if !is.Numeric(value) { ctx.Set(name, to.Numeric(value)) }
-    case "DIGIT":
-        if !is.Digit(value) { ctx.Set(name, to.Digit(value)) }
-    case "DATE":
-        if l < 8 || l > 10 {
-            return errors.New(Sprintf("expected (%s) date length 8|10. received %s", name, strconv.Itoa(l)))
-        }
-        exp := errors.New(Sprintf("expected (%s) date. received %s", name, value))
-        var d string
-        switch l {
-            case 10:
-                if is.Digit(value) { return exp }
-                _, _, _, _, d = to.DateSplit(value)
-            case 9,8:
-                if l == 8 && is.Digit(value) { // diijinkan untuk dikirim tanpa separator dalam format Ymd
-                    d = Sprintf("%s-%s-%s", value[:4], value[4:6], value[6:])
-                    if _, err := time.Parse("2006-01-02", d); err != nil {
-                        d = Sprintf("%s-%s-%s", value[4:], value[2:4], value[:2])
-                    }
-                } else {
-                    _, _, _, _, d = to.DateSplit(value) // asumsi m/d hanya 1 digit
-                }
-        }
-        if _, e := time.Parse("2006-01-02", d); e != nil { return e }
-        ctx.Set(name, d)
+//
+// Daftar coerce (termasuk yang di export modules) ada di coerce.go
+func (self *controller) coerce(ctx *Context, enum, name, value string) (string, error) {
+    v, e := Coerce(enum, name, value)
+    if e == nil && v != value {
+        ctx.Set(name, v)
     }
-    return nil
+    return v, e
 }
 
 // Validasi payload berdasarkan mapping constraint ke argument. Yang akan diproses hanya
 // parameter yang memiliki constraint (didefinisikan di st_handler_arguments)
+//
+// Return error berupa ValidationErrors (list error per field), pesan dibentuk sesuai
+// bahasa client (lihat Context.Language)
 func (self *controller) validate(args map[string]Argument, ctx *Context, log bool, USR string) (e error) {
     var m SMap
     if log {
@@ -267,68 +317,92 @@ func (self *controller) validate(args map[string]Argument, ctx *Context, log boo
             }
         }()
     }
-    z := make([]string, 0)
+    lang := ctx.Language()
+    z := make(ValidationErrors, 0)
+    var tree map[string]interface{}  // parameter json yang sudah di-decode (nested path)
     for n, r := range args {
+        if isPath(n) || r.Minc > 0 || r.Maxc > 0 { // nested json atau jumlah item array
+            if tree == nil { tree = make(map[string]interface{}) }
+            self.nested(ctx, &z, lang, tree, n, r)
+            continue
+        }
         if !ctx.Exists(n) {
             if r.Required { // rule 1: seperti apapun datanya, mandatory tidak boleh null
-                z = append(z, Sprintf("expected (%s) is not null", n))
+                z.add(lang, n, "required", "not null", "")
             }
             continue // hanya disyaratkan memenuhi contraint selama tidak null
         }
         v := ctx.Get(n)
-        if v == "" && r.Required {  // rule 2: argument mandatory, tidak null tapi juga tidak boleh kosong
-            z = append(z, Sprintf("expected (%s) is not empty", n))
-        }
         if log && r.Logged { m[n] = v }
+        self.check(ctx, &z, lang, n, r, v)
+    }
+    if len(z) > 0 {
+        e = z
+    }
+    return
+}
+
+// Constraint untuk satu field (tidak null). Dipisah dari validate agar aturan yang sama
+// bisa digunakan untuk sumber data selain parameter flat
+func (self *controller) check(ctx *Context, z *ValidationErrors, lang, n string, r Argument, v string) {
+    if v == "" && r.Required {  // rule 2: argument mandatory, tidak null tapi juga tidak boleh kosong
+        z.add(lang, n, "empty", "not empty", v)
+    }
 
-        // constraint awal paling sederhana: panjang minimal/maksimal data parameter
-        l := len(v)
-        if r.Minl > 0 && l < r.Minl {
-            z = append(z, Sprintf("expected (%s) min-length %s. received %s (%s)", n, strconv.Itoa(r.Minl), v, strconv.Itoa(l)))
+    // constraint awal paling sederhana: panjang minimal/maksimal data parameter
+    l := len(v)
+    if r.Minl > 0 && l < r.Minl {
+        z.add(lang, n, "minl", strconv.Itoa(r.Minl), v)
+    }
+    if r.Maxl > 0 && l > r.Maxl {
+        z.add(lang, n, "maxl", strconv.Itoa(r.Maxl), v)
+    }
+    if r.Format != "" && v != "" {
+        if f, b := formats[r.Format]; b && !f(v) {
+            z.add(lang, n, "format", r.Format, v)
         }
-        if r.Maxl > 0 && l > r.Maxl {
-            z = append(z, Sprintf("expected (%s) max-length %s. received %s (%s)", n, strconv.Itoa(r.Maxl), v, strconv.Itoa(l)))
+    }
+    // pipeline (ex: TRIM|DIGIT): tipe data mengikuti coerce terakhir, jadi yang dicek
+    // adalah hasil pipeline. Error coerce dilaporkan oleh rule coerce dibawah
+    t := v
+    if strings.Contains(r.Coerce, CoerceSeparator) {
+        if u, err := Coerce(r.Coerce, n, v); err == nil { t = u }
+    }
+    switch r.Type {
+    case "TINYINT","SMALLINT","MEDIUMINT","INT","BIGINT","DECIMAL","NUMERIC":
+        if !is.Numeric(t) {
+            z.add(lang, n, "type", r.Type, v)
         }
-        switch r.Type {
-        case "TINYINT","SMALLINT","MEDIUMINT","INT","BIGINT","DECIMAL","NUMERIC":
-            if !is.Numeric(v) {
-                z = append(z, Sprintf("expected (%s) type of %s. received %s", n, r.Type, v))
-            }
-        case "YEAR","DIGIT":
-            if !is.Digit(v) {
-                z = append(z, Sprintf("expected (%s) type of %s. received %s", n, r.Type, v))
-            }
-        case "ENUM":
-            if r.Enum != "" {
-                if strings.Index(r.Enum, v) == -1 {
-                    z = append(z, Sprintf("expected (%s) enum of %s. received %s", n, r.Enum, v))
-                }
-            }
+    case "YEAR","DIGIT":
+        if !is.Digit(t) {
+            z.add(lang, n, "type", r.Type, v)
         }
-        // constraint (integer/currency) range minimal dan maksimal
-        if r.Minv != -1 || r.Maxv != -1 {
-            u, err := strconv.Atoi(v)
-            if err != nil {
-                z = append(z, Sprintf("expected (%s) as int, strconv.Atoi(%s) error: %s", n, v, err.Error()))
-            }
-            if r.Minv >= 0 && u < r.Minv {
-                z = append(z, Sprintf("expected (%s) min %s. received %s", n, strconv.Itoa(r.Minv), v))
-            }
-            if r.Maxv >= 0 && l > r.Maxv {
-                z = append(z, Sprintf("expected (%s) max %s. received %s", n, strconv.Itoa(r.Maxv), v))
+    case "ENUM":
+        if r.Enum != "" {
+            if strings.Index(r.Enum, v) == -1 {
+                z.add(lang, n, "enum", r.Enum, v)
             }
         }
-        // coerce digit/numeric
-        if r.Coerce != "" {
-            if err := self.coerce(ctx, r.Coerce, n, v); err != nil {
-                z = append(z, Sprintf("coerce error: %s", err.Error()))
-            }
+    }
+    // constraint (integer/currency) range minimal dan maksimal
+    if r.Minv != -1 || r.Maxv != -1 {
+        u, err := strconv.Atoi(v)
+        if err != nil {
+            z.add(lang, n, "int", "int", v, err.Error())
+        }
+        if r.Minv >= 0 && u < r.Minv {
+            z.add(lang, n, "minv", strconv.Itoa(r.Minv), v)
+        }
+        if r.Maxv >= 0 && u > r.Maxv {  // sebelumnya membandingkan panjang data (l)
+            z.add(lang, n, "maxv", strconv.Itoa(r.Maxv), v)
         }
     }
-    if len(z) > 0 {
-        e = errors.New(strings.Join(z, "\r\n"))
+    // coerce digit/numeric
+    if r.Coerce != "" {
+        if _, err := self.coerce(ctx, r.Coerce, n, v); err != nil {
+            z.add(lang, n, "coerce", r.Coerce, v, err.Error())
+        }
     }
-    return
 }
 
 // Tujuan utamanya adalah mengenkapsulasi payload (url-encoded ataupun json) kedalam map
@@ -346,14 +420,19 @@ func (self *controller) NewContext(w http.ResponseWriter, r *http.Request, conn
     ctx.Values = url.Values{}
     ctx.Files = nil
     ctx.sesMap = nil
+    ctx.cookieAuth = false
+    ctx.sesAdmit = false
+    ctx.apiKey = nil
     ctx.sesCreate = false
     ctx.sesUpdate = false
+    ctx.sesDiff = nil
     ctx.json = nil
     ctx.call = ""
     ctx.method = doPATH
     ctx.sent = false
     ctx.exit = false
     ctx.code = StatusNoContent
+    ctx.trace = nil
     if e := ctx.sessionStart(conn); e != nil { return ctx, e }  // JWT
     for k, v := range r.URL.Query() {   // tidak dibedakan parameter dikirim via query atau body
         for _, j := range v {
@@ -379,7 +458,9 @@ func (self *controller) NewContext(w http.ResponseWriter, r *http.Request, conn
                 if len(b) > 0 {
                     var j interface{}
                     if err := json.Unmarshal(b, &j); err != nil { return ctx, err }
-                    argv := j.(GMap)
+                    // hasil json.Unmarshal ke interface{} adalah map[string]interface{},
+                    // bukan GMap (named type), assert ke GMap akan selalu panic
+                    argv, _ := j.(map[string]interface{})
                     for k, v := range argv {
                         switch v.(type) {
                         case string:
@@ -388,7 +469,7 @@ func (self *controller) NewContext(w http.ResponseWriter, r *http.Request, conn
                             ctx.Values.Add(k, fmt.Sprint(v))
                         case nil:
                             ctx.Values.Add(k, "")
-                        case GMap, []interface{}:
+                        case map[string]interface{}, []interface{}: // nested, divalidasi via path (validate.go)
                             val, err := json.Marshal(v)
                             if err == nil {
                                 ctx.Values.Add(k, string(val))
@@ -488,19 +569,26 @@ func (self *controller) sendError(w http.ResponseWriter, c int, e string) {
     w.Write([]byte(e))
 }
 
+// Error validasi dikirim sebagai json list error per field, kecuali format text lama
+// (pesan dipisah \r\n) diaktifkan melalui config VALIDATION_TEXT
+func (self *controller) sendPrecondition(w http.ResponseWriter, e error) {
+    if z, v := e.(ValidationErrors); v {
+        if text, _ := Cache.Bool("VALIDATION_TEXT"); !text {
+            if b, err := json.Marshal(GMap{"errors": z}); err == nil {
+                w.Header().Set("Content-Type", ContentTypeJSON)
+                self.sendError(w, StatusPreconditionFailed, string(b))
+                return
+            }
+        }
+    }
+    self.sendError(w, StatusPreconditionFailed, e.Error())
+}
+
 // *** request-response dimulai dari sini ***
 func (self *controller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-    if r.Method == doMap[dOPTIONS] {
-        w.Header().Set("Access-Control-Allow-Origin", "*")
-        w.Header().Set("Access-Control-Allow-Headers", "*")
-        w.Header().Set("Access-Control-Allow-Methods", "POST,PUT,GET,OPTIONS,DELETE")
-        w.Header().Set("Access-Control-Allow-Credentials", "true")
-        w.Header().Set("Access-Control-Expose-Headers", "Authorization")
+    if corsHeaders(w, r) {  // lihat csrf.go
         return
     }
-    if origin := r.Header.Get("Origin"); origin != "" {
-        w.Header().Set("Access-Control-Allow-Origin", origin)
-    }
     methodName := ""
     handler, v := servMap[r.URL.Path]
     if !v { // semua request yang tidak memiliki default handler *harus* GET dan akan ditangani fileHandler
@@ -551,7 +639,7 @@ func (self *controller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
     ctx, err := self.NewContext(w, r, conn, methodName)
     defer self.Recover(w, ctx) // oleh karena itu, defer setelahnya
     if err != nil { // sebelum return kalau ada error
-        self.sendError(w, StatusPreconditionFailed, err.Error())
+        self.sendPrecondition(w, err)
         return
     }
 
@@ -576,6 +664,26 @@ func (self *controller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
         }
     }
 
+    // ** Check scope API key **
+    if e := apiKeyCheck(ctx, r.URL.Path); e != nil {
+        self.sendError(w, StatusForbidden, e.Error())
+        return
+    }
+
+    // ** Check impersonation **
+    if e := impersonationCheck(conn, ctx, handler, r.URL.Path); e != nil {
+        self.sendError(w, StatusForbidden, e.Error())
+        return
+    }
+
+    // ** Check CSRF **
+    //
+    // Hanya untuk request yang diautentikasi dengan cookie (lihat csrf.go)
+    if e := csrfCheck(ctx, r.URL.Path); e != nil {
+        self.sendError(w, StatusForbidden, e.Error())
+        return
+    }
+
     // ** Check Role dan ACL **
     //
     // Proses (sebenarnya) jika sudah dipastikan bahwa handler yang akan dipanggil adalah
@@ -601,6 +709,7 @@ func (self *controller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
             // Group/Role yang dikirim harus ada dalam list user groups
             GID := g.(map[string]string)
             if _, v := GID[ctx.GID]; !v {
+                gidViolation(ctx)   // anomali jika berulang (lihat lockout.go)
                 self.sendError(w, StatusBadRequest, "InvalidGIDException: " + ctx.GID)
                 return
             }
@@ -632,25 +741,15 @@ func (self *controller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
     // Jika sebuah handler memiliki rules, akan dieksekusi tepat sebelum method handler
     // dieksekusi. Rule harus memastikan bahwa return error akan dikembalikan jika (dan hanya jika)
     // output tidak sesuai dengan expected-return
-    if rkey, rmap := self.handlerRules(conn, r.URL.Path, ctx.call, ctx.method); rkey != nil && rmap != nil {
-        for ridx, _ := range rkey {
-            name := rkey[ridx]  // rkey[ridx] untuk memastikan lookup pada ruleMap sesuai urutan rule di database
-            if rref, v := ruleRef[name]; v {
-                self.sendError(w, StatusFailedDependency, name + rref)
-                return
-            }
-            robj, v := ruleMap[name]
-            if !v {
-                self.sendError(w, StatusFailedDependency, "RuleNotFoundException: " + name)
-                return
-            }
-            // rule yang sama bisa memiliki expected-return berbeda tergantung kebutuhan
-            // diposisi mana rule dipanggil dalam workflow/proses
-            EXPR, _ := rmap[name]
-            if e := robj.Execute(conn, ctx, EXPR); e != nil {
-                self.sendError(w, StatusExpectationFailed, e.Error())
-                return
-            }
+    //
+    // Setiap rule yang dieksekusi dicatat dalam trace (lihat trace.go)
+    if rs := self.handlerRules(conn, r.URL.Path, ctx.call, ctx.method); rs != nil && len(rs.Key) > 0 {
+        z, code, e := runRules(conn, ctx, rs)
+        ctx.trace = z
+        sendTrace(w, ctx)
+        if e != nil {
+            self.sendError(w, code, e.Error())
+            return
         }
     }
 
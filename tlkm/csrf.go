@@ -0,0 +1,167 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// CSRF dan CORS
+//
+// Token CSRF dibentuk bersama session (attribute CSRF) dan dikirim ke browser melalui
+// cookie SAFCSRF yang bisa dibaca javascript (double-submit). Request POST/PUT/DELETE
+// yang diautentikasi dengan cookie SAFSID wajib mengirim token yang sama melalui header
+// X-CSRF-Token (atau parameter _csrf untuk form html), token dibandingkan dengan token di
+// session (synchronizer). Client API (Authorization: Bearer) tidak diperiksa karena
+// header Authorization tidak pernah dikirim otomatis oleh browser
+//
+// Session yang dibentuk sebelum mekanisme ini mendapat token pada request GET berikutnya
+//
+// Handler yang dikecualikan (misal webhook yang menerima POST dari luar) didaftarkan
+// dengan ExportCSRFExempt atau config CSRF_EXEMPT (path handler dipisahkan koma). Config
+// CSRF false menonaktifkan pemeriksaan
+//
+// CORS hanya diizinkan untuk origin yang terdaftar di config CORS_ORIGINS (dipisahkan
+// koma). Tanpa config, header CORS tidak dikirim (same-origin)
+package tlkm
+
+import (
+    "crypto/rand"
+    "crypto/subtle"
+    "encoding/base64"
+    "errors"
+    "net/http"
+    "strings"
+)
+
+const (
+    CSRFHeader = "X-CSRF-Token"
+    CSRFCookie = "SAFCSRF"
+
+    // ** private **
+    csrfParam   = "_csrf"
+    csrfSession = "CSRF"
+)
+
+var (
+    // ** private **
+    csrfExempt = make(map[string]bool)
+)
+
+// Kecualikan handler dari pemeriksaan CSRF
+func ExportCSRFExempt(object Service) {
+    csrfExempt[typeIndex(object)] = true
+}
+
+// Token CSRF session yang aktif (kosong jika belum ada session)
+func (self *Context) CSRFToken() string {
+    v, _ := self.sesMap[csrfSession].(string)
+    return v
+}
+
+// Bentuk token baru dan kirim cookie SAFCSRF. Dipanggil pada saat session dibentuk
+func (self *Context) csrfIssue() {
+    b := make([]byte, 32)
+    rand.Read(b)
+    token := base64.RawURLEncoding.EncodeToString(b)
+    self.sesMap[csrfSession] = token
+    http.SetCookie(self.Response, &http.Cookie{Name: CSRFCookie, Value: token, Path: FileSeparator,
+        Secure: self.Request.TLS != nil, SameSite: http.SameSiteStrictMode})
+}
+
+func csrfEnabled() bool {
+    if v, b := Cache.Bool("CSRF"); b {
+        return v
+    }
+    return true
+}
+
+func csrfExempted(IDX string) bool {
+    if csrfExempt[IDX] {
+        return true
+    }
+    v, _ := Cache.String("CSRF_EXEMPT")
+    for _, i := range strings.Split(v, ",") {
+        if strings.TrimSpace(i) == IDX {
+            return true
+        }
+    }
+    return false
+}
+
+// Pemeriksaan CSRF request yang diautentikasi dengan cookie
+func csrfCheck(ctx *Context, IDX string) error {
+    if !ctx.cookieAuth || !csrfEnabled() {
+        return nil
+    }
+    if _, b := ctx.SessionUser(); !b {
+        return nil
+    }
+    switch ctx.method {
+    case doPOST, doPUT, doDELETE:
+    default:
+        if ctx.CSRFToken() == "" {   // session lama, token diberikan saat GET
+            ctx.sessionTrack(csrfSession)
+            ctx.csrfIssue()
+        }
+        return nil
+    }
+    if csrfExempted(IDX) {
+        return nil
+    }
+    expected := ctx.CSRFToken()
+    token := ctx.Request.Header.Get(CSRFHeader)
+    if token == "" {
+        token = ctx.Get(csrfParam)
+    }
+    if expected == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+        return errors.New("CSRFException: invalid or missing " + CSRFHeader)
+    }
+    return nil
+}
+
+// Origin terdaftar di CORS_ORIGINS
+func corsAllowed(origin string) bool {
+    if origin == "" {
+        return false
+    }
+    v, _ := Cache.String("CORS_ORIGINS")
+    for _, i := range strings.Split(v, ",") {
+        if i = strings.TrimSpace(i); i != "" && strings.EqualFold(strings.TrimSuffix(i, "/"), origin) {
+            return true
+        }
+    }
+    return false
+}
+
+// Header CORS untuk origin yang diizinkan. Return true jika request adalah preflight
+// (sudah dijawab)
+func corsHeaders(w http.ResponseWriter, r *http.Request) bool {
+    origin := r.Header.Get("Origin")
+    w.Header().Add("Vary", "Origin")
+    allowed := corsAllowed(origin)
+    if allowed {
+        w.Header().Set("Access-Control-Allow-Origin", origin)
+        w.Header().Set("Access-Control-Allow-Credentials", "true")
+        w.Header().Set("Access-Control-Expose-Headers", "Authorization, " + RuleTraceHeader)
+    }
+    if r.Method != doMap[dOPTIONS] {
+        return false
+    }
+    if allowed {
+        headers := r.Header.Get("Access-Control-Request-Headers")
+        if headers == "" {
+            headers = "Authorization, Content-Type, GID, " + CSRFHeader
+        }
+        w.Header().Set("Access-Control-Allow-Headers", headers)
+        w.Header().Set("Access-Control-Allow-Methods", "POST,PUT,GET,OPTIONS,DELETE")
+        w.Header().Set("Access-Control-Max-Age", "600")
+    }
+    w.WriteHeader(StatusNoContent)
+    return true
+}
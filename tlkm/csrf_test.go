@@ -0,0 +1,92 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "testing"
+)
+
+func TestCSRF(t *testing.T) {
+    ctx := testContext("", url.Values{})
+    ctx.sesMap = GMap{"USR": "admin"}
+    ctx.cookieAuth = true
+    ctx.method = doGET
+    if e := csrfCheck(ctx, "/test/api/handler"); e != nil || ctx.CSRFToken() == "" {
+        t.Fatalf("expected token issued on GET. received %v", e)
+    }
+    token := ctx.CSRFToken()
+    if c := ctx.Response.(*httptest.ResponseRecorder).Result().Cookies(); len(c) != 1 || c[0].Value != token || c[0].HttpOnly {
+        t.Errorf("expected readable cookie %s. received %v", CSRFCookie, c)
+    }
+    ctx.method = doPOST
+    if e := csrfCheck(ctx, "/test/api/handler"); e == nil {
+        t.Error("expected CSRFException without token")
+    }
+    ctx.Request.Header.Set(CSRFHeader, "x" + token)
+    if e := csrfCheck(ctx, "/test/api/handler"); e == nil {
+        t.Error("expected CSRFException with wrong token")
+    }
+    ctx.Request.Header.Set(CSRFHeader, token)
+    if e := csrfCheck(ctx, "/test/api/handler"); e != nil {
+        t.Error(e)
+    }
+    ctx.Request.Header.Del(CSRFHeader)
+    ctx.Values.Set(csrfParam, token)
+    if e := csrfCheck(ctx, "/test/api/handler"); e != nil {
+        t.Error(e)
+    }
+    ctx.Values.Del(csrfParam)
+
+    // Bearer client tidak diperiksa
+    ctx.cookieAuth = false
+    if e := csrfCheck(ctx, "/test/api/handler"); e != nil {
+        t.Error(e)
+    }
+    ctx.cookieAuth = true
+
+    Cache.Set("CSRF_EXEMPT", "/test/api/webhook, /test/api/handler", 0)
+    defer Cache.Delete("CSRF_EXEMPT")
+    if e := csrfCheck(ctx, "/test/api/handler"); e != nil {
+        t.Error(e)
+    }
+}
+
+func TestCORS(t *testing.T) {
+    Cache.Set("CORS_ORIGINS", "https://app.example.com/, https://admin.example.com", 0)
+    defer Cache.Delete("CORS_ORIGINS")
+    for origin, allowed := range map[string]bool{"https://app.example.com": true, "https://evil.example.com": false, "": false} {
+        r := httptest.NewRequest(http.MethodOptions, "http://127.0.0.1/test/api/handler", nil)
+        r.Header.Set("Origin", origin)
+        r.Header.Set("Access-Control-Request-Headers", "Content-Type, " + CSRFHeader)
+        w := httptest.NewRecorder()
+        if !corsHeaders(w, r) {
+            t.Fatal("expected preflight handled")
+        }
+        if v := w.Header().Get("Access-Control-Allow-Origin"); (v == origin && v != "") != allowed {
+            t.Errorf("%q: expected allowed=%v. received %q", origin, allowed, v)
+        }
+        if allowed && w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+            t.Errorf("%q: expected credentials", origin)
+        }
+    }
+    r := httptest.NewRequest(http.MethodGet, "http://127.0.0.1/test/api/handler", nil)
+    r.Header.Set("Origin", "https://evil.example.com")
+    w := httptest.NewRecorder()
+    if corsHeaders(w, r) || w.Header().Get("Access-Control-Allow-Origin") != "" {
+        t.Error("expected no CORS header for unlisted origin")
+    }
+}
@@ -0,0 +1,329 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Deklarasi argument dan rule dari kode (code-first). Handler yang mengimplementasikan
+// ServiceDeclaration akan disinkronisasi ke st_handler_arguments dan st_handler_rules
+// pada saat startup, sama seperti st_handlers disinkronisasi dari servMap
+//
+// Setiap baris hasil sinkronisasi menyimpan CHECKSUM dari value yang ditulis framework.
+// Jika value di database berbeda dengan CHECKSUM, artinya baris sudah diedit admin,
+// dan perlakuannya tergantung config DECLARE_POLICY:
+//   ADMIN  (default) perubahan admin dipertahankan, deklarasi kode diabaikan
+//   CODE   deklarasi kode selalu menimpa perubahan admin
+package tlkm
+
+import (
+    "encoding/json"
+    "path"
+    "reflect"
+    "strconv"
+    "strings"
+    "github.com/telkomdit/goframework/to"
+)
+
+type (
+    // Interface (optional) untuk handler. Declare dipanggil 1x pada saat Export
+    //
+    // contoh:
+    //
+    //      func (self *Order) Declare(d *Declaration) {
+    //          d.Argument("POST", "tr_orders", "CUSTOMER_ID").Required()
+    //          d.Argument("POST", "tr_order_items", "QTY").Path("items[].qty").Required()
+    //          d.Rule("POST", new(CreditLimit), true)
+    //      }
+    ServiceDeclaration interface {
+        Declare(*Declaration)
+    }
+
+    // Kumpulan deklarasi satu handler
+    Declaration struct {
+        args    []*ArgumentDeclaration
+        rule    []*RuleDeclaration
+    }
+
+    // Representasi satu baris st_handler_arguments. Kolom (TBL, COL) harus ada
+    // di st_metadata sebagai referensi tipe dan panjang data
+    ArgumentDeclaration struct {
+        MID, TBL, COL       string
+        PATH, COERCED       string
+        FORMAT              string
+        REQUIRED, LOGGED    bool
+        MINC, MAXC          int
+    }
+
+    // Representasi satu baris st_handler_rules, urutan (SEQ) sesuai urutan deklarasi
+    RuleDeclaration struct {
+        MID     string
+        Rule    ServiceRule
+        EXPR    bool
+        PARAMS  string  // json, lihat ruleparam.go
+    }
+)
+
+const (
+    DeclarePolicyAdmin = "ADMIN"
+    DeclarePolicyCode  = "CODE"
+)
+
+var (
+    // ** private **
+    // deklarasi per handler (IDX)
+    declMap = make(map[string]*Declaration)
+)
+
+// Deklarasi argument untuk method (GET/POST/PUT/DELETE/...) handler
+func (self *Declaration) Argument(method, table, column string) *ArgumentDeclaration {
+    a := &ArgumentDeclaration{MID: strings.ToUpper(method), TBL: table, COL: column}
+    self.args = append(self.args, a)
+    return a
+}
+
+// Deklarasi rule untuk method handler dengan expected-return EXPR. Rule harus di
+// export (ExportRule) dan berada dalam package yang sama dengan handler
+func (self *Declaration) Rule(method string, rule ServiceRule, expr bool) *RuleDeclaration {
+    r := &RuleDeclaration{MID: strings.ToUpper(method), Rule: rule, EXPR: expr}
+    self.rule = append(self.rule, r)
+    return r
+}
+
+// Parameter binding rule (st_handler_rules.PARAMS), divalidasi terhadap schema rule saat sinkronisasi
+func (self *RuleDeclaration) Params(params GMap) *RuleDeclaration {
+    if b, e := json.Marshal(params); e == nil {
+        self.PARAMS = string(b)
+    }
+    return self
+}
+
+func (self *ArgumentDeclaration) Required() *ArgumentDeclaration {
+    self.REQUIRED = true
+    return self
+}
+
+func (self *ArgumentDeclaration) Logged() *ArgumentDeclaration {
+    self.LOGGED = true
+    return self
+}
+
+// Pipeline coerce, ex: TRIM|UPPER
+func (self *ArgumentDeclaration) Coerce(coerce string) *ArgumentDeclaration {
+    self.COERCED = coerce
+    return self
+}
+
+// Path nested json, ex: items[].qty
+func (self *ArgumentDeclaration) Path(path string) *ArgumentDeclaration {
+    self.PATH = path
+    return self
+}
+
+func (self *ArgumentDeclaration) Format(format string) *ArgumentDeclaration {
+    self.FORMAT = strings.ToUpper(format)
+    return self
+}
+
+// Jumlah item minimal/maksimal untuk json array, 0 berarti tanpa batas
+func (self *ArgumentDeclaration) Items(min, max int) *ArgumentDeclaration {
+    self.MINC = min
+    self.MAXC = max
+    return self
+}
+
+// bool -> CHAR(1) sesuai konvensi kolom flag
+func declFlag(b bool) string {
+    if b { return "1" }
+    return "0"
+}
+
+// Checksum value yang ditulis framework, untuk mendeteksi baris yang sudah diedit admin
+func (self *ArgumentDeclaration) checksum() string {
+    return declChecksum(self.COERCED, declFlag(self.REQUIRED), declFlag(self.LOGGED), self.FORMAT, strconv.Itoa(self.MINC), strconv.Itoa(self.MAXC))
+}
+
+func declChecksum(v ...string) string {
+    return to.MD5(strings.Join(v, "|"))
+}
+
+// Dipanggil oleh Export, deklarasi hanya dibaca 1x
+func declare(IDX string, object Service) {
+    if d, v := object.(ServiceDeclaration); v {
+        decl := &Declaration{}
+        d.Declare(decl)
+        declMap[IDX] = decl
+    }
+}
+
+// IDX object (sama seperti getIndexes) tanpa inject properties
+func typeIndex(object interface{}) string {
+    typ := reflect.TypeOf(object)
+    if typ.Kind() == reflect.Ptr {
+        typ = typ.Elem()
+    }
+    return path.Join(FileSeparator, typ.PkgPath(), typ.Name())
+}
+
+func declarePolicy() string {
+    if v, b := Cache.String("DECLARE_POLICY"); b && strings.ToUpper(v) == DeclarePolicyCode {
+        return DeclarePolicyCode
+    }
+    return DeclarePolicyAdmin
+}
+
+// Sinkronisasi deklarasi ke st_handler_arguments dan st_handler_rules. Dipanggil
+// setelah updateHandlers (st_handlers sudah terbentuk). Handler yang tidak (lagi)
+// mengimplementasikan ServiceDeclaration diperlakukan sebagai deklarasi kosong jika
+// masih memiliki baris milik framework dari deklarasi sebelumnya, baris tersebut ikut
+// dihapus. Handler tanpa deklarasi dan tanpa baris framework tidak diproses
+//
+// Sinkronisasi dilewati (WARN) jika kolom deklarasi belum ada (migrasi SYST versi 2)
+func updateDeclarations(conn *Connection, now string) {
+    logger := &Logger{logNs: "SYST", logLv: loglv}
+    if !handlerColumns(conn, "st_handler_arguments", "PATH, FORMAT, MINC, MAXC, CHECKSUM, UPDATED_AT") ||
+        !handlerColumns(conn, "st_handler_rules", "PARAMS, CHECKSUM, UPDATED_AT") {
+        if len(declMap) > 0 {
+            logger.Log(WARN, "DeclarationSchemaException: st_handler_arguments/st_handler_rules belum dimigrasi (SYST versi 2), sinkronisasi deklarasi dilewati")
+        }
+        return
+    }
+    policy := declarePolicy()
+    for IDX, decl := range declMap {
+        updateDeclaration(conn, logger, policy, IDX, decl, now)
+    }
+    owned := make(BMap)
+    rows := conn.Query(`SELECT PID, HID FROM st_handler_arguments WHERE CHECKSUM IS NOT NULL
+                  UNION SELECT PID, HID FROM st_handler_rules WHERE CHECKSUM IS NOT NULL`)
+    for rows.Next() {
+        owned[rows.String("PID") + "|" + rows.String("HID")] = true
+    }
+    rows.Close()
+    if len(owned) == 0 { return }
+    for IDX := range servKey {
+        if _, v := declMap[IDX]; v { continue }
+        if PID, HID := ShortURL(IDX); owned[PID + "|" + HID] {
+            updateDeclaration(conn, logger, policy, IDX, &Declaration{}, now)
+        }
+    }
+}
+
+// Sinkronisasi deklarasi satu handler
+func updateDeclaration(conn *Connection, logger *Logger, policy, IDX string, decl *Declaration, now string) {
+    PID, HID := ShortURL(IDX)
+    seen := make(BMap)
+    for _, a := range decl.args {
+        rows := conn.Query("SELECT TID, CID FROM st_metadata WHERE TBL=? AND COL=?", a.TBL, a.COL)
+        if !rows.Next() {
+            rows.Close()
+            logger.Log(WARN, Sprintf("MetadataNotFoundException: %s.%s (%s)", a.TBL, a.COL, IDX))
+            continue
+        }
+        TID, CID := rows.String("TID"), rows.String("CID")
+        rows.Close()
+        seen[a.MID + "|" + TID + "|" + CID + "|" + a.PATH] = true
+        sum := a.checksum()
+        rows = conn.Query(`SELECT COERCED, REQUIRED, LOGGED, FORMAT, MINC, MAXC, CHECKSUM
+                             FROM st_handler_arguments
+                            WHERE PID=? AND HID=? AND MID=? AND TID=? AND CID=? AND COALESCE(PATH, '')=?`, PID, HID, a.MID, TID, CID, a.PATH)
+        if rows.Next() {
+            cur := declChecksum(rows.String("COERCED"), declFlag(rows.Bool("REQUIRED")), declFlag(rows.Bool("LOGGED")), rows.String("FORMAT"), strconv.Itoa(rows.Int("MINC")), strconv.Itoa(rows.Int("MAXC")))
+            edited := cur != rows.String("CHECKSUM")
+            rows.Close()
+            if cur == sum { continue }  // tidak ada perubahan
+            if edited && policy == DeclarePolicyAdmin {
+                logger.Log(INFO, Sprintf("DeclarationConflict: %s %s %s.%s kept (admin)", IDX, a.MID, a.TBL, a.COL))
+                continue
+            }
+            conn.Exec(`UPDATE st_handler_arguments SET COERCED=?, REQUIRED=?, LOGGED=?, FORMAT=?, MINC=?, MAXC=?, CHECKSUM=?, UPDATED_AT=?
+                        WHERE PID=? AND HID=? AND MID=? AND TID=? AND CID=? AND COALESCE(PATH, '')=?`,
+                a.COERCED, declFlag(a.REQUIRED), declFlag(a.LOGGED), a.FORMAT, a.MINC, a.MAXC, sum, now, PID, HID, a.MID, TID, CID, a.PATH)
+            continue
+        }
+        rows.Close()
+        var path interface{}
+        if a.PATH != "" { path = a.PATH }
+        conn.Exec(`INSERT INTO st_handler_arguments(PID, HID, MID, TID, CID, PATH, COERCED, REQUIRED, LOGGED, FORMAT, MINC, MAXC, CHECKSUM, UPDATED_AT)
+                   VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+            PID, HID, a.MID, TID, CID, path, a.COERCED, declFlag(a.REQUIRED), declFlag(a.LOGGED), a.FORMAT, a.MINC, a.MAXC, sum, now)
+    }
+
+    // deklarasi yang dihapus dari kode: hapus baris milik framework yang belum diedit admin
+    rows := conn.Query(`SELECT MID, TID, CID, PATH, COERCED, REQUIRED, LOGGED, FORMAT, MINC, MAXC, CHECKSUM
+                          FROM st_handler_arguments WHERE PID=? AND HID=? AND CHECKSUM IS NOT NULL`, PID, HID)
+    drop := make([]SList, 0)
+    for rows.Next() {
+        if seen[rows.String("MID") + "|" + rows.String("TID") + "|" + rows.String("CID") + "|" + rows.String("PATH")] { continue }
+        cur := declChecksum(rows.String("COERCED"), declFlag(rows.Bool("REQUIRED")), declFlag(rows.Bool("LOGGED")), rows.String("FORMAT"), strconv.Itoa(rows.Int("MINC")), strconv.Itoa(rows.Int("MAXC")))
+        if cur == rows.String("CHECKSUM") || policy == DeclarePolicyCode {
+            drop = append(drop, SList{rows.String("MID"), rows.String("TID"), rows.String("CID"), rows.String("PATH")})
+        }
+    }
+    rows.Close()
+    for _, j := range drop {
+        conn.Exec("DELETE FROM st_handler_arguments WHERE PID=? AND HID=? AND MID=? AND TID=? AND CID=? AND COALESCE(PATH, '')=?", PID, HID, j[0], j[1], j[2], j[3])
+    }
+
+    updateRuleDeclarations(conn, logger, policy, IDX, PID, HID, decl, now)
+}
+
+// Bagian rules dari updateDeclarations. SEQ mengikuti urutan deklarasi
+func updateRuleDeclarations(conn *Connection, logger *Logger, policy, IDX, PID, HID string, decl *Declaration, now string) {
+    seen := make(BMap)
+    seq := make(IMap)
+    for _, r := range decl.rule {
+        SRC := typeIndex(r.Rule)
+        RPID, RID := ShortURL(SRC)
+        if _, v := ruleMap[SRC]; !v {
+            logger.Log(WARN, Sprintf("RuleNotFoundException: %s (%s)", SRC, IDX))
+            continue
+        }
+        if RPID != PID {    // st_handler_rules join st_rules berdasarkan PID handler
+            logger.Log(WARN, Sprintf("RulePackageException: %s (%s)", SRC, IDX))
+            continue
+        }
+        if _, e := ParseRuleParams(SRC, r.PARAMS); e != nil {
+            logger.Log(WARN, Sprintf("%s: %s (%s)", e.Error(), SRC, IDX))
+            continue
+        }
+        seq[r.MID] += 1
+        seen[r.MID + "|" + RID] = true
+        sum := declChecksum(strconv.Itoa(seq[r.MID]), declFlag(r.EXPR), r.PARAMS)
+        rows := conn.Query("SELECT SEQ, EXPR, PARAMS, CHECKSUM FROM st_handler_rules WHERE PID=? AND HID=? AND MID=? AND RID=?", PID, HID, r.MID, RID)
+        if rows.Next() {
+            cur := declChecksum(strconv.Itoa(rows.Int("SEQ")), declFlag(rows.Bool("EXPR")), rows.String("PARAMS"))
+            edited := cur != rows.String("CHECKSUM")
+            rows.Close()
+            if cur == sum { continue }
+            if edited && policy == DeclarePolicyAdmin {
+                logger.Log(INFO, Sprintf("DeclarationConflict: %s %s %s kept (admin)", IDX, r.MID, SRC))
+                continue
+            }
+            conn.Exec("UPDATE st_handler_rules SET SEQ=?, EXPR=?, PARAMS=?, CHECKSUM=?, UPDATED_AT=? WHERE PID=? AND HID=? AND MID=? AND RID=?",
+                seq[r.MID], declFlag(r.EXPR), r.PARAMS, sum, now, PID, HID, r.MID, RID)
+            continue
+        }
+        rows.Close()
+        conn.Exec("INSERT INTO st_handler_rules(PID, HID, MID, RID, SEQ, EXPR, PARAMS, USED, CHECKSUM, UPDATED_AT) VALUES (?, ?, ?, ?, ?, ?, ?, '1', ?, ?)",
+            PID, HID, r.MID, RID, seq[r.MID], declFlag(r.EXPR), r.PARAMS, sum, now)
+    }
+    rows := conn.Query("SELECT MID, RID, SEQ, EXPR, PARAMS, CHECKSUM FROM st_handler_rules WHERE PID=? AND HID=? AND CHECKSUM IS NOT NULL", PID, HID)
+    drop := make([]SList, 0)
+    for rows.Next() {
+        if seen[rows.String("MID") + "|" + rows.String("RID")] { continue }
+        cur := declChecksum(strconv.Itoa(rows.Int("SEQ")), declFlag(rows.Bool("EXPR")), rows.String("PARAMS"))
+        if cur == rows.String("CHECKSUM") || policy == DeclarePolicyCode {
+            drop = append(drop, SList{rows.String("MID"), rows.String("RID")})
+        }
+    }
+    rows.Close()
+    for _, j := range drop {
+        conn.Exec("DELETE FROM st_handler_rules WHERE PID=? AND HID=? AND MID=? AND RID=?", PID, HID, j[0], j[1])
+    }
+}
@@ -0,0 +1,163 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "testing"
+)
+
+type (
+    testDeclared struct {}
+    testDeclaredRule struct {}
+)
+
+func (self *testDeclared) Declare(d *Declaration) {
+    d.Argument("post", "tr_orders", "CUSTOMER_ID").Required().Coerce("TRIM|UPPER")
+    d.Argument("POST", "tr_order_items", "QTY").Path("items[].qty").Items(1, 10).Format("digit")
+    d.Rule("post", new(testDeclaredRule), true)
+}
+
+func (self *testDeclared) GET(conn *Connection, ctx *Context)    {}
+func (self *testDeclared) POST(conn *Connection, ctx *Context)   {}
+func (self *testDeclared) PUT(conn *Connection, ctx *Context)    {}
+func (self *testDeclared) DELETE(conn *Connection, ctx *Context) {}
+func (self *testDeclared) GRID(conn *Connection, ctx *Context)   {}
+func (self *testDeclared) HTML(conn *Connection, ctx *Context)   {}
+func (self *testDeclared) JSON(conn *Connection, ctx *Context)   {}
+func (self *testDeclared) TEXT(conn *Connection, ctx *Context)   {}
+func (self *testDeclared) FILE(conn *Connection, ctx *Context)   {}
+
+func (self *testDeclaredRule) Execute(conn *Connection, ctx *Context, expr bool) error { return nil }
+
+func TestDeclaration(t *testing.T) {
+    IDX := typeIndex(new(testDeclared))
+    declare(IDX, new(testDeclared))
+    d, v := declMap[IDX]
+    if !v {
+        t.Fatal("declaration not registered")
+    }
+    if len(d.args) != 2 || len(d.rule) != 1 {
+        t.Fatalf("unexpected declaration %d args, %d rules", len(d.args), len(d.rule))
+    }
+    a := d.args[1]
+    if a.MID != "POST" || a.PATH != "items[].qty" || a.FORMAT != "DIGIT" || a.MINC != 1 || a.MAXC != 10 {
+        t.Errorf("unexpected argument %+v", *a)
+    }
+    if d.rule[0].MID != "POST" || !d.rule[0].EXPR {
+        t.Errorf("unexpected rule %+v", *d.rule[0])
+    }
+    if typeIndex(d.rule[0].Rule) != typeIndex(new(testDeclaredRule)) {
+        t.Error("unexpected rule index")
+    }
+    if d.args[0].checksum() == d.args[1].checksum() {
+        t.Error("checksum collision")
+    }
+}
+
+func TestDeclarePolicy(t *testing.T) {
+    if p := declarePolicy(); p != DeclarePolicyAdmin {
+        t.Errorf("expected %s. received %s", DeclarePolicyAdmin, p)
+    }
+    Cache.Set("DECLARE_POLICY", "code")
+    defer Cache.Delete("DECLARE_POLICY")
+    if p := declarePolicy(); p != DeclarePolicyCode {
+        t.Errorf("expected %s. received %s", DeclarePolicyCode, p)
+    }
+}
+
+// Sinkronisasi deklarasi terhadap database test (TLKM_TEST_DSN)
+func TestUpdateDeclarations(t *testing.T) {
+    conn := testDatabase(t)
+    IDX := typeIndex(new(testDeclared))
+    PID, HID := ShortURL(IDX)
+    RULE := typeIndex(new(testDeclaredRule))
+    count := func(stmt string, args ...interface{}) int {
+        rows := conn.Query(stmt, args...)
+        defer rows.Close()
+        rows.Next()
+        return rows.Int("N")
+    }
+    coerced := func() string {
+        rows := conn.Query("SELECT COERCED FROM st_handler_arguments WHERE PID=? AND HID=? AND TID='TT_DECL' AND CID=1", PID, HID)
+        defer rows.Close()
+        rows.Next()
+        return rows.String("COERCED")
+    }
+    cleanup := func() {
+        conn.Exec("DELETE FROM st_handler_arguments WHERE PID=? AND HID=?", PID, HID)
+        conn.Exec("DELETE FROM st_handler_rules WHERE PID=? AND HID=?", PID, HID)
+        conn.Exec("DELETE FROM st_metadata WHERE TID='TT_DECL'")
+    }
+    cleanup()
+    defer cleanup()
+    conn.Exec("INSERT INTO st_metadata(TID, CID, TBL, COL, COLT) VALUES ('TT_DECL', 1, 'tt_declare', 'CUSTOMER_ID', 'VARCHAR')")
+    conn.Exec("INSERT INTO st_metadata(TID, CID, TBL, COL, COLT) VALUES ('TT_DECL', 2, 'tt_declare', 'QTY', 'INT')")
+
+    prevDecl, prevKey := declMap, servKey
+    declMap, servKey = make(map[string]*Declaration), map[string]serviceKey{IDX: serviceKey{}}
+    ruleMap[RULE] = new(testDeclaredRule)
+    defer func() {
+        declMap, servKey = prevDecl, prevKey
+        delete(ruleMap, RULE)
+    }()
+    declaration := func(coerce string) {
+        d := &Declaration{}
+        d.Argument("POST", "tt_declare", "CUSTOMER_ID").Required().Coerce(coerce)
+        d.Argument("POST", "tt_declare", "QTY").Path("items[].qty").Items(1, 10)
+        d.Rule("POST", new(testDeclaredRule), true)
+        declMap[IDX] = d
+    }
+
+    // sinkronisasi awal, sinkronisasi ulang tanpa perubahan tidak menulis apa pun
+    declaration("TRIM")
+    updateDeclarations(conn, "2020-01-01 00:00:00")
+    args := "SELECT COUNT(*) N FROM st_handler_arguments WHERE PID=? AND HID=? AND CHECKSUM IS NOT NULL"
+    rules := "SELECT COUNT(*) N FROM st_handler_rules WHERE PID=? AND HID=? AND CHECKSUM IS NOT NULL"
+    if n, m := count(args, PID, HID), count(rules, PID, HID); n != 2 || m != 1 {
+        t.Fatalf("expected 2 arguments and 1 rule. received %d %d", n, m)
+    }
+    updateDeclarations(conn, "2021-01-01 00:00:00")
+    if n := count("SELECT COUNT(*) N FROM st_handler_arguments WHERE PID=? AND HID=? AND UPDATED_AT>?", PID, HID, "2020-06-01 00:00:00"); n != 0 {
+        t.Errorf("unchanged checksum must not update, %d rows updated", n)
+    }
+
+    // perubahan kode tanpa edit admin selalu diterapkan
+    declaration("TRIM|UPPER")
+    updateDeclarations(conn, "2021-01-01 00:00:00")
+    if v := coerced(); v != declMap[IDX].args[0].COERCED {
+        t.Errorf("expected code declaration. received %s", v)
+    }
+
+    // edit admin: ADMIN mempertahankan, CODE menimpa
+    conn.Exec("UPDATE st_handler_arguments SET COERCED='LOWER' WHERE PID=? AND HID=? AND TID='TT_DECL' AND CID=1", PID, HID)
+    declaration("UPPER")
+    updateDeclarations(conn, "2022-01-01 00:00:00")
+    if v := coerced(); v != "LOWER" {
+        t.Errorf("ADMIN policy must keep admin edit. received %s", v)
+    }
+    Cache.Set("DECLARE_POLICY", DeclarePolicyCode)
+    defer Cache.Delete("DECLARE_POLICY")
+    updateDeclarations(conn, "2022-01-01 00:00:00")
+    if v := coerced(); v != declMap[IDX].args[0].COERCED {
+        t.Errorf("CODE policy must overwrite admin edit. received %s", v)
+    }
+
+    // handler tidak lagi mengimplementasikan ServiceDeclaration: baris framework dihapus
+    Cache.Delete("DECLARE_POLICY")
+    delete(declMap, IDX)
+    updateDeclarations(conn, "2023-01-01 00:00:00")
+    if n, m := count(args, PID, HID), count(rules, PID, HID); n != 0 || m != 0 {
+        t.Errorf("expected stale declarations removed. received %d %d", n, m)
+    }
+}
@@ -0,0 +1,196 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Query internal framework (sessions, logs, handlers, cron, play, config) ditulis dengan
+// sintaks umum, bagian yang berbeda antar database diambil dari fungsi dialect dibawah
+// berdasarkan driver koneksi:
+//
+//      insertHead/insertTail   INSERT IGNORE (MySQL), INSERT OR IGNORE (SQLite),
+//                              ON CONFLICT DO NOTHING (PostgreSQL)
+//      now/today               CURRENT_TIMESTAMP/CURRENT_DATE, SQLite memakai localtime
+//      deleteOrphans           DELETE JOIN (MySQL), NOT EXISTS untuk yang lain
+//      truncate                SQLite tidak mengenal TRUNCATE
+//      lockTable/unlockTables  hanya MySQL
+//      limit                   LIMIT offset,n (MySQL), LIMIT n OFFSET offset
+//      quote                   escape literal string untuk BulkBuffer
+//      ddl/addColumn           tipe kolom dan ALTER TABLE untuk migrasi (lihat migrate.go)
+//
+// SQLITE ditujukan untuk development dan test (embedded file). Framework tidak meng-import
+// driver apapun, aplikasi (atau file test) yang meng-import:
+//
+//      import _ "github.com/mattn/go-sqlite3"   // nama driver: sqlite3
+//      import _ "modernc.org/sqlite"            // nama driver: sqlite
+//
+//      tlkm.SQL.Register("sqlite3.syst", "file:go.db?_busy_timeout=5000")
+//
+// ":memory:" membuat database terpisah untuk setiap koneksi pool, gunakan
+// "file::memory:?cache=shared" jika memang diperlukan
+package tlkm
+
+import (
+    "strconv"
+    "strings"
+    "github.com/telkomdit/goframework/buffer"
+    "github.com/telkomdit/goframework/to"
+)
+
+// Driver koneksi, untuk query yang perlu dibedakan per database oleh aplikasi
+func (self *Connection) Driver() Driver {
+    return self.driver
+}
+
+// TODOC
+func (self *sqlx) insertHead(driver Driver, ignore bool) string {
+    if ignore {
+        switch driver {
+            case MYSQL:
+                return "INSERT IGNORE INTO "
+            case SQLITE:
+                return "INSERT OR IGNORE INTO "
+        }
+    }
+    return "INSERT INTO "
+}
+
+// TODOC
+func (self *sqlx) insertTail(driver Driver, ignore bool) string {
+    if ignore && driver == PGSQL {
+        return " ON CONFLICT DO NOTHING"
+    }
+    return ""
+}
+
+// Waktu sekarang sisi database. SQLite CURRENT_TIMESTAMP dalam UTC
+func (self *sqlx) now(driver Driver) string {
+    if driver == SQLITE {
+        return "datetime('now','localtime')"
+    }
+    return "CURRENT_TIMESTAMP"
+}
+
+// TODOC
+func (self *sqlx) today(driver Driver) string {
+    switch driver {
+        case SQLITE:
+            return "date('now','localtime')"
+        case MSSQL:
+            return "CAST(GETDATE() AS DATE)"
+    }
+    return "CURRENT_DATE"
+}
+
+// Hapus baris child yang tidak punya parent berdasarkan keys
+func (self *sqlx) deleteOrphans(driver Driver, child, parent string, keys List) string {
+    stmt := buffer.Get()
+    defer stmt.Close()
+    if driver == MYSQL {
+        stmt.WS("DELETE A FROM ").WS(child).WS(" A LEFT JOIN ").WS(parent).WS(" B ON (")
+        for i, k := range keys {
+            if i > 0 { stmt.WS(" AND ") }
+            stmt.WS("B.").WS(k).WS("=A.").WS(k)
+        }
+        stmt.WS(") WHERE B.").WS(keys[0]).WS(" IS NULL")
+        return stmt.String()
+    }
+    stmt.WS("DELETE FROM ").WS(child).WS(" WHERE NOT EXISTS (SELECT 1 FROM ").WS(parent).WS(" B WHERE ")
+    for i, k := range keys {
+        if i > 0 { stmt.WS(" AND ") }
+        stmt.WS("B.").WS(k).WRune('=').WS(child).WRune('.').WS(k)
+    }
+    stmt.WRune(')')
+    return stmt.String()
+}
+
+// TODOC
+func (self *sqlx) truncate(driver Driver, name string) string {
+    if driver == SQLITE {
+        return "DELETE FROM " + name
+    }
+    return "TRUNCATE TABLE " + name
+}
+
+// String kosong jika database tidak membutuhkan explicit lock
+func (self *sqlx) lockTable(driver Driver, name string) string {
+    if driver == MYSQL {
+        return "LOCK TABLE " + name + " WRITE"
+    }
+    return ""
+}
+
+// TODOC
+func (self *sqlx) unlockTables(driver Driver) string {
+    if driver == MYSQL {
+        return "UNLOCK TABLES"
+    }
+    return ""
+}
+
+// TODOC
+func (self *sqlx) limit(driver Driver, stmt *buffer.ByteBuffer, limit, offset int) {
+    stmt.WS("LIMIT ")
+    if driver == MYSQL {
+        if offset > 0 {
+            stmt.WS(strconv.Itoa(offset)).WRune(',')   // MySQL: LIMIT offset, limit
+        }
+        stmt.WS(strconv.Itoa(limit))
+        return
+    }
+    stmt.WS(strconv.Itoa(limit))
+    if offset > 0 {
+        stmt.WS(" OFFSET ").WS(strconv.Itoa(offset))
+    }
+}
+
+// Backslash escape hanya dikenal MySQL, database lain menggandakan single quote
+func (self *sqlx) quote(driver Driver, v string) string {
+    if driver == MYSQL {
+        return to.Escape(v)
+    }
+    return strings.ReplaceAll(v, "'", "''")
+}
+
+// Placeholder tipe kolom DDL migrasi. Identifier dalam backtick (kata kunci MySQL,
+// mis. `UNSIGNED`) hanya dipertahankan untuk MySQL
+var ddlTypes = map[Driver]*strings.Replacer{
+    MYSQL: strings.NewReplacer("{SERIAL}", "BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY", "{TEXT}", "LONGTEXT", "{DATETIME}", "DATETIME", "{BIGINT}", "BIGINT"),
+    SQLITE: strings.NewReplacer("{SERIAL}", "INTEGER PRIMARY KEY AUTOINCREMENT", "{TEXT}", "TEXT", "{DATETIME}", "DATETIME", "{BIGINT}", "BIGINT", "`", ""),
+    PGSQL: strings.NewReplacer("{SERIAL}", "BIGSERIAL PRIMARY KEY", "{TEXT}", "TEXT", "{DATETIME}", "TIMESTAMP", "{BIGINT}", "BIGINT", "`", ""),
+    MSSQL: strings.NewReplacer("{SERIAL}", "BIGINT IDENTITY(1,1) PRIMARY KEY", "{TEXT}", "NVARCHAR(MAX)", "{DATETIME}", "DATETIME2", "{BIGINT}", "BIGINT", "`", ""),
+    ORACL: strings.NewReplacer("{SERIAL}", "NUMBER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY", "{TEXT}", "CLOB", "{DATETIME}", "TIMESTAMP", "{BIGINT}", "NUMBER(19)", "`", ""),
+}
+
+// TODOC
+func (self *sqlx) ddl(driver Driver, stmt string) string {
+    return ddlTypes[driver].Replace(stmt)
+}
+
+// DDL bisa di-rollback dalam transaksi. MySQL dan Oracle melakukan implicit commit
+// pada setiap DDL
+func (self *sqlx) transactionalDDL(driver Driver) bool {
+    switch driver {
+        case PGSQL, SQLITE, MSSQL:
+            return true
+    }
+    return false
+}
+
+// TODOC
+func (self *sqlx) addColumn(driver Driver, table, column, def string) string {
+    switch driver {
+        case MSSQL:
+            return "ALTER TABLE " + table + " ADD " + column + " " + def
+        case ORACL:
+            return "ALTER TABLE " + table + " ADD (" + column + " " + def + ")"
+    }
+    return "ALTER TABLE " + table + " ADD COLUMN " + column + " " + def
+}
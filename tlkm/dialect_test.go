@@ -0,0 +1,97 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "os"
+    "strings"
+    "testing"
+)
+
+// Datasource test dari env TLKM_TEST_DSN (format: driver.name=dsn), contoh untuk SQLite:
+//
+//      TLKM_TEST_DSN="sqlite3.syst=file:go.db?_busy_timeout=5000" go test ./tlkm
+//
+// driver sqlite3 (cgo) sudah di-import oleh sqlite_test.go
+func testDataSource() (string, string) {
+    if v := strings.SplitN(os.Getenv("TLKM_TEST_DSN"), "=", 2); len(v) == 2 {
+        return v[0], v[1]
+    }
+    return "mysql.syst", "root:test@tcp(127.0.0.1:3306)/go"
+}
+
+// Koneksi datasource test dengan schema SYST terbaru (Migrate). Test di-skip jika
+// datasource tidak di-register
+func testDatabase(t *testing.T) *Connection {
+    if !SQL.Exists(PackageSystem) {
+        t.Skip("datasource " + PackageSystem + " tidak tersedia")
+    }
+    conn := SQL.Default()
+    if _, e := Migrate(conn, false, "SYST"); e != nil {
+        t.Fatal(e)
+    }
+    return conn
+}
+
+func TestDialectInsertIgnore(t *testing.T) {
+    expected := map[Driver]string{
+        MYSQL: "INSERT IGNORE INTO st_logs (MSG) VALUES (?)",
+        SQLITE: "INSERT OR IGNORE INTO st_logs (MSG) VALUES (?)",
+        PGSQL: "INSERT INTO st_logs (MSG) VALUES ($1) ON CONFLICT DO NOTHING",
+    }
+    for driver, v := range expected {
+        if stmt, argv := SQL.InsertIgnoreQuery(driver, "st_logs", &GMap{"MSG": "test"}); stmt != v || len(argv) != 1 {
+            t.Errorf("expected %s. received %s %v", v, stmt, argv)
+        }
+        bulk := SQL.BulkInsertIgnore("st_logs", List{"MSG"}, driver)
+        bulk.Add(GList{"it's"})
+        if s := bulk.String(); !strings.HasPrefix(s, v[:strings.Index(v, " (")]) {
+            t.Errorf("unexpected bulk %s", s)
+        }
+        bulk.Close()
+    }
+    bulk := SQL.BulkInsert("st_logs", List{"MSG"}, SQLITE)
+    defer bulk.Close()
+    if s := bulk.Add(GList{"it's"}).String(); s != "INSERT INTO st_logs(MSG) VALUES ('it''s')" {
+        t.Errorf("unexpected %s", s)
+    }
+}
+
+func TestDialectRawInsert(t *testing.T) {
+    stmt, argv := SQL.InsertQuery(SQLITE, "st_logs", &GMap{"@LOGT": SQL.now(SQLITE)})
+    if stmt != "INSERT INTO st_logs (LOGT) VALUES (datetime('now','localtime'))" || len(argv) != 0 {
+        t.Errorf("unexpected %s %v", stmt, argv)
+    }
+}
+
+func TestDialectOrphans(t *testing.T) {
+    keys := List{"PID", "HID"}
+    if s := SQL.deleteOrphans(MYSQL, "st_handler_rules", "st_handlers", keys); s != "DELETE A FROM st_handler_rules A LEFT JOIN st_handlers B ON (B.PID=A.PID AND B.HID=A.HID) WHERE B.PID IS NULL" {
+        t.Errorf("unexpected %s", s)
+    }
+    if s := SQL.deleteOrphans(SQLITE, "st_handler_rules", "st_handlers", keys); s != "DELETE FROM st_handler_rules WHERE NOT EXISTS (SELECT 1 FROM st_handlers B WHERE B.PID=st_handler_rules.PID AND B.HID=st_handler_rules.HID)" {
+        t.Errorf("unexpected %s", s)
+    }
+}
+
+func TestDialectLimit(t *testing.T) {
+    for driver, v := range map[Driver]string{MYSQL: "LIMIT 20,10", SQLITE: "LIMIT 10 OFFSET 20"} {
+        qb := SQL.Builder(driver)
+        qb.Select("*").From("st_logs").Limit(10, 20)
+        if s, _ := qb.SelectQuery(); !strings.HasSuffix(s, v) {
+            t.Errorf("expected %s. received %s", v, s)
+        }
+        qb.Close()
+    }
+}
@@ -22,15 +22,13 @@ package tlkm
 
 import (
     "context"
-    "encoding/json"
     "github.com/judwhite/go-svc"
     "github.com/telkomdit/goframework/buffer"
     "github.com/telkomdit/goframework/to"
     "net/http"
-    "os"
     "path"
     "reflect"
-    "strconv"
+    "strings"
     "sync"
     "time"
     "unicode"
@@ -143,8 +141,7 @@ type (
     //          ExportSessionListener(new(mySessionListener))
     //      }
     //
-    // Kedepan mungkin perlu enhancement agar session listener bisa subscribe/bind
-    // method OnUpdate hanya untuk perubahan pada package tertentu, kalo diperlukan
+    // Subscribe package/key tertentu, OnDestroy dan OnExpire lihat sessionevent.go
     SessionCallback interface {
         OnCreate(*Connection, *Context)
         OnUpdate(*Connection, *Context)
@@ -282,12 +279,9 @@ var (
     documentRoot    string
 
     // ** private **
-    // secret key bisa ditaruh di environment variable (akan diakses via os.Getenv)
-    // atau langsung didefinisikan di source-code
-    //
-    // variable ini digunakan http context pada saat membentuk token
-    jwtSecretKey = "JWT_SECRET"              // env variable SALT
-    jwtSecret    = []byte("JWT_SECRET_TEXT") // jika SALT ingin ditanam di kode
+    // secret HMAC diambil dari environment variable (akan diakses via os.Getenv),
+    // key RSA/EC dari JWT_KEY_FILE. Lihat token.go
+    jwtSecretKey = "JWT_SECRET"
 
     StatusText = http.StatusText
 
@@ -307,7 +301,6 @@ var (
     servKey = make(map[string]serviceKey)
     ruleMap = make(map[string]ServiceRule)
     sessMap = make(map[string]SessionCallback)
-    ruleRef = make(map[string]string)
     configs = make(map[string]GMap)
 
     // ** private **
@@ -327,10 +320,7 @@ var (
 // Semua proses berkaitan dengan framework yang harus dilakukan sebelum http server
 // dijalankan akan dipanggil dalam fungsi ini
 func init() {
-    secret := os.Getenv(jwtSecretKey) // jika (dan hanya jika) JWT_SECRET ditemukan di environment variable, maka
-    if secret != "" {
-        jwtSecret = []byte(secret) // kita gunakan yang ada di ENV
-    }
+    jwtInit()   // key set JWT dari environment variable
     for k, v := range doMap {
         doKey[v] = k
     }
@@ -465,6 +455,7 @@ func Export(object Service, secure ...bool) (PID, HID string) {
         property.SEC = secure[0] // kecuali didefinisikan sebaliknya (ex: API login/sso)
     }
     servRef[IDX] = property
+    declare(IDX, object)
 
     return
 }
@@ -472,9 +463,13 @@ func Export(object Service, secure ...bool) (PID, HID string) {
 // Mapping rule object ke ruleMap
 //
 // @params ServiceRule      service object
-func ExportRule(object ServiceRule) (PID, HID string) {
+// @params RuleParam        schema parameter binding (optional, lihat ruleparam.go)
+func ExportRule(object ServiceRule, schema ...RuleParam) (PID, HID string) {
     IDX, PID, HID := getIndexes(object)
     ruleMap[IDX] = object
+    if len(schema) > 0 {
+        ruleSchema[IDX] = schema
+    }
     return
 }
 
@@ -634,8 +629,8 @@ func updateHandlers(conn *Connection, now string) {
     }
 
     conn.Exec("DELETE FROM st_handlers WHERE UPDATED_AT<?", now)
-    conn.Exec("DELETE A FROM st_handler_arguments A LEFT JOIN st_handlers B ON (B.PID=A.PID AND B.HID=A.HID) WHERE B.PID IS NULL")
-    conn.Exec("DELETE A FROM st_handler_rules A LEFT JOIN st_handlers B ON (B.PID=A.PID AND B.HID=A.HID) WHERE B.PID IS NULL")
+    conn.Exec(SQL.deleteOrphans(conn.driver, "st_handler_arguments", "st_handlers", List{"PID", "HID"}))
+    conn.Exec(SQL.deleteOrphans(conn.driver, "st_handler_rules", "st_handlers", List{"PID", "HID"}))
 
     chk = "SELECT * FROM st_rules WHERE PID=? AND RID=?"
     sql = "INSERT INTO st_rules(PID, RID, SRC, CREATED_AT, UPDATED_AT) VALUES (?, ?, ?, ?, ?)"
@@ -650,8 +645,9 @@ func updateHandlers(conn *Connection, now string) {
         rows.Close()
     }
 
-    conn.Exec("DELETE FROM st_rules WHERE UPDATED_AT<?", now)
-    conn.Exec("DELETE A FROM st_rule_arguments A LEFT JOIN st_rules B ON (B.PID=A.PID AND B.RID=A.RID) WHERE B.PID IS NULL")
+    // play rule tidak ada di ruleMap, didaftarkan melalui RegisterPlayRule (lihat playrule.go)
+    conn.Exec("DELETE FROM st_rules WHERE UPDATED_AT<? AND SRC NOT LIKE ?", now, PlayRulePrefix + "%")
+    conn.Exec(SQL.deleteOrphans(conn.driver, "st_rule_arguments", "st_rules", List{"PID", "RID"}))
 }
 
 // Proses yang sama seperti handlers dilakukan untuk crons
@@ -712,28 +708,24 @@ func updateCron(conn *Connection, now string) {
     }()
 }
 
-// Kondisi dimana server harus restart, sessions yang terbentuk (dan masih valid)
-// akan di push ulang ke cache
+// Kondisi dimana server harus restart, sessions yang expired dipindahkan ke archive
+// dan sessions yang (masih) valid akan di push ulang ke cache
 func updateSession(conn *Connection, now time.Time) {
-    ssot, _ := Cache.Int("SSO_SSN_EXP")
-    ssof := strconv.FormatInt(now.Add(time.Duration(-ssot)*time.Minute).Unix(), 10)
-    rows := conn.Query("SELECT SID, MSGT FROM st_sessions WHERE UTS>? FOR UPDATE", ssof)
-    defer rows.Close()
-    ssox, _ := Cache.Int("SSO_SSN_EXP")
-    for rows.Next() {
-        SID := rows.String("SID")
-        var m GMap
-        if e := json.Unmarshal(rows.Bytes("MSGT"), &m); e == nil {
-            g := remap(m, "GID", "ACL")
-            Cache.Set(SID, g, time.Duration(ssox))
-        }
+    sessionPurge(conn)
+    if s, v := sessionStore.(*sqlSessionStore); v {
+        s.warm(conn)
     }
 }
 
+// memastikan session (yang dimanage framework) sesuai tipe data yang diinginkan
+// untuk menghindari assert dalam setiap request/response
+//
+// beberapa kasus, hasil assert json.Unmarshal SMap menjadi GMap
 func remap(sesMap GMap, index ...string) GMap {
     for _, j := range index {
         if k, v := sesMap[j]; v {
-            g := k.(map[string]interface{})
+            g, b := k.(map[string]interface{})
+            if !b { continue }  // sudah map[string]string
             m := make(map[string]string)
             for o, p := range g {
                 m[o] = p.(string)
@@ -745,7 +737,8 @@ func remap(sesMap GMap, index ...string) GMap {
 }
 
 func LoadConfig(conn *Connection) {
-    rows := conn.Query("SELECT PID,CFT,CFK,CFV FROM st_configs WHERE CHK='1' AND BEGDA<=CURRENT_DATE AND BEGDA IS NOT NULL AND (ENDDA>=CURRENT_DATE OR ENDDA IS NULL)")
+    today := SQL.today(conn.driver)
+    rows := conn.Query("SELECT PID,CFT,CFK,CFV FROM st_configs WHERE CHK='1' AND BEGDA<=" + today + " AND BEGDA IS NOT NULL AND (ENDDA>=" + today + " OR ENDDA IS NULL)")
     defer rows.Close()
     for rows.Next() {
         PID := rows.String("PID")
@@ -790,8 +783,11 @@ func (self *win32svc) setup() {
     now := time.Now()
     str := now.Format("2006-01-02 15:04:05")
     updateHandlers(conn, str)
+    updateDeclarations(conn, str)
     updateCron(conn, str)
     updateSession(conn, now)
+    watchHandlers()
+    watchSessions()
 }
 
 func (self *win32svc) Start() error {
@@ -804,6 +800,14 @@ func (self *win32svc) Stop() error {
     if chant != nil {
         close(chant)
     }
+    if chinv != nil {
+        close(chinv)
+        chinv = nil
+    }
+    if chssn != nil {
+        close(chssn)
+        chssn = nil
+    }
     if er := self.srv.Shutdown(context.TODO()); er != nil {
         panic(er)
     }
@@ -833,10 +837,25 @@ func Win32Service(object Service, httpSwagger http.HandlerFunc, https bool, www
         return service
     }
     conn := SQL.Default()
+    migrateOnStart(conn)    // migrasi SYST (MIGRATE_ON_START), lihat migrate.go
     LoadConfig(conn)
     conn.Close()
+    if v, _ := Cache.String("SESSION_STORE"); strings.ToUpper(v) == "FILE" {
+        dir, _ := Cache.String("SESSION_DIR")
+        if dir == "" { dir = "sessions" }
+        ExportSessionStore(&FileSessionStore{Dir: dir})
+    }
+    if v, _ := Cache.String("LDAP_URL"); v != "" {
+        ExportAuthenticator("LDAP", LDAPFromConfig())
+    }
+    if v, _ := Cache.Bool("AUTH_LOCAL"); v {
+        ExportAuthenticator("LOCAL", new(LocalAuthenticator))
+    }
     port, _ := Cache.String("HTTPD_PORT")
     loglv, _ = Cache.Int("LOG_LEVEL")
+    if jwtEphemeral {
+        (&Logger{logNs: "SYST", logLv: loglv}).Log(WARN, "JWT_SECRET/JWT_KEY_FILE tidak ditemukan, token JWT tidak valid setelah restart")
+    }
     _, PID, HID := getIndexes(object)
     servMap[FileSeparator] = object
     servRef[FileSeparator] = ServiceProperty{SEC: false, PID: PID, HID: HID}
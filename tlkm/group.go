@@ -0,0 +1,252 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Hierarki group: satu group bisa extend group lain (st_group_inherits) sehingga
+// permission yang sama tidak perlu diduplikasi di banyak group
+//
+// ACL handler per group ada di st_group_handlers (GID, PID, HID, ACL). ACL adalah
+// string per method sesuai urutan httpMethod (POST, GET, PUT, DELETE): '1' allow,
+// '0' deny, karakter lain (misal '-') tidak diatur. ACL efektif group adalah gabungan
+// ACL group tersebut dan semua parent-nya, deny mengalahkan allow
+//
+// Jika config GROUP_INHERIT true, GID/ACL session dibentuk oleh framework pada saat
+// login (Context.SessionLogin):
+//
+//      GID     group user (st_group_users), dipilih client melalui parameter GID
+//      GIDX    group efektif (GID dan semua parent), digunakan oleh HasRole
+//      ACL     GID+PID+HID => ACL efektif, digunakan oleh ServeHTTP dan HasHandler
+//
+// Tanpa config tersebut, modul tetap bisa menggunakan EffectiveACL dari OnCreate
+//
+// Cycle ditolak oleh SetGroupParents. Cycle yang ada di database (diubah langsung)
+// menyebabkan login user group tersebut tanpa group (fail closed)
+//
+// Tabel:
+//
+//      st_group_inherits   (GID, PARENT)
+package tlkm
+
+import (
+    "errors"
+    "strings"
+    "time"
+)
+
+type (
+    // Query permission efektif, di embed oleh handler modul (secure)
+    //
+    //  GET     GID=<gid>[&PID=<pid>&HID=<hid>]     ACL efektif dan parent group
+    GroupPermissionService struct {
+        NotAllowedService
+    }
+
+    // ** private **
+    groupGraph struct {
+        parents map[string][]string
+        acl     map[string]map[string]string   // GID => PID+HID => ACL
+    }
+)
+
+// Reload hierarki dan ACL group pada request berikutnya
+func InvalidateGroups() {
+    Cache.Delete("group:graph")
+}
+
+func groupInherit() bool {
+    v, _ := Cache.Bool("GROUP_INHERIT")
+    return v
+}
+
+// Hierarki dari cache (GROUP_CACHE detik, default 60) atau database
+func groupLoad(conn *Connection) *groupGraph {
+    if v, b := Cache.Get("group:graph"); b {
+        if g, b := v.(*groupGraph); b {
+            return g
+        }
+    }
+    g := &groupGraph{parents: make(map[string][]string), acl: make(map[string]map[string]string)}
+    rows := conn.Query("SELECT GID, PARENT FROM st_group_inherits")
+    for rows.Next() {
+        GID := rows.String("GID")
+        g.parents[GID] = append(g.parents[GID], rows.String("PARENT"))
+    }
+    rows.Close()
+    rows = conn.Query("SELECT GID, PID, HID, ACL FROM st_group_handlers")
+    for rows.Next() {
+        GID := rows.String("GID")
+        if g.acl[GID] == nil {
+            g.acl[GID] = make(map[string]string)
+        }
+        g.acl[GID][rows.String("PID") + rows.String("HID")] = rows.String("ACL")
+    }
+    rows.Close()
+    exp, b := Cache.Int("GROUP_CACHE")
+    if !b {
+        exp = 60
+    }
+    Cache.Set("group:graph", g, time.Duration(exp))
+    return g
+}
+
+// GID dan semua parent (depth-first, GID pertama). Error jika ada cycle
+func (self *groupGraph) ancestors(GID string) (List, error) {
+    z := List{}
+    state := make(map[string]int)   // 1: sedang dikunjungi, 2: selesai
+    var visit func(string, List) error
+    visit = func(g string, trail List) error {
+        switch state[g] {
+        case 1:
+            return errors.New("GroupCycleException: " + strings.Join(append(trail, g), " > "))
+        case 2:
+            return nil
+        }
+        state[g] = 1
+        z = append(z, g)
+        for _, p := range self.parents[g] {
+            if e := visit(p, append(trail, g)); e != nil {
+                return e
+            }
+        }
+        state[g] = 2
+        return nil
+    }
+    return z, visit(GID, List{})
+}
+
+// Gabungan dua ACL, deny mengalahkan allow
+func aclMerge(a, b string) string {
+    if len(b) > len(a) {
+        a, b = b, a
+    }
+    z := []byte(a)
+    for i := 0; i < len(b); i++ {
+        switch {
+        case z[i] == '0' || b[i] == '0':
+            z[i] = '0'
+        case b[i] == '1':
+            z[i] = '1'
+        }
+    }
+    return string(z)
+}
+
+// PID+HID => ACL efektif satu group
+func (self *groupGraph) effective(GID string) (map[string]string, List, error) {
+    list, e := self.ancestors(GID)
+    if e != nil {
+        return nil, nil, e
+    }
+    z := make(map[string]string)
+    for _, g := range list {
+        for k, v := range self.acl[g] {
+            z[k] = aclMerge(z[k], v)
+        }
+    }
+    return z, list, nil
+}
+
+// ACL efektif (GID+PID+HID => ACL) dan group efektif untuk groups user
+func EffectiveACL(conn *Connection, GID map[string]string) (ACL map[string]string, GIDX map[string]string, e error) {
+    g := groupLoad(conn)
+    ACL = make(map[string]string)
+    GIDX = make(map[string]string)
+    for k := range GID {
+        m, list, e := g.effective(k)
+        if e != nil {
+            return nil, nil, e
+        }
+        for i, j := range m {
+            ACL[k + i] = j
+        }
+        for _, i := range list {
+            GIDX[i] = i
+        }
+    }
+    return
+}
+
+// ACL efektif group GID untuk handler PID/HID (kosong jika tidak diatur)
+func EffectivePermission(conn *Connection, GID, PID, HID string) (string, error) {
+    m, _, e := groupLoad(conn).effective(GID)
+    if e != nil {
+        return "", e
+    }
+    return m[PID + HID], nil
+}
+
+// Replace parent group GID. Ditolak jika menyebabkan cycle
+func SetGroupParents(conn *Connection, GID string, parents List) (e error) {
+    InvalidateGroups()
+    g := &groupGraph{parents: make(map[string][]string)}
+    for k, v := range groupLoad(conn).parents {   // graph di cache tidak diubah
+        g.parents[k] = v
+    }
+    g.parents[GID] = parents
+    if _, e = g.ancestors(GID); e != nil {
+        return
+    }
+    tx := conn.Begin()
+    defer func() {
+        if e != nil {
+            tx.Rollback()
+        }
+        InvalidateGroups()
+    }()
+    if _, e = tx.Exec("DELETE FROM st_group_inherits WHERE GID=?", GID); e != nil {
+        return
+    }
+    for _, i := range parents {
+        if _, e = tx.Exec("INSERT INTO st_group_inherits(GID,PARENT) VALUES (?,?)", GID, i); e != nil {
+            return
+        }
+    }
+    return tx.Commit()
+}
+
+// Bentuk GIDX/ACL session sesuai hierarki (config GROUP_INHERIT)
+func (self *Context) sessionGroups(conn *Connection, GID map[string]string) {
+    if !groupInherit() || GID == nil {
+        return
+    }
+    if conn == nil {
+        if _, b := Cache.Get("group:graph"); !b {
+            conn = SQL.Default()
+            defer conn.Close()
+        }
+    }
+    ACL, GIDX, e := EffectiveACL(conn, GID)
+    if e != nil {
+        if ctrl != nil {
+            ctrl.Log(ERROR, e.Error())
+        }
+        self.SessionSet("GID", map[string]string{})   // fail closed
+        self.SessionUnset("ACL")
+        return
+    }
+    self.SessionSet("GIDX", GIDX).SessionSet("ACL", ACL)
+}
+
+func (self *GroupPermissionService) GET(conn *Connection, ctx *Context) {
+    GID := ctx.Get("GID")
+    g := groupLoad(conn)
+    m, list, e := g.effective(GID)
+    if e != nil {
+        ctx.Code(StatusConflict).Warn(e.Error())
+        return
+    }
+    if ctx.Exists("PID") {
+        ctx.Data(GMap{"GID": GID, "ACL": m[ctx.Get("PID") + ctx.Get("HID")], "groups": list})
+        return
+    }
+    ctx.Data(GMap{"GID": GID, "ACL": m, "groups": list})
+}
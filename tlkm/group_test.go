@@ -0,0 +1,86 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "net/url"
+    "testing"
+)
+
+func testGroupGraph() *groupGraph {
+    return &groupGraph{
+        parents: map[string][]string{"OPS": {"STAFF"}, "LEAD": {"OPS", "AUDIT"}, "STAFF": {"BASE"}},
+        acl: map[string]map[string]string{
+            "BASE":  {"HRREP": "0100", "HREMP": "-1--"},
+            "STAFF": {"HREMP": "1110"},
+            "OPS":   {"FIINV": "1111"},
+            "AUDIT": {"FIINV": "-1-0"},
+        },
+    }
+}
+
+func TestGroupInheritance(t *testing.T) {
+    g := testGroupGraph()
+    if list, e := g.ancestors("LEAD"); e != nil || len(list) != 5 || list[0] != "LEAD" {
+        t.Errorf("unexpected ancestors %v %v", list, e)
+    }
+    m, _, e := g.effective("LEAD")
+    if e != nil {
+        t.Fatal(e)
+    }
+    expected := map[string]string{"HRREP": "0100", "HREMP": "1110", "FIINV": "1110"}
+    for k, v := range expected {
+        if m[k] != v {
+            t.Errorf("%s: expected %s. received %s", k, v, m[k])
+        }
+    }
+
+    g.parents["BASE"] = []string{"LEAD"}
+    if _, e := g.ancestors("OPS"); e == nil {
+        t.Error("expected GroupCycleException")
+    } else {
+        t.Log(e)
+    }
+    if _, e := g.ancestors("AUDIT"); e != nil {
+        t.Errorf("group outside cycle must resolve: %v", e)
+    }
+}
+
+func TestSessionGroups(t *testing.T) {
+    Cache.Set("group:graph", testGroupGraph(), 60)
+    Cache.Set("GROUP_INHERIT", true)
+    defer InvalidateGroups()
+    defer Cache.Delete("GROUP_INHERIT")
+
+    ctx := testContext("", url.Values{})
+    ctx.SessionLogin("tester", map[string]string{"OPS": "Operator"})
+    if !ctx.HasRole("OPS") || !ctx.HasRole("BASE") || ctx.HasRole("AUDIT") {
+        t.Errorf("unexpected roles %v", ctx.sesMap["GIDX"])
+    }
+    if !ctx.HasHandler("OPS", "HR", "REP") {
+        t.Error("expected inherited handler HR/REP")
+    }
+    if v, _ := EffectivePermission(nil, "OPS", "HR", "EMP"); v != "1110" {
+        t.Errorf("unexpected permission %s", v)
+    }
+
+    g := testGroupGraph()
+    g.parents["BASE"] = []string{"OPS"}
+    Cache.Set("group:graph", g, 60)
+    ctx = testContext("", url.Values{})
+    ctx.SessionLogin("tester", map[string]string{"OPS": "Operator"})
+    if ctx.HasRole("OPS") || ctx.HasHandler("OPS", "FI", "INV") {
+        t.Error("cycle must fail closed")
+    }
+}
@@ -0,0 +1,194 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Impersonation: support staff membentuk session sebagai user lain tanpa password user
+// tersebut, untuk mereproduksi apa yang dilihat user
+//
+// Hanya anggota group config IMPERSONATE_GROUPS (GID dipisahkan koma) yang boleh
+// melakukan impersonation, dan user target tidak boleh anggota group tersebut. Session
+// target dibentuk seperti login biasa (OnCreate), identitas asli disimpan di attribute
+// IMP_USR/IMP_GID/IMP_AUTH dan tersedia melalui Context.Impersonator. Stop
+// mengembalikan session ke identitas asli
+//
+// Selama impersonation:
+//   1. Setiap response membawa header X-Impersonated-By, session attribute IMP untuk UI
+//   2. DELETE selalu ditolak, POST/PUT hanya jika config IMPERSONATE_WRITE true
+//   3. PasswordService, MFAService, APIKeyService, SessionAdminService (dan handler yang
+//      meng-embed-nya) serta handler yang didaftarkan dengan ExportImpersonationDeny
+//      selalu ditolak
+//   4. Start/stop dan setiap request POST/PUT/DELETE (termasuk yang ditolak) dicatat di
+//      st_impersonation_audit (IMP_USR, USR, ACTION, URI, METHOD, ADDR, CREATED_AT)
+package tlkm
+
+import (
+    "errors"
+    "strings"
+    "time"
+)
+
+type (
+    // Di embed oleh handler modul (secure), tetap bisa dipanggil selama impersonation
+    //
+    //  POST    USR=<username>  mulai impersonation
+    //  DELETE                  kembali ke identitas asli
+    ImpersonationService struct {
+        NotAllowedService
+    }
+
+    // ** private **
+    impersonationControl interface {
+        impersonation()
+    }
+
+    // ** private **
+    impersonationDenied interface {
+        impersonationDenied()
+    }
+)
+
+const (
+    ImpersonatedHeader = "X-Impersonated-By"
+)
+
+var (
+    // ** private **
+    impersonationDeny = make(map[string]bool)
+)
+
+// Handler yang tidak boleh dipanggil selama impersonation
+func ExportImpersonationDeny(object Service) {
+    impersonationDeny[typeIndex(object)] = true
+}
+
+// User asli jika session adalah impersonation
+func (self *Context) Impersonator() (string, bool) {
+    return self.SessionUser("IMP_USR")
+}
+
+func impersonationAllowed(GID map[string]string) bool {
+    v, _ := Cache.String("IMPERSONATE_GROUPS")
+    for _, i := range strings.Split(v, ",") {
+        if _, b := GID[strings.TrimSpace(i)]; b {
+            return true
+        }
+    }
+    return false
+}
+
+func impersonationAudit(conn *Connection, ctx *Context, IMP, USR, action string) {
+    URI, method := "", ""
+    if ctx.Request != nil {
+        URI, method = ctx.Request.URL.Path, ctx.Request.Method
+    }
+    conn.Exec("INSERT INTO st_impersonation_audit(IMP_USR,USR,ACTION,URI,METHOD,ADDR,CREATED_AT) VALUES (?,?,?,?,?,?,?)",
+        IMP, USR, action, URI, method, ctx.ClientIP(), time.Now().Format(sqlDatetime))
+}
+
+// Mulai impersonation sebagai USR. Session aktif harus milik anggota IMPERSONATE_GROUPS
+func (self *Context) Impersonate(conn *Connection, USR string) error {
+    IMP, b := self.SessionUser()
+    if !b {
+        return errors.New("ImpersonationException: expected session")
+    }
+    if _, b := self.Impersonator(); b {
+        return errors.New("ImpersonationException: session sudah impersonation")
+    }
+    g, _ := self.Session("GID")
+    GID, _ := g.(map[string]string)
+    if !impersonationAllowed(GID) {
+        return errors.New("ImpersonationException: " + IMP + " tidak diizinkan")
+    }
+    if USR == "" || USR == IMP {
+        return errors.New("ImpersonationException: user tidak valid")
+    }
+    target := userGroups(conn, USR)
+    if len(target) == 0 {
+        return errors.New("ImpersonationException: " + USR + " tidak ditemukan")
+    }
+    if impersonationAllowed(target) {
+        return errors.New("ImpersonationException: " + USR + " tidak bisa di-impersonate")
+    }
+    AUTH, _ := self.SessionUser("AUTH")
+    self.sesAdmit = true    // menggantikan session aktif, bukan login baru (lihat sessionpolicy.go)
+    self.SessionLogin(USR, target).SessionSet("AUTH", AUTH)
+    self.SessionSet("IMP", true).SessionSet("IMP_USR", IMP).SessionSet("IMP_GID", GID).SessionSet("IMP_AUTH", AUTH)
+    impersonationAudit(conn, self, IMP, USR, "START")
+    return nil
+}
+
+// Kembali ke identitas asli
+func (self *Context) StopImpersonation(conn *Connection) error {
+    IMP, b := self.Impersonator()
+    if !b {
+        return errors.New("ImpersonationException: session bukan impersonation")
+    }
+    USR, _ := self.SessionUser()
+    g, _ := self.Session("IMP_GID")
+    GID, _ := g.(map[string]string)
+    AUTH, _ := self.SessionUser("IMP_AUTH")
+    impersonationAudit(conn, self, IMP, USR, "STOP")
+    self.sesAdmit = true
+    self.SessionLogin(IMP, GID).SessionSet("AUTH", AUTH)
+    return nil
+}
+
+// Dipanggil ServeHTTP sebelum pemeriksaan ACL: flag response, pembatasan method dan
+// audit request write
+func impersonationCheck(conn *Connection, ctx *Context, handler Service, IDX string) error {
+    IMP, b := ctx.Impersonator()
+    if !b {
+        return nil
+    }
+    ctx.Header(ImpersonatedHeader, IMP)
+    if _, b := handler.(impersonationControl); b {
+        return nil
+    }
+    var e error
+    if _, b := handler.(impersonationDenied); b || impersonationDeny[IDX] {
+        e = errors.New("ImpersonationException: " + IDX + " tidak diizinkan selama impersonation")
+    }
+    switch ctx.method {
+    case doPOST, doPUT, doDELETE:
+    default:
+        return e
+    }
+    if w, _ := Cache.Bool("IMPERSONATE_WRITE"); ctx.method == doDELETE || !w {
+        e = errors.New("ImpersonationException: " + ctx.call + " tidak diizinkan selama impersonation")
+    }
+    USR, _ := ctx.SessionUser()
+    action := "WRITE"
+    if e != nil {
+        action = "DENIED"
+    }
+    impersonationAudit(conn, ctx, IMP, USR, action)
+    return e
+}
+
+func (self *ImpersonationService) impersonation() {}
+
+func (self *ImpersonationService) POST(conn *Connection, ctx *Context) {
+    if e := ctx.Impersonate(conn, ctx.Get("USR")); e != nil {
+        ctx.Code(StatusForbidden).Warn(e.Error())
+        return
+    }
+    ctx.Code(StatusOK).Data(GMap{"USR": ctx.Get("USR")})
+}
+
+func (self *ImpersonationService) DELETE(conn *Connection, ctx *Context) {
+    if e := ctx.StopImpersonation(conn); e != nil {
+        ctx.Code(StatusBadRequest).Warn(e.Error())
+        return
+    }
+    USR, _ := ctx.SessionUser()
+    ctx.Code(StatusOK).Data(GMap{"USR": USR})
+}
@@ -0,0 +1,98 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "net/url"
+    "testing"
+)
+
+type testImpersonationHandler struct {
+    ImpersonationService
+}
+
+func TestImpersonationAllowed(t *testing.T) {
+    Cache.Set("IMPERSONATE_GROUPS", "SUPPORT, ADMIN")
+    defer Cache.Delete("IMPERSONATE_GROUPS")
+
+    ctx := testContext("", url.Values{})
+    if e := ctx.Impersonate(nil, "tester"); e == nil {
+        t.Error("expected ImpersonationException without session")
+    }
+    ctx.sesMap = GMap{"USR": "staff", "GID": map[string]string{"OPS": "Operator"}}
+    if e := ctx.Impersonate(nil, "tester"); e == nil {
+        t.Error("expected ImpersonationException for group OPS")
+    }
+    ctx.sesMap = GMap{"USR": "staff", "GID": map[string]string{"SUPPORT": "Support"}, "IMP_USR": "admin"}
+    if e := ctx.Impersonate(nil, "tester"); e == nil {
+        t.Error("nested impersonation must be rejected")
+    }
+    ctx.sesMap = GMap{"USR": "staff"}
+    if e := ctx.StopImpersonation(nil); e == nil {
+        t.Error("expected ImpersonationException for non impersonation session")
+    }
+}
+
+func TestImpersonationCheck(t *testing.T) {
+    ExportImpersonationDeny(&testImpersonationHandler{})
+    defer delete(impersonationDeny, typeIndex(&testImpersonationHandler{}))
+    IDX := typeIndex(&testImpersonationHandler{})
+
+    ctx := testContext("", url.Values{})
+    ctx.sesMap = GMap{"USR": "staff"}
+    ctx.method = doDELETE
+    if e := impersonationCheck(nil, ctx, &NotAllowedService{}, IDX); e != nil {
+        t.Errorf("non impersonation session must not be restricted: %v", e)
+    }
+
+    ctx.sesMap = GMap{"USR": "tester", "IMP": true, "IMP_USR": "staff"}
+    ctx.method = doGET
+    ctx.call = "GET"
+    if e := impersonationCheck(nil, ctx, &NotAllowedService{}, "/app/Report"); e != nil {
+        t.Error(e)
+    }
+    if v := ctx.Response.Header().Get(ImpersonatedHeader); v != "staff" {
+        t.Errorf("expected %s staff. received %q", ImpersonatedHeader, v)
+    }
+    if e := impersonationCheck(nil, ctx, &NotAllowedService{}, IDX); e == nil {
+        t.Error("denied handler must be rejected")
+    }
+    // stop impersonation selalu diizinkan
+    ctx.method = doDELETE
+    if e := impersonationCheck(nil, ctx, &testImpersonationHandler{}, IDX); e != nil {
+        t.Error(e)
+    }
+    if v, b := ctx.Impersonator(); !b || v != "staff" {
+        t.Errorf("unexpected impersonator %q", v)
+    }
+}
+
+type testImpersonationPassword struct {
+    PasswordService
+}
+
+func TestImpersonationDenied(t *testing.T) {
+    ctx := testContext("", url.Values{})
+    ctx.sesMap = GMap{"USR": "tester", "IMP": true, "IMP_USR": "staff"}
+    ctx.method = doGET
+    ctx.call = "GET"
+    for _, v := range []Service{&PasswordService{}, &MFAService{}, &APIKeyService{}, &SessionAdminService{}, &testImpersonationPassword{}} {
+        if e := impersonationCheck(nil, ctx, v, typeIndex(v)); e == nil {
+            t.Errorf("%T must be rejected during impersonation", v)
+        }
+    }
+    if e := impersonationCheck(nil, ctx, &NotAllowedService{}, "/app/Report"); e != nil {
+        t.Error(e)
+    }
+}
@@ -0,0 +1,334 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Invalidasi cache rules (rule:) dan arguments (argv:) per handler. Sebelumnya perubahan
+// st_handler_rules/st_handler_arguments baru berlaku setelah restart atau Cache.Flush
+// (yang juga menghapus semua session)
+//
+// Ada 3 cara invalidasi:
+//   1. langsung via Invalidate/InvalidateRule/InvalidateAll
+//   2. admin API, embed InvalidateService kedalam handler modul (lihat contoh dibawah)
+//   3. poller yang membandingkan hash isi baris setiap INVALIDATE_INTERVAL detik
+package tlkm
+
+import (
+    "reflect"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+    "github.com/telkomdit/goframework/to"
+)
+
+type (
+    // Rule efektif sebuah handler. Ref tidak kosong jika argument wajib rule tidak
+    // disyaratkan oleh handler (rule akan selalu gagal, StatusFailedDependency)
+    EffectiveRule struct {
+        SRC         string  `json:"src"`
+        EXPR        bool    `json:"expr"`
+        Exported    bool    `json:"exported"`  // ada di ruleMap (ExportRule) atau procedure Play
+        Ref         string  `json:"ref,omitempty"`
+        Params      RuleParams  `json:"params,omitempty"`
+        ParamError  string      `json:"paramError,omitempty"`
+    }
+
+    // Hasil preview rules dan arguments handler sesuai isi database saat ini
+    HandlerEffective struct {
+        SRC         string              `json:"src"`
+        MID         string              `json:"mid"`
+        Cached      bool                `json:"cached"`    // false: request berikutnya akan lookup ulang ke database
+        Rules       []EffectiveRule     `json:"rules"`
+        Arguments   map[string]Argument `json:"arguments"`
+    }
+
+    // Admin API invalidasi, di embed oleh handler modul agar path dan ACL mengikuti modul
+    //
+    // contoh:
+    //
+    //      type Cache struct {
+    //          tlkm.InvalidateService
+    //      }
+    //
+    //      func init() {
+    //          tlkm.Export(new(Cache))
+    //      }
+    //
+    //  GET     ?path=/syst/api/user&call=POST     preview rules dan arguments
+    //  DELETE  ?path=/syst/api/user               invalidasi satu handler
+    //  DELETE  ?rule=/syst/rule/Limit             invalidasi semua handler yang menggunakan rule
+    //  DELETE                                     invalidasi semua handler
+    InvalidateService struct {
+        NotAllowedService
+    }
+
+    // Implementasi default Service untuk admin API yang di embed: semua method
+    // mengembalikan StatusMethodNotAllowed kecuali yang di-override
+    NotAllowedService struct {}
+)
+
+var (
+    // ** private **
+    // poller properties
+    chinv   chan struct{}
+    sigMap  SMap
+)
+
+// Semua key cache (GET, POST, dst) dari cacheKey
+func cacheKeys(k cacheKey) List {
+    V := reflect.ValueOf(k)
+    r := make(List, V.NumField())
+    for i := 0; i < V.NumField(); i++ {
+        r[i] = V.Field(i).String()
+    }
+    return r
+}
+
+// Hapus cache rules dan arguments satu handler (IDX/path handler). Return false jika
+// handler tidak ditemukan
+func Invalidate(IDX string) bool {
+    nv, v := servKey[IDX]
+    if !v {
+        return false
+    }
+    for _, ns := range cacheKeys(nv.rule) {
+        Cache.Delete(ns)
+    }
+    for _, ns := range cacheKeys(nv.argv) {
+        Cache.Delete(ns)
+    }
+    return true
+}
+
+// Invalidasi semua handler yang menggunakan rule (SRC), termasuk rule yang tidak aktif
+// (USED='0') karena perubahan bisa jadi justru mengaktifkan rule
+func InvalidateRule(conn *Connection, SRC string) List {
+    r := make(List, 0)
+    rows := conn.Query(`SELECT DISTINCT a.SRC
+       FROM st_handlers a
+       JOIN st_handler_rules b ON (b.PID=a.PID AND b.HID=a.HID)
+       JOIN st_rules c ON (c.PID=b.PID AND c.RID=b.RID)
+      WHERE c.SRC=?`, SRC)
+    for rows.Next() {
+        r = append(r, rows.String("SRC"))
+    }
+    rows.Close()
+    for _, j := range r {
+        Invalidate(j)
+    }
+    if namespace, method, v := ParsePlayRule(SRC); v {
+        // hanya procedure rule yang di-load ulang, handler lain dalam namespace tetap jalan
+        if e := reloadPlay(conn, namespace, method); e != nil {
+            (&Logger{logNs: "SYST", logLv: loglv}).Log(WARN, Sprintf("InvalidateException: %s %s", SRC, e.Error()))
+        }
+    }
+    return r
+}
+
+// Invalidasi semua handler tanpa menyentuh session dan config
+func InvalidateAll() {
+    for IDX, _ := range servKey {
+        Invalidate(IDX)
+    }
+}
+
+// Preview rules dan arguments handler untuk method (call) tertentu, dibaca langsung
+// dari database sehingga bisa digunakan untuk memastikan hasil perubahan sebelum invalidasi
+func Effective(conn *Connection, IDX, call string) HandlerEffective {
+    call = strings.ToUpper(call)
+    z := HandlerEffective{SRC: IDX, MID: call, Rules: make([]EffectiveRule, 0)}
+    if nv, v := servKey[IDX]; v {
+        for i, j := range cacheKeys(nv.argv) {
+            if strings.HasSuffix(j, "." + call) {
+                z.Cached = Cache.Exists(j) || Cache.Exists(cacheKeys(nv.rule)[i])
+            }
+        }
+    }
+    rs := loadRules(conn, IDX, call)
+    for _, j := range rs.Key {
+        _, exported := lookupRule(j)
+        z.Rules = append(z.Rules, EffectiveRule{SRC: j, EXPR: rs.Map[j], Exported: exported, Ref: strings.TrimSpace(rs.Ref[j]),
+            Params: rs.Params[j], ParamError: rs.Errs[j]})
+    }
+    z.Arguments = loadArguments(conn, IDX, call)
+    return z
+}
+
+// Signature per handler: hash isi baris arguments, rules dan rule arguments (tanpa
+// CREATED_AT/UPDATED_AT yang di-touch setiap startup). Perubahan lewat admin/SQL
+// langsung tetap terdeteksi walaupun UPDATED_AT tidak diisi, baris yang ditambah atau
+// dihapus mengubah hash
+func handlerSignatures(conn *Connection) SMap {
+    stmts := List{
+        `SELECT a.SRC HSRC, b.*
+           FROM st_handlers a
+           JOIN st_handler_arguments b ON (b.PID=a.PID AND b.HID=a.HID)`,
+        `SELECT a.SRC HSRC, b.*
+           FROM st_handlers a
+           JOIN st_handler_rules b ON (b.PID=a.PID AND b.HID=a.HID)`,
+        `SELECT a.SRC HSRC, c.*
+           FROM st_handlers a
+           JOIN st_handler_rules b ON (b.PID=a.PID AND b.HID=a.HID)
+           JOIN st_rules c ON (c.PID=b.PID AND c.RID=b.RID)`,
+        `SELECT a.SRC HSRC, d.*
+           FROM st_handlers a
+           JOIN st_handler_rules b ON (b.PID=a.PID AND b.HID=a.HID)
+           JOIN st_rule_arguments d ON (d.PID=b.PID AND d.RID=b.RID)`,
+    }
+    list := make(map[string]List)
+    for i, stmt := range stmts {
+        rows := conn.Query(stmt)
+        for rows.Next() {
+            m := rows.SMap()
+            SRC := m["HSRC"]
+            keys := make(List, 0, len(m))
+            for k, _ := range m {
+                switch strings.ToUpper(k) {
+                case "HSRC", "CREATED_AT", "UPDATED_AT":
+                default:
+                    keys = append(keys, k)
+                }
+            }
+            sort.Strings(keys)
+            v := make(List, len(keys))
+            for j, k := range keys {
+                v[j] = strings.ToUpper(k) + "=" + m[k]
+            }
+            list[SRC] = append(list[SRC], strconv.Itoa(i) + ":" + strings.Join(v, "\x1f"))
+        }
+        rows.Close()
+    }
+    sig := make(SMap, len(list))
+    for i, j := range list {
+        sort.Strings(j)     // urutan baris dari database tidak dijamin
+        sig[i] = to.MD5(strings.Join(j, "\n"))
+    }
+    return sig
+}
+
+// Handler yang signaturenya berubah (termasuk yang muncul/hilang)
+func changedSignatures(prev, next SMap) List {
+    r := make(List, 0)
+    for i, j := range next {
+        if k, v := prev[i]; !v || k != j {
+            r = append(r, i)
+        }
+    }
+    for i, _ := range prev {
+        if _, v := next[i]; !v {
+            r = append(r, i)
+        }
+    }
+    sort.Strings(r)
+    return r
+}
+
+// Satu siklus poller. Siklus pertama hanya menyimpan signature sebagai baseline
+func pollHandlers(conn *Connection) List {
+    next := handlerSignatures(conn)
+    prev := sigMap
+    sigMap = next
+    if prev == nil {
+        return nil
+    }
+    r := changedSignatures(prev, next)
+    for _, j := range r {
+        Invalidate(j)
+    }
+    return r
+}
+
+// Poller dijalankan oleh setup, interval (detik) dari config INVALIDATE_INTERVAL
+// (default 60, 0 untuk menonaktifkan)
+func watchHandlers() {
+    if chinv != nil {
+        close(chinv)
+        chinv = nil
+    }
+    d, b := Cache.Int("INVALIDATE_INTERVAL")
+    if !b {
+        d = 60
+    }
+    if d <= 0 {
+        return
+    }
+    sigMap = nil
+    chinv = make(chan struct{})
+    go func(stop chan struct{}) {
+        tick := time.NewTicker(time.Duration(d) * time.Second)
+        defer tick.Stop()
+        for {
+            pollTick()
+            select {
+            case <-stop:
+                return
+            case <-tick.C:
+            }
+        }
+    }(chinv)
+}
+
+// Satu putaran poller. Error database (tabel belum dimigrasi, koneksi putus dst) hanya
+// dicatat, poller tetap berjalan pada interval berikutnya
+func pollTick() {
+    conn := SQL.Default()
+    defer conn.Close()
+    (&Go{
+        Try: func() {
+            if r := pollHandlers(conn); len(r) > 0 && ctrl != nil && ctrl.logLv >= INFO {
+                ctrl.Log(INFO, "Invalidate: " + strings.Join(r, ","))
+            }
+        },
+        Catch: func(ex Exception) {
+            (&Logger{logNs: "SYST", logLv: loglv}).Log(WARN, Sprintf("InvalidateException: %s", ex))
+        },
+    }).Run()
+}
+
+func (self *InvalidateService) GET(conn *Connection, ctx *Context) {
+    IDX := ctx.Get("path")
+    if _, v := servKey[IDX]; !v {
+        ctx.Code(StatusNotFound, true)
+        return
+    }
+    call := ctx.Get("call")
+    if call == "" {
+        call = doMap[doGET]
+    }
+    ctx.Data(Effective(conn, IDX, call))
+}
+
+func (self *InvalidateService) DELETE(conn *Connection, ctx *Context) {
+    switch {
+    case ctx.Exists("path"):
+        if !Invalidate(ctx.Get("path")) {
+            ctx.Code(StatusNotFound, true)
+            return
+        }
+        ctx.List(List{ctx.Get("path")})
+    case ctx.Exists("rule"):
+        ctx.List(InvalidateRule(conn, ctx.Get("rule")))
+    default:
+        InvalidateAll()
+        ctx.Message("invalidated")
+    }
+}
+
+func (self *NotAllowedService) GET(conn *Connection, ctx *Context)    { ctx.Code(StatusMethodNotAllowed, true) }
+func (self *NotAllowedService) POST(conn *Connection, ctx *Context)   { ctx.Code(StatusMethodNotAllowed, true) }
+func (self *NotAllowedService) PUT(conn *Connection, ctx *Context)    { ctx.Code(StatusMethodNotAllowed, true) }
+func (self *NotAllowedService) DELETE(conn *Connection, ctx *Context) { ctx.Code(StatusMethodNotAllowed, true) }
+func (self *NotAllowedService) GRID(conn *Connection, ctx *Context)   { ctx.Code(StatusMethodNotAllowed, true) }
+func (self *NotAllowedService) HTML(conn *Connection, ctx *Context)   { ctx.Code(StatusMethodNotAllowed, true) }
+func (self *NotAllowedService) JSON(conn *Connection, ctx *Context)   { ctx.Code(StatusMethodNotAllowed, true) }
+func (self *NotAllowedService) TEXT(conn *Connection, ctx *Context)   { ctx.Code(StatusMethodNotAllowed, true) }
+func (self *NotAllowedService) FILE(conn *Connection, ctx *Context)   { ctx.Code(StatusMethodNotAllowed, true) }
@@ -0,0 +1,89 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "reflect"
+    "testing"
+)
+
+var _ Service = new(InvalidateService)
+
+func TestCacheKeys(t *testing.T) {
+    k := cacheKeys(getKey("rule:/test/api/Invalidate."))
+    if len(k) != 9 || k[0] != "rule:/test/api/Invalidate.GET" || k[8] != "rule:/test/api/Invalidate.FILE" {
+        t.Errorf("unexpected keys %v", k)
+    }
+}
+
+func TestInvalidate(t *testing.T) {
+    IDX := "/test/api/Invalidate"
+    servKey[IDX] = serviceKey{rule: getKey("rule:" + IDX + "."), argv: getKey("argv:" + IDX + ".")}
+    defer delete(servKey, IDX)
+
+    Cache.Set("rule:" + IDX + ".POST", &ruleSet{Key: List{"/test/rule/A"}, Map: BMap{"/test/rule/A": true}})
+    Cache.Set("argv:" + IDX + ".POST", map[string]Argument{})
+    Cache.Set("SID-INVALIDATE", GMap{"USR": "test"})
+    defer Cache.Delete("SID-INVALIDATE")
+
+    if Invalidate("/test/api/Unknown") {
+        t.Error("expected false for unknown handler")
+    }
+    if !Invalidate(IDX) {
+        t.Fatal("expected true for exported handler")
+    }
+    if Cache.Exists("rule:" + IDX + ".POST") || Cache.Exists("argv:" + IDX + ".POST") {
+        t.Error("handler cache not evicted")
+    }
+    if !Cache.Exists("SID-INVALIDATE") {
+        t.Error("session must not be evicted")
+    }
+}
+
+func TestChangedSignatures(t *testing.T) {
+    prev := SMap{"/a": "0:1@2021|", "/b": "1:2@2021|", "/c": "0:1@2021|"}
+    next := SMap{"/a": "0:1@2021|", "/b": "1:2@2022|", "/d": "0:1@2021|"}
+    if r := changedSignatures(prev, next); !reflect.DeepEqual(r, List{"/b", "/c", "/d"}) {
+        t.Errorf("unexpected changes %v", r)
+    }
+}
+
+// Default connection yang selalu error (database tertutup), logger dimatikan agar
+// LogSync tidak menyentuh koneksi
+func testBrokenDefault(t *testing.T) func() {
+    conn := testMigrationConn(t)
+    conn.DB.Close()
+    prev, had := SQL.proto[PackageSystem]
+    SQL.proto[PackageSystem] = conn
+    lv := loglv
+    loglv = FRAUD + 1
+    return func() {
+        loglv = lv
+        if had {
+            SQL.proto[PackageSystem] = prev
+        } else {
+            delete(SQL.proto, PackageSystem)
+        }
+    }
+}
+
+// Error database (tabel belum dimigrasi dst) tidak boleh mematikan proses
+func TestPollTickRecover(t *testing.T) {
+    defer testBrokenDefault(t)()
+    sigMap = nil
+    pollTick()
+    if sigMap != nil {
+        t.Error("expected signatures untouched on error")
+    }
+}
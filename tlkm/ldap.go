@@ -0,0 +1,670 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Authentication provider LDAP/Active Directory. Client LDAPv3 (RFC 4511) yang digunakan
+// adalah subset minimal yang dibutuhkan untuk authentication: simple bind, search,
+// StartTLS dan unbind, tanpa dependency di luar standard library
+//
+// Alur Authenticate:
+//   1. koneksi (pool) bind sebagai service account (LDAP_BIND_DN/LDAP_BIND_PWD),
+//      atau anonymous jika tidak di-set
+//   2. search user di LDAP_BASE_DN dengan LDAP_USER_FILTER, harus tepat 1 entry
+//   3. bind sebagai DN user dengan password, lalu bind ulang sebagai service account
+//      sebelum koneksi dikembalikan ke pool
+//   4. group dari attribute memberOf dan (opsional) search LDAP_GROUP_FILTER, dipetakan
+//      ke GID melalui LDAP_GROUP_MAP (cn=GID, dipisahkan koma) atau dicocokkan dengan
+//      GID yang ada di st_groups
+//
+// Config (st_configs SYST):
+//
+//      LDAP_URL            ldap://host:389 atau ldaps://host:636
+//      LDAP_STARTTLS       upgrade koneksi ldap:// ke TLS
+//      LDAP_BASE_DN        dc=example,dc=com
+//      LDAP_USER_FILTER    default (uid=%s), AD: (sAMAccountName=%s)
+//      LDAP_GROUP_FILTER   opsional, %s diganti DN user, misal (member=%s)
+//      LDAP_POOL           jumlah koneksi idle, default 4
+package tlkm
+
+import (
+    "bufio"
+    "crypto/tls"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "net/url"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+type (
+    LDAPAuthenticator struct {
+        URL         string
+        StartTLS    bool
+        BindDN      string
+        BindPWD     string
+        BaseDN      string
+        UserFilter  string      // %s diganti username (escaped)
+        GroupFilter string      // %s diganti DN user (escaped)
+        GroupMap    SMap        // cn group => GID, nil berarti dicocokkan dengan st_groups
+        PoolSize    int
+        Timeout     time.Duration
+        TLSConfig   *tls.Config // default: verifikasi dengan hostname LDAP_URL
+
+        // ** private **
+        once    sync.Once
+        pool    chan *ldapConn
+    }
+
+    // Satu entry hasil search
+    LDAPEntry struct {
+        DN      string
+        Attrs   map[string]List
+    }
+
+    // ** private **
+    ldapConn struct {
+        conn    net.Conn
+        r       *bufio.Reader
+        msgID   int
+        timeout time.Duration
+    }
+
+    // ** private **
+    // node BER (tag, content), children terisi jika tag constructed
+    berNode struct {
+        tag     byte
+        data    []byte
+        items   []*berNode
+    }
+
+    // ** private **
+    // io.Reader sederhana di atas content node
+    berSlice struct {
+        b   []byte
+        i   int
+    }
+)
+
+const (
+    // ** private **
+    // application tag LDAP message (RFC 4511)
+    ldapBindRequest     = 0x60
+    ldapBindResponse    = 0x61
+    ldapUnbindRequest   = 0x42
+    ldapSearchRequest   = 0x63
+    ldapSearchEntry     = 0x64
+    ldapSearchDone      = 0x65
+    ldapSearchReference = 0x73
+    ldapExtendedRequest = 0x77
+    ldapExtendedResponse = 0x78
+    ldapStartTLSOID     = "1.3.6.1.4.1.1466.20037"
+)
+
+// Authenticator dari config LDAP_*
+func LDAPFromConfig() *LDAPAuthenticator {
+    p := &LDAPAuthenticator{}
+    p.URL, _ = Cache.String("LDAP_URL")
+    p.StartTLS, _ = Cache.Bool("LDAP_STARTTLS")
+    p.BindDN, _ = Cache.String("LDAP_BIND_DN")
+    p.BindPWD, _ = Cache.String("LDAP_BIND_PWD")
+    p.BaseDN, _ = Cache.String("LDAP_BASE_DN")
+    p.UserFilter, _ = Cache.String("LDAP_USER_FILTER")
+    p.GroupFilter, _ = Cache.String("LDAP_GROUP_FILTER")
+    p.PoolSize, _ = Cache.Int("LDAP_POOL")
+    if v, _ := Cache.String("LDAP_GROUP_MAP"); v != "" {
+        p.GroupMap = SMap{}
+        for _, i := range strings.Split(v, ",") {
+            if j := strings.SplitN(i, "=", 2); len(j) == 2 {
+                p.GroupMap[strings.ToLower(strings.TrimSpace(j[0]))] = strings.TrimSpace(j[1])
+            }
+        }
+    }
+    return p
+}
+
+func (self *LDAPAuthenticator) Authenticate(conn *Connection, USR, PWD string) (*Identity, error) {
+    if USR == "" || PWD == "" {    // bind tanpa password = anonymous bind (selalu berhasil)
+        return nil, ErrInvalidCredentials
+    }
+    c, e := self.get()
+    if e != nil {
+        return nil, e
+    }
+    filter := self.UserFilter
+    if filter == "" {
+        filter = "(uid=%s)"
+    }
+    z, e := c.search(self.BaseDN, strings.Replace(filter, "%s", LDAPEscape(USR), -1), "memberOf")
+    if e != nil {
+        c.close()
+        return nil, e
+    }
+    if len(z) != 1 {
+        self.put(c)
+        return nil, ErrInvalidCredentials
+    }
+    user := z[0]
+    if e := c.bind(user.DN, PWD); e != nil {
+        if e == ErrInvalidCredentials && c.bind(self.BindDN, self.BindPWD) == nil {
+            self.put(c)
+        } else {
+            c.close()
+        }
+        return nil, e
+    }
+    groups := user.Attrs["memberof"]
+    if self.GroupFilter != "" {
+        if c.bind(self.BindDN, self.BindPWD) != nil {
+            c.close()
+            return nil, errors.New("LDAPException: rebind service account")
+        }
+        g, e := c.search(self.BaseDN, strings.Replace(self.GroupFilter, "%s", LDAPEscape(user.DN), -1), "cn")
+        if e != nil {
+            c.close()
+            return nil, e
+        }
+        for _, i := range g {
+            groups = append(groups, i.DN)
+        }
+        self.put(c)
+    } else if c.bind(self.BindDN, self.BindPWD) == nil {
+        self.put(c)
+    } else {
+        c.close()
+    }
+    return &Identity{USR: USR, GID: self.groups(conn, groups), Source: "LDAP",
+        Claims: GMap{"dn": user.DN}}, nil
+}
+
+// Mapping DN group ke GID berdasarkan cn
+func (self *LDAPAuthenticator) groups(conn *Connection, DN List) map[string]string {
+    GID := make(map[string]string)
+    if len(DN) == 0 {
+        return GID
+    }
+    known := self.GroupMap
+    if known == nil {
+        known = SMap{}
+        if conn != nil {
+            rows := conn.Query("SELECT GID FROM st_groups")
+            for rows.Next() {
+                known[strings.ToLower(rows.String("GID"))] = rows.String("GID")
+            }
+            rows.Close()
+        }
+    }
+    for _, i := range DN {
+        cn := ldapCN(i)
+        if j, b := known[strings.ToLower(cn)]; b {
+            GID[j] = cn
+        }
+    }
+    return GID
+}
+
+// RDN pertama (cn=Admins,ou=Groups,... => Admins)
+func ldapCN(DN string) string {
+    v := DN
+    if i := strings.Index(v, ","); i >= 0 {
+        v = v[:i]
+    }
+    if i := strings.Index(v, "="); i >= 0 {
+        v = v[i+1:]
+    }
+    return strings.TrimSpace(v)
+}
+
+// Escape value untuk filter (RFC 4515)
+func LDAPEscape(v string) string {
+    b := strings.Builder{}
+    for i := 0; i < len(v); i++ {
+        switch c := v[i]; c {
+        case '*', '(', ')', '\\', 0:
+            fmt.Fprintf(&b, "\\%02x", c)
+        default:
+            b.WriteByte(c)
+        }
+    }
+    return b.String()
+}
+
+// ** pool **
+
+func (self *LDAPAuthenticator) get() (*ldapConn, error) {
+    self.once.Do(func() {
+        n := self.PoolSize
+        if n <= 0 {
+            n = 4
+        }
+        self.pool = make(chan *ldapConn, n)
+    })
+    select {
+    case c := <-self.pool:
+        return c, nil
+    default:
+    }
+    return self.dial()
+}
+
+func (self *LDAPAuthenticator) put(c *ldapConn) {
+    select {
+    case self.pool <- c:
+    default:
+        c.close()
+    }
+}
+
+// Koneksi baru yang sudah bind sebagai service account
+func (self *LDAPAuthenticator) dial() (*ldapConn, error) {
+    u, e := url.Parse(self.URL)
+    if e != nil {
+        return nil, e
+    }
+    timeout := self.Timeout
+    if timeout == 0 {
+        timeout = 10 * time.Second
+    }
+    cfg := self.TLSConfig
+    if cfg == nil {
+        cfg = &tls.Config{ServerName: u.Hostname()}
+    }
+    host := u.Host
+    var nc net.Conn
+    switch u.Scheme {
+    case "ldaps":
+        if u.Port() == "" {
+            host = net.JoinHostPort(host, "636")
+        }
+        nc, e = tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", host, cfg)
+    case "ldap":
+        if u.Port() == "" {
+            host = net.JoinHostPort(host, "389")
+        }
+        nc, e = net.DialTimeout("tcp", host, timeout)
+    default:
+        return nil, errors.New("LDAPException: scheme " + u.Scheme + " tidak didukung")
+    }
+    if e != nil {
+        return nil, e
+    }
+    c := &ldapConn{conn: nc, r: bufio.NewReader(nc), timeout: timeout}
+    if self.StartTLS && u.Scheme == "ldap" {
+        if e := c.startTLS(cfg); e != nil {
+            c.close()
+            return nil, e
+        }
+    }
+    if e := c.bind(self.BindDN, self.BindPWD); e != nil {
+        c.close()
+        if e == ErrInvalidCredentials {
+            return nil, errors.New("LDAPException: bind service account gagal")
+        }
+        return nil, e
+    }
+    return c, nil
+}
+
+// ** ldapConn **
+
+// Kirim satu request, return message ID
+func (self *ldapConn) send(op []byte) (int, error) {
+    self.msgID++
+    self.conn.SetDeadline(time.Now().Add(self.timeout))
+    _, e := self.conn.Write(berEncode(0x30, append(berInt(0x02, self.msgID), op...)))
+    return self.msgID, e
+}
+
+// Baca response untuk message ID, return protocolOp
+func (self *ldapConn) recv(ID int) (*berNode, error) {
+    for {
+        m, e := berRead(self.r)
+        if e != nil {
+            return nil, e
+        }
+        if len(m.items) < 2 {
+            return nil, errors.New("LDAPException: response tidak valid")
+        }
+        if berToInt(m.items[0].data) == ID {
+            return m.items[1], nil
+        }
+    }
+}
+
+// resultCode dan diagnosticMessage dari LDAPResult
+func ldapResult(op *berNode) error {
+    if len(op.items) < 3 {
+        return errors.New("LDAPException: result tidak valid")
+    }
+    switch code := berToInt(op.items[0].data); code {
+    case 0:
+        return nil
+    case 49:    // invalidCredentials
+        return ErrInvalidCredentials
+    default:
+        return errors.New("LDAPException: " + strconv.Itoa(code) + " " + string(op.items[2].data))
+    }
+}
+
+func (self *ldapConn) bind(DN, PWD string) error {
+    ID, e := self.send(berEncode(ldapBindRequest, berJoin(berInt(0x02, 3), berEncode(0x04, []byte(DN)),
+        berEncode(0x80, []byte(PWD)))))
+    if e != nil {
+        return e
+    }
+    op, e := self.recv(ID)
+    if e != nil {
+        return e
+    }
+    if op.tag != ldapBindResponse {
+        return errors.New("LDAPException: expected BindResponse")
+    }
+    return ldapResult(op)
+}
+
+func (self *ldapConn) startTLS(cfg *tls.Config) error {
+    ID, e := self.send(berEncode(ldapExtendedRequest, berEncode(0x80, []byte(ldapStartTLSOID))))
+    if e != nil {
+        return e
+    }
+    op, e := self.recv(ID)
+    if e != nil {
+        return e
+    }
+    if op.tag != ldapExtendedResponse {
+        return errors.New("LDAPException: expected ExtendedResponse")
+    }
+    if e := ldapResult(op); e != nil {
+        return e
+    }
+    c := tls.Client(self.conn, cfg)
+    c.SetDeadline(time.Now().Add(self.timeout))
+    if e := c.Handshake(); e != nil {
+        return e
+    }
+    self.conn = c
+    self.r = bufio.NewReader(c)
+    return nil
+}
+
+// Search subtree
+func (self *ldapConn) search(base, filter string, attrs ...string) (z []*LDAPEntry, e error) {
+    f, e := ldapFilter(filter)
+    if e != nil {
+        return nil, e
+    }
+    var a []byte
+    for _, i := range attrs {
+        a = append(a, berEncode(0x04, []byte(i))...)
+    }
+    ID, e := self.send(berEncode(ldapSearchRequest, berJoin(berEncode(0x04, []byte(base)),
+        berInt(0x0a, 2), berInt(0x0a, 0), berInt(0x02, 0), berInt(0x02, 0),
+        berEncode(0x01, []byte{0}), f, berEncode(0x30, a))))
+    if e != nil {
+        return nil, e
+    }
+    for {
+        op, e := self.recv(ID)
+        if e != nil {
+            return nil, e
+        }
+        switch op.tag {
+        case ldapSearchEntry:
+            if len(op.items) < 2 {
+                return nil, errors.New("LDAPException: entry tidak valid")
+            }
+            r := &LDAPEntry{DN: string(op.items[0].data), Attrs: make(map[string]List)}
+            for _, i := range op.items[1].items {
+                if len(i.items) < 2 {
+                    continue
+                }
+                k := strings.ToLower(string(i.items[0].data))
+                for _, j := range i.items[1].items {
+                    r.Attrs[k] = append(r.Attrs[k], string(j.data))
+                }
+            }
+            z = append(z, r)
+        case ldapSearchReference:   // referral tidak diikuti
+        case ldapSearchDone:
+            return z, ldapResult(op)
+        default:
+            return nil, errors.New("LDAPException: unexpected response")
+        }
+    }
+}
+
+func (self *ldapConn) close() {
+    self.send(berEncode(ldapUnbindRequest, nil))
+    self.conn.Close()
+}
+
+// ** filter (RFC 4515) **
+
+// Compile string filter ke BER. Didukung: &, |, !, =, =*, substring, >=, <= dan ~=
+func ldapFilter(v string) ([]byte, error) {
+    v = strings.TrimSpace(v)
+    if !strings.HasPrefix(v, "(") {
+        v = "(" + v + ")"
+    }
+    z, n, e := ldapFilterAt(v, 0)
+    if e == nil && n != len(v) {
+        e = errors.New("LDAPException: filter " + v)
+    }
+    return z, e
+}
+
+func ldapFilterAt(v string, i int) ([]byte, int, error) {
+    if i >= len(v) || v[i] != '(' {
+        return nil, i, errors.New("LDAPException: filter " + v)
+    }
+    i++
+    if i >= len(v) {
+        return nil, i, errors.New("LDAPException: filter " + v)
+    }
+    switch v[i] {
+    case '&', '|':
+        tag := byte(0xa0)
+        if v[i] == '|' {
+            tag = 0xa1
+        }
+        i++
+        var items []byte
+        for i < len(v) && v[i] == '(' {
+            z, n, e := ldapFilterAt(v, i)
+            if e != nil {
+                return nil, n, e
+            }
+            items, i = append(items, z...), n
+        }
+        if i >= len(v) || v[i] != ')' {
+            return nil, i, errors.New("LDAPException: filter " + v)
+        }
+        return berEncode(tag, items), i + 1, nil
+    case '!':
+        z, n, e := ldapFilterAt(v, i + 1)
+        if e != nil || n >= len(v) || v[n] != ')' {
+            return nil, n, errors.New("LDAPException: filter " + v)
+        }
+        return berEncode(0xa2, z), n + 1, nil
+    }
+    j := strings.IndexByte(v[i:], ')')
+    if j < 0 {
+        return nil, i, errors.New("LDAPException: filter " + v)
+    }
+    z, e := ldapItem(v[i:i+j])
+    return z, i + j + 1, e
+}
+
+// Satu item filter (attr op value)
+func ldapItem(v string) ([]byte, error) {
+    i := strings.IndexByte(v, '=')
+    if i <= 0 {
+        return nil, errors.New("LDAPException: filter item " + v)
+    }
+    attr, value, tag := v[:i], v[i+1:], byte(0xa3)
+    switch attr[len(attr)-1] {
+    case '>':
+        attr, tag = attr[:len(attr)-1], 0xa5
+    case '<':
+        attr, tag = attr[:len(attr)-1], 0xa6
+    case '~':
+        attr, tag = attr[:len(attr)-1], 0xa8
+    }
+    if tag == 0xa3 && value == "*" {
+        return berEncode(0x87, []byte(attr)), nil
+    }
+    if tag == 0xa3 && strings.Contains(value, "*") {
+        parts := strings.Split(value, "*")
+        var s []byte
+        for k, p := range parts {
+            if p == "" {
+                continue
+            }
+            u, e := ldapUnescape(p)
+            if e != nil {
+                return nil, e
+            }
+            t := byte(0x81)    // any
+            if k == 0 {
+                t = 0x80        // initial
+            } else if k == len(parts) - 1 {
+                t = 0x82        // final
+            }
+            s = append(s, berEncode(t, u)...)
+        }
+        return berEncode(0xa4, berJoin(berEncode(0x04, []byte(attr)), berEncode(0x30, s))), nil
+    }
+    u, e := ldapUnescape(value)
+    if e != nil {
+        return nil, e
+    }
+    return berEncode(tag, berJoin(berEncode(0x04, []byte(attr)), berEncode(0x04, u))), nil
+}
+
+// Decode escape \XX pada value filter
+func ldapUnescape(v string) ([]byte, error) {
+    var z []byte
+    for i := 0; i < len(v); i++ {
+        if v[i] != '\\' {
+            z = append(z, v[i])
+            continue
+        }
+        if i + 3 > len(v) {
+            return nil, errors.New("LDAPException: escape " + v)
+        }
+        b, e := strconv.ParseUint(v[i+1:i+3], 16, 8)
+        if e != nil {
+            return nil, errors.New("LDAPException: escape " + v)
+        }
+        z = append(z, byte(b))
+        i += 2
+    }
+    return z, nil
+}
+
+// ** BER **
+
+func berLength(n int) []byte {
+    if n < 0x80 {
+        return []byte{byte(n)}
+    }
+    var b []byte
+    for ; n > 0; n >>= 8 {
+        b = append([]byte{byte(n)}, b...)
+    }
+    return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+func berEncode(tag byte, data []byte) []byte {
+    return append(append([]byte{tag}, berLength(len(data))...), data...)
+}
+
+func berJoin(parts ...[]byte) []byte {
+    var b []byte
+    for _, i := range parts {
+        b = append(b, i...)
+    }
+    return b
+}
+
+// INTEGER/ENUMERATED non-negatif
+func berInt(tag byte, v int) []byte {
+    b := []byte{byte(v)}
+    for v >>= 8; v > 0; v >>= 8 {
+        b = append([]byte{byte(v)}, b...)
+    }
+    if b[0] & 0x80 != 0 {
+        b = append([]byte{0}, b...)
+    }
+    return berEncode(tag, b)
+}
+
+func berToInt(b []byte) int {
+    v := 0
+    for _, i := range b {
+        v = v << 8 | int(i)
+    }
+    return v
+}
+
+// Baca satu TLV dari stream
+func berRead(r io.Reader) (*berNode, error) {
+    h := make([]byte, 2)
+    if _, e := io.ReadFull(r, h); e != nil {
+        return nil, e
+    }
+    n := int(h[1])
+    if n & 0x80 != 0 {
+        k := n & 0x7f
+        if k == 0 || k > 4 {
+            return nil, errors.New("BERException: length")
+        }
+        b := make([]byte, k)
+        if _, e := io.ReadFull(r, b); e != nil {
+            return nil, e
+        }
+        n = berToInt(b)
+    }
+    data := make([]byte, n)
+    if _, e := io.ReadFull(r, data); e != nil {
+        return nil, e
+    }
+    return berParse(h[0], data)
+}
+
+func berParse(tag byte, data []byte) (*berNode, error) {
+    node := &berNode{tag: tag, data: data}
+    if tag & 0x20 == 0 {
+        return node, nil
+    }
+    r := &berSlice{b: data}
+    for r.i < len(data) {
+        i, e := berRead(r)
+        if e != nil {
+            return nil, e
+        }
+        node.items = append(node.items, i)
+    }
+    return node, nil
+}
+
+func (self *berSlice) Read(p []byte) (int, error) {
+    if self.i >= len(self.b) {
+        return 0, io.EOF
+    }
+    n := copy(p, self.b[self.i:])
+    self.i += n
+    return n, nil
+}
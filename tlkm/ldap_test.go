@@ -0,0 +1,246 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "bufio"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "math/big"
+    "net"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// LDAP server in-process: bind, search (and/or/not/equality/present), StartTLS
+type ldapStub struct {
+    ln      net.Listener
+    tls     *tls.Config
+    entries []ldapStubEntry
+    lock    sync.Mutex
+    dials   int
+}
+
+type ldapStubEntry struct {
+    DN      string
+    PWD     string
+    Attrs   map[string]List
+}
+
+func newLDAPStub(t *testing.T) (*ldapStub, *tls.Config) {
+    ln, e := net.Listen("tcp", "127.0.0.1:0")
+    if e != nil {
+        t.Fatal(e)
+    }
+    k, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    tpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "ldap"},
+        NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+        IPAddresses: []net.IP{net.ParseIP("127.0.0.1")}, KeyUsage: x509.KeyUsageDigitalSignature,
+        ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}
+    der, e := x509.CreateCertificate(rand.Reader, tpl, tpl, &k.PublicKey, k)
+    if e != nil {
+        t.Fatal(e)
+    }
+    cert, _ := x509.ParseCertificate(der)
+    roots := x509.NewCertPool()
+    roots.AddCert(cert)
+    s := &ldapStub{ln: ln, tls: &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: k}}},
+        entries: []ldapStubEntry{
+            {DN: "cn=svc,dc=example,dc=com", PWD: "svc", Attrs: map[string]List{}},
+            {DN: "uid=tester,ou=people,dc=example,dc=com", PWD: "rahasia", Attrs: map[string]List{
+                "uid": {"tester"}, "objectclass": {"person"},
+                "memberof": {"cn=Admins,ou=groups,dc=example,dc=com", "cn=Unknown,ou=groups,dc=example,dc=com"}}},
+            {DN: "cn=Operators,ou=groups,dc=example,dc=com", Attrs: map[string]List{
+                "cn": {"Operators"}, "member": {"uid=tester,ou=people,dc=example,dc=com"}}},
+        }}
+    go s.serve()
+    return s, &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"}
+}
+
+func (self *ldapStub) URL() string {
+    return "ldap://" + self.ln.Addr().String()
+}
+
+func (self *ldapStub) serve() {
+    for {
+        c, e := self.ln.Accept()
+        if e != nil {
+            return
+        }
+        self.lock.Lock()
+        self.dials++
+        self.lock.Unlock()
+        go self.handle(c)
+    }
+}
+
+func ldapStubResponse(ID int, tag byte, code int, parts ...[]byte) []byte {
+    op := berJoin(append(parts, berInt(0x0a, code), berEncode(0x04, nil), berEncode(0x04, nil))...)
+    if tag == ldapSearchEntry {
+        op = berJoin(parts...)
+    }
+    return berEncode(0x30, berJoin(berInt(0x02, ID), berEncode(tag, op)))
+}
+
+func (self *ldapStub) handle(c net.Conn) {
+    defer c.Close()
+    r := bufio.NewReader(c)
+    for {
+        m, e := berRead(r)
+        if e != nil || len(m.items) < 2 {
+            return
+        }
+        ID, op := berToInt(m.items[0].data), m.items[1]
+        switch op.tag {
+        case ldapBindRequest:
+            DN, PWD := string(op.items[1].data), string(op.items[2].data)
+            code := 49
+            if DN == "" && PWD == "" {
+                code = 0
+            }
+            for _, i := range self.entries {
+                if i.DN == DN && i.PWD != "" && i.PWD == PWD {
+                    code = 0
+                }
+            }
+            c.Write(ldapStubResponse(ID, ldapBindResponse, code))
+        case ldapExtendedRequest:
+            c.Write(ldapStubResponse(ID, ldapExtendedResponse, 0))
+            t := tls.Server(c, self.tls)
+            if t.Handshake() != nil {
+                return
+            }
+            c, r = t, bufio.NewReader(t)
+        case ldapSearchRequest:
+            for _, i := range self.entries {
+                if !strings.HasSuffix(i.DN, string(op.items[0].data)) || !ldapStubMatch(op.items[6], i) {
+                    continue
+                }
+                var attrs []byte
+                for k, v := range i.Attrs {
+                    var vals []byte
+                    for _, j := range v {
+                        vals = append(vals, berEncode(0x04, []byte(j))...)
+                    }
+                    attrs = append(attrs, berEncode(0x30, berJoin(berEncode(0x04, []byte(k)), berEncode(0x31, vals)))...)
+                }
+                c.Write(ldapStubResponse(ID, ldapSearchEntry, 0, berEncode(0x04, []byte(i.DN)), berEncode(0x30, attrs)))
+            }
+            c.Write(ldapStubResponse(ID, ldapSearchDone, 0))
+        case ldapUnbindRequest:
+            return
+        }
+    }
+}
+
+func ldapStubMatch(f *berNode, entry ldapStubEntry) bool {
+    switch f.tag {
+    case 0xa0:
+        for _, i := range f.items {
+            if !ldapStubMatch(i, entry) {
+                return false
+            }
+        }
+        return true
+    case 0xa1:
+        for _, i := range f.items {
+            if ldapStubMatch(i, entry) {
+                return true
+            }
+        }
+        return false
+    case 0xa2:
+        return !ldapStubMatch(f.items[0], entry)
+    case 0x87:
+        _, b := entry.Attrs[strings.ToLower(string(f.data))]
+        return b
+    case 0xa3:
+        for _, i := range entry.Attrs[strings.ToLower(string(f.items[0].data))] {
+            if strings.EqualFold(i, string(f.items[1].data)) {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+func TestLDAPFilter(t *testing.T) {
+    if v := LDAPEscape("a*b(c)\\"); v != "a\\2ab\\28c\\29\\5c" {
+        t.Errorf("unexpected escape %s", v)
+    }
+    f, e := ldapFilter("(&(objectClass=person)(|(uid=te*er)(mail=*))(!(cn=a\\2ab)))")
+    if e != nil {
+        t.Fatal(e)
+    }
+    n, _ := berParse(f[0], f[2:])
+    if n.tag != 0xa0 || len(n.items) != 3 || n.items[1].items[1].tag != 0x87 {
+        t.Fatalf("unexpected filter %#v", n)
+    }
+    if v := n.items[2].items[0].items[1].data; string(v) != "a*b" {
+        t.Errorf("unexpected value %q", v)
+    }
+    for _, i := range []string{"(uid=a", "(&(uid=a)", "((uid=a))", "(uid=\\2)", "(=a)"} {
+        if _, e := ldapFilter(i); e == nil {
+            t.Errorf("%s must be rejected", i)
+        }
+    }
+}
+
+func TestLDAPAuthenticator(t *testing.T) {
+    s, cfg := newLDAPStub(t)
+    defer s.ln.Close()
+    p := &LDAPAuthenticator{URL: s.URL(), StartTLS: true, TLSConfig: cfg, BindDN: "cn=svc,dc=example,dc=com",
+        BindPWD: "svc", BaseDN: "dc=example,dc=com", UserFilter: "(&(objectClass=person)(uid=%s))",
+        GroupFilter: "(member=%s)", GroupMap: SMap{"admins": "ADMIN", "operators": "OPR"}, PoolSize: 1}
+
+    z, e := p.Authenticate(nil, "tester", "rahasia")
+    if e != nil {
+        t.Fatal(e)
+    }
+    if z.USR != "tester" || len(z.GID) != 2 || z.GID["ADMIN"] != "Admins" || z.GID["OPR"] != "Operators" {
+        t.Errorf("unexpected identity %+v", z)
+    }
+    if _, e := p.Authenticate(nil, "tester", "salah"); e != ErrInvalidCredentials {
+        t.Errorf("expected ErrInvalidCredentials. received %v", e)
+    }
+    // filter injection tidak boleh match user lain
+    if _, e := p.Authenticate(nil, "*", "rahasia"); e != ErrInvalidCredentials {
+        t.Errorf("expected ErrInvalidCredentials. received %v", e)
+    }
+    if _, e := p.Authenticate(nil, "tester", ""); e != ErrInvalidCredentials {
+        t.Error("empty password must be rejected")
+    }
+    if _, e := p.Authenticate(nil, "tester", "rahasia"); e != nil {
+        t.Fatal(e)
+    }
+    // koneksi di-reuse melalui pool
+    s.lock.Lock()
+    dials := s.dials
+    s.lock.Unlock()
+    if dials != 1 {
+        t.Errorf("expected 1 connection. received %d", dials)
+    }
+
+    p = &LDAPAuthenticator{URL: s.URL(), StartTLS: true, TLSConfig: cfg, BindDN: "cn=svc,dc=example,dc=com",
+        BindPWD: "wrong", BaseDN: "dc=example,dc=com"}
+    if _, e := p.Authenticate(nil, "tester", "rahasia"); e == nil || e == ErrInvalidCredentials {
+        t.Errorf("service account failure must not be reported as invalid credentials. received %v", e)
+    }
+}
@@ -0,0 +1,346 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Pelacakan percobaan login (per USR dan per IP), lockout sementara dan deteksi anomali
+//
+// Setiap login gagal (Context.Login) menambah counter USR dan IP dalam window
+// LOGIN_WINDOW detik (default 900):
+//
+//      LOGIN_DELAY_AFTER   mulai gagal ke-n (default 3), percobaan berikutnya harus
+//                          menunggu 1, 2, 4 ... detik, maksimal LOGIN_MAX_DELAY (default
+//                          30). Percobaan sebelum waktunya ditolak (429 + Retry-After)
+//      LOGIN_MAX_FAILS     USR dikunci selama LOGIN_LOCK_SECONDS (default 5 dan 900)
+//      LOGIN_IP_MAX_FAILS  IP dikunci selama LOGIN_LOCK_SECONDS (default 20)
+//
+// Login berhasil me-reset counter USR. Lockout dikirim ke LockoutNotifier yang
+// didaftarkan aplikasi (email, sms dst) dan dicatat di st_logs (WARN). IP client sama
+// seperti allow-list API key (RemoteAddr atau header API_KEY_IP_HEADER)
+//
+// Anomali dicatat di st_logs dengan level FRAUD:
+//   1. USR login berhasil dari lebih dari LOGIN_MAX_IPS IP berbeda (default 5) dalam
+//      LOGIN_IP_WINDOW detik (default 3600)
+//   2. InvalidGIDException berulang (LOGIN_GID_MAX, default 5) dalam LOGIN_WINDOW
+//
+// Counter disimpan di Cache (per instance)
+package tlkm
+
+import (
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+type (
+    // Login ditolak karena lockout (Locked) atau progressive delay
+    LoginLocked struct {
+        Until   time.Time
+        Locked  bool
+    }
+
+    // Notifikasi lockout USR (IP kosong) atau IP (USR kosong)
+    LockoutNotifier func(conn *Connection, USR, IP string, until time.Time)
+
+    // Admin lockout, di embed oleh handler modul (secure)
+    //
+    //  GET     USR=<username>|ADDR=<ip>    status lockout
+    //  DELETE  USR=<username>|ADDR=<ip>    unlock
+    LockoutService struct {
+        NotAllowedService
+    }
+
+    // ** private **
+    loginCounter struct {
+        Fails       int
+        First       time.Time
+        Next        time.Time   // progressive delay
+        Locked      time.Time   // lockout sampai
+        Reported    bool        // anomali sudah dicatat dalam window ini
+    }
+)
+
+var (
+    // ** private **
+    lockoutNotifier LockoutNotifier
+    loginMutex      sync.Mutex
+)
+
+func (self *LoginLocked) Error() string {
+    if self.Locked {
+        return "LoginLockedException: locked until " + self.Until.Format(sqlDatetime)
+    }
+    return "LoginThrottledException: retry after " + self.Until.Format(sqlDatetime)
+}
+
+// Detik sampai login boleh dicoba lagi
+func (self *LoginLocked) RetryAfter() int {
+    n := int(time.Until(self.Until) / time.Second) + 1
+    if n < 1 {
+        n = 1
+    }
+    return n
+}
+
+func ExportLockoutNotifier(f LockoutNotifier) {
+    lockoutNotifier = f
+}
+
+func loginConfig(k string, d int) int {
+    if v, b := Cache.Int(k); b {
+        return v
+    }
+    return d
+}
+
+// Counter key yang masih dalam window (atau terkunci), tanpa membentuk counter baru
+func loginCounterFind(k string, now time.Time) (*loginCounter, bool) {
+    if v, b := Cache.Get(k); b {
+        if c, b := v.(*loginCounter); b {
+            if now.Before(c.Locked) || now.Sub(c.First) < time.Duration(loginConfig("LOGIN_WINDOW", 900)) * time.Second {
+                return c, true
+            }
+        }
+    }
+    return nil, false
+}
+
+// Counter key dalam window. Counter yang sudah melewati window (dan tidak terkunci)
+// dimulai ulang
+func loginCounterOf(k string, now time.Time) *loginCounter {
+    if c, b := loginCounterFind(k, now); b {
+        return c
+    }
+    c := &loginCounter{First: now}
+    Cache.Set(k, c, loginCounterTTL())
+    return c
+}
+
+// TTL cache counter (detik): cukup untuk window, lock maupun delay. Di-set ulang setiap
+// Locked/Next berubah agar counter tidak expire sebelum lock berakhir
+func loginCounterTTL() time.Duration {
+    window := loginConfig("LOGIN_WINDOW", 900)
+    if lock := loginConfig("LOGIN_LOCK_SECONDS", 900); lock > window {
+        window = lock
+    }
+    if d := loginConfig("LOGIN_MAX_DELAY", 30); d > window {
+        window = d
+    }
+    return time.Duration(window)
+}
+
+func loginKeys(USR, IP string) (List) {
+    z := List{}
+    if USR != "" {
+        z = append(z, "login:usr:" + USR)
+    }
+    if IP != "" {
+        z = append(z, "login:ip:" + IP)
+    }
+    return z
+}
+
+// Error *LoginLocked jika USR atau IP sedang dikunci atau belum melewati delay
+func loginAllowed(USR, IP string, now time.Time) error {
+    loginMutex.Lock()
+    defer loginMutex.Unlock()
+    for _, k := range loginKeys(USR, IP) {
+        c, b := loginCounterFind(k, now)
+        if !b {
+            continue
+        }
+        if now.Before(c.Locked) {
+            return &LoginLocked{Until: c.Locked, Locked: true}
+        }
+        if now.Before(c.Next) {
+            return &LoginLocked{Until: c.Next}
+        }
+    }
+    return nil
+}
+
+// Catat login gagal. Return true jika USR atau IP menjadi terkunci
+func loginFailed(conn *Connection, ctx *Context, USR, IP string, now time.Time) bool {
+    type lockout struct {
+        USR, IP string
+        until   time.Time
+    }
+    locked := make([]lockout, 0)
+    loginMutex.Lock()
+    for _, k := range loginKeys(USR, IP) {
+        c := loginCounterOf(k, now)
+        c.Fails++
+        max := loginConfig("LOGIN_MAX_FAILS", 5)
+        if strings.HasPrefix(k, "login:ip:") {
+            max = loginConfig("LOGIN_IP_MAX_FAILS", 20)
+        }
+        if max > 0 && c.Fails >= max && !now.Before(c.Locked) {
+            c.Locked = now.Add(time.Duration(loginConfig("LOGIN_LOCK_SECONDS", 900)) * time.Second)
+            c.Fails = 0
+            c.First = now
+            Cache.Set(k, c, loginCounterTTL())
+            if strings.HasPrefix(k, "login:ip:") {
+                locked = append(locked, lockout{IP: IP, until: c.Locked})
+            } else {
+                locked = append(locked, lockout{USR: USR, until: c.Locked})
+            }
+            continue
+        }
+        if n := c.Fails - loginConfig("LOGIN_DELAY_AFTER", 3); n >= 0 {
+            d := loginConfig("LOGIN_MAX_DELAY", 30)
+            if n < 16 && 1 << uint(n) < d {
+                d = 1 << uint(n)
+            }
+            c.Next = now.Add(time.Duration(d) * time.Second)
+            Cache.Set(k, c, loginCounterTTL())
+        }
+    }
+    loginMutex.Unlock()
+    for _, j := range locked {
+        loginLog(ctx, WARN, "LoginLockedException: " + j.USR + j.IP + " locked until " + j.until.Format(sqlDatetime), j.USR)
+        if lockoutNotifier != nil {
+            lockoutNotifier(conn, j.USR, j.IP, j.until)
+        }
+    }
+    return len(locked) > 0
+}
+
+// Login berhasil: reset counter USR dan periksa anomali multi IP. Return true jika
+// anomali dicatat
+func loginSucceeded(ctx *Context, USR, IP string, now time.Time) bool {
+    Cache.Delete("login:usr:" + USR)
+    if IP == "" {
+        return false
+    }
+    window := time.Duration(loginConfig("LOGIN_IP_WINDOW", 3600)) * time.Second
+    loginMutex.Lock()
+    ips := make(map[string]time.Time)
+    if v, b := Cache.Get("login:ips:" + USR); b {
+        if m, b := v.(map[string]time.Time); b {
+            for k, t := range m {
+                if now.Sub(t) < window {
+                    ips[k] = t
+                }
+            }
+        }
+    }
+    ips[IP] = now
+    Cache.Set("login:ips:" + USR, ips, window / time.Second)
+    _, reported := Cache.Get("login:ips-reported:" + USR)
+    anomaly := len(ips) > loginConfig("LOGIN_MAX_IPS", 5) && !reported
+    if anomaly {
+        Cache.Set("login:ips-reported:" + USR, true, window / time.Second)
+    }
+    loginMutex.Unlock()
+    if anomaly {
+        loginLog(ctx, FRAUD, "LoginAnomalyException: " + USR + " login dari " + strconv.Itoa(len(ips)) + " IP dalam " + window.String(), USR)
+    }
+    return anomaly
+}
+
+// InvalidGIDException dari ServeHTTP. Return true jika anomali dicatat
+func gidViolation(ctx *Context) bool {
+    USR, _ := ctx.SessionUser()
+    now := time.Now()
+    loginMutex.Lock()
+    c := loginCounterOf("login:gid:" + USR, now)
+    c.Fails++
+    anomaly := c.Fails >= loginConfig("LOGIN_GID_MAX", 5) && !c.Reported
+    if anomaly {
+        c.Reported = true
+    }
+    loginMutex.Unlock()
+    if anomaly {
+        loginLog(ctx, FRAUD, "InvalidGIDException berulang: " + USR + " (" + strconv.Itoa(c.Fails) + "x), GID terakhir " + ctx.GID, USR)
+    }
+    return anomaly
+}
+
+func loginLog(ctx *Context, level int, message, USR string) {
+    if ctrl == nil {
+        return
+    }
+    URI, ADDR := "", ""
+    if ctx != nil && ctx.Request != nil {
+        URI, ADDR = ctx.Request.URL.Path, ctx.ClientIP()
+    }
+    ctrl.Log(level, message, URI, USR, ADDR)
+}
+
+func loginAddr(ctx *Context) string {
+    if ip := apiKeyIP(ctx); ip != nil {
+        return ip.String()
+    }
+    return ""
+}
+
+// Status lockout USR (atau IP jika USR kosong)
+func LoginLockStatus(USR, IP string) (until time.Time, fails int) {
+    k := "login:ip:" + IP
+    if USR != "" {
+        k = "login:usr:" + USR
+    }
+    loginMutex.Lock()
+    defer loginMutex.Unlock()
+    if c, b := loginCounterFind(k, time.Now()); b {
+        return c.Locked, c.Fails
+    }
+    return
+}
+
+// Hapus lockout dan counter USR dan/atau IP
+func UnlockLogin(USR, IP string) {
+    loginMutex.Lock()
+    defer loginMutex.Unlock()
+    for _, k := range loginKeys(USR, IP) {
+        Cache.Delete(k)
+    }
+}
+
+// Status http untuk error login yang ditolak tracker, Retry-After diset pada response
+func lockoutResponse(ctx *Context, e error) bool {
+    l, b := e.(*LoginLocked)
+    if !b {
+        return false
+    }
+    ctx.Header("Retry-After", strconv.Itoa(l.RetryAfter()))
+    if l.Locked {
+        ctx.Code(StatusLocked).Warn(e.Error())
+    } else {
+        ctx.Code(StatusTooManyRequests).Warn(e.Error())
+    }
+    return true
+}
+
+func (self *LockoutService) GET(conn *Connection, ctx *Context) {
+    USR, IP := ctx.Get("USR"), ctx.Get("ADDR")
+    if USR == "" && IP == "" {
+        ctx.Code(StatusBadRequest).Warn("EmptyParameterException: USR atau ADDR")
+        return
+    }
+    until, fails := LoginLockStatus(USR, IP)
+    z := GMap{"USR": USR, "ADDR": IP, "fails": fails, "locked": time.Now().Before(until)}
+    if time.Now().Before(until) {
+        z["until"] = until.Format(sqlDatetime)
+    }
+    ctx.Data(z)
+}
+
+func (self *LockoutService) DELETE(conn *Connection, ctx *Context) {
+    USR, IP := ctx.Get("USR"), ctx.Get("ADDR")
+    if USR == "" && IP == "" {
+        ctx.Code(StatusBadRequest).Warn("EmptyParameterException: USR atau ADDR")
+        return
+    }
+    UnlockLogin(USR, IP)
+    ctx.Code(StatusOK).Message("unlocked")
+}
@@ -0,0 +1,142 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "net/url"
+    "testing"
+    "time"
+)
+
+func TestLoginLockout(t *testing.T) {
+    defer UnlockLogin("locked", "10.9.9.9")
+    notified := ""
+    ExportLockoutNotifier(func(conn *Connection, USR, IP string, until time.Time) {
+        notified += USR + IP
+    })
+    defer ExportLockoutNotifier(nil)
+
+    ctx := testContext("", url.Values{})
+    now := time.Now()
+    for i := 1; i <= 4; i++ {
+        if e := loginAllowed("locked", "10.9.9.9", now); e != nil {
+            t.Fatalf("attempt %d: %v", i, e)
+        }
+        if loginFailed(nil, ctx, "locked", "10.9.9.9", now) {
+            t.Fatalf("attempt %d must not lock", i)
+        }
+        if i >= 3 {
+            // progressive delay 1, 2 detik
+            e, b := loginAllowed("locked", "10.9.9.9", now).(*LoginLocked)
+            if !b || e.Locked || e.Until.Sub(now) != time.Duration(1 << uint(i - 3)) * time.Second {
+                t.Fatalf("attempt %d: expected delay. received %v", i, e)
+            }
+            now = e.Until
+        }
+    }
+    if !loginFailed(nil, ctx, "locked", "10.9.9.9", now) || notified != "locked" {
+        t.Fatalf("expected lockout notification. received %q", notified)
+    }
+    e, b := loginAllowed("locked", "10.1.1.1", now).(*LoginLocked)
+    if !b || !e.Locked || e.RetryAfter() < 800 {
+        t.Fatalf("expected locked USR. received %v", e)
+    }
+    if e, b := loginAllowed("other", "10.9.9.9", now).(*LoginLocked); b && e.Locked {
+        t.Errorf("IP must not be locked yet: %v", e)
+    }
+    if until, _ := LoginLockStatus("locked", ""); !until.After(now) {
+        t.Error("expected lock status")
+    }
+    lockoutResponse(ctx, e)
+    if ctx.code != StatusLocked || ctx.Response.Header().Get("Retry-After") == "" {
+        t.Errorf("unexpected response %d", ctx.code)
+    }
+    UnlockLogin("locked", "")
+    if e := loginAllowed("locked", "10.1.1.1", now); e != nil {
+        t.Errorf("expected unlocked: %v", e)
+    }
+    // status/pemeriksaan tidak membentuk counter
+    if until, fails := LoginLockStatus("nobody", ""); !until.IsZero() || fails != 0 {
+        t.Errorf("unexpected status %v %d", until, fails)
+    }
+    keys := List{"login:usr:nobody", "login:usr:other"}
+    for _, k := range keys {
+        if _, b := Cache.Get(k); b {
+            t.Errorf("unexpected counter %s", k)
+        }
+    }
+}
+
+func TestLoginAnomaly(t *testing.T) {
+    Cache.Set("LOGIN_MAX_IPS", 2)
+    defer Cache.Delete("LOGIN_MAX_IPS")
+    defer Cache.Delete("login:ips:roaming")
+    defer Cache.Delete("login:ips-reported:roaming")
+
+    ctx := testContext("", url.Values{})
+    now := time.Now()
+    for i, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.1"} {
+        if loginSucceeded(ctx, "roaming", ip, now) {
+            t.Errorf("login %d must not be an anomaly", i)
+        }
+    }
+    if !loginSucceeded(ctx, "roaming", "10.0.0.3", now) {
+        t.Error("expected anomaly from 3 IPs")
+    }
+    if loginSucceeded(ctx, "roaming", "10.0.0.4", now) {
+        t.Error("anomaly must be reported once per window")
+    }
+
+    ctx.sesMap = GMap{"USR": "prober"}
+    defer Cache.Delete("login:gid:prober")
+    n := 0
+    for i := 0; i < 7; i++ {
+        if gidViolation(ctx) {
+            n++
+        }
+    }
+    if n != 1 {
+        t.Errorf("expected 1 FRAUD entry. received %d", n)
+    }
+}
+
+// Lock yang di-set menjelang akhir TTL counter harus memperpanjang TTL
+func TestLoginLockTTL(t *testing.T) {
+    defer UnlockLogin("ttl", "")
+    ctx := testContext("", url.Values{})
+    now := time.Now()
+    loginFailed(nil, ctx, "ttl", "", now)
+    Cache.Extend("login:usr:ttl", 1)
+    for i := 0; i < 4; i++ {
+        loginFailed(nil, ctx, "ttl", "", now)
+    }
+    v, _ := Cache.items.Load("login:usr:ttl")
+    c := v.(value).Object.(*loginCounter)
+    if !now.Before(c.Locked) || v.(value).expire < c.Locked.Unix() {
+        t.Errorf("counter expires before lock: %d < %d", v.(value).expire, c.Locked.Unix())
+    }
+}
+
+// Ganti password tanpa session melalui tracker yang sama dengan login
+func TestPasswordChangeLocked(t *testing.T) {
+    defer UnlockLogin("pwd-locked", "")
+    ctx := testContext("", url.Values{"USR": {"pwd-locked"}, "PWD": {"guess"}, "NEW": {"new"}})
+    for i := 0; i < 5; i++ {
+        loginFailed(nil, ctx, "pwd-locked", "", time.Now())
+    }
+    (&PasswordService{}).PUT(nil, ctx)
+    if ctx.code != StatusLocked {
+        t.Errorf("expected locked. received %d", ctx.code)
+    }
+}
@@ -63,7 +63,7 @@ func (self *Logger) LogSync(logLv int, message string, args ...string) (ID int64
         "LGLV": logLv,
         "NAMESPACE": self.logNs,
         "MSG": message,
-        "@LOGT": "CURRENT_TIMESTAMP",
+        "@LOGT": SQL.now(conn.driver),
     }
     arln := len(args)
     if arln > 0 { argv["URI"] = args[0] }
@@ -0,0 +1,562 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Two-factor authentication TOTP (RFC 6238: HMAC-SHA1, 6 digit, periode 30 detik)
+//
+// Login dengan password (Context.Login) tidak langsung membentuk session jika user
+// sudah enroll TOTP atau termasuk group yang diwajibkan (config MFA_GROUPS, GID
+// dipisahkan koma). Identity disimpan sebagai pending login (ticket, 5 menit, maksimal
+// 5 percobaan) dan Login mengembalikan *MFARequired. Session baru dibentuk setelah
+// LoginMFA berhasil memverifikasi kode TOTP atau recovery code
+//
+// User group wajib yang belum enroll mendapat ticket enroll: enrollment dilakukan
+// dengan ticket tersebut lalu dikonfirmasi dengan kode pertama (MFAService)
+//
+// Secret TOTP disimpan terenkripsi (AES-256-GCM) dengan key dari environment MFA_KEY
+// (32 byte, hex atau base64). Recovery code dan token remembered-device hanya disimpan
+// hash-nya. Remembered device (cookie SAFMFA) berlaku MFA_REMEMBER_DAYS hari (default
+// 30, 0 untuk menonaktifkan)
+//
+// Tabel:
+//
+//      st_user_mfa             (USR, SECRET, ENABLED, LAST_STEP, CREATED_AT)
+//      st_user_recovery_codes  (USR, CODE, USED)
+//      st_mfa_devices          (TOKEN, USR, EXPIRES_AT)
+//
+// Login melalui OIDC tidak melalui TOTP framework, second factor menjadi tanggung jawab
+// identity provider
+package tlkm
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha1"
+    "crypto/sha256"
+    "encoding/base32"
+    "encoding/base64"
+    "encoding/binary"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/url"
+    "os"
+    "strings"
+    "time"
+)
+
+type (
+    // Error Context.Login jika second factor dibutuhkan
+    MFARequired struct {
+        Ticket  string
+        Enroll  bool    // user belum enroll, ticket hanya untuk enrollment
+    }
+
+    // Two-factor API, di export tanpa session (SEC false) karena digunakan sebelum login
+    //
+    //  POST    TICKET=<ticket>&CODE=<kode>[&REMEMBER=1]    verifikasi login
+    //  POST    TICKET=<ticket>                             enrollment (ticket enroll)
+    //  PUT     (session)                                   enrollment
+    //  PUT     (session) CODE=<kode>                       konfirmasi enrollment
+    //  PUT     (session) CODE=<kode saat ini>              re-enrollment (TOTP aktif)
+    //  DELETE  (session) CODE=<kode>                       nonaktifkan TOTP
+    MFAService struct {
+        NotAllowedService
+    }
+
+    // ** private **
+    // pending login
+    mfaTicket struct {
+        identity    *Identity
+        enroll      bool
+        attempts    int
+    }
+)
+
+const (
+    // ** private **
+    totpPeriod      = 30
+    totpDigits      = 6
+    mfaCookie       = "SAFMFA"
+    mfaTicketExpiry = 300
+    mfaMaxAttempts  = 5
+    mfaRecoveryCodes = 10
+)
+
+var (
+    ErrInvalidMFACode = errors.New("MFAException: invalid code")
+
+    // ** private **
+    base32NoPad = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+func (self *MFARequired) Error() string {
+    if self.Enroll {
+        return "MFARequiredException: enrollment required"
+    }
+    return "MFARequiredException: second factor required"
+}
+
+// ** TOTP **
+
+// Secret baru (160 bit, base32)
+func GenerateTOTPSecret() string {
+    b := make([]byte, 20)
+    rand.Read(b)
+    return base32NoPad.EncodeToString(b)
+}
+
+func totpKey(secret string) ([]byte, error) {
+    return base32NoPad.DecodeString(strings.ToUpper(strings.TrimRight(strings.Replace(secret, " ", "", -1), "=")))
+}
+
+// HOTP (RFC 4226) untuk counter
+func hotp(key []byte, counter int64) string {
+    msg := make([]byte, 8)
+    binary.BigEndian.PutUint64(msg, uint64(counter))
+    m := hmac.New(sha1.New, key)
+    m.Write(msg)
+    h := m.Sum(nil)
+    o := h[len(h)-1] & 0x0f
+    v := binary.BigEndian.Uint32(h[o:o+4]) & 0x7fffffff
+    return fmt.Sprintf("%0*d", totpDigits, v % 1000000)
+}
+
+// Kode TOTP pada waktu t
+func TOTPCode(secret string, t time.Time) (string, error) {
+    key, e := totpKey(secret)
+    if e != nil {
+        return "", e
+    }
+    return hotp(key, t.Unix() / totpPeriod), nil
+}
+
+// Validasi kode dengan toleransi 1 periode (clock skew). Kode dengan step <= last
+// (sudah pernah digunakan) ditolak untuk mencegah replay. Return step yang cocok
+func ValidateTOTP(secret, code string, t time.Time, last int64) (int64, bool) {
+    key, e := totpKey(secret)
+    if e != nil || len(code) != totpDigits {
+        return 0, false
+    }
+    now := t.Unix() / totpPeriod
+    for _, step := range []int64{now - 1, now, now + 1} {
+        if step > last && hmac.Equal([]byte(hotp(key, step)), []byte(code)) {
+            return step, true
+        }
+    }
+    return 0, false
+}
+
+// URI provisioning (Key URI Format), di-render sebagai QR code oleh client. Issuer dari
+// config MFA_ISSUER (default goframework)
+func TOTPProvisioningURI(USR, secret string) string {
+    issuer, _ := Cache.String("MFA_ISSUER")
+    if issuer == "" {
+        issuer = "goframework"
+    }
+    q := url.Values{}
+    q.Set("secret", secret)
+    q.Set("issuer", issuer)
+    q.Set("algorithm", "SHA1")
+    q.Set("digits", fmt.Sprint(totpDigits))
+    q.Set("period", fmt.Sprint(totpPeriod))
+    return "otpauth://totp/" + url.PathEscape(issuer + ":" + USR) + "?" + q.Encode()
+}
+
+// ** enkripsi secret **
+
+func mfaKey() ([]byte, error) {
+    v := os.Getenv("MFA_KEY")
+    if b, e := hex.DecodeString(v); e == nil && len(b) == 32 {
+        return b, nil
+    }
+    if b, e := base64.StdEncoding.DecodeString(v); e == nil && len(b) == 32 {
+        return b, nil
+    }
+    return nil, errors.New("MFAKeyException: environment MFA_KEY harus 32 byte (hex atau base64)")
+}
+
+func mfaCipher() (cipher.AEAD, error) {
+    key, e := mfaKey()
+    if e != nil {
+        return nil, e
+    }
+    b, e := aes.NewCipher(key)
+    if e != nil {
+        return nil, e
+    }
+    return cipher.NewGCM(b)
+}
+
+// base64(nonce | ciphertext), USR sebagai additional data agar secret tidak bisa
+// dipindahkan ke user lain
+func encryptSecret(USR, secret string) (string, error) {
+    g, e := mfaCipher()
+    if e != nil {
+        return "", e
+    }
+    nonce := make([]byte, g.NonceSize())
+    if _, e := rand.Read(nonce); e != nil {
+        return "", e
+    }
+    return base64.StdEncoding.EncodeToString(g.Seal(nonce, nonce, []byte(secret), []byte(USR))), nil
+}
+
+func decryptSecret(USR, v string) (string, error) {
+    g, e := mfaCipher()
+    if e != nil {
+        return "", e
+    }
+    b, e := base64.StdEncoding.DecodeString(v)
+    if e != nil || len(b) < g.NonceSize() {
+        return "", errors.New("MFAException: secret tidak valid")
+    }
+    s, e := g.Open(nil, b[:g.NonceSize()], b[g.NonceSize():], []byte(USR))
+    if e != nil {
+        return "", errors.New("MFAException: secret tidak valid")
+    }
+    return string(s), nil
+}
+
+// ** recovery code **
+
+// XXXXX-XXXXX (base32)
+func newRecoveryCode() string {
+    b := make([]byte, 7)
+    rand.Read(b)
+    v := base32NoPad.EncodeToString(b)[:10]
+    return v[:5] + "-" + v[5:]
+}
+
+func recoveryHash(code string) string {
+    h := sha256.Sum256([]byte(strings.ToUpper(strings.Replace(strings.TrimSpace(code), "-", "", -1))))
+    return hex.EncodeToString(h[:])
+}
+
+// ** persistence **
+
+// Enrollment baru (atau ulang): secret dan recovery code diganti, TOTP aktif setelah
+// dikonfirmasi ConfirmTOTP
+func EnrollTOTP(conn *Connection, USR string) (secret, uri string, recovery List, e error) {
+    secret = GenerateTOTPSecret()
+    enc, e := encryptSecret(USR, secret)
+    if e != nil {
+        return
+    }
+    for i := 0; i < mfaRecoveryCodes; i++ {
+        recovery = append(recovery, newRecoveryCode())
+    }
+    tx := conn.Begin()
+    defer func() {
+        if e != nil {
+            tx.Rollback()
+        }
+    }()
+    if _, e = tx.Exec("DELETE FROM st_user_mfa WHERE USR=?", USR); e != nil {
+        return
+    }
+    if _, e = tx.Exec("INSERT INTO st_user_mfa(USR,SECRET,ENABLED,LAST_STEP,CREATED_AT) VALUES (?,?,'0',0,?)",
+        USR, enc, time.Now().Format(sqlDatetime)); e != nil {
+        return
+    }
+    if _, e = tx.Exec("DELETE FROM st_user_recovery_codes WHERE USR=?", USR); e != nil {
+        return
+    }
+    for _, i := range recovery {
+        if _, e = tx.Exec("INSERT INTO st_user_recovery_codes(USR,CODE,USED) VALUES (?,?,'0')", USR, recoveryHash(i)); e != nil {
+            return
+        }
+    }
+    if e = tx.Commit(); e == nil {
+        uri = TOTPProvisioningURI(USR, secret)
+    }
+    return
+}
+
+// Secret dan status enrollment
+func totpSecret(conn *Connection, USR string) (secret string, enabled bool, last int64, e error) {
+    rows := conn.Query("SELECT SECRET,ENABLED,LAST_STEP FROM st_user_mfa WHERE USR=?", USR)
+    defer rows.Close()
+    if !rows.Next() {
+        return "", false, 0, errors.New("MFAException: TOTP belum di-enroll")
+    }
+    enabled, last = rows.Bool("ENABLED"), int64(rows.Int("LAST_STEP"))
+    secret, e = decryptSecret(USR, rows.String("SECRET"))
+    return
+}
+
+// Verifikasi kode TOTP (dan simpan step untuk mencegah replay)
+func verifyTOTP(conn *Connection, USR, code string, confirm bool) error {
+    secret, enabled, last, e := totpSecret(conn, USR)
+    if e != nil {
+        return e
+    }
+    if enabled == confirm {
+        return ErrInvalidMFACode
+    }
+    step, ok := ValidateTOTP(secret, code, time.Now(), last)
+    if !ok {
+        return ErrInvalidMFACode
+    }
+    r, e := conn.Exec("UPDATE st_user_mfa SET LAST_STEP=?,ENABLED='1' WHERE USR=? AND LAST_STEP<?", step, USR, step)
+    if e != nil {
+        return e
+    }
+    if n, _ := r.RowsAffected(); n == 0 {   // request paralel dengan kode yang sama
+        return ErrInvalidMFACode
+    }
+    return nil
+}
+
+// Aktifkan TOTP dengan kode pertama dari authenticator
+func ConfirmTOTP(conn *Connection, USR, code string) error {
+    return verifyTOTP(conn, USR, code, true)
+}
+
+// Nonaktifkan TOTP beserta recovery code dan remembered device
+func DisableTOTP(conn *Connection, USR string) error {
+    tables := List{"st_user_mfa", "st_user_recovery_codes", "st_mfa_devices"}
+    for _, i := range tables {
+        if _, e := conn.Exec("DELETE FROM " + i + " WHERE USR=?", USR); e != nil {
+            return e
+        }
+    }
+    return nil
+}
+
+// TOTP sudah aktif
+func MFAEnabled(conn *Connection, USR string) bool {
+    rows := conn.Query("SELECT USR FROM st_user_mfa WHERE USR=? AND ENABLED='1'", USR)
+    defer rows.Close()
+    return rows.Next()
+}
+
+// Verifikasi second factor: kode TOTP atau recovery code (1x pakai)
+func VerifyMFA(conn *Connection, USR, code string) error {
+    code = strings.TrimSpace(code)
+    if len(code) == totpDigits {
+        return verifyTOTP(conn, USR, code, false)
+    }
+    r, e := conn.Exec("UPDATE st_user_recovery_codes SET USED='1' WHERE USR=? AND CODE=? AND USED='0'", USR, recoveryHash(code))
+    if e != nil {
+        return e
+    }
+    if n, _ := r.RowsAffected(); n == 0 {
+        return ErrInvalidMFACode
+    }
+    return nil
+}
+
+// User termasuk group yang diwajibkan two-factor
+func mfaEnforced(GID map[string]string) bool {
+    v, _ := Cache.String("MFA_GROUPS")
+    for _, i := range strings.Split(v, ",") {
+        if _, b := GID[strings.TrimSpace(i)]; b {
+            return true
+        }
+    }
+    return false
+}
+
+// ** remembered device **
+
+func mfaRememberDays() int {
+    if v, b := Cache.Int("MFA_REMEMBER_DAYS"); b {
+        return v
+    }
+    return 30
+}
+
+func (self *Context) rememberDevice(conn *Connection, USR string) {
+    days := mfaRememberDays()
+    if days <= 0 {
+        return
+    }
+    b := make([]byte, 32)
+    rand.Read(b)
+    token := base64.RawURLEncoding.EncodeToString(b)
+    h := sha256.Sum256([]byte(token))
+    if _, e := conn.Exec("INSERT INTO st_mfa_devices(TOKEN,USR,EXPIRES_AT) VALUES (?,?,?)",
+        hex.EncodeToString(h[:]), USR, time.Now().AddDate(0, 0, days).Format(sqlDatetime)); e != nil {
+        return
+    }
+    http.SetCookie(self.Response, &http.Cookie{Name: mfaCookie, Value: token, MaxAge: days * 86400,
+        Path: FileSeparator, HttpOnly: true, Secure: self.Request.TLS != nil, SameSite: http.SameSiteStrictMode})
+}
+
+func (self *Context) rememberedDevice(conn *Connection, USR string) bool {
+    token := self.Cookie(mfaCookie)
+    if token == "" || mfaRememberDays() <= 0 {
+        return false
+    }
+    h := sha256.Sum256([]byte(token))
+    rows := conn.Query("SELECT USR FROM st_mfa_devices WHERE TOKEN=? AND USR=? AND EXPIRES_AT>?",
+        hex.EncodeToString(h[:]), USR, time.Now().Format(sqlDatetime))
+    defer rows.Close()
+    return rows.Next()
+}
+
+// ** login **
+
+// Identity menjadi pending login jika second factor dibutuhkan
+func (self *Context) mfaChallenge(conn *Connection, z *Identity) error {
+    enabled := MFAEnabled(conn, z.USR)
+    if !enabled && !mfaEnforced(z.GID) {
+        return nil
+    }
+    if enabled && self.rememberedDevice(conn, z.USR) {
+        return nil
+    }
+    b := make([]byte, 32)
+    rand.Read(b)
+    ticket := base64.RawURLEncoding.EncodeToString(b)
+    Cache.Set("mfa:" + ticket, &mfaTicket{identity: z, enroll: !enabled}, time.Duration(mfaTicketExpiry))
+    return &MFARequired{Ticket: ticket, Enroll: !enabled}
+}
+
+func mfaPending(ticket string) (*mfaTicket, bool) {
+    if ticket == "" {
+        return nil, false
+    }
+    v, b := Cache.Get("mfa:" + ticket)
+    if !b {
+        return nil, false
+    }
+    t, b := v.(*mfaTicket)
+    return t, b
+}
+
+// Selesaikan login dengan second factor. Ticket dihapus setelah berhasil atau
+// setelah mfaMaxAttempts percobaan gagal. Kode yang salah dicatat sebagai login gagal
+// (lockout.go), counter USR baru di-reset setelah second factor berhasil
+func (self *Context) LoginMFA(conn *Connection, ticket, code string, remember bool) error {
+    t, b := mfaPending(ticket)
+    if !b {
+        return errors.New("MFAException: ticket tidak valid atau expired")
+    }
+    IP, now := loginAddr(self), time.Now()
+    if e := loginAllowed(t.identity.USR, IP, now); e != nil {
+        return e
+    }
+    var e error
+    if t.enroll {
+        e = ConfirmTOTP(conn, t.identity.USR, code)
+    } else {
+        e = VerifyMFA(conn, t.identity.USR, code)
+    }
+    if e != nil {
+        if t.attempts++; t.attempts >= mfaMaxAttempts {
+            Cache.Delete("mfa:" + ticket)
+        }
+        loginFailed(conn, self, t.identity.USR, IP, now)
+        return e
+    }
+    Cache.Delete("mfa:" + ticket)
+    loginSucceeded(self, t.identity.USR, IP, now)
+    if e := self.LoginIdentity(t.identity); e != nil {
+        return e
+    }
+    self.SessionSet("MFA", true)
+    if remember {
+        self.rememberDevice(conn, t.identity.USR)
+    }
+    return nil
+}
+
+// Status http dan data response untuk error login
+func mfaResponse(ctx *Context, e error) {
+    if lockoutResponse(ctx, e) {
+        return
+    }
+    if v, b := e.(*MFARequired); b {
+        ctx.Code(StatusUnauthorized).Data(GMap{"ticket": v.Ticket, "enroll": v.Enroll}).Warn(e.Error())
+        return
+    }
+    ctx.Code(accountStatus(e)).Warn(e.Error())
+}
+
+func (self *MFAService) impersonationDenied() {}
+
+func (self *MFAService) POST(conn *Connection, ctx *Context) {
+    ticket := ctx.Get("TICKET")
+    if !ctx.Exists("CODE") {
+        t, b := mfaPending(ticket)
+        if !b || !t.enroll {
+            ctx.Code(StatusBadRequest).Warn("MFAException: ticket tidak valid atau expired")
+            return
+        }
+        secret, uri, recovery, e := EnrollTOTP(conn, t.identity.USR)
+        if e != nil {
+            ctx.Code(StatusInternalServerError).Warn(e.Error())
+            return
+        }
+        ctx.Data(GMap{"secret": secret, "uri": uri, "recovery": recovery})
+        return
+    }
+    if e := ctx.LoginMFA(conn, ticket, ctx.Get("CODE"), ctx.Get("REMEMBER") == "1"); e != nil {
+        if !lockoutResponse(ctx, e) {
+            ctx.Code(StatusUnauthorized).Warn(e.Error())
+        }
+        return
+    }
+    USR, _ := ctx.SessionUser()
+    ctx.Data(GMap{"USR": USR})
+}
+
+func (self *MFAService) PUT(conn *Connection, ctx *Context) {
+    USR, b := ctx.SessionUser()
+    if !b {
+        ctx.Code(StatusUnauthorized, true)
+        return
+    }
+    // Enroll ulang mengganti secret aktif (ENABLED kembali '0'), sama seperti DELETE
+    // harus dibuktikan dengan code saat ini
+    if MFAEnabled(conn, USR) {
+        if e := VerifyMFA(conn, USR, ctx.Get("CODE")); e != nil {
+            ctx.Code(StatusBadRequest).Warn(e.Error())
+            return
+        }
+    } else if ctx.Exists("CODE") {
+        if e := ConfirmTOTP(conn, USR, ctx.Get("CODE")); e != nil {
+            ctx.Code(StatusBadRequest).Warn(e.Error())
+            return
+        }
+        ctx.Code(StatusOK).Message("TOTP enabled")
+        return
+    }
+    secret, uri, recovery, e := EnrollTOTP(conn, USR)
+    if e != nil {
+        ctx.Code(StatusInternalServerError).Warn(e.Error())
+        return
+    }
+    ctx.Data(GMap{"secret": secret, "uri": uri, "recovery": recovery})
+}
+
+func (self *MFAService) DELETE(conn *Connection, ctx *Context) {
+    USR, b := ctx.SessionUser()
+    if !b {
+        ctx.Code(StatusUnauthorized, true)
+        return
+    }
+    if e := VerifyMFA(conn, USR, ctx.Get("CODE")); e != nil {
+        ctx.Code(StatusBadRequest).Warn(e.Error())
+        return
+    }
+    if e := DisableTOTP(conn, USR); e != nil {
+        ctx.Code(StatusInternalServerError).Warn(e.Error())
+        return
+    }
+    ctx.Code(StatusOK).Message("TOTP disabled")
+}
@@ -0,0 +1,144 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "net/http/httptest"
+    "os"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestTOTP(t *testing.T) {
+    // RFC 6238 Appendix B (SHA1), 6 digit terakhir
+    secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+    for ts, code := range map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924", 2000000000: "279037"} {
+        if v, _ := TOTPCode(secret, time.Unix(ts, 0)); v != code {
+            t.Errorf("T=%d: expected %s. received %s", ts, code, v)
+        }
+    }
+
+    now := time.Unix(1234567890, 0)
+    prev, _ := TOTPCode(secret, now.Add(-totpPeriod * time.Second))
+    if step, ok := ValidateTOTP(secret, prev, now, 0); !ok || step != now.Unix() / totpPeriod - 1 {
+        t.Error("previous period must be accepted")
+    }
+    old, _ := TOTPCode(secret, now.Add(-3 * totpPeriod * time.Second))
+    if _, ok := ValidateTOTP(secret, old, now, 0); ok {
+        t.Error("expired code must be rejected")
+    }
+    // replay: step yang sudah digunakan ditolak
+    if _, ok := ValidateTOTP(secret, "005924", now, now.Unix() / totpPeriod); ok {
+        t.Error("used step must be rejected")
+    }
+    if _, ok := ValidateTOTP("bukan-base32!", "005924", now, 0); ok {
+        t.Error("invalid secret must be rejected")
+    }
+
+    s := GenerateTOTPSecret()
+    if len(s) != 32 {
+        t.Errorf("unexpected secret %s", s)
+    }
+    uri := TOTPProvisioningURI("tester", s)
+    if !strings.HasPrefix(uri, "otpauth://totp/goframework:tester?") || !strings.Contains(uri, "secret=" + s) {
+        t.Errorf("unexpected uri %s", uri)
+    }
+}
+
+func TestMFASecretEncryption(t *testing.T) {
+    os.Setenv("MFA_KEY", "")
+    if _, e := encryptSecret("tester", "secret"); e == nil {
+        t.Error("missing MFA_KEY must be rejected")
+    }
+    os.Setenv("MFA_KEY", strings.Repeat("ab", 32))
+    defer os.Unsetenv("MFA_KEY")
+
+    v, e := encryptSecret("tester", "GEZDGNBVGY3TQOJQ")
+    if e != nil {
+        t.Fatal(e)
+    }
+    if strings.Contains(v, "GEZDGNBVGY3TQOJQ") {
+        t.Error("secret must be encrypted")
+    }
+    if s, e := decryptSecret("tester", v); e != nil || s != "GEZDGNBVGY3TQOJQ" {
+        t.Errorf("unexpected secret %s %v", s, e)
+    }
+    // ciphertext terikat ke user
+    if _, e := decryptSecret("other", v); e == nil {
+        t.Error("secret must not be decrypted for another user")
+    }
+}
+
+func TestMFARecoveryAndPolicy(t *testing.T) {
+    c := newRecoveryCode()
+    if len(c) != 11 || c[5] != '-' {
+        t.Errorf("unexpected recovery code %s", c)
+    }
+    if recoveryHash(c) != recoveryHash(" " + strings.ToLower(strings.Replace(c, "-", "", 1))) {
+        t.Error("recovery code must be normalized")
+    }
+
+    Cache.Set("MFA_GROUPS", "ADMIN, FINANCE")
+    defer Cache.Delete("MFA_GROUPS")
+    if !mfaEnforced(map[string]string{"FINANCE": "Finance"}) || mfaEnforced(map[string]string{"USER": "User"}) {
+        t.Error("unexpected enforcement")
+    }
+
+    ctx := testContext("", nil)
+    if e := ctx.LoginMFA(nil, "unknown", "123456", false); e == nil {
+        t.Error("unknown ticket must be rejected")
+    }
+    if _, b := ctx.SessionUser(); b {
+        t.Error("session must not be created")
+    }
+
+    // USR yang terkunci tidak bisa menyelesaikan second factor
+    defer UnlockLogin("mfa-locked", "")
+    for i := 0; i < 5; i++ {
+        loginFailed(nil, ctx, "mfa-locked", "", time.Now())
+    }
+    Cache.Set("mfa:locked-ticket", &mfaTicket{identity: &Identity{USR: "mfa-locked"}}, time.Duration(mfaTicketExpiry))
+    defer Cache.Delete("mfa:locked-ticket")
+    if e, b := ctx.LoginMFA(nil, "locked-ticket", "123456", false).(*LoginLocked); !b || !e.Locked {
+        t.Errorf("expected locked USR. received %v", e)
+    }
+}
+
+// EXPIRES_AT remembered device disimpan dan dibandingkan sebagai DATETIME
+func TestRememberedDevice(t *testing.T) {
+    conn, done := testSQLite(t)
+    defer done()
+    if _, e := Migrate(conn, false, "SYST"); e != nil {
+        t.Fatal(e)
+    }
+    ctx := testContext("", nil)
+    ctx.rememberDevice(conn, "tester")
+    z := ctx.Response.(*httptest.ResponseRecorder).Result().Cookies()
+    if len(z) != 1 || z[0].Name != mfaCookie {
+        t.Fatalf("expected %s cookie. received %v", mfaCookie, z)
+    }
+    ctx = testContext("", nil)
+    ctx.Request.AddCookie(z[0])
+    if !ctx.rememberedDevice(conn, "tester") {
+        t.Error("expected remembered device")
+    }
+    if ctx.rememberedDevice(conn, "other") {
+        t.Error("device must be bound to USR")
+    }
+    conn.Exec("UPDATE st_mfa_devices SET EXPIRES_AT=?", time.Now().Add(-time.Minute).Format(sqlDatetime))
+    if ctx.rememberedDevice(conn, "tester") {
+        t.Error("expired device must not be remembered")
+    }
+}
@@ -0,0 +1,524 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Migrasi skema versioned. Setiap package (PID) mendaftarkan daftar Migration dengan
+// Version berurutan, versi yang sudah dijalankan dicatat di st_migrations (PID, VERSION,
+// NAME, CHECKSUM, APPLIED_AT). Migrasi framework (PID SYST, lihat schema.go) selalu
+// dijalankan lebih dulu, package lain urut PID
+//
+// Up berisi statement dipisah ';' dengan placeholder tipe {SERIAL}, {TEXT}, {DATETIME}
+// dan {BIGINT} (lihat dialect.go). ';' di dalam string/identifier quote, komentar, dollar
+// quote PostgreSQL ($$ ... $$) dan body BEGIN ... END routine (CREATE FUNCTION/PROCEDURE/
+// TRIGGER/EVENT) tidak memisahkan statement, sehingga file seperti mySQL.func.sql bisa
+// digunakan apa adanya (tanpa DELIMITER). Dua bentuk statement diperiksa lebih dulu
+// sehingga aman dijalankan terhadap database yang tabelnya sudah dibuat manual:
+//
+//      CREATE TABLE name (...)                     dilewati jika tabel sudah ada
+//      ALTER TABLE name ADD COLUMN col definisi    dilewati jika kolom sudah ada,
+//                                                  ditulis ulang sesuai dialect
+//
+// Statement lain dijalankan apa adanya, gunakan Dialect jika sintaks berbeda per database
+//
+// contoh:
+//
+//      func init() {
+//          tlkm.ExportMigration("SALES", tlkm.Migration{Version: 1, Name: "orders", Up: `
+//              CREATE TABLE sl_orders (
+//                  ID      {SERIAL},
+//                  AMOUNT  DECIMAL(15,2),
+//                  CREATED_AT {DATETIME}
+//              )`})
+//      }
+//
+// Migrasi dijalankan melalui:
+//
+//      1. startup: sebelum LoadConfig, sesuai environment variable MIGRATE_ON_START
+//         kosong (default) hanya SYST, 1/true semua package, 0/false tidak ada migrasi
+//         tapi startup gagal jika versi SYST lebih rendah dari kebutuhan framework
+//      2. CLI: MigrateCommand dari main aplikasi, "app migrate [-dry-run] [-pkg PID] [-dsn name]"
+//      3. langsung: Migrate(conn, dryRun, PID...)
+//
+// Versi yang sudah tercatat tidak dijalankan ulang. CHECKSUM yang berbeda (isi migrasi
+// diubah setelah dijalankan) hanya dicatat sebagai WARN
+//
+// Statement satu versi dan pencatatan di st_migrations dijalankan dalam satu transaksi
+// untuk PostgreSQL, SQLite dan SQL Server: versi yang gagal tidak meninggalkan perubahan.
+// MySQL dan Oracle melakukan implicit commit pada setiap DDL, statement yang sudah
+// berhasil sebelum error tetap tersimpan. Pemeriksaan CREATE TABLE/ADD COLUMN membuat
+// versi tersebut aman dijalankan ulang setelah error diperbaiki
+//
+// Instance yang melakukan migrasi memegang lock (baris PID '#LOCK' di st_migrations),
+// instance lain menunggu maksimal 60 detik. Lock dari proses yang mati di tengah migrasi
+// harus dihapus manual: DELETE FROM st_migrations WHERE PID='#LOCK'
+package tlkm
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "regexp"
+    "sort"
+    "strings"
+    "time"
+)
+
+type (
+    // Satu versi skema package
+    Migration struct {
+        Version int
+        Name    string
+        Up      string
+        Dialect map[Driver]string   // menggantikan Up untuk driver tertentu
+    }
+)
+
+const (
+    // ** private **
+    migrationLockPID = "#LOCK"
+    migrationTable = `CREATE TABLE st_migrations (
+    PID         VARCHAR(32) NOT NULL,
+    VERSION     INT NOT NULL,
+    NAME        VARCHAR(128),
+    CHECKSUM    VARCHAR(64),
+    APPLIED_AT  {DATETIME},
+    PRIMARY KEY (PID, VERSION)
+)`
+)
+
+var (
+    // ** private **
+    migrations = make(map[string][]Migration)
+    migrationCreate = regexp.MustCompile(`(?is)^CREATE\s+TABLE\s+(\w+)\s*\(`)
+    migrationColumn = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(\w+)\s+ADD\s+COLUMN\s+(\w+)\s+(.+)$`)
+    migrationRoutine = regexp.MustCompile(`(?is)^CREATE\s+(OR\s+REPLACE\s+)?(DEFINER\s*=\s*\S+\s+)?(AGGREGATE\s+)?(FUNCTION|PROCEDURE|TRIGGER|EVENT)\b`)
+    migrationDollar = regexp.MustCompile(`^\$(\w*)\$`)
+    migrationLockWait = 60 * time.Second
+)
+
+// Daftarkan migrasi package. Version harus unik per PID
+func ExportMigration(PID string, list ...Migration) {
+    PID = strings.ToUpper(PID)
+    for _, m := range list {
+        for _, j := range migrations[PID] {
+            if j.Version == m.Version {
+                panic(Sprintf("MigrationException: %s version %d already exported", PID, m.Version))
+            }
+        }
+        migrations[PID] = append(migrations[PID], m)
+    }
+    sort.Slice(migrations[PID], func(i, j int) bool {
+        return migrations[PID][i].Version < migrations[PID][j].Version
+    })
+}
+
+// SYST lebih dulu, kemudian urut PID
+func migrationPackages(PID ...string) List {
+    z := make(List, 0)
+    for k, _ := range migrations {
+        if len(PID) > 0 && !migrationSelected(k, PID) {
+            continue
+        }
+        z = append(z, k)
+    }
+    sort.Slice(z, func(i, j int) bool {
+        if z[i] == "SYST" || z[j] == "SYST" {
+            return z[i] == "SYST"
+        }
+        return z[i] < z[j]
+    })
+    return z
+}
+
+func migrationSelected(k string, PID []string) bool {
+    for _, i := range PID {
+        if strings.EqualFold(i, k) {
+            return true
+        }
+    }
+    return false
+}
+
+// Statement migrasi setelah placeholder diganti sesuai driver
+func (self *Migration) statements(driver Driver) List {
+    up := self.Up
+    if v, b := self.Dialect[driver]; b {
+        up = v
+    }
+    z := make(List, 0)
+    for _, i := range migrationSplit(driver, up) {
+        z = append(z, SQL.ddl(driver, i))
+    }
+    return z
+}
+
+func migrationWord(c byte) bool {
+    return c == '_' || c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+}
+
+// Index penutup quote yang dibuka di i. Quote ganda ('') adalah escape, backslash
+// hanya untuk MySQL
+func migrationQuoted(driver Driver, up string, i int) int {
+    q := up[i]
+    for j := i + 1; j < len(up); j++ {
+        switch {
+        case up[j] == '\\' && driver == MYSQL && q != '`':
+            j++
+        case up[j] == q && j + 1 < len(up) && up[j+1] == q:
+            j++
+        case up[j] == q:
+            return j
+        }
+    }
+    return len(up)
+}
+
+// Pisahkan statement pada ';' di luar quote, komentar, dollar quote dan body routine.
+// Potongan yang hanya berisi komentar diabaikan
+func migrationSplit(driver Driver, up string) List {
+    z := make(List, 0)
+    start, depth, cases := 0, 0, 0
+    code, routine := false, false
+    for i := 0; i < len(up); i++ {
+        c := up[i]
+        switch {
+        case c == '\'' || c == '"' || c == '`':
+            i, code = migrationQuoted(driver, up, i), true
+        case c == '-' && strings.HasPrefix(up[i:], "--"), c == '#' && driver == MYSQL:
+            if j := strings.IndexByte(up[i:], '\n'); j >= 0 {
+                i += j
+            } else {
+                i = len(up)
+            }
+        case c == '/' && strings.HasPrefix(up[i:], "/*"):
+            if j := strings.Index(up[i+2:], "*/"); j >= 0 {
+                i += j + 3
+            } else {
+                i = len(up)
+            }
+        case c == '$' && driver == PGSQL && migrationDollar.MatchString(up[i:]):
+            tag := migrationDollar.FindString(up[i:])
+            if j := strings.Index(up[i+len(tag):], tag); j >= 0 {
+                i += len(tag) + j + len(tag) - 1
+            } else {
+                i = len(up)
+            }
+            code = true
+        case c == ';' && depth == 0:
+            if s := strings.TrimSpace(up[start:i]); code && s != "" {
+                z = append(z, s)
+            }
+            start, cases, code, routine = i + 1, 0, false, false
+        case migrationWord(c) && (i == 0 || !migrationWord(up[i-1])):
+            j := i
+            for j < len(up) && migrationWord(up[j]) {
+                j++
+            }
+            if !code {
+                routine = migrationRoutine.MatchString(up[i:])
+            }
+            code = true
+            if routine {
+                switch strings.ToUpper(up[i:j]) {
+                case "BEGIN":
+                    depth++
+                case "CASE":
+                    cases++
+                case "END":
+                    k := j
+                    for k < len(up) && (up[k] == ' ' || up[k] == '\t' || up[k] == '\r' || up[k] == '\n') {
+                        k++
+                    }
+                    n := k
+                    for n < len(up) && migrationWord(up[n]) {
+                        n++
+                    }
+                    switch strings.ToUpper(up[k:n]) {
+                    case "IF", "WHILE", "LOOP", "REPEAT":
+                    case "CASE":
+                        cases--
+                        j = n
+                    default:
+                        if cases > 0 {
+                            cases--
+                        } else if depth > 0 {
+                            depth--
+                        }
+                    }
+                }
+            }
+            i = j - 1
+        }
+    }
+    if s := strings.TrimSpace(up[start:]); code && s != "" {
+        z = append(z, s)
+    }
+    return z
+}
+
+// TODOC
+func (self *Migration) checksum(driver Driver) string {
+    h := sha256.Sum256([]byte(strings.Join(self.statements(driver), ";\n")))
+    return hex.EncodeToString(h[:])
+}
+
+// Tabel/kolom sudah ada jika SELECT berhasil, portable untuk semua driver
+func migrationExists(conn *Connection, table, column string) bool {
+    rows, e := conn.DB.Query("SELECT " + column + " FROM " + table + " WHERE 1=0")
+    if e != nil {
+        return false
+    }
+    rows.Close()
+    return true
+}
+
+// Statement yang harus dijalankan, "" jika dilewati (tabel/kolom sudah ada)
+func migrationStatement(conn *Connection, stmt string) string {
+    if m := migrationCreate.FindStringSubmatch(stmt); m != nil {
+        if migrationExists(conn, m[1], "1") {
+            return ""
+        }
+        return stmt
+    }
+    if m := migrationColumn.FindStringSubmatch(stmt); m != nil {
+        if migrationExists(conn, m[1], m[2]) {
+            return ""
+        }
+        return SQL.addColumn(conn.driver, m[1], m[2], strings.TrimSpace(m[3]))
+    }
+    return stmt
+}
+
+// Versi yang sudah dijalankan: PID => VERSION => CHECKSUM
+func migrationApplied(conn *Connection) map[string]map[int]string {
+    z := make(map[string]map[int]string)
+    if !migrationExists(conn, "st_migrations", "PID") {
+        return z
+    }
+    rows := conn.Query("SELECT PID, VERSION, CHECKSUM FROM st_migrations")
+    defer rows.Close()
+    for rows.Next() {
+        PID := rows.String("PID")
+        if z[PID] == nil {
+            z[PID] = make(map[int]string)
+        }
+        z[PID][rows.Int("VERSION")] = rows.String("CHECKSUM")
+    }
+    return z
+}
+
+// Jalankan migrasi yang belum tercatat (semua package atau hanya PID). Return daftar
+// statement (diawali komentar -- PID VERSION NAME per migrasi), dengan dryRun tidak
+// ada yang dieksekusi. Berhenti pada error pertama, migrasi yang gagal tidak dicatat
+func Migrate(conn *Connection, dryRun bool, PID ...string) (plan List, e error) {
+    logger := &Logger{logNs: "SYST", logLv: loglv}
+    plan = make(List, 0)
+    if stmt := migrationStatement(conn, SQL.ddl(conn.driver, migrationTable)); stmt != "" {
+        plan = append(plan, stmt + ";")
+        if !dryRun {
+            // instance lain bisa membuat tabel yang sama pada saat bersamaan
+            if _, e = conn.Exec(stmt); e != nil && !migrationExists(conn, "st_migrations", "PID") {
+                return plan, errors.New("MigrationException: st_migrations: " + e.Error())
+            }
+        }
+    }
+    applied := migrationApplied(conn)
+    locked := false
+    defer func() {
+        if locked {
+            migrationUnlock(conn)
+        }
+    }()
+    for _, k := range migrationPackages(PID...) {
+        for i, _ := range migrations[k] {
+            m := &migrations[k][i]
+            sum := m.checksum(conn.driver)
+            if v, b := applied[k][m.Version]; b {
+                if v != sum {
+                    logger.Log(WARN, Sprintf("MigrationChecksumException: %s %d (%s) changed after applied", k, m.Version, m.Name))
+                }
+                continue
+            }
+            if !dryRun && !locked {
+                if e = migrationLock(conn); e != nil {
+                    return plan, e
+                }
+                locked = true
+                // versi bisa sudah dijalankan instance yang memegang lock sebelumnya
+                applied = migrationApplied(conn)
+                if _, b := applied[k][m.Version]; b {
+                    continue
+                }
+            }
+            plan = append(plan, Sprintf("-- %s %d %s", k, m.Version, m.Name))
+            list := make(List, 0)
+            for _, j := range m.statements(conn.driver) {
+                stmt := migrationStatement(conn, j)
+                if stmt == "" {
+                    plan = append(plan, "-- exists: " + strings.SplitN(j, "\n", 2)[0])
+                    continue
+                }
+                plan = append(plan, stmt + ";")
+                list = append(list, stmt)
+            }
+            if dryRun { continue }
+            if e = migrationApply(conn, k, m, sum, list); e != nil {
+                return plan, e
+            }
+        }
+    }
+    return plan, nil
+}
+
+// Jalankan statement satu versi lalu catat di st_migrations, dalam satu transaksi jika
+// DDL driver transactional
+func migrationApply(conn *Connection, PID string, m *Migration, sum string, list List) (e error) {
+    exec := conn.Exec
+    if SQL.transactionalDDL(conn.driver) {
+        tx, x := conn.DB.Begin()
+        if x != nil {
+            return errors.New("MigrationException: " + x.Error())
+        }
+        defer func() {
+            if e != nil {
+                tx.Rollback()
+            } else if e = tx.Commit(); e != nil {
+                e = errors.New("MigrationException: " + e.Error())
+            }
+        }()
+        exec = tx.Exec
+    }
+    for _, stmt := range list {
+        if _, e = exec(stmt); e != nil {
+            return errors.New(Sprintf("MigrationException: %s %d (%s): %s", PID, m.Version, m.Name, e.Error()))
+        }
+    }
+    if _, e = exec("INSERT INTO st_migrations(PID, VERSION, NAME, CHECKSUM, APPLIED_AT) VALUES (?, ?, ?, ?, ?)",
+        PID, m.Version, m.Name, sum, time.Now().Format(sqlDatetime)); e != nil {
+        return errors.New("MigrationException: " + e.Error())
+    }
+    return nil
+}
+
+// Lock migrasi antar instance: INSERT baris '#LOCK' gagal (primary key) selama lock
+// dipegang instance lain. Menunggu maksimal migrationLockWait
+func migrationLock(conn *Connection) error {
+    host, _ := os.Hostname()
+    holder := Sprintf("%s:%d", host, os.Getpid())
+    deadline := time.Now().Add(migrationLockWait)
+    retry := false
+    for {
+        _, e := conn.Exec("INSERT INTO st_migrations(PID, VERSION, NAME, CHECKSUM, APPLIED_AT) VALUES (?, ?, ?, ?, ?)",
+            migrationLockPID, 0, holder, "", time.Now().Format(sqlDatetime))
+        if e == nil {
+            return nil
+        }
+        rows := conn.Query("SELECT NAME, APPLIED_AT FROM st_migrations WHERE PID=?", migrationLockPID)
+        held := rows.Next()
+        by, since := rows.String("NAME"), rows.String("APPLIED_AT")
+        rows.Close()
+        if !held {
+            // lock baru saja dilepas, jika tetap gagal berarti error lain
+            if retry {
+                return errors.New("MigrationException: lock: " + e.Error())
+            }
+            retry = true
+            continue
+        }
+        if time.Now().After(deadline) {
+            return errors.New(Sprintf("MigrationLockedException: migrasi sedang dijalankan %s sejak %s", by, since))
+        }
+        time.Sleep(time.Second)
+    }
+}
+
+func migrationUnlock(conn *Connection) {
+    conn.Exec("DELETE FROM st_migrations WHERE PID=?", migrationLockPID)
+}
+
+// Versi terakhir yang sudah dijalankan, 0 jika belum ada
+func migrationVersion(conn *Connection, PID string) (z int) {
+    for v, _ := range migrationApplied(conn)[PID] {
+        if v > z { z = v }
+    }
+    return
+}
+
+// Dipanggil dari startup (Win32Service). Kode framework membutuhkan skema SYST versi
+// terakhir, sehingga migrasi SYST dijalankan kecuali MIGRATE_ON_START=0
+func migrateOnStart(conn *Connection) {
+    var e error
+    switch strings.ToLower(os.Getenv("MIGRATE_ON_START")) {
+    case "0", "false":
+        list := migrations["SYST"]
+        if n, m := migrationVersion(conn, "SYST"), list[len(list)-1].Version; n < m {
+            panic(Sprintf("MigrationException: skema SYST versi %d, framework membutuhkan versi %d. Jalankan \"app migrate -pkg SYST\" atau hapus MIGRATE_ON_START=0", n, m))
+        }
+        return
+    case "1", "true":
+        _, e = Migrate(conn, false)
+    default:
+        _, e = Migrate(conn, false, "SYST")
+    }
+    if e != nil {
+        panic(e.Error())
+    }
+}
+
+// Sub command "migrate" untuk main aplikasi, return false jika args bukan migrate:
+//
+//      func main() {
+//          tlkm.SQL.Register("mysql.syst", dsn)
+//          if tlkm.MigrateCommand(os.Args[1:]) {
+//              return
+//          }
+//          ...
+//      }
+//
+// Exit code 1 jika migrasi gagal
+func MigrateCommand(args []string) bool {
+    ok, e := migrateCommand(args, os.Stdout)
+    if e != nil {
+        fmt.Fprintln(os.Stderr, e.Error())
+        os.Exit(1)
+    }
+    return ok
+}
+
+func migrateCommand(args []string, w io.Writer) (bool, error) {
+    if len(args) == 0 || args[0] != "migrate" {
+        return false, nil
+    }
+    f := flag.NewFlagSet("migrate", flag.ContinueOnError)
+    f.SetOutput(w)
+    dry := f.Bool("dry-run", false, "tampilkan statement tanpa eksekusi")
+    pkg := f.String("pkg", "", "PID package (dipisah koma), kosong untuk semua")
+    dsn := f.String("dsn", PackageSystem, "nama datasource (SQL.Register)")
+    if e := f.Parse(args[1:]); e != nil {
+        return true, e
+    }
+    PID := make([]string, 0)
+    for _, i := range strings.Split(*pkg, ",") {
+        if i = strings.TrimSpace(i); i != "" {
+            PID = append(PID, i)
+        }
+    }
+    plan, e := Migrate(SQL.Lookup(*dsn), *dry, PID...)
+    for _, i := range plan {
+        fmt.Fprintln(w, i)
+    }
+    return true, e
+}
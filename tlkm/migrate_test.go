@@ -0,0 +1,275 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "bytes"
+    "database/sql"
+    "database/sql/driver"
+    "errors"
+    "io"
+    "io/ioutil"
+    "regexp"
+    "strings"
+    "testing"
+)
+
+// Driver palsu untuk migrasi: mencatat statement, tabel/kolom dari CREATE/ALTER dan
+// baris st_migrations
+type (
+    migrationDB struct {
+        exec    List
+        columns BMap    // "table.column", "table.1" untuk tabel
+        applied [][]driver.Value
+        lock    string  // holder baris #LOCK
+    }
+    migrationConn struct { db *migrationDB }
+    migrationStmt struct { db *migrationDB; query string }
+    migrationRows struct { cols []string; rows [][]driver.Value }
+)
+
+var (
+    migrationFake = &migrationDB{}
+    migrationProbe = regexp.MustCompile(`^SELECT (\w+) FROM (\w+) WHERE 1=0$`)
+    migrationCols = regexp.MustCompile(`(?m)^\s+(\w+)\s`)
+)
+
+func init() {
+    sql.Register("tlkm-migration", migrationFake)
+}
+
+func (self *migrationDB) Open(name string) (driver.Conn, error) { return &migrationConn{self}, nil }
+func (self *migrationConn) Prepare(query string) (driver.Stmt, error) { return &migrationStmt{self.db, query}, nil }
+func (self *migrationConn) Close() error { return nil }
+func (self *migrationConn) Begin() (driver.Tx, error) {
+    self.db.exec = append(self.db.exec, "BEGIN")
+    return self, nil
+}
+func (self *migrationConn) Commit() error { self.db.exec = append(self.db.exec, "COMMIT"); return nil }
+func (self *migrationConn) Rollback() error { self.db.exec = append(self.db.exec, "ROLLBACK"); return nil }
+func (self *migrationStmt) Close() error { return nil }
+func (self *migrationStmt) NumInput() int { return -1 }
+
+func (self *migrationStmt) Exec(args []driver.Value) (driver.Result, error) {
+    self.db.exec = append(self.db.exec, self.query)
+    if strings.Contains(self.query, "'FAIL'") {
+        return nil, errors.New("failed")
+    }
+    if strings.HasPrefix(self.query, "INSERT INTO st_migrations") && args[0] == migrationLockPID {
+        if self.db.lock != "" {
+            return nil, errors.New("UNIQUE constraint failed")
+        }
+        self.db.lock = args[2].(string)
+        return driver.RowsAffected(1), nil
+    }
+    if strings.HasPrefix(self.query, "DELETE FROM st_migrations") {
+        self.db.lock = ""
+    }
+    if m := migrationCreate.FindStringSubmatch(self.query); m != nil {
+        self.db.columns[m[1] + ".1"] = true
+        for _, c := range migrationCols.FindAllStringSubmatch(self.query, -1) {
+            self.db.columns[m[1] + "." + c[1]] = true
+        }
+    }
+    if m := migrationColumn.FindStringSubmatch(self.query); m != nil {
+        self.db.columns[m[1] + "." + m[2]] = true
+    }
+    if strings.HasPrefix(self.query, "INSERT INTO st_migrations") {
+        self.db.applied = append(self.db.applied, []driver.Value{args[0], args[1], args[3]})
+    }
+    return driver.RowsAffected(1), nil
+}
+
+func (self *migrationStmt) Query(args []driver.Value) (driver.Rows, error) {
+    if m := migrationProbe.FindStringSubmatch(self.query); m != nil {
+        if !self.db.columns[m[2] + "." + m[1]] {
+            return nil, errors.New("no such column " + m[1])
+        }
+        return &migrationRows{cols: []string{m[1]}}, nil
+    }
+    if strings.HasSuffix(self.query, "WHERE PID=?") {
+        if self.db.lock == "" {
+            return &migrationRows{cols: []string{"NAME", "APPLIED_AT"}}, nil
+        }
+        return &migrationRows{cols: []string{"NAME", "APPLIED_AT"}, rows: [][]driver.Value{{self.db.lock, "2020-01-01 00:00:00"}}}, nil
+    }
+    return &migrationRows{cols: []string{"PID", "VERSION", "CHECKSUM"}, rows: self.db.applied}, nil
+}
+
+func (self *migrationRows) Columns() []string { return self.cols }
+func (self *migrationRows) Close() error { return nil }
+func (self *migrationRows) Next(dest []driver.Value) error {
+    if len(self.rows) == 0 {
+        return io.EOF
+    }
+    copy(dest, self.rows[0])
+    self.rows = self.rows[1:]
+    return nil
+}
+
+func testMigrationConn(t *testing.T) *Connection {
+    migrationFake.exec, migrationFake.columns, migrationFake.applied, migrationFake.lock = List{}, BMap{}, nil, ""
+    db, e := sql.Open("tlkm-migration", "")
+    if e != nil {
+        t.Fatal(e)
+    }
+    return &Connection{DB: db, driver: SQLITE}
+}
+
+func TestMigrationStatements(t *testing.T) {
+    for _, m := range migrations["SYST"] {
+        for _, stmt := range m.statements(SQLITE) {
+            if strings.ContainsAny(stmt, "{}`") {
+                t.Errorf("unresolved placeholder: %s", stmt)
+            }
+            // semua statement framework harus bisa diperiksa (idempotent)
+            if !migrationCreate.MatchString(stmt) && !migrationColumn.MatchString(stmt) {
+                t.Errorf("SYST %d: unchecked statement %s", m.Version, stmt)
+            }
+        }
+    }
+    if m := migrations["SYST"][0]; m.checksum(MYSQL) == m.checksum(PGSQL) || m.checksum(MYSQL) != m.checksum(MYSQL) {
+        t.Error("checksum must be stable and follow dialect")
+    }
+    if s := SQL.ddl(MYSQL, "`UNSIGNED` CHAR(1), ID {SERIAL}"); s != "`UNSIGNED` CHAR(1), ID BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY" {
+        t.Errorf("unexpected %s", s)
+    }
+    if s := SQL.addColumn(ORACL, "st_users", "PWD", "VARCHAR(255)"); s != "ALTER TABLE st_users ADD (PWD VARCHAR(255))" {
+        t.Errorf("unexpected %s", s)
+    }
+}
+
+func TestMigrate(t *testing.T) {
+    conn := testMigrationConn(t)
+    defer conn.DB.Close()
+    // tabel lama yang dibuat manual, sebagian kolom sudah ada
+    migrationFake.columns = BMap{"st_users.1": true, "st_users.USR": true, "st_users.PWD": true}
+
+    plan, e := Migrate(conn, true)
+    if e != nil || len(migrationFake.exec) != 0 {
+        t.Fatalf("dry-run must not execute: %v %v", e, migrationFake.exec)
+    }
+    if plan[0] != SQL.ddl(SQLITE, migrationTable) + ";" {
+        t.Errorf("expected st_migrations first. received %s", plan[0])
+    }
+    text := strings.Join(plan, "\n")
+    expected := List{"-- SYST 1 core tables", "-- exists: CREATE TABLE st_users (", "-- exists: ALTER TABLE st_users ADD COLUMN PWD",
+        "ALTER TABLE st_users ADD COLUMN PWD_CHANGED DATETIME;", "LGID        INTEGER PRIMARY KEY AUTOINCREMENT"}
+    for _, i := range expected {
+        if !strings.Contains(text, i) {
+            t.Errorf("expected %q in plan", i)
+        }
+    }
+
+    if _, e = Migrate(conn, false); e != nil {
+        t.Fatal(e)
+    }
+    if n := len(migrationFake.applied); n != len(migrations["SYST"]) {
+        t.Errorf("expected %d versions recorded. received %d", len(migrations["SYST"]), n)
+    }
+    if !migrationFake.columns["st_group_inherits.PARENT"] || !migrationFake.columns["st_handler_arguments.PATH"] {
+        t.Error("expected tables and columns created")
+    }
+    migrationFake.exec = List{}
+    if plan, _ = Migrate(conn, false); len(plan) != 0 || len(migrationFake.exec) != 0 {
+        t.Errorf("expected nothing to apply. received %v", plan)
+    }
+}
+
+func TestMigratePackage(t *testing.T) {
+    defer delete(migrations, "TEST")
+    ExportMigration("test",
+        Migration{Version: 2, Name: "second", Up: "ALTER TABLE ts_items ADD COLUMN QTY INT"},
+        Migration{Version: 1, Name: "first", Up: "CREATE TABLE ts_items (ID {SERIAL})",
+            Dialect: map[Driver]string{MYSQL: "CREATE TABLE ts_items (ID {SERIAL}) ENGINE=InnoDB"}})
+    if z := migrationPackages(); z[0] != "SYST" || z[1] != "TEST" {
+        t.Errorf("expected SYST first. received %v", z)
+    }
+    func() {
+        defer func() {
+            if recover() == nil {
+                t.Error("expected duplicate version panic")
+            }
+        }()
+        ExportMigration("TEST", Migration{Version: 1})
+    }()
+
+    conn := testMigrationConn(t)
+    defer conn.DB.Close()
+    SQL.proto["tlkm-migration"] = conn
+    defer delete(SQL.proto, "tlkm-migration")
+
+    w := &bytes.Buffer{}
+    if b, e := migrateCommand(List{"migrate", "-dry-run", "-pkg", "test", "-dsn", "tlkm-migration"}, w); !b || e != nil {
+        t.Fatal(e)
+    }
+    if s := w.String(); strings.Contains(s, "SYST") || !strings.Contains(s, "-- TEST 1 first\nCREATE TABLE ts_items (ID INTEGER PRIMARY KEY AUTOINCREMENT);\n-- TEST 2 second\nALTER TABLE ts_items ADD COLUMN QTY INT;") {
+        t.Errorf("unexpected output\n%s", s)
+    }
+    if b, _ := migrateCommand(List{"serve"}, w); b {
+        t.Error("expected non migrate command ignored")
+    }
+}
+
+func TestMigrationSplit(t *testing.T) {
+    b, e := ioutil.ReadFile("../mySQL.func.sql")
+    if e != nil {
+        t.Fatal(e)
+    }
+    z := migrationSplit(MYSQL, string(b))
+    if len(z) != 10 || !strings.HasPrefix(z[5], "CREATE FUNCTION FUNC_HAVE_DIGIT") || !strings.HasSuffix(z[9], "END") {
+        t.Fatalf("unexpected split %d %q", len(z), z)
+    }
+    for i, j := range map[Driver]string{
+        MYSQL: "-- komentar; diabaikan\nINSERT INTO t VALUES ('a;b', 'it\\'s;'); # x;\nSELECT `a;b` FROM t",
+        SQLITE: "/* a; b */ INSERT INTO t VALUES ('a;''b'); SELECT \"x;y\" FROM t;",
+        PGSQL: "CREATE FUNCTION f() RETURNS INT AS $body$ BEGIN RETURN 1; END; $body$ LANGUAGE plpgsql; SELECT 1",
+        ORACL: "CREATE OR REPLACE TRIGGER t BEFORE INSERT ON x FOR EACH ROW BEGIN CASE WHEN 1=1 THEN NULL; END CASE; :NEW.A := CASE WHEN 1=1 THEN 1 ELSE 2 END; END; SELECT 1 FROM DUAL",
+    } {
+        if z := migrationSplit(i, j); len(z) != 2 {
+            t.Errorf("%v: expected 2 statements. received %q", i, z)
+        }
+    }
+}
+
+// Versi yang gagal di-rollback (driver dengan DDL transactional) dan tidak dicatat
+func TestMigrateRollback(t *testing.T) {
+    defer delete(migrations, "TEST")
+    ExportMigration("TEST", Migration{Version: 1, Name: "fail", Up: "CREATE TABLE ts_fail (ID INT); INSERT INTO ts_fail VALUES ('FAIL')"})
+    conn := testMigrationConn(t)
+    defer conn.DB.Close()
+    if _, e := Migrate(conn, false, "TEST"); e == nil {
+        t.Fatal("expected error")
+    }
+    z := migrationFake.exec
+    if z[len(z) - 2] != "ROLLBACK" || len(migrationFake.applied) != 0 || migrationFake.lock != "" {
+        t.Errorf("expected rollback and lock released %v", z)
+    }
+}
+
+// Instance lain sedang migrasi
+func TestMigrateLocked(t *testing.T) {
+    wait := migrationLockWait
+    migrationLockWait = 0
+    defer func() { migrationLockWait = wait }()
+    conn := testMigrationConn(t)
+    defer conn.DB.Close()
+    migrationFake.lock = "other:1"
+    if _, e := Migrate(conn, false); e == nil || !strings.HasPrefix(e.Error(), "MigrationLockedException") {
+        t.Fatalf("expected lock error. received %v", e)
+    }
+    if len(migrationFake.applied) != 0 || migrationFake.lock != "other:1" {
+        t.Error("lock holder must not be touched")
+    }
+}
@@ -0,0 +1,456 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// OpenID Connect relying party (authorization code + PKCE). Identity provider
+// (Keycloak, Azure AD, Google dst) ditemukan melalui discovery
+// <Issuer>/.well-known/openid-configuration, ID token divalidasi dengan JWKS provider
+//
+// Alur login:
+//   1. GET tanpa code      redirect ke authorization endpoint. state, nonce dan PKCE
+//                          verifier disimpan di Cache (one-time, 10 menit), state juga
+//                          disimpan di cookie untuk mengikat callback ke browser yang sama
+//   2. GET code & state    tukar code dengan token, validasi ID token, lalu
+//                          Context.SessionLogin: session dibentuk dengan alur yang sama
+//                          seperti login biasa (SessionCallback.OnCreate)
+//
+// Claim USR diambil dari UserClaim (default preferred_username, fallback sub), claim
+// groups (GroupClaim) dipetakan ke GID melalui GroupMap
+//
+// contoh:
+//
+//      type sso struct {
+//          tlkm.OIDCService
+//      }
+//
+//      func init() {
+//          tlkm.Export(&sso{tlkm.OIDCService{Provider: tlkm.OIDCFromConfig()}}, false)
+//      }
+package tlkm
+
+import (
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "html"
+    "math/big"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+    "github.com/golang-jwt/jwt"
+    "github.com/telkomdit/goframework/to"
+)
+
+type (
+    // Konfigurasi identity provider. Field tidak boleh diubah setelah provider digunakan
+    OIDCProvider struct {
+        Issuer          string
+        ClientID        string
+        ClientSecret    string      // kosong untuk public client (PKCE saja)
+        RedirectURL     string      // url handler OIDCService (callback)
+        LandingURL      string      // redirect setelah login berhasil, default /
+        Scopes          List        // default openid profile email
+        UserClaim       string      // default preferred_username
+        GroupClaim      string      // default groups
+        GroupMap        SMap        // group IdP => GID, nil berarti group IdP digunakan apa adanya
+        Client          *http.Client
+
+        // ** private **
+        lock    sync.RWMutex
+        meta    *oidcMetadata
+        keys    map[string]interface{}
+        config  *sync.Once  // OIDCFromConfig: field dibaca dari config saat pertama digunakan
+    }
+
+    // Handler login/callback, di embed oleh handler modul dan di export tanpa session
+    // (SEC false)
+    OIDCService struct {
+        NotAllowedService
+        Provider    *OIDCProvider
+    }
+
+    // ** private **
+    oidcMetadata struct {
+        Issuer                  string  `json:"issuer"`
+        AuthorizationEndpoint   string  `json:"authorization_endpoint"`
+        TokenEndpoint           string  `json:"token_endpoint"`
+        JwksURI                 string  `json:"jwks_uri"`
+    }
+)
+
+const (
+    // ** private **
+    oidcStateCookie = "SAFOIDC"
+    oidcStateExpiry = 600   // detik
+)
+
+// Provider dari config OIDC_ISSUER, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET,
+// OIDC_REDIRECT_URL, OIDC_USR_CLAIM dan OIDC_GID_CLAIM. Mapping group
+// OIDC_GID_MAP dalam format group=GID dipisahkan koma
+//
+// Config dibaca saat provider pertama kali digunakan (request pertama), bukan saat
+// OIDCFromConfig dipanggil, karena Export di init() berjalan sebelum LoadConfig
+func OIDCFromConfig() *OIDCProvider {
+    return &OIDCProvider{config: &sync.Once{}}
+}
+
+// Isi field provider dari config, hanya untuk provider OIDCFromConfig
+func (self *OIDCProvider) resolve() {
+    if self.config != nil {
+        self.config.Do(self.fromConfig)
+    }
+}
+
+func (self *OIDCProvider) fromConfig() {
+    self.Issuer, _ = Cache.String("OIDC_ISSUER")
+    self.ClientID, _ = Cache.String("OIDC_CLIENT_ID")
+    self.ClientSecret, _ = Cache.String("OIDC_CLIENT_SECRET")
+    self.RedirectURL, _ = Cache.String("OIDC_REDIRECT_URL")
+    self.UserClaim, _ = Cache.String("OIDC_USR_CLAIM")
+    self.GroupClaim, _ = Cache.String("OIDC_GID_CLAIM")
+    if v, _ := Cache.String("OIDC_GID_MAP"); v != "" {
+        self.GroupMap = SMap{}
+        for _, i := range strings.Split(v, ",") {
+            if j := strings.SplitN(i, "=", 2); len(j) == 2 {
+                self.GroupMap[strings.TrimSpace(j[0])] = strings.TrimSpace(j[1])
+            }
+        }
+    }
+}
+
+func (self *OIDCProvider) client() *http.Client {
+    if self.Client != nil {
+        return self.Client
+    }
+    return &http.Client{Timeout: 10 * time.Second}
+}
+
+// GET json dari provider
+func (self *OIDCProvider) fetch(uri string, v interface{}) error {
+    r, e := self.client().Get(uri)
+    if e != nil {
+        return e
+    }
+    defer r.Body.Close()
+    if r.StatusCode != StatusOK {
+        return errors.New("OIDCException: " + uri + " " + r.Status)
+    }
+    return json.NewDecoder(r.Body).Decode(v)
+}
+
+// Metadata provider (discovery), diambil 1x
+func (self *OIDCProvider) metadata() (*oidcMetadata, error) {
+    self.lock.RLock()
+    m := self.meta
+    self.lock.RUnlock()
+    if m != nil {
+        return m, nil
+    }
+    m = &oidcMetadata{}
+    if e := self.fetch(strings.TrimSuffix(self.Issuer, "/") + "/.well-known/openid-configuration", m); e != nil {
+        return nil, e
+    }
+    if m.Issuer != self.Issuer {
+        return nil, errors.New("OIDCException: issuer " + m.Issuer + " tidak sesuai")
+    }
+    if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JwksURI == "" {
+        return nil, errors.New("OIDCException: metadata provider tidak lengkap")
+    }
+    self.lock.Lock()
+    self.meta = m
+    self.lock.Unlock()
+    return m, nil
+}
+
+// Public key provider berdasarkan kid. Key set diambil ulang jika kid tidak ditemukan
+// (provider melakukan rotasi key)
+func (self *OIDCProvider) key(KID string) (interface{}, error) {
+    self.lock.RLock()
+    k, b := self.keys[KID]
+    self.lock.RUnlock()
+    if b {
+        return k, nil
+    }
+    m, e := self.metadata()
+    if e != nil {
+        return nil, e
+    }
+    var set struct {
+        Keys []map[string]string `json:"keys"`
+    }
+    if e := self.fetch(m.JwksURI, &set); e != nil {
+        return nil, e
+    }
+    keys := make(map[string]interface{})
+    for _, j := range set.Keys {
+        if j["use"] != "" && j["use"] != "sig" {
+            continue
+        }
+        if v, e := parseJWK(j); e == nil {
+            keys[j["kid"]] = v
+        }
+    }
+    self.lock.Lock()
+    self.keys = keys
+    self.lock.Unlock()
+    if k, b := keys[KID]; b {
+        return k, nil
+    }
+    return nil, errors.New("OIDCException: kid " + KID + " tidak dikenal")
+}
+
+// Public key RSA/EC dari JWK (RFC 7517)
+func parseJWK(j map[string]string) (interface{}, error) {
+    dec := base64.RawURLEncoding.DecodeString
+    switch j["kty"] {
+    case "RSA":
+        n, e := dec(j["n"])
+        if e != nil {
+            return nil, e
+        }
+        x, e := dec(j["e"])
+        if e != nil {
+            return nil, e
+        }
+        return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(x).Int64())}, nil
+    case "EC":
+        var c elliptic.Curve
+        switch j["crv"] {
+        case "P-256":
+            c = elliptic.P256()
+        case "P-384":
+            c = elliptic.P384()
+        case "P-521":
+            c = elliptic.P521()
+        default:
+            return nil, errors.New("OIDCException: curve " + j["crv"] + " tidak didukung")
+        }
+        x, e := dec(j["x"])
+        if e != nil {
+            return nil, e
+        }
+        y, e := dec(j["y"])
+        if e != nil {
+            return nil, e
+        }
+        return &ecdsa.PublicKey{Curve: c, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+    }
+    return nil, errors.New("OIDCException: kty " + j["kty"] + " tidak didukung")
+}
+
+// Random string base64url
+func oidcRandom() string {
+    b := make([]byte, 32)
+    rand.Read(b)
+    return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// URL authorization endpoint. state, nonce dan PKCE verifier disimpan di Cache
+func (self *OIDCProvider) AuthURL() (uri, state string, e error) {
+    self.resolve()
+    m, e := self.metadata()
+    if e != nil {
+        return
+    }
+    state = oidcRandom()
+    nonce, verifier := oidcRandom(), oidcRandom()
+    Cache.Set("oidc:" + state, SMap{"nonce": nonce, "verifier": verifier}, time.Duration(oidcStateExpiry))
+    h := sha256.Sum256([]byte(verifier))
+    scopes := self.Scopes
+    if len(scopes) == 0 {
+        scopes = List{"openid", "profile", "email"}
+    }
+    q := url.Values{}
+    q.Set("response_type", "code")
+    q.Set("client_id", self.ClientID)
+    q.Set("redirect_uri", self.RedirectURL)
+    q.Set("scope", strings.Join(scopes, " "))
+    q.Set("state", state)
+    q.Set("nonce", nonce)
+    q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(h[:]))
+    q.Set("code_challenge_method", "S256")
+    sep := "?"
+    if strings.Contains(m.AuthorizationEndpoint, "?") {
+        sep = "&"
+    }
+    uri = m.AuthorizationEndpoint + sep + q.Encode()
+    return
+}
+
+// Tukar authorization code dengan token dan validasi ID token. state hanya bisa
+// digunakan 1x
+func (self *OIDCProvider) Exchange(code, state string) (*Identity, error) {
+    self.resolve()
+    s, b := Cache.SMap("oidc:" + state)
+    if !b || state == "" {
+        return nil, errors.New("OIDCException: state tidak valid atau expired")
+    }
+    Cache.Delete("oidc:" + state)
+    m, e := self.metadata()
+    if e != nil {
+        return nil, e
+    }
+    form := url.Values{}
+    form.Set("grant_type", "authorization_code")
+    form.Set("code", code)
+    form.Set("redirect_uri", self.RedirectURL)
+    form.Set("client_id", self.ClientID)
+    form.Set("code_verifier", s["verifier"])
+    if self.ClientSecret != "" {
+        form.Set("client_secret", self.ClientSecret)
+    }
+    r, e := self.client().PostForm(m.TokenEndpoint, form)
+    if e != nil {
+        return nil, e
+    }
+    defer r.Body.Close()
+    var token struct {
+        IDToken string  `json:"id_token"`
+        Error   string  `json:"error"`
+    }
+    if e := json.NewDecoder(r.Body).Decode(&token); e != nil {
+        return nil, e
+    }
+    if r.StatusCode != StatusOK || token.IDToken == "" {
+        return nil, errors.New("OIDCException: token endpoint " + r.Status + " " + token.Error)
+    }
+    return self.Verify(token.IDToken, s["nonce"])
+}
+
+// Validasi ID token: signature (JWKS), iss, aud, exp dan nonce
+func (self *OIDCProvider) Verify(IDToken, nonce string) (*Identity, error) {
+    self.resolve()
+    mc := jwt.MapClaims{}
+    _, e := jwt.ParseWithClaims(IDToken, mc, func(T *jwt.Token) (interface{}, error) {
+        k, e := self.key(to.String(T.Header["kid"]))
+        if e != nil {
+            return nil, e
+        }
+        switch k.(type) {   // algoritma harus sesuai tipe key
+        case *rsa.PublicKey:
+            if _, b := T.Method.(*jwt.SigningMethodRSA); b {
+                return k, nil
+            }
+        case *ecdsa.PublicKey:
+            if _, b := T.Method.(*jwt.SigningMethodECDSA); b {
+                return k, nil
+            }
+        }
+        return nil, errors.New("SigningMethodException: " + to.String(T.Header["alg"]))
+    })
+    if e != nil {
+        return nil, e
+    }
+    if !mc.VerifyExpiresAt(time.Now().Unix(), true) {
+        return nil, errors.New("OIDCException: token expired")
+    }
+    if !mc.VerifyIssuer(self.Issuer, true) {
+        return nil, errors.New("OIDCException: iss " + to.String(mc["iss"]))
+    }
+    if !mc.VerifyAudience(self.ClientID, true) {
+        return nil, errors.New("OIDCException: aud tidak sesuai")
+    }
+    if nonce == "" || to.String(mc["nonce"]) != nonce {
+        return nil, errors.New("OIDCException: nonce tidak sesuai")
+    }
+    return self.identity(GMap(mc))
+}
+
+// Mapping claims ke USR dan GID
+func (self *OIDCProvider) identity(claims GMap) (*Identity, error) {
+    claim := self.UserClaim
+    if claim == "" {
+        claim = "preferred_username"
+    }
+    USR := to.String(claims[claim])
+    if USR == "" {
+        USR = to.String(claims["sub"])
+    }
+    if USR == "" {
+        return nil, errors.New("OIDCException: claim " + claim + " tidak ditemukan")
+    }
+    claim = self.GroupClaim
+    if claim == "" {
+        claim = "groups"
+    }
+    var groups List
+    switch v := claims[claim].(type) {
+    case string:
+        groups = List{v}
+    case []interface{}:
+        for _, i := range v {
+            groups = append(groups, to.String(i))
+        }
+    }
+    GID := make(map[string]string)
+    for _, i := range groups {
+        if self.GroupMap == nil {
+            GID[i] = i
+        } else if j, b := self.GroupMap[i]; b {
+            GID[j] = i
+        }
+    }
+    return &Identity{USR: USR, GID: GID, Source: "OIDC", Claims: claims}, nil
+}
+
+// Cookie state dengan SameSite Lax agar tetap dikirim browser saat redirect dari provider
+func oidcCookie(ctx *Context, value string, maxAge int) {
+    http.SetCookie(ctx.Response, &http.Cookie{Name: oidcStateCookie, Value: value, MaxAge: maxAge,
+        Path: FileSeparator, HttpOnly: true, Secure: ctx.Request.TLS != nil, SameSite: http.SameSiteLaxMode})
+}
+
+func (self *OIDCService) GET(conn *Connection, ctx *Context) {
+    if ctx.Exists("error") {
+        ctx.Code(StatusUnauthorized).Warn(ctx.Get("error") + " " + ctx.Get("error_description"))
+        return
+    }
+    if !ctx.Exists("code") {
+        uri, state, e := self.Provider.AuthURL()
+        if e != nil {
+            ctx.Code(StatusBadGateway).Warn(e.Error())
+            return
+        }
+        oidcCookie(ctx, state, oidcStateExpiry)
+        ctx.Redirect(uri)
+        return
+    }
+    state := ctx.Get("state")
+    if ctx.Cookie(oidcStateCookie) != state {
+        ctx.Code(StatusUnauthorized).Warn("OIDCException: state tidak sesuai")
+        return
+    }
+    oidcCookie(ctx, "", -1)
+    z, e := self.Provider.Exchange(ctx.Get("code"), state)
+    if e != nil {
+        ctx.Code(StatusUnauthorized).Warn(e.Error())
+        return
+    }
+    if e := ctx.LoginIdentity(z); e != nil {
+        ctx.Code(accountStatus(e)).Warn(e.Error())
+        return
+    }
+    landing := self.Provider.LandingURL
+    if landing == "" {
+        landing = FileSeparator
+    }
+    // Redirect via html (bukan 302): cookie session SameSite Strict tidak dikirim browser
+    // pada rangkaian redirect yang dimulai dari situs provider
+    ctx.Code(StatusOK).ContentType(ContentTypeHTML)
+    ctx.Echo(`<!DOCTYPE html><meta http-equiv="refresh" content="0;url=` + html.EscapeString(landing) + `">`)
+}
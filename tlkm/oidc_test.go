@@ -0,0 +1,200 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "math/big"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+    "github.com/golang-jwt/jwt"
+)
+
+// Mock identity provider: discovery, JWKS, authorize (langsung memberikan code) dan token
+// endpoint yang memvalidasi PKCE
+type mockIdP struct {
+    *httptest.Server
+    key     *rsa.PrivateKey
+    claims  jwt.MapClaims   // override claims ID token
+    codes   map[string]url.Values
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+    k, e := rsa.GenerateKey(rand.Reader, 2048)
+    if e != nil {
+        t.Fatal(e)
+    }
+    m := &mockIdP{key: k, claims: jwt.MapClaims{}, codes: make(map[string]url.Values)}
+    mux := http.NewServeMux()
+    mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+        json.NewEncoder(w).Encode(GMap{"issuer": m.URL, "authorization_endpoint": m.URL + "/authorize",
+            "token_endpoint": m.URL + "/token", "jwks_uri": m.URL + "/jwks"})
+    })
+    mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+        enc := base64.RawURLEncoding.EncodeToString
+        json.NewEncoder(w).Encode(GMap{"keys": []GMap{{"kty": "RSA", "use": "sig", "kid": "idp",
+            "n": enc(k.N.Bytes()), "e": enc(big.NewInt(int64(k.E)).Bytes())}}})
+    })
+    mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+        r.ParseForm()
+        q, b := m.codes[r.Form.Get("code")]
+        h := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+        if !b || base64.RawURLEncoding.EncodeToString(h[:]) != q.Get("code_challenge") {
+            w.WriteHeader(StatusBadRequest)
+            json.NewEncoder(w).Encode(GMap{"error": "invalid_grant"})
+            return
+        }
+        delete(m.codes, r.Form.Get("code"))
+        mc := jwt.MapClaims{"iss": m.URL, "aud": q.Get("client_id"), "sub": "u-1",
+            "preferred_username": "tester", "nonce": q.Get("nonce"), "groups": []string{"idp-admin", "idp-other"},
+            "exp": time.Now().Add(time.Minute).Unix(), "iat": time.Now().Unix()}
+        for i, j := range m.claims {
+            mc[i] = j
+        }
+        T := jwt.NewWithClaims(jwt.SigningMethodRS256, mc)
+        T.Header["kid"] = "idp"
+        v, _ := T.SignedString(k)
+        json.NewEncoder(w).Encode(GMap{"id_token": v, "token_type": "Bearer"})
+    })
+    m.Server = httptest.NewServer(mux)
+    return m
+}
+
+// Simulasi browser: ambil query authorization request, IdP memberikan code
+func (self *mockIdP) authorize(t *testing.T, uri string) (code string, q url.Values) {
+    u, e := url.Parse(uri)
+    if e != nil {
+        t.Fatal(e)
+    }
+    q = u.Query()
+    code = oidcRandom()
+    self.codes[code] = q
+    return
+}
+
+func TestOIDCLogin(t *testing.T) {
+    idp := newMockIdP(t)
+    defer idp.Close()
+    p := &OIDCProvider{Issuer: idp.URL, ClientID: "app", RedirectURL: "http://127.0.0.1/sso",
+        GroupMap: SMap{"idp-admin": "ADMIN"}}
+
+    uri, state, e := p.AuthURL()
+    if e != nil {
+        t.Fatal(e)
+    }
+    code, q := idp.authorize(t, uri)
+    if q.Get("code_challenge_method") != "S256" || q.Get("state") != state || q.Get("nonce") == "" {
+        t.Fatalf("unexpected authorization request %v", q)
+    }
+    z, e := p.Exchange(code, state)
+    if e != nil {
+        t.Fatal(e)
+    }
+    if z.USR != "tester" || len(z.GID) != 1 || z.GID["ADMIN"] != "idp-admin" {
+        t.Errorf("unexpected identity %+v", z)
+    }
+
+    // state hanya bisa digunakan 1x
+    if _, e := p.Exchange(code, state); e == nil {
+        t.Error("state must not be reused")
+    }
+}
+
+// Provider di-export sebelum LoadConfig, config dibaca saat pertama digunakan
+func TestOIDCFromConfig(t *testing.T) {
+    idp := newMockIdP(t)
+    defer idp.Close()
+    p := OIDCFromConfig()
+    config := SMap{"OIDC_ISSUER": idp.URL, "OIDC_CLIENT_ID": "app", "OIDC_GID_MAP": "idp-admin = ADMIN"}
+    for i, j := range config {
+        Cache.Set(i, j)
+        defer Cache.Delete(i)
+    }
+    uri, state, e := p.AuthURL()
+    if e != nil {
+        t.Fatal(e)
+    }
+    code, _ := idp.authorize(t, uri)
+    z, e := p.Exchange(code, state)
+    if e != nil {
+        t.Fatal(e)
+    }
+    if z.USR != "tester" || z.GID["ADMIN"] != "idp-admin" {
+        t.Errorf("unexpected identity %+v", z)
+    }
+}
+
+func TestOIDCVerify(t *testing.T) {
+    idp := newMockIdP(t)
+    defer idp.Close()
+    p := &OIDCProvider{Issuer: idp.URL, ClientID: "app", RedirectURL: "http://127.0.0.1/sso"}
+
+    for name, claims := range map[string]jwt.MapClaims{
+        "aud":   {"aud": "other"},
+        "iss":   {"iss": "http://evil"},
+        "exp":   {"exp": time.Now().Add(-time.Minute).Unix()},
+        "nonce": {"nonce": "replayed"},
+    } {
+        idp.claims = claims
+        uri, state, _ := p.AuthURL()
+        code, _ := idp.authorize(t, uri)
+        if _, e := p.Exchange(code, state); e == nil {
+            t.Errorf("%s must be validated", name)
+        }
+    }
+
+    // tanpa GroupMap group IdP digunakan apa adanya, USR fallback ke sub
+    idp.claims = jwt.MapClaims{"preferred_username": ""}
+    uri, state, _ := p.AuthURL()
+    code, _ := idp.authorize(t, uri)
+    z, e := p.Exchange(code, state)
+    if e != nil {
+        t.Fatal(e)
+    }
+    if z.USR != "u-1" || len(z.GID) != 2 {
+        t.Errorf("unexpected identity %+v", z)
+    }
+}
+
+func TestOIDCService(t *testing.T) {
+    idp := newMockIdP(t)
+    defer idp.Close()
+    s := &OIDCService{Provider: &OIDCProvider{Issuer: idp.URL, ClientID: "app"}}
+
+    ctx := testContext("", url.Values{})
+    ctx.code = StatusOK
+    s.GET(nil, ctx)
+    w := ctx.Response.(*httptest.ResponseRecorder)
+    if w.Code != StatusFound || !strings.HasPrefix(w.Header().Get("Location"), idp.URL + "/authorize?") {
+        t.Fatalf("expected redirect to provider. received %d %s", w.Code, w.Header().Get("Location"))
+    }
+    if !strings.Contains(w.Header().Get("Set-Cookie"), oidcStateCookie + "=") {
+        t.Error("state cookie not found")
+    }
+
+    // callback dari browser lain (tanpa cookie state) ditolak
+    ctx = testContext("", url.Values{"code": {"x"}, "state": {"y"}})
+    s.GET(nil, ctx)
+    if ctx.code != StatusUnauthorized {
+        t.Errorf("expected %d. received %d", StatusUnauthorized, ctx.code)
+    }
+}
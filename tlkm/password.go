@@ -0,0 +1,253 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Hashing password dan password policy untuk akun lokal (lihat account.go)
+//
+// Format hash yang dihasilkan (config PASSWORD_HASH):
+//   1. BCRYPT   (default) $2a$<cost>$..., cost dari BCRYPT_COST (default 12)
+//   2. ARGON2ID $argon2id$v=19$m=<KiB>,t=<iterasi>,p=<thread>$<salt>$<hash>, parameter
+//               dari ARGON2_MEMORY (default 65536), ARGON2_TIME (3) dan ARGON2_THREADS (2)
+//
+// Hash lama (MD5/SHA1 hex tanpa salt, yang selama ini dibentuk aplikasi dengan to.MD5
+// atau to.Sha1) tetap bisa diverifikasi, dengan flag rehash sehingga hash diganti
+// secara transparan pada saat login berhasil. Hal yang sama berlaku jika algoritma
+// atau parameter hash berubah
+//
+// Policy (config):
+//
+//      PWD_MIN_LENGTH  panjang minimal, default 8
+//      PWD_CLASSES     jumlah minimal jenis karakter (huruf kecil, huruf besar, angka,
+//                      simbol), default 0
+//      PWD_HISTORY     jumlah password terakhir yang tidak boleh digunakan ulang, default 5
+//      PWD_MAX_AGE     umur password dalam hari, default 0 (tidak expired)
+package tlkm
+
+import (
+    "crypto/md5"
+    "crypto/rand"
+    "crypto/sha1"
+    "crypto/subtle"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+    "unicode"
+    "golang.org/x/crypto/argon2"
+    "golang.org/x/crypto/bcrypt"
+)
+
+type (
+    // Policy password yang berlaku, lihat PasswordPolicyConfig
+    PasswordPolicy struct {
+        MinLength   int
+        Classes     int
+        History     int
+        MaxAge      int     // hari
+    }
+
+    // ** private **
+    argon2Params struct {
+        memory  uint32
+        time    uint32
+        threads uint8
+    }
+)
+
+const (
+    PasswordBcrypt   = "BCRYPT"
+    PasswordArgon2id = "ARGON2ID"
+)
+
+var (
+    ErrPasswordExpired = errors.New("PasswordExpiredException: password expired")
+)
+
+// Algoritma hash yang aktif
+func passwordAlgorithm() string {
+    if v, _ := Cache.String("PASSWORD_HASH"); strings.ToUpper(v) == PasswordArgon2id {
+        return PasswordArgon2id
+    }
+    return PasswordBcrypt
+}
+
+func bcryptCost() int {
+    if v, _ := Cache.Int("BCRYPT_COST"); v >= bcrypt.MinCost && v <= bcrypt.MaxCost {
+        return v
+    }
+    return 12
+}
+
+func argon2Config() argon2Params {
+    p := argon2Params{memory: 65536, time: 3, threads: 2}
+    if v, _ := Cache.Int("ARGON2_MEMORY"); v > 0 {
+        p.memory = uint32(v)
+    }
+    if v, _ := Cache.Int("ARGON2_TIME"); v > 0 {
+        p.time = uint32(v)
+    }
+    if v, _ := Cache.Int("ARGON2_THREADS"); v > 0 && v < 256 {
+        p.threads = uint8(v)
+    }
+    return p
+}
+
+// Hash password dengan algoritma dan parameter yang aktif
+func HashPassword(PWD string) (string, error) {
+    if passwordAlgorithm() == PasswordArgon2id {
+        p := argon2Config()
+        salt := make([]byte, 16)
+        if _, e := rand.Read(salt); e != nil {
+            return "", e
+        }
+        h := argon2.IDKey([]byte(PWD), salt, p.time, p.memory, p.threads, 32)
+        enc := base64.RawStdEncoding.EncodeToString
+        return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.memory, p.time, p.threads,
+            enc(salt), enc(h)), nil
+    }
+    h, e := bcrypt.GenerateFromPassword([]byte(PWD), bcryptCost())
+    return string(h), e
+}
+
+// Verifikasi password terhadap hash. rehash true jika password benar tetapi hash harus
+// diganti (hash lama, algoritma atau parameter berbeda dengan config)
+func VerifyPassword(hash, PWD string) (ok, rehash bool) {
+    switch {
+    case strings.HasPrefix(hash, "$2"):
+        if bcrypt.CompareHashAndPassword([]byte(hash), []byte(PWD)) != nil {
+            return false, false
+        }
+        cost, _ := bcrypt.Cost([]byte(hash))
+        return true, passwordAlgorithm() != PasswordBcrypt || cost != bcryptCost()
+    case strings.HasPrefix(hash, "$argon2id$"):
+        p, salt, h, e := parseArgon2(hash)
+        if e != nil {
+            return false, false
+        }
+        v := argon2.IDKey([]byte(PWD), salt, p.time, p.memory, p.threads, uint32(len(h)))
+        if subtle.ConstantTimeCompare(v, h) != 1 {
+            return false, false
+        }
+        return true, passwordAlgorithm() != PasswordArgon2id || p != argon2Config()
+    case len(hash) == 32:   // legacy MD5
+        v := md5.Sum([]byte(PWD))
+        return legacyEqual(hash, v[:]), true
+    case len(hash) == 40:   // legacy SHA1
+        v := sha1.Sum([]byte(PWD))
+        return legacyEqual(hash, v[:]), true
+    }
+    return false, false
+}
+
+func legacyEqual(hash string, v []byte) bool {
+    return subtle.ConstantTimeCompare([]byte(strings.ToLower(hash)), []byte(hex.EncodeToString(v))) == 1
+}
+
+// $argon2id$v=19$m=65536,t=3,p=2$salt$hash
+func parseArgon2(hash string) (p argon2Params, salt, h []byte, e error) {
+    s := strings.Split(hash, "$")
+    if len(s) != 6 || s[2] != "v=" + strconv.Itoa(argon2.Version) {
+        return p, nil, nil, errors.New("PasswordHashException: format argon2id")
+    }
+    var m, t, n uint64
+    for _, i := range strings.Split(s[3], ",") {
+        kv := strings.SplitN(i, "=", 2)
+        if len(kv) != 2 {
+            return p, nil, nil, errors.New("PasswordHashException: parameter argon2id")
+        }
+        v, err := strconv.ParseUint(kv[1], 10, 32)
+        if err != nil {
+            return p, nil, nil, err
+        }
+        switch kv[0] {
+        case "m":
+            m = v
+        case "t":
+            t = v
+        case "p":
+            n = v
+        }
+    }
+    if m == 0 || t == 0 || n == 0 || n > 255 {
+        return p, nil, nil, errors.New("PasswordHashException: parameter argon2id")
+    }
+    p = argon2Params{memory: uint32(m), time: uint32(t), threads: uint8(n)}
+    if salt, e = base64.RawStdEncoding.DecodeString(s[4]); e != nil {
+        return
+    }
+    h, e = base64.RawStdEncoding.DecodeString(s[5])
+    return
+}
+
+// Policy dari config PWD_*
+func PasswordPolicyConfig() PasswordPolicy {
+    p := PasswordPolicy{MinLength: 8, History: 5}
+    if v, b := Cache.Int("PWD_MIN_LENGTH"); b {
+        p.MinLength = v
+    }
+    if v, b := Cache.Int("PWD_CLASSES"); b {
+        p.Classes = v
+    }
+    if v, b := Cache.Int("PWD_HISTORY"); b {
+        p.History = v
+    }
+    if v, b := Cache.Int("PWD_MAX_AGE"); b {
+        p.MaxAge = v
+    }
+    return p
+}
+
+// Validasi password baru. history adalah hash password sebelumnya (terbaru lebih dulu)
+func (self PasswordPolicy) Check(USR, PWD string, history List) error {
+    if n := len([]rune(PWD)); n < self.MinLength {
+        return fmt.Errorf("PasswordPolicyException: minimal %d karakter", self.MinLength)
+    }
+    if USR != "" && strings.Contains(strings.ToLower(PWD), strings.ToLower(USR)) {
+        return errors.New("PasswordPolicyException: password tidak boleh mengandung username")
+    }
+    var lower, upper, digit, other int
+    for _, r := range PWD {
+        switch {
+        case unicode.IsLower(r):
+            lower = 1
+        case unicode.IsUpper(r):
+            upper = 1
+        case unicode.IsDigit(r):
+            digit = 1
+        default:
+            other = 1
+        }
+    }
+    if lower + upper + digit + other < self.Classes {
+        return fmt.Errorf("PasswordPolicyException: minimal %d jenis karakter (huruf kecil, huruf besar, angka, simbol)", self.Classes)
+    }
+    for i, j := range history {
+        if i >= self.History {
+            break
+        }
+        if ok, _ := VerifyPassword(j, PWD); ok {
+            return fmt.Errorf("PasswordPolicyException: password tidak boleh sama dengan %d password terakhir", self.History)
+        }
+    }
+    return nil
+}
+
+// Password expired jika umur melewati MaxAge
+func (self PasswordPolicy) Expired(changed time.Time) bool {
+    if self.MaxAge <= 0 || changed.IsZero() {
+        return false
+    }
+    return time.Since(changed) > time.Duration(self.MaxAge) * 24 * time.Hour
+}
@@ -0,0 +1,148 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "strings"
+    "testing"
+    "time"
+    "github.com/telkomdit/goframework/to"
+)
+
+func testPasswordConfig(algo string) func() {
+    Cache.Set("PASSWORD_HASH", algo)
+    Cache.Set("BCRYPT_COST", 4)
+    Cache.Set("ARGON2_MEMORY", 1024)
+    Cache.Set("ARGON2_TIME", 1)
+    return func() {
+        for _, k := range []string{"PASSWORD_HASH", "BCRYPT_COST", "ARGON2_MEMORY", "ARGON2_TIME"} {
+            Cache.Delete(k)
+        }
+    }
+}
+
+func TestHashPassword(t *testing.T) {
+    for _, algo := range []string{PasswordBcrypt, PasswordArgon2id} {
+        done := testPasswordConfig(algo)
+        h, e := HashPassword("Rahasia-123")
+        if e != nil {
+            t.Fatal(e)
+        }
+        if algo == PasswordArgon2id && !strings.HasPrefix(h, "$argon2id$v=19$m=1024,t=1,p=2$") {
+            t.Errorf("unexpected hash %s", h)
+        }
+        if ok, rehash := VerifyPassword(h, "Rahasia-123"); !ok || rehash {
+            t.Errorf("%s: expected ok without rehash. received %v %v", algo, ok, rehash)
+        }
+        if ok, _ := VerifyPassword(h, "rahasia-123"); ok {
+            t.Errorf("%s: wrong password must be rejected", algo)
+        }
+        // parameter berubah: rehash
+        Cache.Set("BCRYPT_COST", 5)
+        Cache.Set("ARGON2_TIME", 2)
+        if ok, rehash := VerifyPassword(h, "Rahasia-123"); !ok || !rehash {
+            t.Errorf("%s: expected rehash after parameter change", algo)
+        }
+        done()
+    }
+}
+
+func TestVerifyLegacyPassword(t *testing.T) {
+    defer testPasswordConfig(PasswordBcrypt)()
+    for _, h := range []string{to.MD5("rahasia"), strings.ToUpper(to.MD5("rahasia")), to.Sha1("rahasia")} {
+        if ok, rehash := VerifyPassword(h, "rahasia"); !ok || !rehash {
+            t.Errorf("%s: expected ok with rehash. received %v %v", h, ok, rehash)
+        }
+        if ok, _ := VerifyPassword(h, "salah"); ok {
+            t.Errorf("%s: wrong password must be rejected", h)
+        }
+    }
+    for _, h := range []string{"", "plain", "$argon2id$v=19$m=0,t=1,p=1$AA$AA"} {
+        if ok, _ := VerifyPassword(h, "plain"); ok {
+            t.Errorf("%q must be rejected", h)
+        }
+    }
+}
+
+func TestPasswordPolicy(t *testing.T) {
+    defer testPasswordConfig(PasswordBcrypt)()
+    p := PasswordPolicy{MinLength: 8, Classes: 3, History: 2}
+    old1, _ := HashPassword("Lama-0001")
+    old2, _ := HashPassword("Lama-0002")
+    old3, _ := HashPassword("Lama-0003")
+    history := List{old1, old2, old3}
+
+    for PWD, valid := range map[string]bool{
+        "Pendek1":      false,
+        "semuakecil":   false,
+        "Tester-2026":  false,  // mengandung username
+        "Lama-0001":    false,
+        "Lama-0002":    false,
+        "Lama-0003":    true,   // di luar batas history
+        "Baru-2026!":   true,
+    } {
+        if e := p.Check("tester", PWD, history); (e == nil) != valid {
+            t.Errorf("%s: expected valid %v. received %v", PWD, valid, e)
+        }
+    }
+
+    p.MaxAge = 30
+    if !p.Expired(time.Now().AddDate(0, 0, -31)) || p.Expired(time.Now().AddDate(0, 0, -29)) {
+        t.Error("unexpected expiry")
+    }
+    if (PasswordPolicy{}).Expired(time.Now().AddDate(-5, 0, 0)) {
+        t.Error("MaxAge 0 must not expire")
+    }
+}
+
+// EXPIRES_AT disimpan sebagai DATETIME, token hanya bisa digunakan satu kali
+func TestPasswordReset(t *testing.T) {
+    defer testPasswordConfig(PasswordBcrypt)()
+    conn, done := testSQLite(t)
+    defer done()
+    if _, e := Migrate(conn, false, "SYST"); e != nil {
+        t.Fatal(e)
+    }
+    if e := CreateUser(conn, "tester", "Awal-2026!", nil); e != nil {
+        t.Fatal(e)
+    }
+    token, e := RequestPasswordReset(conn, "tester")
+    if e != nil {
+        t.Fatal(e)
+    }
+    rows := conn.Query("SELECT EXPIRES_AT FROM st_password_resets WHERE TOKEN=?", passwordResetKey(token))
+    rows.Next()
+    exp, b := sessionTime(rows.String("EXPIRES_AT"))
+    rows.Close()
+    if !b || exp.Before(time.Now()) {
+        t.Fatalf("unexpected EXPIRES_AT %v %v", exp, b)
+    }
+
+    // password ditolak policy: token tetap bisa digunakan
+    if e := ResetPassword(conn, token, "pendek"); e == nil || !strings.HasPrefix(e.Error(), "PasswordPolicyException") {
+        t.Fatalf("expected PasswordPolicyException. received %v", e)
+    }
+    if e := ResetPassword(conn, token, "Baru-2026!"); e != nil {
+        t.Fatal(e)
+    }
+    if e := ResetPassword(conn, token, "Lain-2026!"); e == nil {
+        t.Error("token must not be redeemed twice")
+    }
+
+    token, _ = RequestPasswordReset(conn, "tester")
+    conn.Exec("UPDATE st_password_resets SET EXPIRES_AT=? WHERE TOKEN=?", time.Now().Add(-time.Minute).Format(sqlDatetime), passwordResetKey(token))
+    if e := ResetPassword(conn, token, "Lain-2026!"); e == nil || !strings.Contains(e.Error(), "expired") {
+        t.Errorf("expected expired token. received %v", e)
+    }
+}
@@ -161,6 +161,7 @@ type (
 
 var (
     playMap = make(map[string]PlayService)
+    playLock sync.RWMutex   // AST bisa di-load saat request (play rule, lihat playrule.go)
     playHandlers = make(PlayExportSignature)
     PlayNull playNull
     player = &Player{}
@@ -430,7 +431,7 @@ func (self *PlayContext) callFunc(m string) (r PlayType) {
 // Diluar map (Argv) untuk menampung variable global, environment yang sama akan
 // diteruskan dari context sebelumnya
 func (self *PlayContext) Execute(namespace, methodName string) error {
-    b, v := playMap[namespace]
+    b, v := playService(namespace)
     if !v {
         return errors.New("ASTNotFoundException: " + namespace)
     }
@@ -444,6 +445,29 @@ func (self *PlayContext) Execute(namespace, methodName string) error {
     return nil
 }
 
+// Sama seperti callFunc, dengan return value procedure (procedures_defreturn). Panic
+// selama eksekusi dikembalikan sebagai error, bukan diteruskan ke http context
+func (self *PlayContext) Call(methodName string) (r PlayType, e error) {
+    v, b := self.Func[methodName]
+    if !b {
+        return PlayNull, errors.New("FuncNotFoundException: " + methodName)
+    }
+    defer func() {
+        if x := recover(); x != nil {
+            r = PlayNull
+            e = errors.New(to.String(x))
+        }
+    }()
+    if v.Func != nil {
+        self.Visit(v.Func)
+    }
+    r = PlayNull
+    if v.Rtrn != nil {
+        r = self.Visit(v.Rtrn)
+    }
+    return
+}
+
 // Jika eksekusi berhenti karena panic, output akan diteruskan ke http context
 // sebelum play context dikembalikan ke sync.Pool
 //
@@ -468,7 +492,7 @@ func (self *Player) getContext() (v *PlayContext) {
 // Map untuk http method diasumsikan tidak ada perubahan, hanya Map untuk global variables
 // yang akan dibentuk ulang pada saat diambil dari pool
 func (self *Player) execute(namespace string, conn *Connection, cntx *Context) error {
-    b, v := playMap[namespace]
+    b, v := playService(namespace)
     if !v {
         return errors.New("ASTNotFoundException: " + namespace)
     }
@@ -487,9 +511,10 @@ func saveXML(conn *Connection, cntx *Context, namespace, methodName string, XML
     USR, _ := cntx.SessionUser()
     GID := cntx.GID
     data := string(XML)
+    now := SQL.now(conn.driver)
     rows := conn.Query("SELECT PID FROM st_plays WHERE PID=? AND HID=?", PID, HID)
     if !rows.Next() {
-        _sql := "INSERT INTO st_plays(PID, HID, SRC, CREATED_AT, CREATED_BY, CREATED) VALUES (?, ?, ?, CURRENT_TIMESTAMP, ?, ?)"
+        _sql := "INSERT INTO st_plays(PID, HID, SRC, CREATED_AT, CREATED_BY, CREATED) VALUES (?, ?, ?, " + now + ", ?, ?)"
         conn.Exec(_sql, PID, HID, namespace, USR, GID)
     }
     rows.Close()
@@ -501,7 +526,7 @@ func saveXML(conn *Connection, cntx *Context, namespace, methodName string, XML
         conn.Exec("INSERT INTO st_play_methods(PID, HID, API, REV, XML) VALUES (?, ?, ?, ?, ?)", PID, HID, methodName, _rev, data)
     }
     rows.Close()
-    _sql := "INSERT INTO st_play_repos(PID, HID, API, REV, XML, UPDATED_AT, CREATED_BY, CREATED) VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP, ?, ?)"
+    _sql := "INSERT INTO st_play_repos(PID, HID, API, REV, XML, UPDATED_AT, CREATED_BY, CREATED) VALUES (?, ?, ?, ?, ?, " + now + ", ?, ?)"
     conn.Exec(_sql, PID, HID, methodName, _rev, data, USR, GID)
     if _rev > 1 {
         conn.Exec("UPDATE st_play_methods SET REV=?, XML=? WHERE PID=? AND HID=? AND API=?", _rev, data, PID, HID, methodName)
@@ -516,33 +541,49 @@ func PlayParse(conn *Connection, cntx *Context, namespace string, XML []byte, re
         x PlayService
     )
     if e = xml.Unmarshal(XML, &m); e != nil { return }
-    b := false
-    x, b = playMap[namespace]
-    if !b {
-        x.Func = make(map[string]PlayFunc)
+    // copy-on-write, AST lama bisa jadi sedang dieksekusi request lain
+    o, _ := playService(namespace)
+    x.Func = make(map[string]PlayFunc)
+    for i, j := range o.Func {
+        x.Func[i] = j
     }
     save := false
     if len(repo) > 0 { save = repo[0] }
-    for _, v := range m.Tree {
-        if v.Type != "procedures_defnoreturn" && v.Type != "procedures_defreturn" { continue }
-        if f := v.Field("NAME"); f != nil {
-            methodName := f.Value
-            u := PlayFunc{}
-            if v.Mutation != nil {
-                for _, o := range v.Mutation.Argv {
-                    u.Argv = append(u.Argv, o.Name)
-                }
-            }
-            u.Func = v.Stack()
-            r := v.Value("RETURN")
-            if r != nil && len(r.Tree) > 0 { u.Rtrn = &r.Tree[0] }
+    for i := range m.Tree {
+        if methodName, u, v := playProcedure(&m.Tree[i]); v {
             x.Func[methodName] = u
             if save {
                 saveXML(conn, cntx, namespace, methodName, XML)
             }
         }
     }
+    playLock.Lock()
     playMap[namespace] = x
+    playLock.Unlock()
+    return
+}
+
+// Block procedure (procedures_defnoreturn/procedures_defreturn) -> nama dan PlayFunc
+func playProcedure(v *PlayBlock) (string, PlayFunc, bool) {
+    u := PlayFunc{}
+    if v.Type != "procedures_defnoreturn" && v.Type != "procedures_defreturn" { return "", u, false }
+    f := v.Field("NAME")
+    if f == nil { return "", u, false }
+    if v.Mutation != nil {
+        for _, o := range v.Mutation.Argv {
+            u.Argv = append(u.Argv, o.Name)
+        }
+    }
+    u.Func = v.Stack()
+    r := v.Value("RETURN")
+    if r != nil && len(r.Tree) > 0 { u.Rtrn = &r.Tree[0] }
+    return f.Value, u, true
+}
+
+func playService(namespace string) (x PlayService, b bool) {
+    playLock.RLock()
+    defer playLock.RUnlock()
+    x, b = playMap[namespace]
     return
 }
 
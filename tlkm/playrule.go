@@ -0,0 +1,233 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Procedure Play (interpreter) sebagai ServiceRule. Business user bisa membuat
+// constraint melalui visual editor tanpa deploy, cukup mendaftarkan procedure ke
+// st_rules dengan SRC berformat:
+//
+//      play:<namespace>#<procedure>    ex: play:/sales/rule/Credit#checkLimit
+//
+// Procedure (procedures_defreturn) harus me-return:
+//   1. Boolean, hasil rule
+//   2. List [Boolean, Text], hasil rule dan pesan error jika tidak sesuai expected-return
+//
+// AST di-load dari st_play_methods saat pertama kali rule dieksekusi, parameter binding
+// (st_handler_rules.PARAMS) tersedia sebagai global variable procedure
+package tlkm
+
+import (
+    "encoding/xml"
+    "errors"
+    "strings"
+)
+
+type (
+    // ** private **
+    // adapter procedure Play ke ParameterizedRule
+    playRule struct {
+        SRC, namespace, method  string
+    }
+)
+
+const (
+    PlayRulePrefix = "play:"
+)
+
+// SRC play rule -> namespace dan nama procedure
+func ParsePlayRule(SRC string) (namespace, method string, b bool) {
+    if !strings.HasPrefix(SRC, PlayRulePrefix) {
+        return
+    }
+    v := SRC[len(PlayRulePrefix):]
+    i := strings.LastIndex(v, "#")
+    if i <= 0 || i == len(v) - 1 {
+        return
+    }
+    return v[:i], v[i+1:], true
+}
+
+// Daftarkan procedure sebagai rule (st_rules). Rule hanya bisa di-binding ke handler
+// dalam package yang sama (PID namespace)
+func RegisterPlayRule(conn *Connection, namespace, method string) (PID, RID string, e error) {
+    SRC := PlayRulePrefix + namespace + "#" + method
+    if _, _, b := ParsePlayRule(SRC); !b {
+        return "", "", errors.New("PlayRuleException: " + SRC)
+    }
+    PID, RID = ShortURL(strings.TrimSuffix(namespace, FileSeparator) + FileSeparator + method)
+    rows := conn.Query("SELECT SRC FROM st_rules WHERE PID=? AND RID=?", PID, RID)
+    exists := rows.Next()
+    if exists && rows.String("SRC") != SRC {
+        e = errors.New("PlayRuleException: RID " + RID + " used by " + rows.String("SRC"))
+    }
+    rows.Close()
+    if e == nil && !exists {
+        now := SQL.now(conn.driver)
+        _, e = conn.Exec("INSERT INTO st_rules(PID, RID, SRC, CREATED_AT, UPDATED_AT) VALUES (?, ?, ?, " + now + ", " + now + ")", PID, RID, SRC)
+    }
+    return
+}
+
+// Lookup rule: ruleMap (native) atau procedure Play
+func lookupRule(SRC string) (ServiceRule, bool) {
+    if r, v := ruleMap[SRC]; v {
+        return r, true
+    }
+    if namespace, method, v := ParsePlayRule(SRC); v {
+        return &playRule{SRC: SRC, namespace: namespace, method: method}, true
+    }
+    return nil, false
+}
+
+// Load AST namespace dari st_play_methods jika belum ada di playMap
+func loadPlay(conn *Connection, namespace string) error {
+    if _, v := playService(namespace); v {
+        return nil
+    }
+    PID, HID := ShortURL(namespace)
+    rows := conn.Query("SELECT XML FROM st_play_methods WHERE PID=? AND HID=?", PID, HID)
+    defer rows.Close()
+    found := false
+    for rows.Next() {
+        if e := PlayParse(conn, nil, namespace, rows.Bytes("XML")); e != nil {
+            return e
+        }
+        found = true
+    }
+    if !found {
+        return errors.New("ASTNotFoundException: " + namespace)
+    }
+    return nil
+}
+
+// Hapus AST namespace dari playMap agar di-load ulang dari database
+func unloadPlay(namespace string) {
+    playLock.Lock()
+    delete(playMap, namespace)
+    playLock.Unlock()
+}
+
+// Load ulang satu procedure dari st_play_methods, procedure lain dalam namespace (termasuk
+// AST yang hanya ada di memory) tidak berubah. Procedure yang sudah tidak ada di database
+// dihapus dari playMap
+func reloadPlay(conn *Connection, namespace, method string) error {
+    o, v := playService(namespace)
+    if !v {
+        return nil  // belum pernah di-load, loadPlay akan membaca versi terbaru
+    }
+    PID, HID := ShortURL(namespace)
+    rows := conn.Query("SELECT XML FROM st_play_methods WHERE PID=? AND HID=? AND API=?", PID, HID, method)
+    var XML []byte
+    if rows.Next() {
+        XML = rows.Bytes("XML")
+    }
+    rows.Close()
+    var u *PlayFunc
+    if XML != nil {
+        var m PlayXML
+        if e := xml.Unmarshal(XML, &m); e != nil {
+            return e
+        }
+        for i := range m.Tree {
+            if n, f, b := playProcedure(&m.Tree[i]); b && n == method {
+                u = &f
+            }
+        }
+    }
+    // copy-on-write, AST lama bisa jadi sedang dieksekusi request lain
+    x := PlayService{Func: make(map[string]PlayFunc)}
+    for i, j := range o.Func {
+        x.Func[i] = j
+    }
+    if u == nil {
+        delete(x.Func, method)
+    } else {
+        x.Func[method] = *u
+    }
+    playLock.Lock()
+    playMap[namespace] = x
+    playLock.Unlock()
+    return nil
+}
+
+// Konversi value parameter binding ke tipe interpreter
+func playValue(v interface{}) PlayType {
+    switch u := v.(type) {
+    case string:
+        return PlayString(u)
+    case int:
+        return PlayNumber(u)
+    case float64:
+        return PlayNumber(u)
+    case bool:
+        return PlayBool(u)
+    case List:
+        l := make([]PlayType, len(u))
+        for i, j := range u {
+            l[i] = PlayString(j)
+        }
+        return PlayList{T: &l}
+    }
+    return PlayNull
+}
+
+// Interpretasi return procedure: Boolean atau List [Boolean, Text]
+func playResult(p *PlayContext, r PlayType) (b bool, m string, e error) {
+    switch u := r.(type) {
+    case PlayBool:
+        return bool(u), "", nil
+    case PlayList:
+        if l := *u.T; len(l) > 0 {
+            if j, v := l[0].(PlayBool); v {
+                if len(l) > 1 {
+                    m = l[1].String(p)
+                }
+                return bool(j), m, nil
+            }
+        }
+    }
+    return false, "", errors.New("PlayRuleException: expected return Boolean or [Boolean, Text]")
+}
+
+func (self *playRule) Execute(conn *Connection, ctx *Context, expr bool) error {
+    return self.ExecuteWith(conn, ctx, expr, nil)
+}
+
+func (self *playRule) ExecuteWith(conn *Connection, ctx *Context, expr bool, params RuleParams) error {
+    if e := loadPlay(conn, self.namespace); e != nil {
+        return e
+    }
+    x, _ := playService(self.namespace)
+    p := player.getContext()
+    defer p.close()
+    p.Conn = conn
+    p.Cntx = ctx
+    p.Func = x.Func
+    for i, j := range params {
+        p.Argv[i] = playValue(j)
+    }
+    r, e := p.Call(self.method)
+    if e != nil {
+        return e
+    }
+    b, m, e := playResult(p, r)
+    if e != nil {
+        return e
+    }
+    if b != expr {
+        if m == "" {
+            m = Sprintf("PlayRuleException: %s expected %s", self.SRC, PlayBool(expr).String(p))
+        }
+        return errors.New(m)
+    }
+    return nil
+}
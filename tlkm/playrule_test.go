@@ -0,0 +1,104 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "net/url"
+    "testing"
+)
+
+const testPlayRule = `<xml xmlns="https://developers.google.com/blockly/xml">
+  <block type="procedures_defreturn">
+    <field name="NAME">check</field>
+    <value name="RETURN">
+      <block type="test_limit"></block>
+    </value>
+  </block>
+</xml>`
+
+func init() {
+    // AMOUNT (context) dibandingkan dengan global variable LIMIT (parameter binding)
+    PlayExport(PlayExportSignature{"test_limit": func(p *PlayContext, b *PlayBlock) PlayType {
+        amount := PlayString(p.Cntx.Get("AMOUNT")).Float(p)
+        if amount > p.Argv["LIMIT"].Float(p) {
+            l := []PlayType{PlayBool(false), PlayString("amount exceeds limit")}
+            return PlayList{T: &l}
+        }
+        return PlayBool(true)
+    }})
+}
+
+func TestParsePlayRule(t *testing.T) {
+    if n, m, b := ParsePlayRule("play:/sales/rule/Credit#checkLimit"); !b || n != "/sales/rule/Credit" || m != "checkLimit" {
+        t.Errorf("unexpected %s %s %v", n, m, b)
+    }
+    for _, j := range []string{"/sales/rule/Credit", "play:/sales/rule/Credit", "play:#check", "play:/sales/rule/Credit#"} {
+        if _, _, b := ParsePlayRule(j); b {
+            t.Errorf("expected invalid %s", j)
+        }
+    }
+}
+
+func TestPlayRule(t *testing.T) {
+    namespace := "/test/play/Credit"
+    if e := PlayParse(nil, nil, namespace, []byte(testPlayRule)); e != nil {
+        t.Fatal(e)
+    }
+    defer unloadPlay(namespace)
+
+    SRC := PlayRulePrefix + namespace + "#check"
+    rs := &ruleSet{Key: List{SRC}, Map: BMap{SRC: true}, Params: map[string]RuleParams{SRC: RuleParams{"LIMIT": 1000.0}}}
+    if z, _, e := runRules(nil, testContext("", url.Values{"AMOUNT": {"900"}}), rs); e != nil || z[0].Outcome != RulePass {
+        t.Errorf("unexpected result %v %+v", e, z)
+    }
+    z, code, e := runRules(nil, testContext("", url.Values{"AMOUNT": {"1500"}}), rs)
+    if e == nil || code != StatusExpectationFailed || e.Error() != "amount exceeds limit" {
+        t.Errorf("unexpected result %d %v %+v", code, e, z)
+    }
+
+    // expected-return false
+    rs.Map[SRC] = false
+    if _, _, e := runRules(nil, testContext("", url.Values{"AMOUNT": {"1500"}}), rs); e != nil {
+        t.Error(e)
+    }
+
+    // procedure tidak ditemukan
+    SRC = PlayRulePrefix + namespace + "#unknown"
+    rs = &ruleSet{Key: List{SRC}, Map: BMap{SRC: true}}
+    if _, _, e := runRules(nil, testContext("", url.Values{}), rs); e == nil {
+        t.Error("expected FuncNotFoundException")
+    }
+}
+
+// Invalidasi rule hanya menyentuh procedure rule, bukan seluruh namespace
+func TestReloadPlay(t *testing.T) {
+    namespace := "/test/play/Reload"
+    if e := PlayParse(nil, nil, namespace, []byte(testPlayRule)); e != nil {
+        t.Fatal(e)
+    }
+    defer unloadPlay(namespace)
+    x, _ := playService(namespace)
+    x.Func["GET"] = PlayFunc{}  // handler in-memory (tanpa repo)
+
+    if e := reloadPlay(testMigrationConn(t), namespace, "check"); e != nil {
+        t.Fatal(e)
+    }
+    x, v := playService(namespace)
+    if _, b := x.Func["check"]; !v || b {
+        t.Error("expected procedure evicted")
+    }
+    if _, b := x.Func["GET"]; !b {
+        t.Error("other procedures must be kept")
+    }
+}
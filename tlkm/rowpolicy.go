@@ -0,0 +1,236 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Row-level security: filter baris per tabel dan group yang diterapkan otomatis oleh
+// QueryBuilder (SelectQuery, UpdateQuery, DeleteQuery) yang dibentuk dengan Context,
+// sehingga visibilitas data tidak bergantung pada WHERE yang ditulis di setiap handler
+//
+// Filter adalah predicate SQL dengan referensi:
+//
+//      :NAMA   attribute session (Context.Session), slice/map menjadi list placeholder
+//              sehingga bisa digunakan dengan IN (:NAMA)
+//      {T}     alias tabel (atau nama tabel jika tanpa alias)
+//
+// contoh:
+//
+//      func init() {
+//          tlkm.ExportRowPolicy("orders", "REGIONAL", "{T}.REGION_ID=:REGION")
+//          tlkm.ExportRowPolicy("orders", "SALES", "{T}.REGION_ID IN (:REGIONS)")
+//          tlkm.ExportRowPolicy("orders", "HQ", "")                  // tanpa filter
+//          tlkm.ExportRowPolicy("orders", "*", "{T}.DELETED='0'")    // semua group
+//      }
+//
+// Aturan:
+//   1. Policy group "*" selalu diterapkan (AND)
+//   2. Policy group dipilih berdasarkan GID aktif (parameter GID), atau semua group
+//      session jika GID tidak dikirim (OR antar group). Tabel dengan policy group
+//      tetapi tidak ada yang cocok dengan group user tidak menghasilkan baris
+//   3. Attribute session yang tidak ada menghasilkan predicate false (fail closed)
+//   4. QueryBuilder.System() bypass policy untuk proses sistem. Builder tanpa Context
+//      tidak difilter, kecuali config ROW_POLICY_STRICT true (tidak menghasilkan baris)
+//
+// Policy juga diterapkan pada tabel JOIN (di dalam ON). WHERE caller selalu dikurung,
+// (<WHERE>) AND (<policy>), sehingga OR di dalamnya tidak melemahkan policy
+package tlkm
+
+import (
+    "sort"
+    "strings"
+    "github.com/telkomdit/goframework/buffer"
+)
+
+var (
+    // ** private **
+    rowPolicies = make(map[string]map[string]List)  // tabel => GID => filter
+)
+
+// Daftarkan filter tabel untuk group GID ("*" semua group, filter kosong tanpa filter)
+func ExportRowPolicy(table, GID, filter string) {
+    table = strings.ToLower(table)
+    if rowPolicies[table] == nil {
+        rowPolicies[table] = make(map[string]List)
+    }
+    rowPolicies[table][GID] = append(rowPolicies[table][GID], strings.TrimSpace(filter))
+}
+
+// Tabel dan alias dari From/Join ("orders o", "orders AS o"). Subquery tidak difilter
+func rowTable(from string) (table, alias string) {
+    f := strings.Fields(from)
+    if len(f) == 0 || strings.HasPrefix(f[0], "(") {
+        return "", ""
+    }
+    table, alias = f[0], f[0]
+    if len(f) > 2 && strings.EqualFold(f[1], "AS") {
+        alias = f[2]
+    } else if len(f) > 1 {
+        alias = f[1]
+    }
+    return strings.ToLower(table), alias
+}
+
+// Group yang digunakan untuk memilih policy
+func rowGroups(ctx *Context) List {
+    if ctx.GID != "" {
+        return List{ctx.GID}
+    }
+    z := List{}
+    if g, b := ctx.Session("GID"); b {
+        if m, b := g.(map[string]string); b {
+            for k := range m {
+                z = append(z, k)
+            }
+        }
+    }
+    sort.Strings(z)
+    return z
+}
+
+// Tulis predicate policy tabel from (diawali sep) ke stmt
+func (self *QueryBuilder) rowPolicy(stmt *buffer.ByteBuffer, from, sep string, argv *[]interface{}) {
+    table, alias := rowTable(from)
+    policies, b := rowPolicies[table]
+    if !b || self.system {
+        return
+    }
+    if self.ctx == nil {
+        if strict, _ := Cache.Bool("ROW_POLICY_STRICT"); strict {
+            stmt.WS(sep).WS("1=0")
+        }
+        return
+    }
+    parts := List{}
+    for _, j := range policies["*"] {
+        if j != "" {
+            parts = append(parts, self.rowFilter(j, alias, argv))
+        }
+    }
+    if rowGrouped(policies) {
+        // group tanpa filter ditentukan lebih dulu, rowFilter menambah argv sehingga
+        // filter yang dirender harus selalu ditulis ke statement
+        groups := rowGroups(self.ctx)
+        open := false
+        for _, g := range groups {
+            for _, j := range policies[g] {
+                open = open || j == ""
+            }
+        }
+        or := List{}
+        for _, g := range groups {
+            list, b := policies[g]
+            if !b || open {
+                continue
+            }
+            and := List{}
+            for _, j := range list {
+                and = append(and, self.rowFilter(j, alias, argv))
+            }
+            or = append(or, strings.Join(and, " AND "))
+        }
+        switch {
+        case open:
+        case len(or) == 0:
+            parts = append(parts, "1=0")
+        case len(or) == 1:
+            parts = append(parts, or[0])
+        default:
+            parts = append(parts, "(" + strings.Join(or, ") OR (") + ")")
+        }
+    }
+    if len(parts) > 0 {
+        stmt.WS(sep).WRune('(').WS(strings.Join(parts, ") AND (")).WRune(')')
+    }
+}
+
+// Tabel memiliki policy selain "*"
+func rowGrouped(policies map[string]List) bool {
+    for k := range policies {
+        if k != "*" {
+            return true
+        }
+    }
+    return false
+}
+
+// Render satu filter: {T} => alias, :NAMA => placeholder. Attribute yang tidak ada
+// menghasilkan 1=0
+func (self *QueryBuilder) rowFilter(filter, alias string, argv *[]interface{}) string {
+    b := buffer.Get()
+    defer b.Close()
+    args := make([]interface{}, 0)
+    quote := false
+    for i := 0; i < len(filter); i++ {
+        c := filter[i]
+        switch {
+        case c == '\'':
+            quote = !quote
+        case quote:
+        case c == '{' && strings.HasPrefix(filter[i:], "{T}"):
+            b.WS(alias)
+            i += 2
+            continue
+        case c == ':' && i + 1 < len(filter) && rowIdent(filter[i+1], true) && (i == 0 || filter[i-1] != ':'):
+            j := i + 1
+            for j < len(filter) && rowIdent(filter[j], false) {
+                j++
+            }
+            v, found := self.ctx.Session(filter[i+1:j])
+            if !found {
+                return "1=0"
+            }
+            list := rowValues(v)
+            if len(list) == 0 {
+                b.WS("NULL")
+            }
+            for n, x := range list {
+                if n > 0 {
+                    b.WRune(',')
+                }
+                SQL.bind(self.driver, b, len(*argv) + len(args) + 1)
+                args = append(args, x)
+            }
+            i = j - 1
+            continue
+        }
+        b.WB(c)
+    }
+    *argv = append(*argv, args...)
+    return b.String()
+}
+
+func rowIdent(c byte, first bool) bool {
+    return c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (!first && c >= '0' && c <= '9')
+}
+
+// Nilai attribute sebagai list (slice/map key) atau satu nilai
+func rowValues(v interface{}) []interface{} {
+    switch x := v.(type) {
+    case List:
+        z := make([]interface{}, len(x))
+        for i, j := range x {
+            z[i] = j
+        }
+        return z
+    case []string:
+        return rowValues(List(x))
+    case []interface{}:
+        return x
+    case map[string]string:
+        z := List{}
+        for k := range x {
+            z = append(z, k)
+        }
+        sort.Strings(z)
+        return rowValues(z)
+    }
+    return []interface{}{v}
+}
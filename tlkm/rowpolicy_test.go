@@ -0,0 +1,135 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "net/url"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func testRowPolicies(t *testing.T) func() {
+    prev := rowPolicies
+    rowPolicies = make(map[string]map[string]List)
+    ExportRowPolicy("orders", "REGIONAL", "{T}.REGION_ID=:REGION")
+    ExportRowPolicy("orders", "SALES", "{T}.REGION_ID IN (:REGIONS)")
+    ExportRowPolicy("orders", "HQ", "")
+    ExportRowPolicy("orders", "*", "{T}.STATUS<>'X:Y'")
+    ExportRowPolicy("customers", "REGIONAL", "{T}.REGION_ID=:REGION")
+    return func() { rowPolicies = prev }
+}
+
+func TestRowPolicySelect(t *testing.T) {
+    defer testRowPolicies(t)()
+
+    ctx := testContext("", url.Values{})
+    ctx.sesMap = GMap{"USR": "tester", "REGION": "R1", "REGIONS": List{"R1", "R2"},
+        "GID": map[string]string{"REGIONAL": "", "SALES": ""}}
+    ctx.GID = "REGIONAL"
+
+    qb := SQL.Builder()
+    defer qb.Close()
+    qb.Select("o.ID").From("orders o").LeftJoin("customers c", "c.ID=o.CUSTOMER_ID").Where(&GMap{"o.ID": 7}).Context(ctx)
+    stmt, argv := qb.SelectQuery()
+    t.Log(stmt)
+    if !strings.Contains(stmt, "ON (c.ID=o.CUSTOMER_ID) AND (c.REGION_ID=?)") ||
+        !strings.Contains(stmt, "WHERE (o.ID=?) AND (o.STATUS<>'X:Y') AND (o.REGION_ID=?)") {
+        t.Errorf("unexpected statement %s", stmt)
+    }
+    if !reflect.DeepEqual(argv, []interface{}{"R1", 7, "R1"}) {
+        t.Errorf("unexpected argv %v", argv)
+    }
+
+    // OR dalam kondisi caller (raw value) tidak boleh lolos dari policy
+    stmt, _ = SQL.Builder().From("orders").Where(&GMap{"@STATUS": "'A' OR 1=1"}).Context(ctx).SelectQuery()
+    if !strings.Contains(stmt, "WHERE (STATUS='A' OR 1=1) AND (orders.STATUS<>'X:Y') AND (orders.REGION_ID=?)") {
+        t.Errorf("unexpected statement %s", stmt)
+    }
+
+    // tanpa GID aktif: OR antar group session
+    ctx.GID = ""
+    stmt, argv = SQL.Builder().From("orders").Context(ctx).SelectQuery()
+    if !strings.Contains(stmt, "WHERE (orders.STATUS<>'X:Y') AND ((orders.REGION_ID=?) OR (orders.REGION_ID IN (?,?)))") || len(argv) != 3 {
+        t.Errorf("unexpected statement %s %v", stmt, argv)
+    }
+
+    // group tanpa policy dan attribute yang tidak ada: fail closed
+    ctx.GID = "OPS"
+    if stmt, _ = SQL.Builder().From("orders").Context(ctx).SelectQuery(); !strings.Contains(stmt, "1=0") {
+        t.Errorf("expected no rows for group without policy: %s", stmt)
+    }
+    ctx.GID = "REGIONAL"
+    delete(ctx.sesMap, "REGION")
+    if stmt, argv = SQL.Builder().From("orders").Context(ctx).SelectQuery(); !strings.Contains(stmt, "1=0") || len(argv) != 0 {
+        t.Errorf("expected no rows without attribute: %s %v", stmt, argv)
+    }
+
+    // group tanpa filter, system bypass dan builder tanpa Context
+    ctx.GID = "HQ"
+    if stmt, _ = SQL.Builder().From("orders").Context(ctx).SelectQuery(); strings.Contains(stmt, "REGION_ID") {
+        t.Errorf("unexpected filter for HQ: %s", stmt)
+    }
+    if stmt, _ = SQL.Builder().From("orders").Context(ctx).System().SelectQuery(); strings.Contains(stmt, "WHERE") {
+        t.Errorf("system query must not be filtered: %s", stmt)
+    }
+    if stmt, _ = SQL.Builder().From("orders").SelectQuery(); strings.Contains(stmt, "WHERE") {
+        t.Errorf("unexpected filter without Context: %s", stmt)
+    }
+    Cache.Set("ROW_POLICY_STRICT", true)
+    defer Cache.Delete("ROW_POLICY_STRICT")
+    if stmt, _ = SQL.Builder().From("orders").SelectQuery(); !strings.Contains(stmt, "WHERE 1=0") {
+        t.Errorf("expected strict filter without Context: %s", stmt)
+    }
+}
+
+func TestRowPolicyUpdateDelete(t *testing.T) {
+    defer testRowPolicies(t)()
+
+    ctx := testContext("", url.Values{})
+    ctx.sesMap = GMap{"USR": "tester", "REGION": "R1"}
+    ctx.GID = "REGIONAL"
+
+    stmt, argv := SQL.Builder().From("orders").Where(&GMap{"ID": 7}).Context(ctx).UpdateQuery(&GMap{"STATUS": "C"})
+    if stmt != "UPDATE orders SET STATUS=? WHERE (ID=?) AND (orders.STATUS<>'X:Y') AND (orders.REGION_ID=?)" ||
+        !reflect.DeepEqual(argv, []interface{}{"C", 7, "R1"}) {
+        t.Errorf("unexpected update %s %v", stmt, argv)
+    }
+    stmt, argv = SQL.Builder().From("orders").Context(ctx).DeleteQuery()
+    if stmt != "DELETE FROM orders WHERE (orders.STATUS<>'X:Y') AND (orders.REGION_ID=?)" || len(argv) != 1 {
+        t.Errorf("unexpected delete %s %v", stmt, argv)
+    }
+    if stmt, _ = SQL.Builder().From("st_test").Where(&GMap{"ID": 7}).DeleteQuery(); stmt != "DELETE FROM st_test WHERE ID=?" {
+        t.Errorf("unexpected delete %s", stmt)
+    }
+}
+
+// Group tanpa filter setelah group dengan filter: argv filter yang tidak ditulis tidak
+// boleh tertinggal
+func TestRowPolicyMixedGroups(t *testing.T) {
+    defer testRowPolicies(t)()
+    ExportRowPolicy("orders", "AREA", "{T}.REGION_ID=:REGION")
+
+    ctx := testContext("", url.Values{})
+    ctx.sesMap = GMap{"USR": "tester", "REGION": "R1", "GID": map[string]string{"AREA": "", "HQ": ""}}
+    stmt, argv := SQL.Builder().From("orders").Where(&GMap{"ID": 7}).Context(ctx).SelectQuery()
+    if strings.Contains(stmt, "REGION_ID") || !reflect.DeepEqual(argv, []interface{}{7}) {
+        t.Errorf("unexpected statement %s %v", stmt, argv)
+    }
+    qb := SQL.Builder().From("orders").Where(&GMap{"ID": 7}).Context(ctx)
+    qb.driver = PGSQL
+    if stmt, argv = qb.UpdateQuery(&GMap{"STATUS": "C"}); stmt != "UPDATE orders SET STATUS=$1 WHERE (ID=$2) AND (orders.STATUS<>'X:Y')" || len(argv) != 2 {
+        t.Errorf("unexpected update %s %v", stmt, argv)
+    }
+}
@@ -0,0 +1,212 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Parameter per binding rule (st_handler_rules.PARAMS, json). Satu rule bisa digunakan
+// ulang oleh beberapa handler dengan threshold berbeda, ex: rule "amount dibawah limit"
+// dengan LIMIT berbeda untuk setiap handler
+//
+// Rule mendeklarasikan schema parameter pada saat ExportRule, isi PARAMS divalidasi
+// terhadap schema tersebut saat rules handler di lookup (sebelum masuk cache)
+//
+// contoh:
+//
+//      func init() {
+//          tlkm.ExportRule(new(AmountLimit), tlkm.RuleParam{Name: "LIMIT", Type: tlkm.ParamNumeric, Required: true})
+//      }
+//
+//      func (self *AmountLimit) ExecuteWith(conn *tlkm.Connection, ctx *tlkm.Context, expr bool, p tlkm.RuleParams) error {
+//          if to.Float(ctx.Get("AMOUNT")) > p.Float("LIMIT") { ...
+//      }
+package tlkm
+
+import (
+    "encoding/json"
+    "errors"
+    "strconv"
+    "strings"
+)
+
+type (
+    // Interface (optional) untuk rule yang membutuhkan parameter. Jika diimplementasikan,
+    // controller akan memanggil ExecuteWith (bukan Execute)
+    ParameterizedRule interface {
+        ServiceRule
+        ExecuteWith(*Connection, *Context, bool, RuleParams) error
+    }
+
+    // Schema satu parameter. Default digunakan jika parameter tidak ada di PARAMS
+    RuleParam struct {
+        Name        string
+        Type        string
+        Required    bool
+        Default     interface{}
+    }
+
+    // Parameter yang sudah divalidasi dan dikonversi sesuai tipe schema
+    RuleParams map[string]interface{}
+)
+
+const (
+    ParamString  = "STRING"
+    ParamInt     = "INT"
+    ParamNumeric = "NUMERIC"   // float64
+    ParamBool    = "BOOL"
+    ParamList    = "LIST"      // List (array of string)
+)
+
+var (
+    // ** private **
+    // schema parameter per rule (SRC)
+    ruleSchema = make(map[string][]RuleParam)
+)
+
+func (self RuleParams) String(k string) string {
+    if v, b := self[k].(string); b { return v }
+    return ""
+}
+
+func (self RuleParams) Int(k string) int {
+    if v, b := self[k].(int); b { return v }
+    return 0
+}
+
+func (self RuleParams) Float(k string) float64 {
+    switch v := self[k].(type) {
+    case float64:
+        return v
+    case int:
+        return float64(v)
+    }
+    return 0
+}
+
+func (self RuleParams) Bool(k string) bool {
+    if v, b := self[k].(bool); b { return v }
+    return false
+}
+
+func (self RuleParams) List(k string) List {
+    if v, b := self[k].(List); b { return v }
+    return nil
+}
+
+// Schema parameter rule (SRC), nil jika rule tidak mendeklarasikan parameter
+func RuleSchema(SRC string) []RuleParam {
+    return ruleSchema[SRC]
+}
+
+// Konversi satu value json (hasil decode UseNumber) sesuai tipe schema
+func convertRuleParam(p RuleParam, v interface{}) (interface{}, error) {
+    exp := errors.New(Sprintf("RuleParamException: expected (%s) %s. received %s", p.Name, p.Type, strings.TrimSpace(toJSON(v))))
+    switch strings.ToUpper(p.Type) {
+    case ParamInt:
+        switch u := v.(type) {
+        case json.Number:
+            if i, e := strconv.Atoi(u.String()); e == nil { return i, nil }
+        case int:
+            return u, nil
+        case string:
+            if i, e := strconv.Atoi(u); e == nil { return i, nil }
+        }
+        return nil, exp
+    case ParamNumeric:
+        switch u := v.(type) {
+        case json.Number:
+            if f, e := u.Float64(); e == nil { return f, nil }
+        case float64:
+            return u, nil
+        case int:
+            return float64(u), nil
+        case string:
+            if f, e := strconv.ParseFloat(u, 64); e == nil { return f, nil }
+        }
+        return nil, exp
+    case ParamBool:
+        switch u := v.(type) {
+        case bool:
+            return u, nil
+        case string:
+            if s, e := CoerceBoolean(p.Name, u); e == nil { return s == "1", nil }
+        }
+        return nil, exp
+    case ParamList:
+        switch u := v.(type) {
+        case List:
+            return u, nil
+        case []interface{}:
+            r := make(List, len(u))
+            for i, j := range u {
+                s, b := j.(string)
+                if !b { s = toJSON(j) }
+                r[i] = s
+            }
+            return r, nil
+        }
+        return nil, exp
+    default:    // STRING
+        switch u := v.(type) {
+        case string:
+            return u, nil
+        case json.Number:
+            return u.String(), nil
+        }
+        return nil, exp
+    }
+}
+
+func toJSON(v interface{}) string {
+    if s, b := v.(string); b { return s }
+    b, _ := json.Marshal(v)
+    return string(b)
+}
+
+// Validasi dan konversi PARAMS (json object) terhadap schema rule. Parameter yang tidak
+// dideklarasikan dianggap error untuk menghindari typo konfigurasi yang tidak terdeteksi.
+// Rule tanpa schema menerima PARAMS apa adanya
+func ParseRuleParams(SRC, raw string) (RuleParams, error) {
+    m := make(map[string]interface{})
+    if raw = strings.TrimSpace(raw); raw != "" {
+        d := json.NewDecoder(strings.NewReader(raw))
+        d.UseNumber()
+        if e := d.Decode(&m); e != nil {
+            return nil, errors.New("RuleParamException: " + e.Error())
+        }
+    }
+    schema, v := ruleSchema[SRC]
+    if !v {
+        return RuleParams(m), nil
+    }
+    r := make(RuleParams)
+    for _, p := range schema {
+        u, b := m[p.Name]
+        if !b || u == nil {
+            if p.Required {
+                return nil, errors.New(Sprintf("RuleParamException: expected (%s) is not null", p.Name))
+            }
+            if p.Default != nil {
+                r[p.Name] = p.Default
+            }
+            continue
+        }
+        delete(m, p.Name)
+        c, e := convertRuleParam(p, u)
+        if e != nil {
+            return nil, e
+        }
+        r[p.Name] = c
+    }
+    for k, _ := range m {
+        return nil, errors.New("RuleParamException: unknown parameter " + k)
+    }
+    return r, nil
+}
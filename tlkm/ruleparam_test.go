@@ -0,0 +1,80 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "errors"
+    "net/url"
+    "reflect"
+    "testing"
+)
+
+type testParamLimit struct {}
+
+func (self *testParamLimit) Execute(conn *Connection, ctx *Context, expr bool) error {
+    return errors.New("Execute must not be called")
+}
+
+func (self *testParamLimit) ExecuteWith(conn *Connection, ctx *Context, expr bool, p RuleParams) error {
+    if ctx.Get("AMOUNT") > p.String("LIMIT") {
+        return errors.New("amount exceeds " + p.String("LIMIT"))
+    }
+    return nil
+}
+
+func TestParseRuleParams(t *testing.T) {
+    SRC := "/test/rule/Schema"
+    ruleSchema[SRC] = []RuleParam{
+        RuleParam{Name: "LIMIT", Type: ParamNumeric, Required: true},
+        RuleParam{Name: "RETRY", Type: ParamInt, Default: 3},
+        RuleParam{Name: "STRICT", Type: ParamBool},
+        RuleParam{Name: "GROUPS", Type: ParamList},
+    }
+    defer delete(ruleSchema, SRC)
+
+    p, e := ParseRuleParams(SRC, `{"LIMIT": 1500000.5, "STRICT": "yes", "GROUPS": ["A", "B"]}`)
+    if e != nil {
+        t.Fatal(e)
+    }
+    if p.Float("LIMIT") != 1500000.5 || p.Int("RETRY") != 3 || !p.Bool("STRICT") || !reflect.DeepEqual(p.List("GROUPS"), List{"A", "B"}) {
+        t.Errorf("unexpected params %v", p)
+    }
+    for _, j := range []string{`{}`, `{"LIMIT": "abc"}`, `{"LIMIT": 1, "RETRY": 1.5}`, `{"LIMIT": 1, "LIMT": 2}`, `[1]`} {
+        if _, e := ParseRuleParams(SRC, j); e == nil {
+            t.Errorf("expected error for %s", j)
+        }
+    }
+    if p, e := ParseRuleParams("/test/rule/NoSchema", `{"A": "1"}`); e != nil || p["A"] != "1" {
+        t.Errorf("unexpected params %v %v", p, e)
+    }
+}
+
+func TestParameterizedRule(t *testing.T) {
+    SRC := "/test/rule/Limit"
+    ruleMap[SRC] = new(testParamLimit)
+    defer delete(ruleMap, SRC)
+
+    rs := &ruleSet{Key: List{SRC}, Map: BMap{SRC: true}, Params: map[string]RuleParams{SRC: RuleParams{"LIMIT": "5"}}}
+    if _, _, e := runRules(nil, testContext("", url.Values{"AMOUNT": {"3"}}), rs); e != nil {
+        t.Error(e)
+    }
+    z, code, e := runRules(nil, testContext("", url.Values{"AMOUNT": {"7"}}), rs)
+    if e == nil || code != StatusExpectationFailed || z[0].Params.String("LIMIT") != "5" {
+        t.Errorf("unexpected result %d %v %+v", code, e, z)
+    }
+    rs = &ruleSet{Key: List{SRC}, Errs: SMap{SRC: "RuleParamException: unknown parameter X"}}
+    if z, code, _ := runRules(nil, testContext("", url.Values{}), rs); code != StatusFailedDependency || z[0].Outcome != RuleParamError {
+        t.Errorf("unexpected trace %+v", z)
+    }
+}
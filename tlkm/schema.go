@@ -0,0 +1,303 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Skema tabel framework (PID SYST). Versi 1 adalah tabel inti (lihat ERD.txt), versi
+// berikutnya mengikuti fitur yang menambah tabel/kolom. Database lama yang tabelnya
+// dibuat manual tetap aman: CREATE TABLE dan ADD COLUMN dilewati jika sudah ada
+//
+// st_handler_arguments dan st_configs tanpa primary key: PATH dan BEGDA nullable,
+// keunikan dijaga oleh updateDeclarations dan admin
+package tlkm
+
+const (
+    // ** private **
+    schemaCore = `
+CREATE TABLE st_packages (
+    PID         VARCHAR(32) NOT NULL PRIMARY KEY,
+    NAME        VARCHAR(128)
+);
+CREATE TABLE st_metadata (
+    TID         VARCHAR(32) NOT NULL,
+    CID         INT NOT NULL,
+    TBL         VARCHAR(64) NOT NULL,
+    COL         VARCHAR(64) NOT NULL,
+    COLT        VARCHAR(32),
+    COLP        CHAR(1) DEFAULT '0',
+    ` + "`UNSIGNED`" + ` CHAR(1) DEFAULT '0',
+    MINL        INT,
+    MAXL        INT,
+    MINV        {BIGINT},
+    MAXV        {BIGINT},
+    ENUM        VARCHAR(255),
+    SSN         VARCHAR(64),
+    PRIMARY KEY (TID, CID)
+);
+CREATE TABLE st_metadata_copy (
+    TID         VARCHAR(32) NOT NULL,
+    CID         INT NOT NULL,
+    TBL         VARCHAR(64) NOT NULL,
+    COL         VARCHAR(64) NOT NULL,
+    COLT        VARCHAR(32),
+    COLP        CHAR(1) DEFAULT '0',
+    ` + "`UNSIGNED`" + ` CHAR(1) DEFAULT '0',
+    MINL        INT,
+    MAXL        INT,
+    MINV        {BIGINT},
+    MAXV        {BIGINT},
+    ENUM        VARCHAR(255),
+    SSN         VARCHAR(64),
+    PRIMARY KEY (TID, CID)
+);
+CREATE TABLE st_handlers (
+    PID         VARCHAR(32) NOT NULL,
+    HID         VARCHAR(64) NOT NULL,
+    SRC         VARCHAR(255) NOT NULL,
+    CREATED_AT  {DATETIME},
+    UPDATED_AT  {DATETIME},
+    PRIMARY KEY (PID, HID)
+);
+CREATE TABLE st_handler_arguments (
+    PID         VARCHAR(32) NOT NULL,
+    HID         VARCHAR(64) NOT NULL,
+    MID         VARCHAR(8) NOT NULL,
+    TID         VARCHAR(32) NOT NULL,
+    CID         INT NOT NULL,
+    COERCED     VARCHAR(255),
+    REQUIRED    CHAR(1) DEFAULT '0',
+    LOGGED      CHAR(1) DEFAULT '0'
+);
+CREATE TABLE st_rules (
+    PID         VARCHAR(32) NOT NULL,
+    RID         VARCHAR(64) NOT NULL,
+    SRC         VARCHAR(255) NOT NULL,
+    USED        CHAR(1) DEFAULT '1',
+    CREATED_AT  {DATETIME},
+    UPDATED_AT  {DATETIME},
+    PRIMARY KEY (PID, RID)
+);
+CREATE TABLE st_handler_rules (
+    PID         VARCHAR(32) NOT NULL,
+    HID         VARCHAR(64) NOT NULL,
+    MID         VARCHAR(8) NOT NULL,
+    RID         VARCHAR(64) NOT NULL,
+    SEQ         INT DEFAULT 0,
+    EXPR        CHAR(1) DEFAULT '1',
+    USED        CHAR(1) DEFAULT '1',
+    PRIMARY KEY (PID, HID, MID, RID)
+);
+CREATE TABLE st_rule_arguments (
+    PID         VARCHAR(32) NOT NULL,
+    RID         VARCHAR(64) NOT NULL,
+    TID         VARCHAR(32) NOT NULL,
+    CID         INT NOT NULL,
+    REQUIRED    CHAR(1) DEFAULT '0',
+    PRIMARY KEY (PID, RID, TID, CID)
+);
+CREATE TABLE st_groups (
+    GID         VARCHAR(32) NOT NULL PRIMARY KEY,
+    NAME        VARCHAR(128)
+);
+CREATE TABLE st_group_handlers (
+    GID         VARCHAR(32) NOT NULL,
+    PID         VARCHAR(32) NOT NULL,
+    HID         VARCHAR(64) NOT NULL,
+    PRIMARY KEY (GID, PID, HID)
+);
+CREATE TABLE st_users (
+    USR         VARCHAR(64) NOT NULL PRIMARY KEY,
+    NAME        VARCHAR(128)
+);
+CREATE TABLE st_group_users (
+    GID         VARCHAR(32) NOT NULL,
+    USR         VARCHAR(64) NOT NULL,
+    PRIMARY KEY (GID, USR)
+);
+CREATE TABLE st_logs (
+    LGID        {SERIAL},
+    LGLV        INT,
+    NAMESPACE   VARCHAR(32),
+    MSG         {TEXT},
+    LOGT        {DATETIME},
+    URI         VARCHAR(255),
+    USR         VARCHAR(64),
+    ADDR        VARCHAR(64)
+);
+CREATE TABLE st_sessions (
+    SID         VARCHAR(64) NOT NULL PRIMARY KEY,
+    USR         VARCHAR(64),
+    ADDR        VARCHAR(64),
+    UTS         {BIGINT},
+    LOGT        {DATETIME},
+    MSGT        {TEXT}
+);
+CREATE TABLE st_session_archive (
+    PERIOD      VARCHAR(6) NOT NULL,
+    SID         VARCHAR(64) NOT NULL,
+    USR         VARCHAR(64),
+    ADDR        VARCHAR(64),
+    UTS         {BIGINT},
+    LOGT        {DATETIME},
+    MSGT        {TEXT},
+    PRIMARY KEY (PERIOD, SID)
+);
+CREATE TABLE st_cronjob (
+    PID         VARCHAR(32) NOT NULL,
+    SRC         VARCHAR(255) NOT NULL,
+    T_MON       INT,
+    T_DAY       INT,
+    T_HOU       INT,
+    T_MIN       INT,
+    T_SEC       INT,
+    ENABLED     CHAR(1) DEFAULT '1',
+    CREATED_AT  {DATETIME},
+    UPDATED_AT  {DATETIME},
+    PRIMARY KEY (PID, SRC)
+);
+CREATE TABLE st_configs (
+    PID         VARCHAR(32) NOT NULL,
+    CFT         INT DEFAULT 0,
+    CFK         VARCHAR(64) NOT NULL,
+    CFV         VARCHAR(1024),
+    CHK         CHAR(1) DEFAULT '1',
+    BEGDA       DATE,
+    ENDDA       DATE
+);
+CREATE TABLE st_plays (
+    PID         VARCHAR(32) NOT NULL,
+    HID         VARCHAR(64) NOT NULL,
+    SRC         VARCHAR(255),
+    CREATED_AT  {DATETIME},
+    CREATED_BY  VARCHAR(64),
+    CREATED     VARCHAR(32),
+    PRIMARY KEY (PID, HID)
+);
+CREATE TABLE st_play_methods (
+    PID         VARCHAR(32) NOT NULL,
+    HID         VARCHAR(64) NOT NULL,
+    API         VARCHAR(64) NOT NULL,
+    REV         INT NOT NULL,
+    XML         {TEXT},
+    PRIMARY KEY (PID, HID, API)
+);
+CREATE TABLE st_play_repos (
+    PID         VARCHAR(32) NOT NULL,
+    HID         VARCHAR(64) NOT NULL,
+    API         VARCHAR(64) NOT NULL,
+    REV         INT NOT NULL,
+    XML         {TEXT},
+    UPDATED_AT  {DATETIME},
+    CREATED_BY  VARCHAR(64),
+    CREATED     VARCHAR(32),
+    PRIMARY KEY (PID, HID, API, REV)
+)`
+
+    // ServiceDeclaration (declare.go), RuleParam (ruleparam.go), invalidation (invalidate.go)
+    schemaDeclarations = `
+ALTER TABLE st_handler_arguments ADD COLUMN PATH VARCHAR(255);
+ALTER TABLE st_handler_arguments ADD COLUMN FORMAT VARCHAR(64);
+ALTER TABLE st_handler_arguments ADD COLUMN MINC INT;
+ALTER TABLE st_handler_arguments ADD COLUMN MAXC INT;
+ALTER TABLE st_handler_arguments ADD COLUMN CHECKSUM VARCHAR(64);
+ALTER TABLE st_handler_arguments ADD COLUMN UPDATED_AT {DATETIME};
+ALTER TABLE st_handler_rules ADD COLUMN PARAMS {TEXT};
+ALTER TABLE st_handler_rules ADD COLUMN CHECKSUM VARCHAR(64);
+ALTER TABLE st_handler_rules ADD COLUMN UPDATED_AT {DATETIME};
+ALTER TABLE st_rule_arguments ADD COLUMN UPDATED_AT {DATETIME}`
+
+    // LocalAuthenticator dan password policy (account.go, password.go)
+    schemaAccounts = `
+ALTER TABLE st_users ADD COLUMN PWD VARCHAR(255);
+ALTER TABLE st_users ADD COLUMN PWD_CHANGED {DATETIME};
+CREATE TABLE st_password_history (
+    USR         VARCHAR(64) NOT NULL,
+    PWD         VARCHAR(255) NOT NULL,
+    CREATED_AT  {DATETIME}
+);
+CREATE TABLE st_password_resets (
+    TOKEN       VARCHAR(64) NOT NULL PRIMARY KEY,
+    USR         VARCHAR(64) NOT NULL,
+    EXPIRES_AT  {DATETIME},
+    USED        CHAR(1) DEFAULT '0'
+)`
+
+    // TOTP, recovery codes dan trusted device (mfa.go)
+    schemaMFA = `
+CREATE TABLE st_user_mfa (
+    USR         VARCHAR(64) NOT NULL PRIMARY KEY,
+    SECRET      VARCHAR(255) NOT NULL,
+    ENABLED     CHAR(1) DEFAULT '0',
+    LAST_STEP   {BIGINT} DEFAULT 0,
+    CREATED_AT  {DATETIME}
+);
+CREATE TABLE st_user_recovery_codes (
+    USR         VARCHAR(64) NOT NULL,
+    CODE        VARCHAR(64) NOT NULL,
+    USED        CHAR(1) DEFAULT '0',
+    PRIMARY KEY (USR, CODE)
+);
+CREATE TABLE st_mfa_devices (
+    TOKEN       VARCHAR(64) NOT NULL PRIMARY KEY,
+    USR         VARCHAR(64) NOT NULL,
+    EXPIRES_AT  {DATETIME}
+)`
+
+    // apikey.go
+    schemaAPIKeys = `
+CREATE TABLE st_api_keys (
+    KID         VARCHAR(32) NOT NULL PRIMARY KEY,
+    USR         VARCHAR(64) NOT NULL,
+    NAME        VARCHAR(128),
+    HASH        VARCHAR(128) NOT NULL,
+    GID         VARCHAR(255),
+    SCOPE       VARCHAR(1024),
+    IPS         VARCHAR(1024),
+    EXPIRES_AT  {DATETIME},
+    CREATED_AT  {DATETIME},
+    LAST_USED   {DATETIME},
+    REVOKED     CHAR(1) DEFAULT '0'
+)`
+
+    // impersonate.go
+    schemaImpersonation = `
+CREATE TABLE st_impersonation_audit (
+    ID          {SERIAL},
+    IMP_USR     VARCHAR(64) NOT NULL,
+    USR         VARCHAR(64) NOT NULL,
+    ACTION      VARCHAR(32),
+    URI         VARCHAR(255),
+    METHOD      VARCHAR(8),
+    ADDR        VARCHAR(64),
+    CREATED_AT  {DATETIME}
+)`
+
+    // group.go
+    schemaGroups = `
+ALTER TABLE st_group_handlers ADD COLUMN ACL VARCHAR(4);
+CREATE TABLE st_group_inherits (
+    GID         VARCHAR(32) NOT NULL,
+    PARENT      VARCHAR(32) NOT NULL,
+    PRIMARY KEY (GID, PARENT)
+)`
+)
+
+func init() {
+    ExportMigration("SYST",
+        Migration{Version: 1, Name: "core tables", Up: schemaCore},
+        Migration{Version: 2, Name: "handler declarations", Up: schemaDeclarations},
+        Migration{Version: 3, Name: "local accounts", Up: schemaAccounts},
+        Migration{Version: 4, Name: "multi factor authentication", Up: schemaMFA},
+        Migration{Version: 5, Name: "api keys", Up: schemaAPIKeys},
+        Migration{Version: 6, Name: "impersonation audit", Up: schemaImpersonation},
+        Migration{Version: 7, Name: "group inheritance", Up: schemaGroups},
+    )
+}
@@ -0,0 +1,509 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Penyimpanan session dipisahkan dari Context melalui interface SessionStore, sehingga
+// session bisa digunakan bersama oleh beberapa instance dan database selain MySQL
+//
+// Implementasi yang tersedia:
+//   1. sqlSessionStore (default) Cache + tabel st_sessions, perilaku sama seperti sebelumnya
+//   2. FileSessionStore satu file json per session, untuk deployment tanpa database
+//      session atau shared storage antar instance (config SESSION_STORE=FILE, SESSION_DIR)
+//
+// Implementasi lain (redis, etcd dst) bisa didaftarkan modul melalui ExportSessionStore
+//
+// Lifetime session (detik) diambil dari config SSO_SSN_EXP, dihitung dari aktivitas
+// terakhir (UTS). Policy per group (lihat sessionpolicy.go) bisa memperpendek idle
+// timeout dan menambahkan absolute timeout melalui attribute SSN_IDLE dan SSN_ABS
+package tlkm
+
+import (
+    "encoding/json"
+    "errors"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+    "github.com/telkomdit/goframework/to"
+)
+
+type (
+    // Satu session. Data adalah session attributes (Context.SessionSet)
+    SessionRecord struct {
+        SID     string      `json:"sid"`
+        USR     string      `json:"usr"`
+        ADDR    string      `json:"addr"`
+        UTS     int64       `json:"uts"`   // unix timestamp aktivitas terakhir
+        LOGT    time.Time   `json:"logt"`  // waktu login
+        Data    GMap        `json:"data"`
+    }
+
+    // Kontrak penyimpanan session. Load harus mengembalikan error jika session tidak
+    // ditemukan atau sudah expired. List dengan USR kosong berarti semua session aktif
+    SessionStore interface {
+        Load(SID string) (*SessionRecord, error)
+        Save(r *SessionRecord, create bool) error
+        Touch(SID string) error
+        Destroy(SID string) error
+        List(USR string) ([]*SessionRecord, error)
+        Purge() ([]*SessionRecord, error)   // session expired yang dipindahkan ke archive
+    }
+
+    // ** private **
+    // default store: Cache sebagai lookup, st_sessions sebagai persistence
+    sqlSessionStore struct {}
+
+    // Satu file json per session dalam Dir, session yang di-destroy/expired dipindahkan
+    // ke Dir/archive untuk kebutuhan audit (sama seperti st_session_archive)
+    FileSessionStore struct {
+        Dir     string
+        lock    sync.Mutex
+    }
+)
+
+const (
+    // interval (detik) update UTS st_sessions oleh Touch
+    sessionTouchInterval = time.Duration(60)
+)
+
+var (
+    // ** private **
+    sessionStore SessionStore = &sqlSessionStore{}
+
+    // attribute map[string]string yang harus di-remap setelah unmarshal json
+    sessionMaps = List{"GID", "GIDX", "ACL", "IMP_GID"}
+)
+
+// Replace session store, dipanggil sebelum service dijalankan
+//
+// contoh:
+//
+//      func init() {
+//          tlkm.ExportSessionStore(&tlkm.FileSessionStore{Dir: "/var/lib/app/sessions"})
+//      }
+func ExportSessionStore(store SessionStore) {
+    sessionStore = store
+}
+
+// Session store yang aktif
+func Sessions() SessionStore {
+    return sessionStore
+}
+
+// Lifetime session dalam detik
+func sessionExpiry() int64 {
+    ssox, _ := Cache.Int("SSO_SSN_EXP")
+    return int64(ssox)
+}
+
+// Idle timeout session (detik): SSN_IDLE jika lebih pendek dari SSO_SSN_EXP
+func sessionIdle(data GMap) int64 {
+    exp := sessionExpiry()
+    if v := sessionInt(data, "SSN_IDLE"); v > 0 && v < exp {
+        return v
+    }
+    return exp
+}
+
+// Attribute numerik session, setelah unmarshal json tipenya float64
+func sessionInt(data GMap, k string) int64 {
+    switch v := data[k].(type) {
+    case int64:
+        return v
+    case int:
+        return int64(v)
+    case float64:
+        return int64(v)
+    }
+    return 0
+}
+
+// Session masih valid: belum melewati idle timeout dan absolute timeout (SSN_ABS)
+func (self *SessionRecord) alive(now int64) bool {
+    if abs := sessionInt(self.Data, "SSN_ABS"); abs > 0 && now >= abs {
+        return false
+    }
+    return self.UTS > now - sessionIdle(self.Data)
+}
+
+// Format PERIOD st_session_archive (YYYYMM), dihitung di Go agar tidak bergantung
+// pada fungsi tanggal database
+func sessionPeriod(t time.Time) string {
+    return t.Format("200601")
+}
+
+// LOGT dari database. MySQL (tanpa parseTime) mengembalikan format DATETIME, driver
+// lain (PostgreSQL, SQLite dst) mengembalikan time.Time yang di-scan ke RawBytes sebagai
+// RFC3339. LOGT ditulis sebagai waktu lokal, jam dinding hasil parse selalu dibaca
+// sebagai time.Local
+func sessionTime(v string) (time.Time, bool) {
+    for _, layout := range []string{sqlDatetime, time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05"} {
+        if t, e := time.Parse(layout, v); e == nil {
+            return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local), true
+        }
+    }
+    return time.Time{}, false
+}
+
+// ** sqlSessionStore **
+
+func (self *sqlSessionStore) Load(SID string) (*SessionRecord, error) {
+    if v, b := Cache.GMap(SID); b {
+        // idle timeout dijaga oleh expiry cache, absolute timeout harus diperiksa
+        if abs := sessionInt(v, "SSN_ABS"); abs == 0 || time.Now().Unix() < abs {
+            return &SessionRecord{SID: SID, Data: v}, nil
+        }
+        Cache.Delete(SID)
+        return nil, errors.New("SessionNotFoundException: " + SID)
+    }
+    // Tidak ditemukan di cache belum tentu benar2 expired, ada kemungkinan karena
+    // flush Cache atau restart. Jadi selama session di DB ditemukan (dan valid), maka
+    // cache harus push ulang
+    conn := SQL.Default()
+    defer conn.Close()
+    rows := conn.Query("SELECT USR, ADDR, UTS, MSGT FROM st_sessions WHERE SID=? AND UTS>?", SID, time.Now().Unix() - sessionExpiry())
+    defer rows.Close()
+    if !rows.Next() {
+        return nil, errors.New("SessionNotFoundException: " + SID)
+    }
+    var v GMap
+    if e := json.Unmarshal(rows.Bytes("MSGT"), &v); e != nil {
+        return nil, e
+    }
+    r := &SessionRecord{SID: SID, USR: rows.String("USR"), ADDR: rows.String("ADDR"), UTS: int64(rows.Int("UTS")), Data: remap(v, sessionMaps...)}
+    if !r.alive(time.Now().Unix()) {
+        return nil, errors.New("SessionNotFoundException: " + SID)
+    }
+    Cache.Set(SID, r.Data, time.Duration(sessionIdle(r.Data)))
+    return r, nil
+}
+
+func (self *sqlSessionStore) Save(r *SessionRecord, create bool) error {
+    j, e := json.Marshal(r.Data)   // serialize/marshal map untuk disimpan di DB
+    if e != nil {
+        return e
+    }
+    conn := SQL.Default()
+    defer conn.Close()
+    now := time.Now()
+    if create {
+        _, e = conn.Exec("INSERT INTO st_sessions(SID,USR,ADDR,UTS,LOGT,MSGT) VALUES (?,?,?,?,?,?)",
+            r.SID, r.USR, r.ADDR, now.Unix(), now.Format("2006-01-02 15:04:05"), string(j))
+    } else {
+        _, e = conn.Exec("UPDATE st_sessions SET UTS=?,MSGT=? WHERE SID=?", now.Unix(), string(j), r.SID)
+    }
+    if e == nil {
+        Cache.Set(r.SID, r.Data, time.Duration(sessionIdle(r.Data)))
+        Cache.Set("uts:" + r.SID, true, sessionTouchInterval)
+    }
+    return e
+}
+
+// Extends lifetime cache. UTS di database diupdate maksimal 1x per sessionTouchInterval
+// agar session yang aktif tetap valid jika cache hilang, tanpa write setiap request
+func (self *sqlSessionStore) Touch(SID string) error {
+    v, _ := Cache.GMap(SID)
+    Cache.Extend(SID, time.Duration(sessionIdle(v)))
+    if _, b := Cache.Get("uts:" + SID); b {
+        return nil
+    }
+    Cache.Set("uts:" + SID, true, sessionTouchInterval)
+    conn := SQL.Default()
+    defer conn.Close()
+    _, e := conn.Exec("UPDATE st_sessions SET UTS=? WHERE SID=?", time.Now().Unix(), SID)
+    return e
+}
+
+// Dua hal yang dilakukan jika session di-destroy:
+//   1. Memindahkan data session ke archive untuk menjaga performansi tabel session dan
+//      untuk kebutuhan audit
+//   2. Hapus cache yang digunakan untuk lookup data
+func (self *sqlSessionStore) Destroy(SID string) error {
+    conn := SQL.Default()
+    defer conn.Close()
+    n, e := archiveSessions(conn, "SID=?", SID)
+    if e == nil && n == 0 {
+        e = errors.New("SessionNotFoundException: " + SID)
+    }
+    return e
+}
+
+func (self *sqlSessionStore) List(USR string) ([]*SessionRecord, error) {
+    conn := SQL.Default()
+    defer conn.Close()
+    z := make([]*SessionRecord, 0)
+    now := time.Now().Unix()
+    where, args := "UTS>?", []interface{}{now - sessionExpiry()}
+    if USR != "" {
+        where, args = "USR=? AND " + where, append([]interface{}{USR}, args...)
+    }
+    rows := conn.Query("SELECT SID, USR, ADDR, UTS, LOGT, MSGT FROM st_sessions WHERE " + where + " ORDER BY UTS DESC", args...)
+    defer rows.Close()
+    for rows.Next() {
+        if r := sessionRow(rows); r.alive(now) {
+            z = append(z, r)
+        }
+    }
+    return z, nil
+}
+
+// Pindahkan session expired ke archive. Idle/absolute timeout per session ada di MSGT,
+// jadi pemeriksaan dilakukan untuk semua session (tabel hanya berisi session aktif)
+func (self *sqlSessionStore) Purge() ([]*SessionRecord, error) {
+    conn := SQL.Default()
+    defer conn.Close()
+    now := time.Now().Unix()
+    z := make([]*SessionRecord, 0)
+    rows := conn.Query("SELECT SID, USR, ADDR, UTS, LOGT, MSGT FROM st_sessions")
+    for rows.Next() {
+        if r := sessionRow(rows); !r.alive(now) {
+            z = append(z, r)
+        }
+    }
+    rows.Close()
+    if len(z) == 0 {
+        return z, nil
+    }
+    SID := make([]interface{}, len(z))
+    for i, j := range z {
+        SID[i] = j.SID
+    }
+    _, e := archiveSessions(conn, "SID IN (?" + strings.Repeat(",?", len(z) - 1) + ")", SID...)
+    return z, e
+}
+
+func sessionRow(rows *ResultSet) *SessionRecord {
+    r := &SessionRecord{SID: rows.String("SID"), USR: rows.String("USR"), ADDR: rows.String("ADDR"), UTS: int64(rows.Int("UTS"))}
+    r.LOGT, _ = sessionTime(rows.String("LOGT"))
+    var v GMap
+    if e := json.Unmarshal(rows.Bytes("MSGT"), &v); e == nil {
+        r.Data = remap(v, sessionMaps...)
+    }
+    return r
+}
+
+// Push ulang session yang masih valid ke cache (restart server)
+func (self *sqlSessionStore) warm(conn *Connection) {
+    rows := conn.Query("SELECT SID, MSGT FROM st_sessions WHERE UTS>?", time.Now().Unix() - sessionExpiry())
+    defer rows.Close()
+    for rows.Next() {
+        var m GMap
+        if e := json.Unmarshal(rows.Bytes("MSGT"), &m); e == nil {
+            m = remap(m, sessionMaps...)
+            Cache.Set(rows.String("SID"), m, time.Duration(sessionIdle(m)))
+        }
+    }
+}
+
+// Archive + delete dalam satu transaksi. LOCK TABLE hanya untuk MySQL (lihat dialect.go),
+// database lain cukup mengandalkan row lock transaksi. Return jumlah session yang di-archive
+func archiveSessions(conn *Connection, where string, args ...interface{}) (n int, e error) {
+    type archived struct {
+        SID, PERIOD string
+    }
+    list := make([]archived, 0)
+    rows := conn.Query("SELECT SID, LOGT FROM st_sessions WHERE " + where, args...)
+    for rows.Next() {
+        t, b := sessionTime(rows.String("LOGT"))
+        if !b {
+            t = time.Now()  // format tidak dikenal, archive pada periode berjalan
+        }
+        list = append(list, archived{SID: rows.String("SID"), PERIOD: sessionPeriod(t)})
+    }
+    rows.Close()
+    tx := conn.Begin()
+    (&Go{
+        Try: func() {
+            for _, j := range list {
+                if _, err := tx.Exec(`INSERT INTO st_session_archive(PERIOD,SID,USR,ADDR,UTS,LOGT,MSGT)
+                                      SELECT ?,SID,USR,ADDR,UTS,LOGT,MSGT
+                                        FROM st_sessions a
+                                       WHERE SID=? AND NOT EXISTS (SELECT 1 FROM st_session_archive b WHERE b.PERIOD=? AND b.SID=a.SID)`,
+                    j.PERIOD, j.SID, j.PERIOD); err != nil {
+                    panic(err.Error())
+                }
+            }
+            if lock := SQL.lockTable(conn.driver, "st_sessions"); lock != "" {
+                tx.Exec(lock)
+            }
+            for _, j := range list {
+                tx.Exec("DELETE FROM st_sessions WHERE SID=?", j.SID)    // hapus dari tabel operasional
+            }
+            if unlock := SQL.unlockTables(conn.driver); unlock != "" {
+                tx.Exec(unlock)
+            }
+            tx.Commit()
+            n = len(list)
+            for _, j := range list {
+                Cache.Delete(j.SID)
+                Cache.Delete("uts:" + j.SID)
+            }
+        },
+        Catch: func(ex Exception) {
+            tx.Rollback()
+            e = errors.New(to.String(ex))
+        },
+    }).Run()
+    return n, e
+}
+
+// ** FileSessionStore **
+
+// SID dari client, pastikan tidak bisa digunakan untuk path traversal
+func (self *FileSessionStore) file(SID string) (string, error) {
+    if SID == "" || strings.ContainsAny(SID, `/\.`) {
+        return "", errors.New("SessionNotFoundException: " + SID)
+    }
+    return filepath.Join(self.Dir, SID + ".json"), nil
+}
+
+func (self *FileSessionStore) read(f string) (*SessionRecord, error) {
+    b, e := ioutil.ReadFile(f)
+    if e != nil {
+        return nil, e
+    }
+    r := &SessionRecord{}
+    if e = json.Unmarshal(b, r); e != nil {
+        return nil, e
+    }
+    r.Data = remap(r.Data, sessionMaps...)
+    return r, nil
+}
+
+// Tulis ke file temporary lalu rename agar instance lain tidak membaca file setengah jadi
+func (self *FileSessionStore) write(r *SessionRecord) error {
+    f, e := self.file(r.SID)
+    if e != nil {
+        return e
+    }
+    b, e := json.Marshal(r)
+    if e != nil {
+        return e
+    }
+    if e = os.MkdirAll(self.Dir, 0700); e != nil {
+        return e
+    }
+    t := f + ".tmp"
+    if e = ioutil.WriteFile(t, b, 0600); e != nil {
+        return e
+    }
+    return os.Rename(t, f)
+}
+
+func (self *FileSessionStore) archive(r *SessionRecord) error {
+    f, e := self.file(r.SID)
+    if e != nil {
+        return e
+    }
+    d := filepath.Join(self.Dir, "archive", sessionPeriod(r.LOGT))
+    if e = os.MkdirAll(d, 0700); e != nil {
+        return e
+    }
+    return os.Rename(f, filepath.Join(d, r.SID + ".json"))
+}
+
+func (self *FileSessionStore) Load(SID string) (*SessionRecord, error) {
+    f, e := self.file(SID)
+    if e != nil {
+        return nil, e
+    }
+    r, e := self.read(f)
+    if e != nil || !r.alive(time.Now().Unix()) {
+        return nil, errors.New("SessionNotFoundException: " + SID)
+    }
+    return r, nil
+}
+
+func (self *FileSessionStore) Save(r *SessionRecord, create bool) error {
+    self.lock.Lock()
+    defer self.lock.Unlock()
+    now := time.Now()
+    if create {
+        r.LOGT = now
+    } else if f, e := self.file(r.SID); e == nil {
+        if o, e := self.read(f); e == nil {  // USR, ADDR dan LOGT tidak berubah
+            r.USR, r.ADDR, r.LOGT = o.USR, o.ADDR, o.LOGT
+        }
+    }
+    r.UTS = now.Unix()
+    return self.write(r)
+}
+
+func (self *FileSessionStore) Touch(SID string) error {
+    self.lock.Lock()
+    defer self.lock.Unlock()
+    f, e := self.file(SID)
+    if e != nil {
+        return e
+    }
+    r, e := self.read(f)
+    if e != nil {
+        return e
+    }
+    r.UTS = time.Now().Unix()
+    return self.write(r)
+}
+
+func (self *FileSessionStore) Destroy(SID string) error {
+    self.lock.Lock()
+    defer self.lock.Unlock()
+    f, e := self.file(SID)
+    if e != nil {
+        return e
+    }
+    r, e := self.read(f)
+    if e != nil {
+        return errors.New("SessionNotFoundException: " + SID)
+    }
+    return self.archive(r)
+}
+
+func (self *FileSessionStore) scan(f func(*SessionRecord)) error {
+    files, e := filepath.Glob(filepath.Join(self.Dir, "*.json"))
+    if e != nil {
+        return e
+    }
+    for _, j := range files {
+        if r, e := self.read(j); e == nil {
+            f(r)
+        }
+    }
+    return nil
+}
+
+func (self *FileSessionStore) List(USR string) ([]*SessionRecord, error) {
+    z := make([]*SessionRecord, 0)
+    now := time.Now().Unix()
+    e := self.scan(func(r *SessionRecord) {
+        if (USR == "" || r.USR == USR) && r.alive(now) {
+            z = append(z, r)
+        }
+    })
+    return z, e
+}
+
+func (self *FileSessionStore) Purge() ([]*SessionRecord, error) {
+    self.lock.Lock()
+    defer self.lock.Unlock()
+    z := make([]*SessionRecord, 0)
+    now := time.Now().Unix()
+    e := self.scan(func(r *SessionRecord) {
+        if !r.alive(now) {
+            if self.archive(r) == nil {
+                z = append(z, r)
+            }
+        }
+    })
+    return z, e
+}
@@ -0,0 +1,131 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "io/ioutil"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func testFileSessionStore(t *testing.T) (*FileSessionStore, func()) {
+    dir, e := ioutil.TempDir("", "session")
+    if e != nil {
+        t.Fatal(e)
+    }
+    Cache.Set("SSO_SSN_EXP", 3600)
+    return &FileSessionStore{Dir: dir}, func() {
+        os.RemoveAll(dir)
+        Cache.Delete("SSO_SSN_EXP")
+    }
+}
+
+func TestFileSessionStore(t *testing.T) {
+    s, done := testFileSessionStore(t)
+    defer done()
+
+    data := GMap{"USR": "tester", "GID": map[string]string{"ADMIN": "Administrator"}}
+    if e := s.Save(&SessionRecord{SID: "SID-1", USR: "tester", ADDR: "127.0.0.1", Data: data}, true); e != nil {
+        t.Fatal(e)
+    }
+    s.Save(&SessionRecord{SID: "SID-2", USR: "tester", Data: GMap{"USR": "tester"}}, true)
+    s.Save(&SessionRecord{SID: "SID-3", USR: "other", Data: GMap{"USR": "other"}}, true)
+
+    r, e := s.Load("SID-1")
+    if e != nil {
+        t.Fatal(e)
+    }
+    if g, v := r.Data["GID"].(map[string]string); !v || g["ADMIN"] != "Administrator" {
+        t.Errorf("unexpected GID %#v", r.Data["GID"])
+    }
+    if r.ADDR != "127.0.0.1" || r.LOGT.IsZero() {
+        t.Errorf("unexpected record %+v", r)
+    }
+
+    // update tidak mengubah informasi login
+    s.Save(&SessionRecord{SID: "SID-1", Data: GMap{"USR": "tester", "LANG": "id"}}, false)
+    if r, _ = s.Load("SID-1"); r.USR != "tester" || r.ADDR != "127.0.0.1" || r.Data["LANG"] != "id" {
+        t.Errorf("unexpected record %+v", r)
+    }
+
+    if l, _ := s.List("tester"); len(l) != 2 {
+        t.Errorf("expected 2 sessions. received %d", len(l))
+    }
+
+    if e := s.Destroy("SID-2"); e != nil {
+        t.Fatal(e)
+    }
+    if _, e := s.Load("SID-2"); e == nil {
+        t.Error("destroyed session must not be loaded")
+    }
+    if m, _ := filepath.Glob(filepath.Join(s.Dir, "archive", "*", "SID-2.json")); len(m) != 1 {
+        t.Error("destroyed session must be archived")
+    }
+
+    // expired
+    r, _ = s.Load("SID-3")
+    r.UTS = time.Now().Unix() - 7200
+    s.write(r)
+    if _, e := s.Load("SID-3"); e == nil {
+        t.Error("expired session must not be loaded")
+    }
+    if z, _ := s.Purge(); len(z) != 1 || z[0].SID != "SID-3" {
+        t.Errorf("expected SID-3 purged. received %v", z)
+    }
+
+    if _, e := s.Load("../SID-1"); e == nil {
+        t.Error("expected invalid SID")
+    }
+}
+
+func TestSessionStart(t *testing.T) {
+    s, done := testFileSessionStore(t)
+    defer done()
+    prev := Sessions()
+    ExportSessionStore(s)
+    defer ExportSessionStore(prev)
+
+    s.Save(&SessionRecord{SID: "SID-START", USR: "tester", Data: GMap{"USR": "tester"}}, true)
+    ctx := testContext("", url.Values{})
+    ctx.Request.AddCookie(&http.Cookie{Name: SAFSID, Value: "SID-START"})
+    if e := ctx.sessionStart(nil); e != nil {
+        t.Fatal(e)
+    }
+    if USR, _ := ctx.SessionUser(); USR != "tester" || ctx.SID != "SID-START" {
+        t.Errorf("unexpected session %s %s", USR, ctx.SID)
+    }
+
+    ctx = testContext("", url.Values{})
+    ctx.Request.AddCookie(&http.Cookie{Name: SAFSID, Value: "SID-UNKNOWN"})
+    if e := ctx.sessionStart(nil); e == nil {
+        t.Error("expected SessionNotFoundException")
+    }
+}
+
+// LOGT dari berbagai driver (DATETIME MySQL, RFC3339 dari time.Time)
+func TestSessionTime(t *testing.T) {
+    for _, j := range []string{"2024-03-05 10:20:30", "2024-03-05T10:20:30Z", "2024-03-05T10:20:30+07:00", "2024-03-05 10:20:30.123456", "2024-03-05T10:20:30"} {
+        v, b := sessionTime(j)
+        if !b || sessionPeriod(v) != "202403" || v.Hour() != 10 || v.Location() != time.Local {
+            t.Errorf("%s: unexpected %v %v", j, v, b)
+        }
+    }
+    if _, b := sessionTime("05/03/2024"); b {
+        t.Error("unknown format must fail")
+    }
+}
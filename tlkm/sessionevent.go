@@ -0,0 +1,226 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Event session untuk SessionCallback (lihat ExportSessionListener)
+//
+//   1. OnCreate    login, dipanggil untuk semua listener
+//   2. OnUpdate    perubahan attribute. Perubahan (key, nilai lama dan baru) tersedia
+//                  melalui Context.SessionChanges. Listener yang mengimplementasikan
+//                  SessionSubscriber hanya dipanggil untuk package/key yang di-subscribe
+//   3. OnDestroy   logout, force logout oleh admin, eviction dst (SessionDestroyListener)
+//   4. OnExpire    session expired (idle/absolute timeout) yang di-purge secara periodik
+//                  dengan interval config SSN_PURGE_INTERVAL detik (default 60, 0 untuk
+//                  menonaktifkan), lihat SessionExpireListener
+//
+// contoh:
+//
+//      func (self *hrSession) Subscribe() tlkm.SessionSubscription {
+//          return tlkm.SessionSubscription{Packages: []string{"github.com/app/hr"}, Keys: []string{"GID"}}
+//      }
+//
+//      func (self *hrSession) OnUpdate(conn *tlkm.Connection, ctx *tlkm.Context) {
+//          if c, b := ctx.SessionChanges()["GID"]; b {
+//              // c.Old, c.New
+//          }
+//      }
+package tlkm
+
+import (
+    "errors"
+    "reflect"
+    "strconv"
+    "strings"
+    "time"
+)
+
+type (
+    // Perubahan satu attribute session. Old/New nil berarti attribute belum ada/dihapus
+    SessionChange struct {
+        Old, New    interface{}
+    }
+
+    SessionDiff map[string]SessionChange
+
+    // Filter OnUpdate: perubahan yang dilakukan handler dalam Packages (package path)
+    // atau perubahan pada Keys. Keduanya kosong berarti semua perubahan
+    SessionSubscription struct {
+        Packages    []string
+        Keys        []string
+    }
+
+    SessionSubscriber interface {
+        Subscribe() SessionSubscription
+    }
+
+    // Opsional, diimplementasikan oleh SessionCallback
+    SessionDestroyListener interface {
+        OnDestroy(*Connection, *SessionRecord)
+    }
+
+    SessionExpireListener interface {
+        OnExpire(*Connection, *SessionRecord)
+    }
+)
+
+var (
+    // ** private **
+    chssn   chan struct{}
+)
+
+// Perubahan attribute session dalam request ini (valid di dalam OnUpdate)
+func (self *Context) SessionChanges() SessionDiff {
+    z := make(SessionDiff)
+    for k, v := range self.sesDiff {
+        n, _ := self.sesMap[k]
+        if !reflect.DeepEqual(v.Old, n) {
+            z[k] = SessionChange{Old: v.Old, New: n}
+        }
+    }
+    return z
+}
+
+// Simpan nilai lama key k (sekali per request) sebelum diubah
+func (self *Context) sessionTrack(k string) {
+    self.sesUpdate = true
+    if self.sesDiff == nil {
+        self.sesDiff = make(SessionDiff)
+    }
+    if _, b := self.sesDiff[k]; !b {
+        v, _ := self.sesMap[k]
+        self.sesDiff[k] = SessionChange{Old: v}
+    }
+}
+
+func (self SessionSubscription) match(ctx *Context, diff SessionDiff) bool {
+    if len(self.Packages) == 0 && len(self.Keys) == 0 {
+        return true
+    }
+    if len(diff) == 0 {
+        return false
+    }
+    if ctx.Request != nil {
+        for _, j := range self.Packages {
+            if p := FileSeparator + strings.Trim(j, FileSeparator) + FileSeparator; strings.HasPrefix(ctx.Request.URL.Path, p) {
+                return true
+            }
+        }
+    }
+    for _, j := range self.Keys {
+        if _, b := diff[j]; b {
+            return true
+        }
+    }
+    return false
+}
+
+// OnUpdate untuk listener yang subscribe perubahan dalam request ini
+func sessionUpdated(conn *Connection, ctx *Context) {
+    diff := ctx.SessionChanges()
+    for _, l := range sessMap {
+        if s, b := l.(SessionSubscriber); b && !s.Subscribe().match(ctx, diff) {
+            continue
+        }
+        l.OnUpdate(conn, ctx)
+    }
+}
+
+// Destroy session SID (archive + hapus cache oleh session store) dan panggil OnDestroy.
+// Session yang tidak dikenal atau sudah expired tetap di-archive (jika ada), tapi return
+// SessionNotFoundException tanpa memanggil OnDestroy. conn boleh nil
+func sessionDestroy(conn *Connection, SID string) error {
+    r, le := sessionStore.Load(SID)
+    if e := sessionStore.Destroy(SID); e != nil {
+        return e
+    }
+    if le != nil {
+        return errors.New("SessionNotFoundException: " + SID)
+    }
+    if r.USR == "" {
+        r.USR, _ = r.Data["USR"].(string)
+    }
+    sessionEvent(conn, func(conn *Connection, l SessionCallback) {
+        if d, b := l.(SessionDestroyListener); b {
+            d.OnDestroy(conn, r)
+        }
+    })
+    return nil
+}
+
+// Purge session expired dan panggil OnExpire
+func sessionPurge(conn *Connection) int {
+    z, _ := sessionStore.Purge()
+    for _, r := range z {
+        sessionEvent(conn, func(conn *Connection, l SessionCallback) {
+            if x, b := l.(SessionExpireListener); b {
+                x.OnExpire(conn, r)
+            }
+        })
+    }
+    return len(z)
+}
+
+func sessionEvent(conn *Connection, f func(*Connection, SessionCallback)) {
+    if len(sessMap) == 0 {
+        return
+    }
+    if conn == nil {
+        conn = SQL.Default()
+        defer conn.Close()
+    }
+    for _, l := range sessMap {
+        f(conn, l)
+    }
+}
+
+// Satu putaran purge. Error database (atau panic listener OnExpire) hanya dicatat,
+// purge tetap berjalan pada interval berikutnya
+func purgeTick() {
+    (&Go{
+        Try: func() {
+            if n := sessionPurge(nil); n > 0 && ctrl != nil && ctrl.logLv >= INFO {
+                ctrl.Log(INFO, "Session expired: " + strconv.Itoa(n))
+            }
+        },
+        Catch: func(ex Exception) {
+            (&Logger{logNs: "SYST", logLv: loglv}).Log(WARN, Sprintf("SessionPurgeException: %s", ex))
+        },
+    }).Run()
+}
+
+// Purge periodik, dijalankan oleh setup
+func watchSessions() {
+    if chssn != nil {
+        close(chssn)
+        chssn = nil
+    }
+    d, b := Cache.Int("SSN_PURGE_INTERVAL")
+    if !b {
+        d = 60
+    }
+    if d <= 0 {
+        return
+    }
+    chssn = make(chan struct{})
+    go func(stop chan struct{}) {
+        tick := time.NewTicker(time.Duration(d) * time.Second)
+        defer tick.Stop()
+        for {
+            select {
+            case <-stop:
+                return
+            case <-tick.C:
+                purgeTick()
+            }
+        }
+    }(chssn)
+}
@@ -0,0 +1,156 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "net/url"
+    "testing"
+    "time"
+)
+
+type testSessionListener struct {
+    sub                         *SessionSubscription
+    update                      int
+    changes                     SessionDiff
+    destroyed, expired          []string
+}
+
+func (self *testSessionListener) OnCreate(conn *Connection, ctx *Context) {}
+
+func (self *testSessionListener) OnUpdate(conn *Connection, ctx *Context) {
+    self.update++
+    self.changes = ctx.SessionChanges()
+}
+
+func (self *testSessionListener) OnDestroy(conn *Connection, r *SessionRecord) {
+    self.destroyed = append(self.destroyed, r.SID + ":" + r.USR)
+}
+
+func (self *testSessionListener) OnExpire(conn *Connection, r *SessionRecord) {
+    self.expired = append(self.expired, r.SID)
+}
+
+type testSessionSubscriber struct {
+    testSessionListener
+}
+
+func (self *testSessionSubscriber) Subscribe() SessionSubscription {
+    return *self.sub
+}
+
+func TestSessionChanges(t *testing.T) {
+    ctx := testContext("", url.Values{})
+    ctx.sesMap = GMap{"USR": "tester", "LANG": "id", "THEME": "dark"}
+    ctx.SessionSet("LANG", "en").SessionSet("LANG", "jv").SessionSet("USR", "tester").SessionSet("PAGE", 10).SessionUnset("THEME")
+    z := ctx.SessionChanges()
+    if len(z) != 3 {
+        t.Fatalf("expected 3 changes. received %v", z)
+    }
+    if c := z["LANG"]; c.Old != "id" || c.New != "jv" {
+        t.Errorf("unexpected LANG %+v", c)
+    }
+    if c := z["PAGE"]; c.Old != nil || c.New != 10 {
+        t.Errorf("unexpected PAGE %+v", c)
+    }
+    if c := z["THEME"]; c.Old != "dark" || c.New != nil {
+        t.Errorf("unexpected THEME %+v", c)
+    }
+}
+
+func TestSessionSubscription(t *testing.T) {
+    all := &testSessionListener{}
+    hr := &testSessionSubscriber{testSessionListener{sub: &SessionSubscription{Packages: []string{"github.com/app/hr"}}}}
+    lang := &testSessionSubscriber{testSessionListener{sub: &SessionSubscription{Keys: []string{"LANG"}}}}
+    prev := sessMap
+    sessMap = map[string]SessionCallback{"all": all, "hr": hr, "lang": lang}
+    defer func() { sessMap = prev }()
+
+    ctx := testContext("", url.Values{})
+    ctx.Request.URL.Path = "/github.com/app/hr/Employee"
+    ctx.sesMap = GMap{"USR": "tester"}
+    ctx.SessionSet("DEPT", "IT")
+    sessionUpdated(nil, ctx)
+    if all.update != 1 || hr.update != 1 || lang.update != 0 {
+        t.Errorf("unexpected calls all=%d hr=%d lang=%d", all.update, hr.update, lang.update)
+    }
+    if c, b := hr.changes["DEPT"]; !b || c.New != "IT" {
+        t.Errorf("unexpected changes %v", hr.changes)
+    }
+
+    ctx = testContext("", url.Values{})
+    ctx.Request.URL.Path = "/github.com/app/finance/Invoice"
+    ctx.sesMap = GMap{"USR": "tester", "LANG": "id"}
+    ctx.SessionSet("LANG", "en")
+    sessionUpdated(nil, ctx)
+    if all.update != 2 || hr.update != 1 || lang.update != 1 {
+        t.Errorf("unexpected calls all=%d hr=%d lang=%d", all.update, hr.update, lang.update)
+    }
+
+    // tanpa perubahan nilai, subscriber tidak dipanggil
+    ctx = testContext("", url.Values{})
+    ctx.Request.URL.Path = "/github.com/app/hr/Employee"
+    ctx.sesMap = GMap{"USR": "tester", "LANG": "id"}
+    ctx.SessionSet("LANG", "id")
+    sessionUpdated(nil, ctx)
+    if hr.update != 1 || lang.update != 1 {
+        t.Errorf("unexpected calls hr=%d lang=%d", hr.update, lang.update)
+    }
+}
+
+func TestSessionDestroyExpire(t *testing.T) {
+    s, done := testFileSessionStore(t)
+    defer done()
+    store := sessionStore
+    ExportSessionStore(s)
+    defer ExportSessionStore(store)
+    l := &testSessionListener{}
+    prev := sessMap
+    sessMap = map[string]SessionCallback{"l": l}
+    defer func() { sessMap = prev }()
+
+    conn := &Connection{}
+    s.Save(&SessionRecord{SID: "SID-1", USR: "tester", Data: GMap{"USR": "tester"}}, true)
+    s.Save(&SessionRecord{SID: "SID-2", USR: "tester", Data: GMap{"USR": "tester", "SSN_ABS": time.Now().Unix() - 1}}, true)
+    if e := sessionDestroy(conn, "SID-1"); e != nil {
+        t.Fatal(e)
+    }
+    if len(l.destroyed) != 1 || l.destroyed[0] != "SID-1:tester" {
+        t.Errorf("unexpected OnDestroy %v", l.destroyed)
+    }
+    if n := sessionPurge(conn); n != 1 || len(l.expired) != 1 || l.expired[0] != "SID-2" {
+        t.Errorf("unexpected OnExpire %d %v", n, l.expired)
+    }
+    // session tidak dikenal atau expired: tidak ada OnDestroy
+    s.Save(&SessionRecord{SID: "SID-3", USR: "tester", Data: GMap{"USR": "tester", "SSN_ABS": time.Now().Unix() - 1}}, true)
+    for _, j := range []string{"SID-1", "SID-3"} {
+        if e := sessionDestroy(conn, j); e == nil {
+            t.Errorf("expected SessionNotFoundException for %s", j)
+        }
+    }
+    if len(l.destroyed) != 1 {
+        t.Errorf("unexpected OnDestroy %v", l.destroyed)
+    }
+    if n := sessionPurge(conn); n != 0 {
+        t.Errorf("expired session must be archived. received %d", n)
+    }
+}
+
+// Purge pada database yang tidak bisa diakses hanya dicatat
+func TestPurgeTickRecover(t *testing.T) {
+    defer testBrokenDefault(t)()
+    store := sessionStore
+    ExportSessionStore(&sqlSessionStore{})
+    defer ExportSessionStore(store)
+    purgeTick()
+}
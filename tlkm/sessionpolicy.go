@@ -0,0 +1,231 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Policy session per group dan administrasi session aktif
+//
+// Policy didaftarkan per GID melalui ExportSessionPolicy, group tanpa policy menggunakan
+// default dari config:
+//
+//      SSN_MAX         maksimal session bersamaan per user (0: tidak dibatasi)
+//      SSN_EVICT       true: session terlama di-destroy, false: login baru ditolak
+//      SSN_IDLE_EXP    idle timeout (detik), tidak bisa melebihi SSO_SSN_EXP
+//      SSN_ABS_EXP     absolute timeout (detik) sejak login (0: tidak dibatasi)
+//
+// User dengan beberapa group mendapat policy yang paling ketat. Timeout disimpan sebagai
+// attribute session (SSN_IDLE, SSN_ABS) pada saat login sehingga perubahan policy hanya
+// berlaku untuk login berikutnya
+//
+// Batas session diperiksa oleh Context.LoginIdentity (semua provider, lihat auth.go).
+// Login legacy melalui SessionSet("USR") atau SessionLogin diperiksa pada saat session
+// disimpan: jika ditolak, session tidak dibentuk dan response dikirim dengan status 409
+package tlkm
+
+import (
+    "errors"
+    "strconv"
+    "time"
+)
+
+type (
+    // Nilai 0 berarti tidak dibatasi (Idle: mengikuti SSO_SSN_EXP)
+    SessionPolicy struct {
+        MaxSessions int
+        EvictOldest bool
+        Idle        time.Duration
+        Absolute    time.Duration
+    }
+
+    // Administrasi session aktif, di export dengan SEC true dan dibatasi ACL
+    //
+    //  GET     [USR=<username>][&ADDR=<ip>]    list session aktif
+    //  DELETE  SID=<sid> | USR=<username>      force logout (archive + hapus cache)
+    SessionAdminService struct {
+        NotAllowedService
+    }
+)
+
+var (
+    // ** private **
+    sessionPolicies = make(map[string]SessionPolicy)
+)
+
+// Daftarkan policy session untuk group GID
+func ExportSessionPolicy(GID string, policy SessionPolicy) {
+    sessionPolicies[GID] = policy
+}
+
+func sessionPolicyConfig() SessionPolicy {
+    z := SessionPolicy{}
+    z.MaxSessions, _ = Cache.Int("SSN_MAX")
+    z.EvictOldest, _ = Cache.Bool("SSN_EVICT")
+    if v, b := Cache.Int("SSN_IDLE_EXP"); b {
+        z.Idle = time.Duration(v) * time.Second
+    }
+    if v, b := Cache.Int("SSN_ABS_EXP"); b {
+        z.Absolute = time.Duration(v) * time.Second
+    }
+    return z
+}
+
+// nilai terkecil yang tidak 0
+func policyMin(a, b int64) int64 {
+    if a == 0 || (b != 0 && b < a) {
+        return b
+    }
+    return a
+}
+
+// Policy efektif user dengan groups GID: paling ketat dari semua group. Eviction hanya
+// jika semua group yang membatasi jumlah session mengizinkan
+func SessionPolicyOf(GID map[string]string) SessionPolicy {
+    list := make([]SessionPolicy, 0)
+    for k := range GID {
+        if v, b := sessionPolicies[k]; b {
+            list = append(list, v)
+        }
+    }
+    if len(list) == 0 {
+        return sessionPolicyConfig()
+    }
+    z := list[0]
+    for _, j := range list[1:] {
+        if j.MaxSessions != 0 {
+            if z.MaxSessions == 0 {
+                z.EvictOldest = j.EvictOldest
+            } else {
+                z.EvictOldest = z.EvictOldest && j.EvictOldest
+            }
+        }
+        z.MaxSessions = int(policyMin(int64(z.MaxSessions), int64(j.MaxSessions)))
+        z.Idle = time.Duration(policyMin(int64(z.Idle), int64(j.Idle)))
+        z.Absolute = time.Duration(policyMin(int64(z.Absolute), int64(j.Absolute)))
+    }
+    return z
+}
+
+// Pastikan user masih boleh membentuk session baru. Session SID (yang akan diganti
+// oleh login ini) tidak dihitung
+func sessionAdmit(USR, SID string, policy SessionPolicy) error {
+    if policy.MaxSessions <= 0 {
+        return nil
+    }
+    list, e := sessionStore.List(USR)
+    if e != nil {
+        return e
+    }
+    active := make([]*SessionRecord, 0, len(list))
+    for _, j := range list {
+        if j.SID != SID {
+            active = append(active, j)
+        }
+    }
+    n := len(active) - policy.MaxSessions + 1
+    if n <= 0 {
+        return nil
+    }
+    if !policy.EvictOldest {
+        return errors.New("SessionLimitException: maksimal " + strconv.Itoa(policy.MaxSessions) + " session aktif")
+    }
+    // terlama berdasarkan waktu login
+    for ; n > 0; n-- {
+        k := 0
+        for i, j := range active {
+            if sessionLogin(j).Before(sessionLogin(active[k])) {
+                k = i
+            }
+        }
+        sessionDestroy(nil, active[k].SID)
+        active = append(active[:k], active[k+1:]...)
+    }
+    return nil
+}
+
+// Waktu login, record tanpa LOGT menggunakan UTS
+func sessionLogin(r *SessionRecord) time.Time {
+    if r.LOGT.IsZero() {
+        return time.Unix(r.UTS, 0)
+    }
+    return r.LOGT
+}
+
+// Set attribute timeout session baru sesuai policy
+func (self *Context) sessionPolicy(policy SessionPolicy) {
+    if policy.Idle > 0 {
+        self.SessionSet("SSN_IDLE", int64(policy.Idle / time.Second))
+    }
+    if policy.Absolute > 0 {
+        self.SessionSet("SSN_ABS", time.Now().Add(policy.Absolute).Unix())
+    }
+}
+
+// Informasi session tanpa Data (berisi token CSRF/refresh)
+func sessionInfo(r *SessionRecord) GMap {
+    z := GMap{"SID": r.SID, "USR": r.USR, "ADDR": r.ADDR, "UTS": r.UTS, "LOGT": r.LOGT.Format(sqlDatetime)}
+    if v, b := r.Data["GID"]; b {
+        z["GID"] = v
+    }
+    if v, b := r.Data["AUTH"]; b {
+        z["AUTH"] = v
+    }
+    return z
+}
+
+func (self *SessionAdminService) impersonationDenied() {}
+
+func (self *SessionAdminService) GET(conn *Connection, ctx *Context) {
+    list, e := sessionStore.List(ctx.Get("USR"))
+    if e != nil {
+        ctx.Code(StatusInternalServerError).Warn(e.Error())
+        return
+    }
+    ADDR := ctx.Get("ADDR")
+    z := make([]GMap, 0, len(list))
+    for _, j := range list {
+        if ADDR == "" || j.ADDR == ADDR {
+            z = append(z, sessionInfo(j))
+        }
+    }
+    ctx.Data(z)
+}
+
+func (self *SessionAdminService) DELETE(conn *Connection, ctx *Context) {
+    SID, USR := ctx.Get("SID"), ctx.Get("USR")
+    list := make([]string, 0)
+    switch {
+    case SID != "":
+        list = append(list, SID)
+    case USR != "":
+        z, e := sessionStore.List(USR)
+        if e != nil {
+            ctx.Code(StatusInternalServerError).Warn(e.Error())
+            return
+        }
+        for _, j := range z {
+            list = append(list, j.SID)
+        }
+    default:
+        ctx.Code(StatusBadRequest).Warn("EmptyParameterException: SID atau USR")
+        return
+    }
+    n := 0
+    for _, j := range list {
+        if sessionDestroy(conn, j) == nil {
+            n++
+        }
+    }
+    if n == 0 && SID != "" {
+        ctx.Code(StatusNotFound).Warn("SessionNotFoundException: " + SID)
+        return
+    }
+    ctx.Code(StatusOK).Data(GMap{"destroyed": n})
+}
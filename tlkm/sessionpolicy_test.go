@@ -0,0 +1,177 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "net/url"
+    "testing"
+    "time"
+)
+
+func TestSessionPolicyOf(t *testing.T) {
+    ExportSessionPolicy("STAFF", SessionPolicy{MaxSessions: 3, EvictOldest: true, Idle: time.Hour})
+    ExportSessionPolicy("ADMIN", SessionPolicy{MaxSessions: 1, Absolute: 8 * time.Hour, Idle: 15 * time.Minute})
+    defer delete(sessionPolicies, "STAFF")
+    defer delete(sessionPolicies, "ADMIN")
+
+    z := SessionPolicyOf(map[string]string{"STAFF": "", "ADMIN": ""})
+    if z.MaxSessions != 1 || z.EvictOldest || z.Idle != 15 * time.Minute || z.Absolute != 8 * time.Hour {
+        t.Errorf("unexpected policy %+v", z)
+    }
+    if z = SessionPolicyOf(map[string]string{"STAFF": ""}); z.MaxSessions != 3 || !z.EvictOldest || z.Absolute != 0 {
+        t.Errorf("unexpected policy %+v", z)
+    }
+    Cache.Set("SSN_MAX", 2)
+    defer Cache.Delete("SSN_MAX")
+    if z = SessionPolicyOf(nil); z.MaxSessions != 2 || z.EvictOldest {
+        t.Errorf("unexpected default policy %+v", z)
+    }
+}
+
+func TestSessionLimit(t *testing.T) {
+    s, done := testFileSessionStore(t)
+    defer done()
+    store := sessionStore
+    ExportSessionStore(s)
+    defer ExportSessionStore(store)
+
+    for _, j := range []string{"SID-1", "SID-2"} {
+        s.Save(&SessionRecord{SID: j, USR: "tester", Data: GMap{"USR": "tester"}}, true)
+        time.Sleep(10 * time.Millisecond)
+    }
+    z := &Identity{USR: "tester", GID: map[string]string{"OPS": "Operator"}, Source: "LOCAL"}
+
+    ExportSessionPolicy("OPS", SessionPolicy{MaxSessions: 2})
+    defer delete(sessionPolicies, "OPS")
+    ctx := testContext("", nil)
+    if e := ctx.LoginIdentity(z); e == nil || accountStatus(e) != StatusConflict {
+        t.Fatalf("expected SessionLimitException. received %v", e)
+    }
+    // session yang diganti tidak dihitung
+    ctx.SID = "SID-2"
+    if e := ctx.LoginIdentity(z); e != nil {
+        t.Error(e)
+    }
+
+    // SID-2 di-destroy oleh login di atas, session baru belum disimpan
+    s.Save(&SessionRecord{SID: "SID-3", USR: "tester", Data: GMap{"USR": "tester"}}, true)
+    ExportSessionPolicy("OPS", SessionPolicy{MaxSessions: 2, EvictOldest: true, Absolute: time.Hour})
+    ctx = testContext("", nil)
+    if e := ctx.LoginIdentity(z); e != nil {
+        t.Fatal(e)
+    }
+    if _, e := s.Load("SID-1"); e == nil {
+        t.Error("oldest session must be evicted")
+    }
+    if _, e := s.Load("SID-3"); e != nil {
+        t.Error(e)
+    }
+    if v, _ := ctx.Session("SSN_ABS"); v == nil || v.(int64) <= time.Now().Unix() {
+        t.Errorf("expected absolute timeout. received %v", v)
+    }
+}
+
+// Login legacy (SessionSet "USR") dibatasi pada saat session disimpan
+func TestSessionLimitLegacy(t *testing.T) {
+    _, done := testSQLite(t)
+    defer done()
+    s, clean := testFileSessionStore(t)
+    defer clean()
+    store := sessionStore
+    ExportSessionStore(s)
+    defer ExportSessionStore(store)
+    lv := loglv
+    loglv = FRAUD + 1
+    defer func() { loglv = lv }()
+
+    s.Save(&SessionRecord{SID: "SID-1", USR: "tester", Data: GMap{"USR": "tester"}}, true)
+    ExportSessionPolicy("OPS", SessionPolicy{MaxSessions: 1})
+    defer delete(sessionPolicies, "OPS")
+    login := func() *Context {
+        ctx := testContext("", nil)
+        ctx.SessionSet("USR", "tester").SessionSet("GID", map[string]string{"OPS": "Operator"})
+        ctx.sessionClose()
+        return ctx
+    }
+    if ctx := login(); ctx.SID != "" || ctx.code != StatusConflict {
+        t.Errorf("expected rejected session. received %q %d", ctx.SID, ctx.code)
+    }
+    if l, _ := s.List("tester"); len(l) != 1 {
+        t.Errorf("expected 1 session. received %d", len(l))
+    }
+
+    ExportSessionPolicy("OPS", SessionPolicy{MaxSessions: 1, EvictOldest: true})
+    ctx := login()
+    if l, _ := s.List("tester"); ctx.SID == "" || len(l) != 1 || l[0].SID != ctx.SID {
+        t.Errorf("expected oldest session evicted. received %v", l)
+    }
+}
+
+func TestSessionTimeout(t *testing.T) {
+    s, done := testFileSessionStore(t)
+    defer done()
+
+    now := time.Now().Unix()
+    s.Save(&SessionRecord{SID: "IDLE", USR: "tester", Data: GMap{"USR": "tester", "SSN_IDLE": int64(60)}}, true)
+    s.Save(&SessionRecord{SID: "ABS", USR: "tester", Data: GMap{"USR": "tester", "SSN_ABS": now - 1}}, true)
+    if _, e := s.Load("IDLE"); e != nil {
+        t.Error(e)
+    }
+    if _, e := s.Load("ABS"); e == nil {
+        t.Error("session past absolute timeout must not be loaded")
+    }
+    r := &SessionRecord{UTS: now - 120, Data: GMap{"SSN_IDLE": float64(60)}}
+    if r.alive(now) {
+        t.Error("session past idle timeout must not be alive")
+    }
+    // SSN_IDLE tidak bisa melebihi SSO_SSN_EXP
+    r = &SessionRecord{UTS: now - 7200, Data: GMap{"SSN_IDLE": float64(86400)}}
+    if r.alive(now) {
+        t.Error("idle timeout must not exceed SSO_SSN_EXP")
+    }
+}
+
+func TestSessionAdminService(t *testing.T) {
+    s, done := testFileSessionStore(t)
+    defer done()
+    store := sessionStore
+    ExportSessionStore(s)
+    defer ExportSessionStore(store)
+
+    s.Save(&SessionRecord{SID: "SID-1", USR: "tester", ADDR: "10.0.0.1", Data: GMap{"USR": "tester", "CSRF": "x"}}, true)
+    s.Save(&SessionRecord{SID: "SID-2", USR: "tester", ADDR: "10.0.0.2", Data: GMap{"USR": "tester"}}, true)
+    s.Save(&SessionRecord{SID: "SID-3", USR: "other", ADDR: "10.0.0.1", Data: GMap{"USR": "other"}}, true)
+
+    svc := &SessionAdminService{}
+    ctx := testContext("", url.Values{"ADDR": {"10.0.0.1"}})
+    svc.GET(nil, ctx)
+    list, _ := ctx.json["data"].([]GMap)
+    if len(list) != 2 {
+        t.Fatalf("expected 2 sessions. received %v", ctx.json["data"])
+    }
+    if _, b := list[0]["CSRF"]; b {
+        t.Error("session data must not be exposed")
+    }
+
+    ctx = testContext("", url.Values{"USR": {"tester"}})
+    svc.DELETE(nil, ctx)
+    if l, _ := s.List(""); len(l) != 1 || l[0].SID != "SID-3" {
+        t.Errorf("expected only SID-3 left. received %v", l)
+    }
+    ctx = testContext("", url.Values{"SID": {"SID-1"}})
+    svc.DELETE(nil, ctx)
+    if ctx.code != StatusNotFound {
+        t.Errorf("expected %d. received %d", StatusNotFound, ctx.code)
+    }
+}
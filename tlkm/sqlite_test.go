@@ -0,0 +1,268 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+    _ "github.com/mattn/go-sqlite3"
+)
+
+// Koneksi SQLite pada file sementara sebagai datasource default (SYST) selama test
+func testSQLite(t *testing.T) (*Connection, func()) {
+    SQL.Register("sqlite3.e2e", "file:" + filepath.Join(t.TempDir(), "go.db") + "?_busy_timeout=5000")
+    conn := SQL.Lookup("e2e")
+    prev, had := SQL.proto[PackageSystem]
+    SQL.proto[PackageSystem] = conn
+    return conn, func() {
+        if had {
+            SQL.proto[PackageSystem] = prev
+        } else {
+            delete(SQL.proto, PackageSystem)
+        }
+        delete(SQL.proto, "e2e")
+        conn.DB.Close()
+    }
+}
+
+// Migrasi lalu jalur utama framework (handler, session, log, play) terhadap database nyata
+func TestSQLiteEndToEnd(t *testing.T) {
+    conn, done := testSQLite(t)
+    defer done()
+    count := func(stmt string, args ...interface{}) int {
+        rows := conn.Query(stmt, args...)
+        defer rows.Close()
+        rows.Next()
+        return rows.Int("N")
+    }
+
+    if _, e := Migrate(conn, false); e != nil {
+        t.Fatal(e)
+    }
+    if plan, e := Migrate(conn, true); e != nil || len(plan) != 0 {
+        t.Fatalf("expected migrated schema. received %v %v", plan, e)
+    }
+
+    // handler
+    IDX := typeIndex(new(testDeclared))
+    servMap[IDX] = new(testDeclared)
+    defer delete(servMap, IDX)
+    updateHandlers(conn, time.Now().Format(sqlDatetime))
+    PID, HID := ShortURL(IDX)
+    if n := count("SELECT COUNT(*) N FROM st_handlers WHERE PID=? AND HID=?", PID, HID); n != 1 {
+        t.Errorf("expected handler row. received %d", n)
+    }
+
+    // session
+    Cache.Set("SSO_SSN_EXP", 3600)
+    defer Cache.Delete("SSO_SSN_EXP")
+    store := &sqlSessionStore{}
+    r := &SessionRecord{SID: "SID-E2E", USR: "tester", ADDR: "127.0.0.1", UTS: time.Now().Unix(), LOGT: time.Now(), Data: GMap{"USR": "tester"}}
+    if e := store.Save(r, true); e != nil {
+        t.Fatal(e)
+    }
+    Cache.Delete("SID-E2E")
+    if z, e := store.Load("SID-E2E"); e != nil || z.USR != "tester" {
+        t.Fatalf("unexpected session %+v %v", z, e)
+    }
+    if z, _ := store.List("tester"); len(z) != 1 || z[0].LOGT.IsZero() {
+        t.Errorf("unexpected session list %+v", z)
+    }
+    if e := store.Destroy("SID-E2E"); e != nil {
+        t.Fatal(e)
+    }
+    if n := count("SELECT COUNT(*) N FROM st_session_archive WHERE SID='SID-E2E' AND PERIOD=?", sessionPeriod(time.Now())); n != 1 {
+        t.Errorf("expected archived session. received %d", n)
+    }
+    if e := store.Destroy("SID-E2E"); e == nil {
+        t.Error("expected SessionNotFoundException")
+    }
+
+    // log
+    if ID, b := (&Logger{logNs: "SYST", logLv: loglv}).LogSync(INFO, "e2e"); !b || ID <= 0 {
+        t.Errorf("unexpected log %d %v", ID, b)
+    }
+    if n := count("SELECT COUNT(*) N FROM st_logs WHERE MSG='e2e' AND LOGT IS NOT NULL"); n != 1 {
+        t.Errorf("expected log row. received %d", n)
+    }
+
+    // play repo: simpan, hapus dari memory lalu load ulang dari st_play_methods
+    namespace := "/test/play/E2E"
+    if e := PlayParse(conn, testContext("", nil), namespace, []byte(testPlayRule), true); e != nil {
+        t.Fatal(e)
+    }
+    unloadPlay(namespace)
+    defer unloadPlay(namespace)
+    if e := loadPlay(conn, namespace); e != nil {
+        t.Fatal(e)
+    }
+    if x, _ := playService(namespace); x.Func["check"].Rtrn == nil {
+        t.Error("expected procedure loaded from repository")
+    }
+}
+
+// Database yang hanya memiliki tabel inti (migrasi SYST versi 1), seperti database lama
+// yang dibuat manual sebelum MIGRATE_ON_START
+func testSQLiteBaseline(t *testing.T) (*Connection, func()) {
+    conn, done := testSQLite(t)
+    for _, i := range migrations["SYST"][0].statements(conn.driver) {
+        if _, e := conn.Exec(i); e != nil {
+            done()
+            t.Fatal(e)
+        }
+    }
+    clear := func() {
+        handlerSchema.Range(func(k, v interface{}) bool {
+            handlerSchema.Delete(k)
+            return true
+        })
+    }
+    clear()
+    return conn, func() {
+        clear()
+        done()
+    }
+}
+
+func TestSQLiteBaselineArguments(t *testing.T) {
+    conn, done := testSQLiteBaseline(t)
+    defer done()
+    stmts := List{
+        "INSERT INTO st_handlers(PID, HID, SRC) VALUES ('test', 'Baseline', '/test/api/Baseline')",
+        "INSERT INTO st_metadata(TID, CID, TBL, COL, COLT, MAXL) VALUES ('tr_test', 1, 'tr_test', 'KODE', 'VARCHAR', 8)",
+        "INSERT INTO st_handler_arguments(PID, HID, MID, TID, CID, REQUIRED) VALUES ('test', 'Baseline', 'POST', 'tr_test', 1, '1')",
+    }
+    for _, i := range stmts {
+        if _, e := conn.Exec(i); e != nil {
+            t.Fatal(e)
+        }
+    }
+    args := loadArguments(conn, "/test/api/Baseline", "POST")
+    if a, b := args["KODE"]; !b || !a.Required || a.Maxl != 8 || a.Minc != 0 {
+        t.Errorf("unexpected arguments %+v", args)
+    }
+}
+
+func TestSQLiteBaselineRules(t *testing.T) {
+    conn, done := testSQLiteBaseline(t)
+    defer done()
+    stmts := List{
+        "INSERT INTO st_handlers(PID, HID, SRC) VALUES ('test', 'Baseline', '/test/api/Baseline')",
+        "INSERT INTO st_rules(PID, RID, SRC) VALUES ('test', 'Check', '/test/rule/Check')",
+        "INSERT INTO st_handler_rules(PID, HID, MID, RID, SEQ, EXPR) VALUES ('test', 'Baseline', 'POST', 'Check', 1, '1')",
+    }
+    for _, i := range stmts {
+        if _, e := conn.Exec(i); e != nil {
+            t.Fatal(e)
+        }
+    }
+    rs := loadRules(conn, "/test/api/Baseline", "POST")
+    if len(rs.Key) != 1 || !rs.Map["/test/rule/Check"] || len(rs.Errs) != 0 {
+        t.Errorf("unexpected rules %+v", rs)
+    }
+}
+
+// Sinkronisasi deklarasi dilewati (tanpa panic) jika kolom deklarasi belum ada
+func TestSQLiteBaselineDeclarations(t *testing.T) {
+    conn, done := testSQLiteBaseline(t)
+    defer done()
+    IDX := typeIndex(new(testDeclared))
+    prevDecl, prevKey := declMap, servKey
+    declMap, servKey = make(map[string]*Declaration), map[string]serviceKey{IDX: serviceKey{}}
+    lv := loglv
+    loglv = FRAUD + 1   // WARN async tidak boleh menulis setelah datasource test dilepas
+    defer func() {
+        declMap, servKey, loglv = prevDecl, prevKey, lv
+    }()
+    d := &Declaration{}
+    d.Argument("POST", "tr_test", "KODE").Required()
+    declMap[IDX] = d
+    updateDeclarations(conn, time.Now().Format(sqlDatetime))
+    rows := conn.Query("SELECT COUNT(*) N FROM st_handler_arguments")
+    defer rows.Close()
+    if rows.Next(); rows.Int("N") != 0 {
+        t.Errorf("expected no declaration rows on an unmigrated database")
+    }
+}
+
+// Perubahan isi baris tanpa UPDATED_AT tetap terdeteksi poller
+func TestSQLitePollHandlers(t *testing.T) {
+    conn, done := testSQLiteBaseline(t)
+    defer done()
+    prev := sigMap
+    defer func() { sigMap = prev }()
+    stmts := List{
+        "INSERT INTO st_handlers(PID, HID, SRC) VALUES ('test', 'Poll', '/test/api/Poll')",
+        "INSERT INTO st_handlers(PID, HID, SRC) VALUES ('test', 'Other', '/test/api/Other')",
+        "INSERT INTO st_handler_arguments(PID, HID, MID, TID, CID, REQUIRED) VALUES ('test', 'Poll', 'POST', 'tr_test', 1, '0')",
+        "INSERT INTO st_handler_arguments(PID, HID, MID, TID, CID, REQUIRED) VALUES ('test', 'Other', 'POST', 'tr_test', 1, '0')",
+    }
+    for _, i := range stmts {
+        if _, e := conn.Exec(i); e != nil {
+            t.Fatal(e)
+        }
+    }
+    sigMap = nil
+    if r := pollHandlers(conn); r != nil {
+        t.Errorf("expected baseline. received %v", r)
+    }
+    conn.Exec("UPDATE st_handler_arguments SET REQUIRED='1' WHERE HID='Poll'")
+    if r := pollHandlers(conn); !reflect.DeepEqual(r, List{"/test/api/Poll"}) {
+        t.Errorf("expected /test/api/Poll. received %v", r)
+    }
+    if r := pollHandlers(conn); len(r) != 0 {
+        t.Errorf("expected no changes. received %v", r)
+    }
+}
+
+func TestSQLiteMigrateOnStart(t *testing.T) {
+    conn, done := testSQLite(t)
+    defer done()
+    prev, had := os.LookupEnv("MIGRATE_ON_START")
+    defer func() {
+        if had {
+            os.Setenv("MIGRATE_ON_START", prev)
+        } else {
+            os.Unsetenv("MIGRATE_ON_START")
+        }
+    }()
+    startup := func() (r string) {
+        defer func() {
+            if x := recover(); x != nil { r = Sprintf("%s", x) }
+        }()
+        migrateOnStart(conn)
+        return
+    }
+
+    os.Setenv("MIGRATE_ON_START", "0")
+    if r := startup(); !strings.Contains(r, "app migrate") {
+        t.Errorf("expected fail fast on unmigrated schema. received %q", r)
+    }
+    os.Unsetenv("MIGRATE_ON_START")
+    if r := startup(); r != "" {
+        t.Fatal(r)
+    }
+    list := migrations["SYST"]
+    if n := migrationVersion(conn, "SYST"); n != list[len(list)-1].Version {
+        t.Errorf("expected SYST migrated by default. received version %d", n)
+    }
+    os.Setenv("MIGRATE_ON_START", "0")
+    if r := startup(); r != "" {
+        t.Error(r)
+    }
+}
@@ -63,16 +63,26 @@ type (
     }
 
     // Disarankan untuk mengambil object QueryBuilder dari sync.Pool via SQL.Builder()
+    //
+    // Builder dengan Context menerapkan row-level policy sesuai session (lihat rowpolicy.go)
     QueryBuilder struct {
         cols, from  string
-        join    List
+        join    []qbJoin
         groupBy, orderBy    string
         limit, offset   int
-        where, value    *GMap
+        where   Condition
+        value   *GMap
         rollup  bool
         union   *QueryBuilder
         unall   bool
         driver  Driver
+        ctx     *Context
+        system  bool    // bypass row-level policy
+    }
+
+    // ** private **
+    qbJoin struct {
+        kind, from, on  string
     }
 
     // Buffer untuk memenuhi kebutuhan multi values insert: INSERT INTO TABLE_A (B, C) VALUES (D, E), (F, G) ...
@@ -82,6 +92,8 @@ type (
         iter    int
         size    int
         bfer    *buffer.ByteBuffer
+        driver  Driver
+        tail    string
     }
 
     // extends struct transaksi, sementara tanpa enhancement
@@ -122,11 +134,12 @@ const (
     ORACL   // :column
     PGSQL   // $index
     MSSQL   // @column
+    SQLITE  // ?
 )
 
 var (
     // ** private **
-    driversMap = map[Driver]string{MYSQL: "mysql", ORACL: "oracl", PGSQL: "pgsql", MSSQL: "mssql"}
+    driversMap = map[Driver]string{MYSQL: "mysql", ORACL: "oracl", PGSQL: "pgsql", MSSQL: "mssql", SQLITE: "sqlite3"}
     drivers = make(map[string]Driver)
 
     // ** GLOBAL **
@@ -147,6 +160,7 @@ func init() {
     for k, v := range driversMap {
         drivers[v] = k
     }
+    drivers["sqlite"] = SQLITE  // modernc.org/sqlite
 }
 
 func (self *FakeResult) LastInsertId() (int64, error) {
@@ -245,34 +259,34 @@ func (self *sqlx) WhereQuery(driver Driver, stmt *buffer.ByteBuffer, argv *GMap,
         }
         if idx > 0 {
             stmt.WS(column[0:idx]).WRune(' ').WS(column[idx+1:]).WRune(' ')
-            self.bind(driver, stmt, column, idx)
+            self.bind(driver, stmt, len(*args) + 1)
             *args = append(*args, value)
             continue
         }
         if name {
             stmt.WS(namespace[0]).WRune('.')
         }
-        stmt.WS(column).WRune('=')
         if value == nil {
-            stmt.WS("NULL")
+            stmt.WS(column).WS(" IS NULL")
         } else {
-            self.bind(driver, stmt, column, idx)
+            stmt.WS(column).WRune('=')
+            self.bind(driver, stmt, len(*args) + 1)
             *args = append(*args, value)
         }
     }
 }
 
-// TODOC
-func (self *sqlx) bind(driver Driver, stmt *buffer.ByteBuffer, column string, counter int) {
+// Placeholder argument ke-counter (mulai 1) pada statement akhir
+func (self *sqlx) bind(driver Driver, stmt *buffer.ByteBuffer, counter int) {
     switch driver {
-        case MYSQL:
+        case MYSQL, SQLITE:
             stmt.WRune('?')
         case ORACL:
-            stmt.WRune(':').WS(column)
+            stmt.WRune(':').WS(strconv.Itoa(counter))
         case PGSQL:
             stmt.WRune('$').WS(strconv.Itoa(counter))
         case MSSQL:
-            stmt.WRune('@').WS(column)
+            stmt.WS("@p").WS(strconv.Itoa(counter))
     }
 }
 
@@ -283,9 +297,7 @@ func (self *sqlx) insertQuery(driver Driver, intoTable string, ignore bool, vals
     bulk := buffer.Get()
     defer stmt.Close()
     defer bulk.Close()
-    stmt.WS("INSERT")
-    if ignore { stmt.WS(" IGNORE") }
-    stmt.WS(" INTO ")
+    stmt.WS(self.insertHead(driver, ignore))
     stmt.WS(intoTable).WRune(' ').WRune('(')
     top := false
     inn := false
@@ -305,14 +317,20 @@ func (self *sqlx) insertQuery(driver Driver, intoTable string, ignore bool, vals
             } else {
                 inn = true
             }
+            if column[0] == '@' {   // raw expression, sama seperti UpdateQuery
+                if out { stmt.WS(column[1:]) }
+                bulk.WS(to.String(value))
+                continue
+            }
             if out { stmt.WS(column) }
-            self.bind(driver, bulk, column, cnt)
+            self.bind(driver, bulk, cnt)
             argv = append(argv, value)
             cnt+= 1
         }
         out = false
     }
     stmt.WS(") VALUES (").WS(bulk.String()).WRune(')')
+    stmt.WS(self.insertTail(driver, ignore))
     return stmt.String(), argv
 }
 
@@ -337,15 +355,13 @@ func (self *sqlx) InsertIgnoreSelectQuery(intoTable string, qb *QueryBuilder) (s
 }
 
 // TODOC
-func (self *sqlx) UpdateQuery(driver Driver, tableName string, set *GMap, where... *GMap) (string, []interface{}) {
+func (self *sqlx) UpdateQuery(driver Driver, tableName string, set *GMap, where... Condition) (string, []interface{}) {
     argv := make([]interface{}, 0)
     stmt := buffer.Get()
     defer stmt.Close()
     stmt.WS("UPDATE ").WS(tableName).WS(" SET ")
     ccat := false
-    idx := 0
     for column, value := range *set {
-        idx+= 1
         if ccat {
             stmt.WRune(',')
         } else {
@@ -359,40 +375,44 @@ func (self *sqlx) UpdateQuery(driver Driver, tableName string, set *GMap, where.
         if value == nil {
             stmt.WS("NULL")
         } else {
-            self.bind(driver, stmt, column, idx)
+            self.bind(driver, stmt, len(argv) + 1)
             argv = append(argv, value)
         }
     }
-    if len(where) > 0 {
-        stmt.WS(" WHERE ")
-        self.WhereQuery(driver, stmt, where[0], &argv)
-    }
+    self.where(driver, stmt, &argv, where)
     return stmt.String(), argv
 }
 
 // TODOC
-func (self *sqlx) DeleteQuery(driver Driver, tableName string, where... *GMap) (string, []interface{}) {
+func (self *sqlx) DeleteQuery(driver Driver, tableName string, where... Condition) (string, []interface{}) {
     argv := make([]interface{}, 0)
     stmt := buffer.Get()
     defer stmt.Close()
     stmt.WS("DELETE FROM ").WS(tableName)
-    if len(where) > 0 {
-        stmt.WS(" WHERE ")
-        self.WhereQuery(driver, stmt, where[0], &argv)
-    }
+    self.where(driver, stmt, &argv, where)
     return stmt.String(), argv
 }
 
+// WHERE dari beberapa kondisi (AND), tidak ditulis jika kosong
+func (self *sqlx) where(driver Driver, stmt *buffer.ByteBuffer, argv *[]interface{}, where []Condition) {
+    w := &conditionWriter{driver: driver, argv: argv}
+    if s := w.render(Cond.And(where...)); s != "" {
+        stmt.WS(" WHERE ").WS(s)
+    }
+}
+
 // TODOC
-func (self *sqlx) bulkInsert(intoTable string, cols List, ignore bool) *BulkBuffer {
+func (self *sqlx) bulkInsert(intoTable string, cols List, ignore bool, driver... Driver) *BulkBuffer {
     var b *BulkBuffer = self.bbfer.Get().(*BulkBuffer)
     b.bfer = buffer.Get()
-    var u *buffer.ByteBuffer = b.bfer
-    u.WS("INSERT")
-    if ignore {
-        u.WS(" IGNORE")
+    b.size = len(cols)
+    b.driver = MYSQL
+    if len(driver) > 0 {
+        b.driver = driver[0]
     }
-    u.WS(" INTO ").WS(intoTable).WRune('(')
+    b.tail = self.insertTail(b.driver, ignore)
+    var u *buffer.ByteBuffer = b.bfer
+    u.WS(self.insertHead(b.driver, ignore)).WS(intoTable).WRune('(')
     c := false
     for _, n := range cols {
         if c {
@@ -407,13 +427,13 @@ func (self *sqlx) bulkInsert(intoTable string, cols List, ignore bool) *BulkBuff
 }
 
 // TODOC
-func (self *sqlx) BulkInsert(intoTable string, cols List) *BulkBuffer {
-    return self.bulkInsert(intoTable, cols, false)
+func (self *sqlx) BulkInsert(intoTable string, cols List, driver... Driver) *BulkBuffer {
+    return self.bulkInsert(intoTable, cols, false, driver...)
 }
 
 // TODOC
-func (self *sqlx) BulkInsertIgnore(intoTable string, cols List) *BulkBuffer {
-    return self.bulkInsert(intoTable, cols, true)
+func (self *sqlx) BulkInsertIgnore(intoTable string, cols List, driver... Driver) *BulkBuffer {
+    return self.bulkInsert(intoTable, cols, true, driver...)
 }
 
 // Jadi idenya sederhana, dereference alamat memory *sql.RawBytes dilakukan oleh
@@ -636,7 +656,7 @@ func (self *BulkBuffer) Add(args ...[]interface{}) *BulkBuffer {
                 coma = true
             }
             u.WRune('\'')
-            u.WS(to.Escape(to.String(value)))
+            u.WS(SQL.quote(self.driver, to.String(value)))
             u.WRune('\'')
         }
     }
@@ -647,13 +667,14 @@ func (self *BulkBuffer) Add(args ...[]interface{}) *BulkBuffer {
 
 // TODOC
 func (self *BulkBuffer) String() string {
-    return self.bfer.String()
+    return self.bfer.String() + self.tail
 }
 
 // TODOC
 func (self *BulkBuffer) Close() {
     self.bfer.Close()
     self.bfer = nil
+    self.tail = ""
     self.iter = 0
     self.size = 0
     SQL.bbfer.Put(self)
@@ -697,27 +718,27 @@ func (self *Tx) Query(query string, args ...interface{}) *ResultSet {
 
 // TODOC
 func (self *Connection) Truncate(name string) (Result, error) {
-    return self.Exec("TRUNCATE ?", name)
+    return self.Exec(SQL.truncate(self.driver, name))
 }
 
 // TODOC
 func (self *Connection) DropTable(name string) (Result, error) {
-    return self.Exec("DROP TABLE ?", name)
+    return self.Exec("DROP TABLE " + name)
 }
 
 // TODOC
 func (self *Connection) DropTableIfExists(name string) (Result, error) {
-    return self.Exec("DROP TABLE IF EXISTS ?", name)
+    return self.Exec("DROP TABLE IF EXISTS " + name)
 }
 
 // TODOC
 func (self *Connection) DropView(name string) (Result, error) {
-    return self.Exec("DROP VIEW ?", name)
+    return self.Exec("DROP VIEW " + name)
 }
 
 // TODOC
 func (self *Connection) DropViewIfExists(name string) (Result, error) {
-    return self.Exec("DROP VIEW IF EXISTS ?", name)
+    return self.Exec("DROP VIEW IF EXISTS " + name)
 }
 
 // TODOC
@@ -858,7 +879,7 @@ func (self *Connection) SaveIgnore(r RecordInterface) (Result, error) {
 }
 
 // TODOC
-func (self *Connection) ExecUpdate(tableName string, CL *GMap, where... *GMap) (Result, error) {
+func (self *Connection) ExecUpdate(tableName string, CL *GMap, where... Condition) (Result, error) {
     stmt, argv := SQL.UpdateQuery(self.driver, tableName, CL, where...)
     return self.Exec(stmt, argv...)
 }
@@ -874,7 +895,7 @@ func (self *Connection) Update(r RecordInterface) (Result, error) {
 }
 
 // TODOC
-func (self *Connection) ExecDelete(tableName string, where... *GMap) (Result, error) {
+func (self *Connection) ExecDelete(tableName string, where... Condition) (Result, error) {
     stmt, argv := SQL.DeleteQuery(self.driver, tableName, where...)
     return self.Exec(stmt, argv...)
 }
@@ -907,6 +928,8 @@ func (self *QueryBuilder) Close() {
     self.value = nil
     self.union = nil
     self.unall = false
+    self.ctx = nil
+    self.system = false
     SQL.query.Put(self)
 }
 
@@ -935,55 +958,47 @@ func (self *QueryBuilder) From(from string) *QueryBuilder {
     return self
 }
 
-// TODOC
-func (self *QueryBuilder) makeList() {
-    if self.join == nil {
-        self.join = make(List, 0)
-    }
-}
-
 // TODOC
 func (self *QueryBuilder) Join(from string, on string) *QueryBuilder {
-    self.makeList()
-    q := buffer.Get()
-    defer q.Close()
-
-    q.WS("     JOIN ").WS(from).WS(" ON (").WS(on).WS(")")
-
-    self.join = append(self.join, q.String())
-
+    self.join = append(self.join, qbJoin{"     JOIN ", from, on})
     return self
 }
 
 // TODOC
 func (self *QueryBuilder) LeftJoin(from string, on string) *QueryBuilder {
-    self.makeList()
-    q := buffer.Get()
-    defer q.Close()
-
-    q.WS("LEFT JOIN ").WS(from).WS(" ON (").WS(on).WS(")")
-
-    self.join = append(self.join, q.String())
-
+    self.join = append(self.join, qbJoin{"LEFT JOIN ", from, on})
     return self
 }
 
 // TODOC
 func (self *QueryBuilder) InnerJoin(from string, on string) *QueryBuilder {
-    self.makeList()
-    q := buffer.Get()
-    defer q.Close()
-
-    q.WS("INNER JOIN ").WS(from).WS(" ON (").WS(on).WS(")")
+    self.join = append(self.join, qbJoin{"INNER JOIN ", from, on})
+    return self
+}
 
-    self.join = append(self.join, q.String())
+// Row-level policy diterapkan sesuai session ctx
+func (self *QueryBuilder) Context(ctx *Context) *QueryBuilder {
+    self.ctx = ctx
+    return self
+}
 
+// Bypass row-level policy, hanya untuk proses sistem (cron, migrasi dst) yang memang
+// membutuhkan akses ke semua data
+func (self *QueryBuilder) System() *QueryBuilder {
+    self.system = true
     return self
 }
 
-// TODOC
-func (self *QueryBuilder) Where(where *GMap) *QueryBuilder {
-    self.where = where
+// Kondisi WHERE (*GMap atau Cond), lebih dari satu kondisi digabung dengan AND
+func (self *QueryBuilder) Where(where ...Condition) *QueryBuilder {
+    switch len(where) {
+    case 0:
+        self.where = nil
+    case 1:
+        self.where = where[0]
+    default:
+        self.where = Cond.And(where...)
+    }
     return self
 }
 
@@ -1023,19 +1038,23 @@ func (self *QueryBuilder) Union(union *QueryBuilder, all ...bool) *QueryBuilder
 // TODOC
 func (self *QueryBuilder) SelectQuery() (string, []interface{}) {
     argv := make([]interface{}, 0)
+    stmt := self.selectQuery(&argv)
+    return stmt, argv
+}
+
+// SELECT dengan penomoran placeholder melanjutkan argv (subquery, UNION)
+func (self *QueryBuilder) selectQuery(argv *[]interface{}) string {
     stmt := buffer.Get()
     defer stmt.Close()
     if self.cols == "" { self.cols = "*" }
     stmt.WS("   SELECT ").WS(self.cols).NL()
     stmt.WS("     FROM ").WS(self.from)
-    if self.join != nil {
-        for _, v := range self.join {
-            stmt.NL().WS(v)
-        }
+    for _, v := range self.join {
+        stmt.NL().WS(v.kind).WS(v.from).WS(" ON (").WS(v.on).WRune(')')
+        self.rowPolicy(stmt, v.from, " AND ", argv)
     }
-    if self.where != nil {
-        stmt.NL().WS("    WHERE ")
-        SQL.WhereQuery(self.driver, stmt, self.where, &argv)
+    if w := self.whereClause(argv); w != "" {
+        stmt.NL().WS("    WHERE ").WS(w)
     }
     if self.groupBy != "" {
         stmt.NL().WS(" GROUP BY ").WS(self.groupBy)
@@ -1060,21 +1079,55 @@ func (self *QueryBuilder) SelectQuery() (string, []interface{}) {
                 stmt.WS(" B.SQL_ROWNUM <= ").WS(strconv.Itoa(self.limit))
             }
         } else {
-            stmt.NL().WS("    LIMIT ")
-            if self.offset > 0 {
-                stmt.WS(strconv.Itoa(self.offset)).WRune(',')   // MySQL: LIMIT offset, limit
-            }
-            stmt.WS(strconv.Itoa(self.limit))
+            stmt.NL().WS("    ")
+            SQL.limit(self.driver, stmt, self.limit, self.offset)
         }
     }
     if self.union != nil {
         stmt.NL().WS(" UNION")
         if self.unall { stmt.WS(" ALL") }
-        slct, args := self.union.SelectQuery()
-        argv = append(argv, args...)
-        stmt.NL().WS(slct)
+        if self.union.ctx == nil && !self.union.system {
+            self.union.ctx, self.union.system = self.ctx, self.system
+        }
+        self.union.driver = self.driver
+        stmt.NL().WS(self.union.selectQuery(argv))
     }
-    return stmt.String(), argv
+    return stmt.String()
+}
+
+// Kondisi WHERE dari Where dan row-level policy tabel From
+func (self *QueryBuilder) whereClause(argv *[]interface{}) string {
+    w := buffer.Get()
+    defer w.Close()
+    cw := &conditionWriter{driver: self.driver, argv: argv, outer: self}
+    s := cw.render(self.where)
+    self.rowPolicy(w, self.from, "", argv)
+    switch {
+    case w.Len() == 0:
+        return s
+    case s == "":
+        return w.String()
+    }
+    // kondisi caller dikurung agar OR (termasuk raw value @col) tidak lolos dari policy
+    return "(" + s + ") AND " + w.String()
+}
+
+// UPDATE tabel From dengan kondisi Where dan row-level policy
+func (self *QueryBuilder) UpdateQuery(set *GMap) (string, []interface{}) {
+    stmt, argv := SQL.UpdateQuery(self.driver, self.from, set)
+    if w := self.whereClause(&argv); w != "" {
+        stmt += " WHERE " + w
+    }
+    return stmt, argv
+}
+
+// DELETE tabel From dengan kondisi Where dan row-level policy
+func (self *QueryBuilder) DeleteQuery() (string, []interface{}) {
+    stmt, argv := SQL.DeleteQuery(self.driver, self.from)
+    if w := self.whereClause(&argv); w != "" {
+        stmt += " WHERE " + w
+    }
+    return stmt, argv
 }
 
 // TODOC
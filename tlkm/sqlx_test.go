@@ -20,7 +20,7 @@ import (
 )
 
 func init() {
-    SQL.Register("mysql.syst", "root:test@tcp(127.0.0.1:3306)/go")
+    SQL.Register(testDataSource())
 }
 
 func TestInsertQuery(t *testing.T) {
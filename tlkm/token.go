@@ -0,0 +1,405 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Token JWT untuk client non-browser (akses via API). Token tetap stateful: claim SAFSID
+// menunjuk ke session yang sama dengan cookie browser (lihat Context.sessionStart)
+//
+// Dua jenis token:
+//   1. access  umur pendek (config JWT_EXP, default 900 detik), dikirim sebagai
+//              Authorization: Bearer <token>
+//   2. refresh umur panjang (config JWT_REFRESH_EXP, default 7 hari), hanya untuk
+//              mendapatkan pasangan token baru (RefreshJWT/TokenRefreshService)
+//
+// Refresh token di-rotasi: setiap refresh menghasilkan refresh token baru dan jti yang
+// aktif disimpan di session (attribute JRT). Refresh token lama yang dipakai ulang
+// dianggap bocor, session langsung di-destroy
+//
+// Claim iss dan aud diambil dari config JWT_ISS dan JWT_AUD (opsional), jika di-set
+// token dengan iss/aud berbeda ditolak
+//
+// Key set: setiap key memiliki kid (header token). Key aktif digunakan untuk sign,
+// semua key yang terdaftar digunakan untuk verifikasi sehingga rotasi key tidak
+// membuat semua client logout. Key yang sudah melewati umur refresh token bisa dihapus
+// dengan RemoveJWTKey. Key dari environment:
+//   1. JWT_KEY_FILE  path PEM private key RSA (RS256) atau EC (ES256/ES384/ES512),
+//                    kid dari JWT_KID atau thumbprint public key
+//   2. JWT_SECRET    HMAC (HS256) dengan kid "default"
+//
+// Public key RSA/EC dipublikasikan dalam format JWKS (JWKS/JWKSService) agar service
+// lain bisa memverifikasi token tanpa shared secret
+package tlkm
+
+import (
+    "crypto/ecdsa"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha256"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
+    "io/ioutil"
+    "math/big"
+    "os"
+    "strings"
+    "sync"
+    "time"
+    "github.com/golang-jwt/jwt"
+    "github.com/satori/go.uuid"
+    "github.com/telkomdit/goframework/to"
+)
+
+type (
+    // Satu key JWT. Sign nil berarti key hanya untuk verifikasi (misal public key dari
+    // key yang sudah dirotasi)
+    JWTKey struct {
+        KID     string
+        Method  jwt.SigningMethod
+        Sign    interface{}     // secret []byte, *rsa.PrivateKey atau *ecdsa.PrivateKey
+        Verify  interface{}     // secret []byte, *rsa.PublicKey atau *ecdsa.PublicKey
+    }
+
+    // Endpoint JWKS (public key set), di embed oleh handler modul dan di export
+    // tanpa session (SEC false)
+    //
+    //  GET
+    JWKSService struct {
+        NotAllowedService
+    }
+
+    // Endpoint refresh token, di export tanpa session (SEC false)
+    //
+    //  POST    refresh_token=<token>
+    TokenRefreshService struct {
+        NotAllowedService
+    }
+)
+
+const (
+    JWTAccess   = "access"
+    JWTRefresh  = "refresh"
+
+    // ** private **
+    jwtDefaultKID   = "default"
+    jwtSessionKey   = "JRT"     // attribute session: jti refresh token yang aktif
+)
+
+var (
+    // ** private **
+    jwtKeys      = make(map[string]*JWTKey)
+    jwtActive    string
+    jwtLock      sync.RWMutex
+    jwtRotate    sync.Mutex
+    jwtEphemeral bool   // true jika tidak ada key dari environment (secret random per proses)
+)
+
+// Register key. Jika active, key digunakan untuk sign token berikutnya, key aktif
+// sebelumnya tetap digunakan untuk verifikasi
+//
+// contoh rotasi:
+//
+//      pem, _ := ioutil.ReadFile("/etc/app/jwt-2026.pem")
+//      k, e := tlkm.ParseJWTKey("2026", pem)
+//      if e == nil {
+//          tlkm.ExportJWTKey(k, true)
+//      }
+func ExportJWTKey(key *JWTKey, active bool) error {
+    if key == nil || key.KID == "" || key.Method == nil || key.Verify == nil {
+        return errors.New("JWTKeyException: kid, method dan verify key wajib diisi")
+    }
+    if active && key.Sign == nil {
+        return errors.New("JWTKeyException: key " + key.KID + " tidak memiliki signing key")
+    }
+    jwtLock.Lock()
+    defer jwtLock.Unlock()
+    jwtKeys[key.KID] = key
+    if active {
+        jwtActive = key.KID
+        jwtEphemeral = false
+    }
+    return nil
+}
+
+// Hapus key dari key set. Token yang di sign dengan key tersebut tidak lagi valid
+func RemoveJWTKey(KID string) error {
+    jwtLock.Lock()
+    defer jwtLock.Unlock()
+    if KID == jwtActive {
+        return errors.New("JWTKeyException: key " + KID + " sedang aktif")
+    }
+    delete(jwtKeys, KID)
+    return nil
+}
+
+// Key HMAC (HS256)
+func NewHMACKey(KID string, secret []byte) *JWTKey {
+    return &JWTKey{KID: KID, Method: jwt.SigningMethodHS256, Sign: secret, Verify: secret}
+}
+
+// Parse PEM private key (RSA/EC) atau public key (verifikasi saja). Jika KID kosong,
+// kid diambil dari thumbprint public key
+func ParseJWTKey(KID string, pem []byte) (*JWTKey, error) {
+    k := &JWTKey{KID: KID}
+    if v, e := jwt.ParseRSAPrivateKeyFromPEM(pem); e == nil {
+        k.Method, k.Sign, k.Verify = jwt.SigningMethodRS256, v, &v.PublicKey
+    } else if v, e := jwt.ParseECPrivateKeyFromPEM(pem); e == nil {
+        k.Sign, k.Verify = v, &v.PublicKey
+    } else if v, e := jwt.ParseRSAPublicKeyFromPEM(pem); e == nil {
+        k.Method, k.Verify = jwt.SigningMethodRS256, v
+    } else if v, e := jwt.ParseECPublicKeyFromPEM(pem); e == nil {
+        k.Verify = v
+    } else {
+        return nil, errors.New("JWTKeyException: format PEM tidak dikenali")
+    }
+    if v, b := k.Verify.(*ecdsa.PublicKey); b {
+        switch v.Curve.Params().BitSize {
+        case 256:
+            k.Method = jwt.SigningMethodES256
+        case 384:
+            k.Method = jwt.SigningMethodES384
+        case 521:
+            k.Method = jwt.SigningMethodES512
+        default:
+            return nil, errors.New("JWTKeyException: curve " + v.Curve.Params().Name + " tidak didukung")
+        }
+    }
+    if k.KID == "" {
+        der, e := x509.MarshalPKIXPublicKey(k.Verify)
+        if e != nil {
+            return nil, e
+        }
+        h := sha256.Sum256(der)
+        k.KID = hex.EncodeToString(h[:8])
+    }
+    return k, nil
+}
+
+// Dipanggil oleh init (fwk.go). Tanpa JWT_KEY_FILE dan JWT_SECRET, secret HMAC dibentuk
+// random per proses: token tidak valid setelah restart dan tidak bisa dipakai lintas
+// instance (lihat warning di Win32Service)
+func jwtInit() {
+    if f := os.Getenv("JWT_KEY_FILE"); f != "" {
+        if pem, e := ioutil.ReadFile(f); e == nil {
+            if k, e := ParseJWTKey(os.Getenv("JWT_KID"), pem); e == nil && k.Sign != nil {
+                ExportJWTKey(k, true)
+            }
+        }
+    }
+    if secret := os.Getenv(jwtSecretKey); secret != "" {
+        ExportJWTKey(NewHMACKey(jwtDefaultKID, []byte(secret)), jwtActive == "")
+    }
+    if jwtActive == "" {
+        b := make([]byte, 32)
+        rand.Read(b)
+        ExportJWTKey(NewHMACKey(jwtDefaultKID, b), true)
+        jwtEphemeral = true
+    }
+}
+
+// Key aktif untuk sign
+func jwtSigningKey() (*JWTKey, error) {
+    jwtLock.RLock()
+    defer jwtLock.RUnlock()
+    if k, b := jwtKeys[jwtActive]; b {
+        return k, nil
+    }
+    return nil, errors.New("JWTKeyException: tidak ada key aktif")
+}
+
+// Key untuk verifikasi berdasarkan header kid, token tanpa kid diverifikasi dengan
+// key default. Algoritma token harus sama dengan algoritma key (mencegah alg confusion,
+// misal public key RSA dipakai sebagai secret HMAC)
+func jwtVerifyKey(T *jwt.Token) (interface{}, error) {
+    KID := to.String(T.Header["kid"])
+    if KID == "" {
+        KID = jwtDefaultKID
+    }
+    jwtLock.RLock()
+    k, b := jwtKeys[KID]
+    jwtLock.RUnlock()
+    if !b {
+        return nil, errors.New("JWTKeyException: kid " + KID + " tidak dikenal")
+    }
+    if T.Method.Alg() != k.Method.Alg() {
+        return nil, errors.New("SigningMethodException: " + to.String(T.Header["alg"]))
+    }
+    return k.Verify, nil
+}
+
+// Lifetime token dalam detik
+func jwtExpiry(typ string) int64 {
+    if typ == JWTRefresh {
+        if v, _ := Cache.Int("JWT_REFRESH_EXP"); v > 0 {
+            return int64(v)
+        }
+        return 7 * 86400
+    }
+    if v, _ := Cache.Int("JWT_EXP"); v > 0 {
+        return int64(v)
+    }
+    return 900
+}
+
+// Sign token baru untuk session SID, return token dan jti
+func jwtIssue(SID, typ string) (v, jti string, e error) {
+    k, e := jwtSigningKey()
+    if e != nil {
+        return
+    }
+    id, _ := uuid.NewV4()
+    jti = id.String()
+    now := time.Now().Unix()
+    m := jwt.MapClaims{SAFSID: SID, "typ": typ, "jti": jti,
+        "iat": now, "nbf": now, "exp": now + jwtExpiry(typ)}
+    if iss, _ := Cache.String("JWT_ISS"); iss != "" {
+        m["iss"] = iss
+    }
+    if aud, _ := Cache.String("JWT_AUD"); aud != "" {
+        m["aud"] = aud
+    }
+    j := jwt.NewWithClaims(k.Method, m)
+    j.Header["kid"] = k.KID
+    v, e = j.SignedString(k.Sign)
+    return
+}
+
+// Parse dan validasi token: signature, exp (wajib), nbf, iat, iss, aud dan typ
+func jwtParse(token, typ string) (jwt.MapClaims, error) {
+    mc := jwt.MapClaims{}
+    if _, e := jwt.ParseWithClaims(token, mc, jwtVerifyKey); e != nil {
+        return nil, e
+    }
+    if !mc.VerifyExpiresAt(time.Now().Unix(), true) {
+        return nil, errors.New("TokenExpiredException")
+    }
+    if iss, _ := Cache.String("JWT_ISS"); iss != "" && !mc.VerifyIssuer(iss, true) {
+        return nil, errors.New("TokenIssuerException: " + to.String(mc["iss"]))
+    }
+    if aud, _ := Cache.String("JWT_AUD"); aud != "" && !mc.VerifyAudience(aud, true) {
+        return nil, errors.New("TokenAudienceException")
+    }
+    if to.String(mc["typ"]) != typ {
+        return nil, errors.New("TokenTypeException: " + to.String(mc["typ"]))
+    }
+    if to.String(mc[SAFSID]) == "" {
+        return nil, errors.New("TokenClaimException: " + SAFSID)
+    }
+    return mc, nil
+}
+
+// Ambil token dari header Authorization. Scheme case-insensitive, whitespace
+// diabaikan. Selain Bearer (Basic, Digest dst) return false
+func bearerToken(HDR string) (string, bool) {
+    HDR = strings.TrimSpace(HDR)
+    i := strings.IndexAny(HDR, " \t")
+    if i < 0 || !strings.EqualFold(HDR[:i], "Bearer") {
+        return "", false
+    }
+    v := strings.TrimSpace(HDR[i+1:])
+    return v, v != ""
+}
+
+// Pasangan access dan refresh token untuk session yang aktif. jti refresh token
+// disimpan di session sehingga hanya refresh token terakhir yang bisa digunakan
+func (self *Context) JWTPair() (access, refresh string, e error) {
+    SID, b := self.SessionID()
+    if !b {
+        return "", "", errors.New("SessionNotFoundException")
+    }
+    if access, _, e = jwtIssue(SID, JWTAccess); e != nil {
+        return
+    }
+    var jti string
+    if refresh, jti, e = jwtIssue(SID, JWTRefresh); e == nil {
+        self.SessionSet(jwtSessionKey, jti)
+    }
+    return
+}
+
+// Tukar refresh token dengan pasangan token baru (rotasi). Refresh token yang sudah
+// pernah digunakan menandakan token bocor, session di-destroy agar pemegang token
+// (siapapun) harus login ulang
+func RefreshJWT(refresh string) (access, next string, e error) {
+    mc, e := jwtParse(refresh, JWTRefresh)
+    if e != nil {
+        return
+    }
+    SID := to.String(mc[SAFSID])
+    jwtRotate.Lock()
+    defer jwtRotate.Unlock()
+    r, e := sessionStore.Load(SID)
+    if e != nil {
+        return "", "", errors.New("SessionNotFoundException: " + SID)
+    }
+    if to.String(r.Data[jwtSessionKey]) != to.String(mc["jti"]) {
+        sessionDestroy(nil, SID)
+        return "", "", errors.New("TokenReuseException: " + SID)
+    }
+    if access, _, e = jwtIssue(SID, JWTAccess); e != nil {
+        return
+    }
+    var jti string
+    if next, jti, e = jwtIssue(SID, JWTRefresh); e != nil {
+        return
+    }
+    data := make(GMap, len(r.Data) + 1)  // jangan ubah map milik cache secara langsung
+    for i, j := range r.Data {
+        data[i] = j
+    }
+    data[jwtSessionKey] = jti
+    r.Data = data
+    e = sessionStore.Save(r, false)
+    return
+}
+
+// Public key set (RFC 7517). Key HMAC tidak pernah dipublikasikan
+func JWKS() GMap {
+    jwtLock.RLock()
+    defer jwtLock.RUnlock()
+    keys := []GMap{}
+    for _, k := range jwtKeys {
+        enc := base64.RawURLEncoding.EncodeToString
+        switch v := k.Verify.(type) {
+        case *rsa.PublicKey:
+            keys = append(keys, GMap{"kty": "RSA", "use": "sig", "kid": k.KID, "alg": k.Method.Alg(),
+                "n": enc(v.N.Bytes()), "e": enc(big.NewInt(int64(v.E)).Bytes())})
+        case *ecdsa.PublicKey:
+            size := (v.Curve.Params().BitSize + 7) / 8
+            keys = append(keys, GMap{"kty": "EC", "use": "sig", "kid": k.KID, "alg": k.Method.Alg(),
+                "crv": v.Curve.Params().Name, "x": enc(padBytes(v.X.Bytes(), size)), "y": enc(padBytes(v.Y.Bytes(), size))})
+        }
+    }
+    return GMap{"keys": keys}
+}
+
+// Koordinat EC harus fixed-length sesuai ukuran curve
+func padBytes(b []byte, size int) []byte {
+    if len(b) >= size {
+        return b
+    }
+    return append(make([]byte, size - len(b)), b...)
+}
+
+func (self *JWKSService) GET(conn *Connection, ctx *Context) {
+    ctx.ContentType(ContentTypeJSON).JSON(JWKS())
+}
+
+func (self *TokenRefreshService) POST(conn *Connection, ctx *Context) {
+    access, refresh, e := RefreshJWT(ctx.Get("refresh_token"))
+    if e != nil {
+        ctx.Code(StatusUnauthorized).Warn(e.Error())
+        return
+    }
+    ctx.Data(GMap{"access_token": access, "refresh_token": refresh,
+        "token_type": "Bearer", "expires_in": jwtExpiry(JWTAccess)})
+}
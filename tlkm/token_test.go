@@ -0,0 +1,200 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/x509"
+    "encoding/pem"
+    "testing"
+    "github.com/golang-jwt/jwt"
+)
+
+// Backup key set global, dikembalikan setelah test
+func testJWTKeys(t *testing.T) func() {
+    jwtLock.Lock()
+    keys, active := jwtKeys, jwtActive
+    jwtKeys, jwtActive = make(map[string]*JWTKey), ""
+    jwtLock.Unlock()
+    if e := ExportJWTKey(NewHMACKey(jwtDefaultKID, []byte("secret")), true); e != nil {
+        t.Fatal(e)
+    }
+    return func() {
+        jwtLock.Lock()
+        jwtKeys, jwtActive = keys, active
+        jwtLock.Unlock()
+    }
+}
+
+func TestBearerToken(t *testing.T) {
+    for HDR, expected := range map[string]string{
+        "Bearer abc":       "abc",
+        "bearer abc":       "abc",
+        "  BEARER   abc  ": "abc",
+        "Bearer\tabc":      "abc",
+        "Bearer":           "",
+        "Bearer ":          "",
+        "Basic dXNlcjpwdw==": "",
+        "":                 "",
+        "abc":              "",
+    } {
+        v, b := bearerToken(HDR)
+        if v != expected || b != (expected != "") {
+            t.Errorf("%q: expected %q. received %q %v", HDR, expected, v, b)
+        }
+    }
+}
+
+func TestJWTClaims(t *testing.T) {
+    defer testJWTKeys(t)()
+    Cache.Set("JWT_ISS", "goframework")
+    Cache.Set("JWT_AUD", "api")
+    defer Cache.Delete("JWT_ISS")
+    defer Cache.Delete("JWT_AUD")
+
+    v, _, e := jwtIssue("SID-1", JWTAccess)
+    if e != nil {
+        t.Fatal(e)
+    }
+    mc, e := jwtParse(v, JWTAccess)
+    if e != nil {
+        t.Fatal(e)
+    }
+    for _, k := range []string{"iss", "aud", "exp", "iat", "jti"} {
+        if _, b := mc[k]; !b {
+            t.Errorf("claim %s not found", k)
+        }
+    }
+    if mc[SAFSID] != "SID-1" {
+        t.Errorf("unexpected SID %v", mc[SAFSID])
+    }
+
+    // refresh token tidak bisa digunakan sebagai access token
+    if _, e := jwtParse(v, JWTRefresh); e == nil {
+        t.Error("typ must be validated")
+    }
+
+    Cache.Set("JWT_AUD", "other")
+    if _, e := jwtParse(v, JWTAccess); e == nil {
+        t.Error("aud must be validated")
+    }
+
+    // token tanpa exp (format lama) ditolak
+    j := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{SAFSID: "SID-1", "typ": JWTAccess})
+    old, _ := j.SignedString([]byte("secret"))
+    Cache.Delete("JWT_AUD")
+    Cache.Delete("JWT_ISS")
+    if _, e := jwtParse(old, JWTAccess); e == nil {
+        t.Error("token without exp must be rejected")
+    }
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+    defer testJWTKeys(t)()
+
+    old, _, _ := jwtIssue("SID-1", JWTAccess)
+
+    rk, _ := rsa.GenerateKey(rand.Reader, 2048)
+    der := x509.MarshalPKCS1PrivateKey(rk)
+    k, e := ParseJWTKey("", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: der}))
+    if e != nil {
+        t.Fatal(e)
+    }
+    if k.Method.Alg() != "RS256" || k.KID == "" {
+        t.Fatalf("unexpected key %s %s", k.Method.Alg(), k.KID)
+    }
+    ExportJWTKey(k, true)
+
+    v, _, _ := jwtIssue("SID-1", JWTAccess)
+    T, _ := jwt.Parse(v, jwtVerifyKey)
+    if T == nil || !T.Valid || T.Header["kid"] != k.KID || T.Header["alg"] != "RS256" {
+        t.Fatalf("token must be signed with active key")
+    }
+    // token lama (HS256) tetap valid setelah rotasi
+    if _, e := jwtParse(old, JWTAccess); e != nil {
+        t.Error(e)
+    }
+
+    if e := RemoveJWTKey(k.KID); e == nil {
+        t.Error("active key must not be removed")
+    }
+    ek, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    ExportJWTKey(&JWTKey{KID: "ec", Method: jwt.SigningMethodES256, Sign: ek, Verify: &ek.PublicKey}, true)
+    RemoveJWTKey(k.KID)
+    if _, e := jwtParse(v, JWTAccess); e == nil {
+        t.Error("token signed with removed key must be rejected")
+    }
+
+    // public key RSA tidak boleh diterima sebagai secret HMAC
+    pub, _ := x509.MarshalPKIXPublicKey(&rk.PublicKey)
+    pk, _ := ParseJWTKey("pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}))
+    ExportJWTKey(pk, false)
+    j := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{SAFSID: "SID-1", "typ": JWTAccess, "exp": 1 << 40})
+    j.Header["kid"] = "pub"
+    forged, _ := j.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}))
+    if _, e := jwtParse(forged, JWTAccess); e == nil {
+        t.Error("alg confusion must be rejected")
+    }
+
+    keys := JWKS()["keys"].([]GMap)
+    if len(keys) != 2 {
+        t.Fatalf("expected 2 public keys. received %d", len(keys))
+    }
+    for _, j := range keys {
+        if j["kty"] == "EC" && (j["crv"] != "P-256" || len(j["x"].(string)) != 43) {
+            t.Errorf("unexpected EC key %v", j)
+        }
+        if j["kty"] == "RSA" && j["e"] != "AQAB" {
+            t.Errorf("unexpected RSA key %v", j)
+        }
+    }
+}
+
+func TestRefreshJWT(t *testing.T) {
+    defer testJWTKeys(t)()
+    s, done := testFileSessionStore(t)
+    defer done()
+    store := sessionStore
+    ExportSessionStore(s)
+    defer ExportSessionStore(store)
+
+    ctx := testContext("id", nil)
+    ctx.SID = "SID-1"
+    access, refresh, e := ctx.JWTPair()
+    if e != nil || access == "" || refresh == "" {
+        t.Fatal(e)
+    }
+    s.Save(&SessionRecord{SID: "SID-1", USR: "tester", Data: ctx.sesMap}, true)
+
+    if _, _, e := RefreshJWT(access); e == nil {
+        t.Error("access token must not be refreshed")
+    }
+    _, next, e := RefreshJWT(refresh)
+    if e != nil {
+        t.Fatal(e)
+    }
+    if _, _, e := RefreshJWT(next); e != nil {
+        t.Fatal(e)
+    }
+    // refresh token lama dipakai ulang: session di-destroy
+    if _, _, e := RefreshJWT(refresh); e == nil {
+        t.Error("reused refresh token must be rejected")
+    }
+    if _, e := s.Load("SID-1"); e == nil {
+        t.Error("session must be destroyed after refresh token reuse")
+    }
+}
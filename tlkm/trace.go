@@ -0,0 +1,295 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Trace eksekusi ServiceRule per request. Setiap rule yang dieksekusi dicatat: SRC,
+// expected-return (EXPR), hasil, durasi dan fakta yang ditambahkan/diubah ke Context
+// (lihat Context.Set), sehingga bisa diketahui rule mana yang gagal dan fakta apa yang
+// sudah terbentuk sebelumnya
+//
+// Trace dikirim ke client melalui header X-Rule-Trace (json) jika client mengirim
+// header yang sama dan GID termasuk dalam config RULE_TRACE_GID (dipisah koma)
+//
+// Dry-run (DryRun/RuleDryRunService) mengeksekusi rules handler terhadap sample payload
+// tanpa memanggil method handler, ditujukan untuk business analyst yang mengkonfigurasi
+// rules. Rules dieksekusi dalam transaksi yang selalu di-rollback dan dengan salinan
+// session, perubahan data maupun session oleh rule tidak tersimpan. Untuk MySQL, DDL
+// dalam rule tetap auto-commit
+package tlkm
+
+import (
+    "context"
+    "database/sql"
+    "database/sql/driver"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+)
+
+type (
+    // Satu baris trace. Facts berisi parameter Context yang ditambahkan/diubah oleh rule,
+    // Unset berisi parameter yang dihapus
+    RuleTrace struct {
+        SRC         string  `json:"src"`
+        EXPR        bool    `json:"expr"`
+        Outcome     string  `json:"outcome"`
+        Error       string  `json:"error,omitempty"`
+        Duration    float64 `json:"duration"`  // milliseconds
+        Params      RuleParams  `json:"params,omitempty"`
+        Facts       SMap    `json:"facts,omitempty"`
+        Unset       List    `json:"unset,omitempty"`
+    }
+
+    // Admin API dry-run, di embed oleh handler modul (sama seperti InvalidateService)
+    //
+    //  POST    path=/syst/api/user&call=POST&payload={"AMOUNT":"1000"}
+    RuleDryRunService struct {
+        NotAllowedService
+    }
+
+    // ** private **
+    // koneksi driver yang sedang dalam transaksi dry-run, Close tidak menutup koneksi asli
+    dryRunConn struct {
+        driver.Conn
+    }
+    dryRunConnector struct {
+        conn    *dryRunConn
+        driver  driver.Driver
+    }
+)
+
+const (
+    RulePass        = "PASS"
+    RuleFail        = "FAIL"        // return error tidak sesuai expected-return
+    RuleDependency  = "DEPENDENCY"  // argument wajib rule tidak disyaratkan handler
+    RuleNotFound    = "NOTFOUND"    // rule ada di database tapi tidak di export
+    RuleParamError  = "PARAMS"      // PARAMS binding tidak sesuai schema rule
+
+    // header request (opt-in) dan response trace
+    RuleTraceHeader = "X-Rule-Trace"
+)
+
+// Trace rules request saat ini (nil jika handler tidak memiliki rules)
+func (self *Context) Trace() []RuleTrace {
+    return self.trace
+}
+
+// Snapshot parameter (value pertama) untuk perbandingan sebelum/sesudah rule
+func snapshotValues(v url.Values) SMap {
+    m := make(SMap, len(v))
+    for i, j := range v {
+        if len(j) > 0 {
+            m[i] = j[0]
+        } else {
+            m[i] = ""
+        }
+    }
+    return m
+}
+
+// Selisih parameter sebelum dan sesudah rule dieksekusi
+func diffValues(prev SMap, next url.Values) (facts SMap, unset List) {
+    for i, j := range next {
+        u := ""
+        if len(j) > 0 { u = j[0] }
+        if k, v := prev[i]; !v || k != u {
+            if facts == nil { facts = make(SMap) }
+            facts[i] = u
+        }
+    }
+    for i, _ := range prev {
+        if _, v := next[i]; !v {
+            unset = append(unset, i)
+        }
+    }
+    return
+}
+
+// Eksekusi rules sesuai urutan Key, berhenti pada rule pertama yang gagal. Return
+// status http dan error jika gagal (0, nil jika semua rule terpenuhi)
+func runRules(conn *Connection, ctx *Context, rs *ruleSet) (z []RuleTrace, code int, e error) {
+    z = make([]RuleTrace, 0, len(rs.Key))
+    for _, name := range rs.Key {
+        // rule yang sama bisa memiliki expected-return berbeda tergantung kebutuhan
+        // diposisi mana rule dipanggil dalam workflow/proses
+        t := RuleTrace{SRC: name, EXPR: rs.Map[name], Params: rs.Params[name]}
+        if rref, v := rs.Ref[name]; v {
+            t.Outcome = RuleDependency
+            t.Error = name + rref
+            z = append(z, t)
+            return z, StatusFailedDependency, errors.New(t.Error)
+        }
+        if perr, v := rs.Errs[name]; v {
+            t.Outcome = RuleParamError
+            t.Error = name + " " + perr
+            z = append(z, t)
+            return z, StatusFailedDependency, errors.New(t.Error)
+        }
+        robj, v := lookupRule(name)
+        if !v {
+            t.Outcome = RuleNotFound
+            t.Error = "RuleNotFoundException: " + name
+            z = append(z, t)
+            return z, StatusFailedDependency, errors.New(t.Error)
+        }
+        prev := snapshotValues(ctx.Values)
+        begin := time.Now()
+        var err error
+        if p, v := robj.(ParameterizedRule); v {
+            err = p.ExecuteWith(conn, ctx, t.EXPR, t.Params)
+        } else {
+            err = robj.Execute(conn, ctx, t.EXPR)
+        }
+        t.Duration = float64(time.Since(begin).Nanoseconds()) / 1e6
+        t.Facts, t.Unset = diffValues(prev, ctx.Values)
+        t.Outcome = RulePass
+        if err != nil {
+            t.Outcome = RuleFail
+            t.Error = err.Error()
+            z = append(z, t)
+            return z, StatusExpectationFailed, err
+        }
+        z = append(z, t)
+    }
+    return z, 0, nil
+}
+
+// Client boleh menerima trace jika mengirim header X-Rule-Trace, sudah login dan GID
+// yang digunakan termasuk dalam config RULE_TRACE_GID
+func traceAllowed(ctx *Context) bool {
+    if ctx.Request == nil || ctx.Request.Header.Get(RuleTraceHeader) == "" || ctx.GID == "" {
+        return false
+    }
+    if _, v := ctx.SessionUser(); !v {
+        return false
+    }
+    g, _ := Cache.String("RULE_TRACE_GID")
+    for _, j := range strings.Split(g, ",") {
+        if strings.TrimSpace(j) == ctx.GID {
+            return true
+        }
+    }
+    return false
+}
+
+// Tulis trace ke response header, harus dipanggil sebelum WriteHeader
+func sendTrace(w http.ResponseWriter, ctx *Context) {
+    if len(ctx.trace) == 0 || !traceAllowed(ctx) {
+        return
+    }
+    if b, e := json.Marshal(ctx.trace); e == nil {
+        w.Header().Set(RuleTraceHeader, string(b))
+    }
+}
+
+// Eksekusi rules handler (IDX) untuk method call terhadap sample payload. Arguments
+// divalidasi (dan di-coerce) terlebih dahulu seperti request biasa, rules dan arguments
+// dibaca langsung dari database (tanpa cache) agar perubahan konfigurasi langsung terlihat
+//
+// Salinan session ctx digunakan sebagai session sample, sehingga rule yang membaca
+// SessionUser dieksekusi sebagai user yang melakukan dry-run tanpa mengubah session
+// user tersebut
+func DryRun(conn *Connection, ctx *Context, IDX, call string, payload SMap) ([]RuleTrace, error) {
+    call = strings.ToUpper(call)
+    if _, v := servKey[IDX]; !v {
+        return nil, errors.New("HandlerNotFoundException: " + IDX)
+    }
+    PID, HID := ShortURL(IDX)
+    session := make(GMap, len(ctx.sesMap))
+    for i, j := range ctx.sesMap {
+        session[i] = j
+    }
+    sample := &Context{Request: ctx.Request, Response: ctx.Response, SID: ctx.SID, PID: PID, HID: HID, GID: ctx.GID,
+        Values: url.Values{}, sesMap: session, call: call, method: doKey[call], code: StatusNoContent}
+    for i, j := range payload {
+        sample.Values.Set(i, j)
+    }
+    if args := loadArguments(conn, IDX, call); len(args) > 0 {
+        if e := new(controller).validate(args, sample, false, ""); e != nil {
+            return nil, e
+        }
+    }
+    var (
+        z   []RuleTrace
+        e   error
+    )
+    if x := rollbackOnly(conn, func(tx *Connection) {
+        z, _, e = runRules(tx, sample, loadRules(tx, IDX, call))
+    }); x != nil {
+        return nil, x
+    }
+    return z, e
+}
+
+func (self *dryRunConn) Close() error { return nil }
+func (self *dryRunConnector) Connect(context.Context) (driver.Conn, error) { return self.conn, nil }
+func (self *dryRunConnector) Driver() driver.Driver { return self.driver }
+
+// Eksekusi fn dengan Connection yang terikat ke satu transaksi pada satu koneksi fisik,
+// transaksi selalu di-rollback (termasuk jika fn panic). Connection hanya valid di dalam fn
+func rollbackOnly(conn *Connection, fn func(tx *Connection)) error {
+    c, e := conn.Conn(context.Background())
+    if e != nil {
+        return e
+    }
+    defer c.Close()
+    return c.Raw(func(dc interface{}) error {
+        d := dc.(driver.Conn)
+        tx, e := d.Begin()
+        if e != nil {
+            return e
+        }
+        defer tx.Rollback()
+        db := sql.OpenDB(&dryRunConnector{conn: &dryRunConn{d}, driver: conn.DB.Driver()})
+        db.SetMaxOpenConns(1)
+        defer db.Close()
+        fn(&Connection{DB: db, driver: conn.driver})
+        return nil
+    })
+}
+
+func (self *RuleDryRunService) POST(conn *Connection, ctx *Context) {
+    payload := make(SMap)
+    if ctx.Exists("payload") {
+        var m map[string]interface{}
+        if e := json.Unmarshal([]byte(ctx.Get("payload")), &m); e != nil {
+            ctx.Code(StatusBadRequest).Warn(e.Error())
+            return
+        }
+        for i, j := range m {
+            switch u := j.(type) {
+            case string:
+                payload[i] = u
+            default:
+                b, _ := json.Marshal(u)  // number, bool, object dan array diteruskan sebagai json
+                payload[i] = string(b)
+            }
+        }
+    }
+    call := ctx.Get("call")
+    if call == "" {
+        call = doMap[doPOST]
+    }
+    z, e := DryRun(conn, ctx, ctx.Get("path"), call, payload)
+    data := GMap{"trace": z, "passed": e == nil}
+    if e != nil {
+        if v, b := e.(ValidationErrors); b {
+            data["errors"] = v
+        } else {
+            data["error"] = e.Error()
+        }
+    }
+    ctx.Data(data)
+}
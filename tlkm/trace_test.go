@@ -0,0 +1,116 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "errors"
+    "net/url"
+    "reflect"
+    "testing"
+)
+
+var _ Service = new(RuleDryRunService)
+
+type (
+    testTraceFact struct {}
+    testTraceFail struct {}
+)
+
+func (self *testTraceFact) Execute(conn *Connection, ctx *Context, expr bool) error {
+    ctx.Set("LIMIT", "1000").Unset("DRAFT")
+    return nil
+}
+
+func (self *testTraceFail) Execute(conn *Connection, ctx *Context, expr bool) error {
+    if ctx.Get("LIMIT") != "" && expr {
+        return errors.New("amount exceeds limit")
+    }
+    return nil
+}
+
+func TestDiffValues(t *testing.T) {
+    prev := SMap{"A": "1", "B": "2", "C": "3"}
+    facts, unset := diffValues(prev, url.Values{"A": {"1"}, "B": {"9"}, "D": {"4"}})
+    if !reflect.DeepEqual(facts, SMap{"B": "9", "D": "4"}) || !reflect.DeepEqual(unset, List{"C"}) {
+        t.Errorf("unexpected diff %v %v", facts, unset)
+    }
+}
+
+func TestRunRules(t *testing.T) {
+    ruleMap["/test/rule/Fact"] = new(testTraceFact)
+    ruleMap["/test/rule/Fail"] = new(testTraceFail)
+    defer delete(ruleMap, "/test/rule/Fact")
+    defer delete(ruleMap, "/test/rule/Fail")
+
+    ctx := testContext("", url.Values{"AMOUNT": {"5000"}, "DRAFT": {"1"}})
+    Key := List{"/test/rule/Fact", "/test/rule/Fail", "/test/rule/Next"}
+    z, code, e := runRules(nil, ctx, &ruleSet{Key: Key, Map: BMap{"/test/rule/Fact": true, "/test/rule/Fail": true}})
+    if e == nil || code != StatusExpectationFailed {
+        t.Fatalf("expected %d. received %d %v", StatusExpectationFailed, code, e)
+    }
+    if len(z) != 2 || z[0].Outcome != RulePass || z[1].Outcome != RuleFail || z[1].Error != "amount exceeds limit" {
+        t.Fatalf("unexpected trace %+v", z)
+    }
+    if !reflect.DeepEqual(z[0].Facts, SMap{"LIMIT": "1000"}) || !reflect.DeepEqual(z[0].Unset, List{"DRAFT"}) {
+        t.Errorf("unexpected facts %v %v", z[0].Facts, z[0].Unset)
+    }
+
+    z, code, _ = runRules(nil, testContext("", url.Values{}), &ruleSet{Key: List{"/test/rule/Next"}})
+    if code != StatusFailedDependency || z[0].Outcome != RuleNotFound {
+        t.Errorf("unexpected trace %+v", z)
+    }
+    z, code, _ = runRules(nil, testContext("", url.Values{}), &ruleSet{Key: List{"/test/rule/Fact"}, Ref: SMap{"/test/rule/Fact": " required a (b) IS NOT NULL"}})
+    if code != StatusFailedDependency || z[0].Outcome != RuleDependency {
+        t.Errorf("unexpected trace %+v", z)
+    }
+}
+
+func TestTraceAllowed(t *testing.T) {
+    ctx := testContext("", url.Values{})
+    ctx.GID = "ANALYST"
+    ctx.sesMap["USR"] = "test"
+    Cache.Set("RULE_TRACE_GID", "ADMIN, ANALYST")
+    defer Cache.Delete("RULE_TRACE_GID")
+    if traceAllowed(ctx) {
+        t.Error("trace must be requested via header")
+    }
+    ctx.Request.Header.Set(RuleTraceHeader, "1")
+    if !traceAllowed(ctx) {
+        t.Error("expected trace allowed")
+    }
+    ctx.GID = "USER"
+    if traceAllowed(ctx) {
+        t.Error("expected trace not allowed")
+    }
+}
+
+// Perubahan data oleh rule dry-run selalu di-rollback
+func TestRollbackOnly(t *testing.T) {
+    conn := testMigrationConn(t)
+    if e := rollbackOnly(conn, func(tx *Connection) {
+        tx.Exec("UPDATE st_sample SET AMOUNT=0")
+    }); e != nil {
+        t.Fatal(e)
+    }
+    if z := migrationFake.exec; len(z) != 3 || z[0] != "BEGIN" || z[2] != "ROLLBACK" {
+        t.Errorf("unexpected statements %v", z)
+    }
+    func() {
+        defer func() { recover() }()
+        rollbackOnly(conn, func(tx *Connection) { panic("rule") })
+    }()
+    if z := migrationFake.exec; z[len(z) - 1] != "ROLLBACK" {
+        t.Errorf("expected rollback after panic %v", z)
+    }
+}
@@ -0,0 +1,309 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Hasil validasi payload tidak lagi berupa satu string panjang, tapi list error
+// per field agar client (UI) bisa menandai field mana yang tidak memenuhi constraint
+//
+// Pesan error dibentuk dari template per bahasa, dipilih berdasarkan session
+// attribute LANG atau http header Accept-Language
+package tlkm
+
+import (
+    "encoding/json"
+    "fmt"
+    "strconv"
+    "strings"
+    "github.com/telkomdit/goframework/is"
+)
+
+type (
+    // Satu constraint yang tidak terpenuhi untuk satu field. Rule adalah nama
+    // constraint (required, minl, maxl, type dst) sesuai key template pesan
+    ValidationError struct {
+        Field       string  `json:"field"`
+        Rule        string  `json:"rule"`
+        Expected    string  `json:"expected"`
+        Received    string  `json:"received"`
+        Message     string  `json:"message"`
+    }
+
+    // Implementasi error agar controller tetap bisa memperlakukan hasil validasi
+    // sama seperti sebelumnya (format text dipisah \r\n)
+    ValidationErrors []ValidationError
+
+    // ** private **
+    // satu segment path nested json, ex: items[] -> {items, true}
+    pathSegment struct {
+        name    string
+        each    bool
+    }
+
+    // ** private **
+    // hasil resolve path: path konkrit (ex: items[0].qty) dan value json
+    pathNode struct {
+        path    string
+        value   interface{}
+    }
+
+    // ** private **
+    // penanda value tidak ditemukan atau bukan array padahal path mensyaratkan []
+    pathMissing struct {}
+    pathNotArray struct {}
+)
+
+const (
+    // Bahasa default jika client tidak mengirim preferensi apapun, bisa diganti
+    // melalui st_configs (SYST) dengan key LANG
+    LanguageDefault = "en"
+)
+
+var (
+    // ** private **
+    // Template pesan per bahasa. Placeholder yang tersedia: {field}, {expected},
+    // {received}, {length} (panjang received) dan {error} (khusus rule int dan coerce).
+    // Template en sama persis dengan text validasi lama
+    //
+    // Template bisa ditambah/replace oleh modules melalui ExportMessages
+    messages = map[string]SMap{
+        "en": SMap{
+            "required": "expected ({field}) is not null",
+            "empty":    "expected ({field}) is not empty",
+            "minl":     "expected ({field}) min-length {expected}. received {received} ({length})",
+            "maxl":     "expected ({field}) max-length {expected}. received {received} ({length})",
+            "type":     "expected ({field}) type of {expected}. received {received}",
+            "enum":     "expected ({field}) enum of {expected}. received {received}",
+            "int":      "expected ({field}) as int, strconv.Atoi({received}) error: {error}",
+            "minv":     "expected ({field}) min {expected}. received {received}",
+            "maxv":     "expected ({field}) max {expected}. received {received}",
+            "coerce":   "coerce error: {error}",
+            "format":   "expected ({field}) format {expected}. received {received}",
+            "minc":     "expected ({field}) min-items {expected}. received {received}",
+            "maxc":     "expected ({field}) max-items {expected}. received {received}",
+        },
+        "id": SMap{
+            "required": "({field}) wajib diisi",
+            "empty":    "({field}) tidak boleh kosong",
+            "minl":     "panjang ({field}) minimal {expected}. diterima {received} ({length})",
+            "maxl":     "panjang ({field}) maksimal {expected}. diterima {received} ({length})",
+            "type":     "({field}) harus bertipe {expected}. diterima {received}",
+            "enum":     "({field}) harus salah satu dari {expected}. diterima {received}",
+            "int":      "({field}) harus berupa bilangan bulat. diterima {received}",
+            "minv":     "({field}) minimal {expected}. diterima {received}",
+            "maxv":     "({field}) maksimal {expected}. diterima {received}",
+            "coerce":   "({field}) gagal dikonversi: {error}",
+            "format":   "({field}) harus berformat {expected}. diterima {received}",
+            "minc":     "jumlah item ({field}) minimal {expected}. diterima {received}",
+            "maxc":     "jumlah item ({field}) maksimal {expected}. diterima {received}",
+        },
+    }
+
+    // ** private **
+    // Validasi format (kolom st_handler_arguments.FORMAT)
+    formats = map[string]func(string) bool{
+        "EMAIL":        is.Email,
+        "URL":          is.URL,
+        "ALNUM":        is.Alnum,
+        "ALPHA":        is.Alpha,
+        "ALPHADASH":    is.AlphaDash,
+        "ALPHASPACE":   is.AlphaSpace,
+        "DIGIT":        is.Digit,
+        "NUMERIC":      is.Numeric,
+        "FLOAT":        is.Float,
+        "DATE":         is.Date,
+        "LATITUDE":     is.Latitude,
+        "LONGITUDE":    is.Longitude,
+        "MAC":          is.MacAddress,
+    }
+)
+
+// Tambah bahasa baru atau replace sebagian template bahasa yang sudah ada
+//
+// contoh:
+//
+//      func init() {
+//          ExportMessages("id", SMap{"required": "({field}) harus diisi"})
+//      }
+func ExportMessages(lang string, m SMap) {
+    lang = strings.ToLower(lang)
+    if _, v := messages[lang]; !v {
+        messages[lang] = make(SMap)
+    }
+    for k, v := range m {
+        messages[lang][k] = v
+    }
+}
+
+// Format text lama (sebelum error per field), pesan dipisah \r\n
+func (self ValidationErrors) Error() string {
+    z := make([]string, len(self))
+    for i, j := range self {
+        z[i] = j.Message
+    }
+    return strings.Join(z, "\r\n")
+}
+
+// Bentuk ValidationError dengan pesan sesuai template bahasa. Jika template tidak
+// ditemukan pada bahasa yang diminta, template bahasa default yang digunakan
+func (self *ValidationErrors) add(lang, field, rule, expected, received string, err ...string) {
+    t, v := messages[lang][rule]
+    if !v {
+        t = messages[LanguageDefault][rule]
+    }
+    e := ""
+    if len(err) > 0 {
+        e = err[0]
+    }
+    r := strings.NewReplacer("{field}", field, "{expected}", expected, "{received}", received, "{length}", strconv.Itoa(len(received)), "{error}", e)
+    *self = append(*self, ValidationError{Field: field, Rule: rule, Expected: expected, Received: received, Message: r.Replace(t)})
+}
+
+// Bahasa yang digunakan untuk pesan validasi. Urutan prioritas:
+//   1. session attribute LANG (preferensi user yang sudah login)
+//   2. http header Accept-Language, diambil yang pertama kali tersedia templatenya
+//   3. config LANG, atau LanguageDefault
+func (self *Context) Language() string {
+    if v, b := self.SessionUser("LANG"); b {
+        if _, b := messages[strings.ToLower(v)]; b {
+            return strings.ToLower(v)
+        }
+    }
+    if self.Request != nil {
+        for _, j := range strings.Split(self.Request.Header.Get("Accept-Language"), ",") {
+            tag := strings.TrimSpace(j)
+            if i := strings.IndexAny(tag, ";-_"); i > 0 { // id-ID;q=0.9 -> id
+                tag = tag[:i]
+            }
+            tag = strings.ToLower(tag)
+            if _, b := messages[tag]; b {
+                return tag
+            }
+        }
+    }
+    if v, b := Cache.String("LANG"); b {
+        if _, b := messages[strings.ToLower(v)]; b {
+            return strings.ToLower(v)
+        }
+    }
+    return LanguageDefault
+}
+
+// Nama argument berupa path nested json (mengandung . atau [])
+func isPath(n string) bool {
+    return strings.ContainsAny(n, ".[")
+}
+
+// items[].qty -> [{items, true}, {qty, false}]
+func splitPath(n string) []pathSegment {
+    p := strings.Split(n, ".")
+    r := make([]pathSegment, len(p))
+    for i, j := range p {
+        r[i].name = j
+        if strings.HasSuffix(j, "[]") {
+            r[i].name = j[:len(j)-2]
+            r[i].each = true
+        }
+    }
+    return r
+}
+
+// Traverse json sesuai path. Segment dengan [] akan menghasilkan satu node untuk
+// setiap item array, sehingga error bisa ditunjukkan per item (items[2].qty)
+func resolvePath(root interface{}, segs []pathSegment) []pathNode {
+    if len(segs) == 0 {
+        return nil
+    }
+    nodes := []pathNode{pathNode{path: segs[0].name, value: root}}
+    for i, s := range segs {
+        next := make([]pathNode, 0, len(nodes))
+        for _, o := range nodes {
+            p, v := o.path, o.value
+            if i > 0 {
+                p = p + "." + s.name
+                if m, b := v.(map[string]interface{}); b {
+                    if v, b = m[s.name]; !b {
+                        v = pathMissing{}
+                    }
+                } else {
+                    v = pathMissing{}   // parent tidak ada (atau bukan object)
+                }
+            }
+            if s.each {
+                if a, b := v.([]interface{}); b {
+                    for k, u := range a {
+                        next = append(next, pathNode{path: p + "[" + strconv.Itoa(k) + "]", value: u})
+                    }
+                    continue
+                }
+                if _, b := v.(pathMissing); !b {
+                    v = pathNotArray{}
+                }
+            }
+            next = append(next, pathNode{path: p, value: v})
+        }
+        nodes = next
+    }
+    return nodes
+}
+
+// Validasi argument nested json. Parameter root (payload json yang oleh NewContext
+// disimpan sebagai string) di-decode sekali per request dan disimpan di tree
+//
+// Coerce tidak berlaku untuk nested path karena hasilnya tidak bisa ditulis ulang
+// ke Context tanpa marshal ulang seluruh payload
+func (self *controller) nested(ctx *Context, z *ValidationErrors, lang string, tree map[string]interface{}, n string, r Argument) {
+    segs := splitPath(n)
+    root := segs[0].name
+    v, b := tree[root]
+    if !b {
+        v = pathMissing{}
+        if ctx.Exists(root) {
+            d := json.NewDecoder(strings.NewReader(ctx.Get(root)))
+            d.UseNumber()   // hindari float64 agar angka besar tetap utuh
+            var j interface{}
+            if e := d.Decode(&j); e == nil {
+                v = j
+            } else {
+                v = ctx.Get(root)   // bukan json, perlakukan sebagai string biasa
+            }
+        }
+        tree[root] = v
+    }
+    r.Coerce = ""
+    for _, o := range resolvePath(v, segs) {
+        switch u := o.value.(type) {
+        case pathMissing:
+            if r.Required {
+                z.add(lang, o.path, "required", "not null", "")
+            }
+        case pathNotArray:
+            z.add(lang, o.path, "type", "ARRAY", "")
+        case []interface{}:
+            l := len(u)
+            if r.Required && l == 0 {
+                z.add(lang, o.path, "empty", "not empty", "")
+            }
+            if r.Minc > 0 && l < r.Minc {
+                z.add(lang, o.path, "minc", strconv.Itoa(r.Minc), strconv.Itoa(l))
+            }
+            if r.Maxc > 0 && l > r.Maxc {
+                z.add(lang, o.path, "maxc", strconv.Itoa(r.Maxc), strconv.Itoa(l))
+            }
+        case map[string]interface{}:
+            // object hanya disyaratkan ada, constraint berlaku untuk field didalamnya
+        case nil:
+            self.check(ctx, z, lang, o.path, r, "")
+        default:
+            self.check(ctx, z, lang, o.path, r, fmt.Sprint(u))
+        }
+    }
+}
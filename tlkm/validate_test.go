@@ -0,0 +1,144 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package tlkm
+
+import (
+    "net/http/httptest"
+    "net/url"
+    "testing"
+)
+
+func testContext(lang string, values url.Values) *Context {
+    r := httptest.NewRequest("POST", "http://127.0.0.1/test/api/handler", nil)
+    if lang != "" {
+        r.Header.Set("Accept-Language", lang)
+    }
+    return &Context{Request: r, Response: httptest.NewRecorder(), Values: values, sesMap: GMap{}}
+}
+
+func TestValidationErrors(t *testing.T) {
+    c := &controller{Logger: &Logger{logNs: "HTTP", logLv: ERROR}}
+    args := map[string]Argument{
+        "NAMA": Argument{Required: true, Minl: 3, Maxl: -1, Minv: -1, Maxv: -1},
+        "UMUR": Argument{Minl: -1, Maxl: -1, Minv: 17, Maxv: 60},
+        "KODE": Argument{Required: true, Minl: -1, Maxl: -1, Minv: -1, Maxv: -1},
+    }
+    ctx := testContext("id-ID,id;q=0.9,en;q=0.8", url.Values{"NAMA": {"ab"}, "UMUR": {"10"}})
+    e := c.validate(args, ctx, false, "")
+    z, v := e.(ValidationErrors)
+    if !v || len(z) != 3 {
+        t.Fatalf("expected 3 ValidationErrors, received %#v", e)
+    }
+    rules := make(SMap)
+    for _, j := range z {
+        rules[j.Field] = j.Rule
+        t.Log(j.Message)
+    }
+    if rules["NAMA"] != "minl" || rules["UMUR"] != "minv" || rules["KODE"] != "required" {
+        t.Errorf("unexpected rules %v", rules)
+    }
+}
+
+// Template en harus menghasilkan text validasi lama
+func TestValidationLegacyText(t *testing.T) {
+    c := &controller{Logger: &Logger{logNs: "HTTP", logLv: ERROR}}
+    data := []struct {
+        r Argument
+        v string
+        m string
+    }{
+        {Argument{Minl: 3, Maxl: -1, Minv: -1, Maxv: -1}, "ab", "expected (F) min-length 3. received ab (2)"},
+        {Argument{Minl: -1, Maxl: 2, Minv: -1, Maxv: -1}, "abc", "expected (F) max-length 2. received abc (3)"},
+        {Argument{Minl: -1, Maxl: -1, Minv: -1, Maxv: 9}, "x", `expected (F) as int, strconv.Atoi(x) error: strconv.Atoi: parsing "x": invalid syntax`},
+    }
+    for _, j := range data {
+        e := c.validate(map[string]Argument{"F": j.r}, testContext("en", url.Values{"F": {j.v}}), false, "")
+        if e == nil || e.Error() != j.m {
+            t.Errorf("expected %q, received %v", j.m, e)
+        }
+    }
+}
+
+// MAXV dibandingkan dengan nilai, bukan panjang data
+func TestValidationMaxValue(t *testing.T) {
+    c := &controller{Logger: &Logger{logNs: "HTTP", logLv: ERROR}}
+    args := map[string]Argument{"UMUR": Argument{Minl: -1, Maxl: -1, Minv: -1, Maxv: 60}}
+    for v, j := range map[string]bool{"70": true, "60": false, "5": false, "100": true} {
+        e := c.validate(args, testContext("", url.Values{"UMUR": {v}}), false, "")
+        z, _ := e.(ValidationErrors)
+        if j != (len(z) == 1 && z[0].Rule == "maxv") {
+            t.Errorf("UMUR=%s: unexpected result %v", v, e)
+        }
+    }
+}
+
+func TestValidationLanguage(t *testing.T) {
+    z := make(ValidationErrors, 0)
+    z.add("id", "NAMA", "required", "not null", "")
+    z.add("xx", "NAMA", "required", "not null", "")
+    if z[0].Message != "(NAMA) wajib diisi" {
+        t.Errorf("unexpected message %s", z[0].Message)
+    }
+    if z[1].Message != "expected (NAMA) is not null" {
+        t.Errorf("unexpected fallback message %s", z[1].Message)
+    }
+    if z.Error() != z[0].Message + "\r\n" + z[1].Message {
+        t.Errorf("unexpected text format %q", z.Error())
+    }
+    if l := testContext("fr-FR, en;q=0.5", nil).Language(); l != "en" {
+        t.Errorf("expected en, received %s", l)
+    }
+    ctx := testContext("en", nil)
+    ctx.sesMap["LANG"] = "ID"
+    if l := ctx.Language(); l != "id" {
+        t.Errorf("expected session language id, received %s", l)
+    }
+}
+
+func TestValidationNested(t *testing.T) {
+    c := &controller{Logger: &Logger{logNs: "HTTP", logLv: ERROR}}
+    args := map[string]Argument{
+        "items": Argument{Required: true, Minl: -1, Maxl: -1, Minv: -1, Maxv: -1, Minc: 1, Maxc: 3},
+        "items[].qty": Argument{Required: true, Minl: -1, Maxl: -1, Minv: 1, Maxv: -1},
+        "customer.email": Argument{Required: true, Minl: -1, Maxl: -1, Minv: -1, Maxv: -1, Format: "EMAIL"},
+        "customer.phone": Argument{Minl: -1, Maxl: -1, Minv: -1, Maxv: -1},
+    }
+    ctx := testContext("", url.Values{
+        "items": {`[{"qty": 2}, {"qty": 0}, {"sku": "A"}]`},
+        "customer": {`{"email": "bukan-email"}`},
+    })
+    e := c.validate(args, ctx, false, "")
+    z, _ := e.(ValidationErrors)
+    rules := make(SMap)
+    for _, j := range z {
+        rules[j.Field] = j.Rule
+    }
+    expected := SMap{"items[1].qty": "minv", "items[2].qty": "required", "customer.email": "format"}
+    if len(rules) != len(expected) {
+        t.Fatalf("expected %v, received %v", expected, rules)
+    }
+    for i, j := range expected {
+        if rules[i] != j {
+            t.Errorf("%s: expected %s, received %s", i, j, rules[i])
+        }
+    }
+    ctx = testContext("", url.Values{"items": {`[]`}, "customer": {`"x"`}})
+    z, _ = c.validate(args, ctx, false, "").(ValidationErrors)
+    for _, j := range z {
+        t.Log(j.Field, j.Rule)
+    }
+    if len(z) != 3 { // items (empty + minc), customer.email (required)
+        t.Errorf("expected 3 errors, received %d", len(z))
+    }
+}
@@ -21,6 +21,7 @@ import (
     "io/ioutil"
 )
 
+// Checksum, bukan untuk hashing password (lihat tlkm.HashPassword)
 func MD5(v string) string {
     m := md5.New()
     m.Write([]byte(v))